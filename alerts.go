@@ -2,9 +2,15 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/fatih/color"
@@ -15,19 +21,43 @@ import (
 
 var commandAlerts = cli.Command{
 	Name:  "alerts",
-	Usage: "Retrieve/Close alerts",
+	Usage: "Retrieve/Close/Update alerts",
 	Description: `
     Retrieve/Close alerts. With no subcommand specified, this will show all alerts.
     Requests APIs under "/api/v0/alerts". See https://mackerel.io/api-docs/entry/alerts .
 `,
 	Action: doAlertsRetrieve,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "field", Value: "", Usage: "Print only values at the dotted <path> line by line (e.g. '.[].id')"},
+	},
 	Subcommands: []cli.Command{
 		{
 			Name:      "list",
 			Usage:     "list alerts",
-			ArgsUsage: "[--service | -s <service>] [--host-status | -S <file>] [--color | -c]",
+			ArgsUsage: "[--service | -s <service>] [--host-status | -S <file>] [--sort <key> [--reverse]] [--limit <N>] [--color | -c] [--format | -f <format>] [--template <template>] [--field <path>] [--out <path>] [--exit-code-by-severity] [--include-closed [--from <time>] [--to <time>]]",
 			Description: `
     Shows alerts in human-readable format.
+    Alerts are sorted by openedAt (newest first), status (CRITICAL first) or type (alphabetical) with --sort,
+    and only the first <N> alerts are shown with --limit. Sorting and limiting are applied after filtering.
+    With --format tsv, each alert is output as a tab-separated line of
+    id, status, type, monitorName, hostId, openedAt and value. --format json outputs the same fields,
+    and --format jsonl outputs them as a line of JSON per alert as soon as each page of alerts is fetched,
+    in the fetched order (newest first, and closed ones after open ones) without --sort and --reverse.
+    --format markdown outputs them as a Markdown table.
+    With --field <path>, only values at the dotted <path> of the --format json output are printed line by line
+    (e.g. '.[].id'). --format defaults to json with --field, and the other formats and --template can't be used.
+    Times are formatted in RFC3339 in these formats.
+    With --template, each alert is rendered by the Go template <template> with .Alert, .Host and .Monitor,
+    where "join" and "default" functions are available (e.g. '{{.Alert.ID}} {{.Alert.Status}} {{.Alert.HostID | default "-"}}').
+    With --out <path>, alerts are written to the file without colors.
+    With --exit-code-by-severity, mkr exits with code 2 if any CRITICAL alert is open, 1 if WARNING alerts are open
+    but no CRITICAL one, and 0 otherwise. The code reflects alerts after filtering regardless of --limit,
+    and UNKNOWN alerts don't affect it.
+    With --include-closed, alerts opened between <from> and <to> and already closed are listed too,
+    with the status OK and the time they were closed (closedAt in json and jsonl, and the last column in tsv and
+    the CLOSED AT column in markdown, which are empty for open alerts).
+    <from> and <to> are durations before now (e.g. '24h') or absolute times (RFC3339 or YYYY-MM-DD),
+    and they default to a week ago and now.
 `,
 			Action: doAlertsList,
 			Flags: []cli.Flag{
@@ -41,22 +71,73 @@ var commandAlerts = cli.Command{
 					Value: &cli.StringSlice{},
 					Usage: "Filters alerts by status of each host. Multiple choices are allowed.",
 				},
+				cli.StringFlag{Name: "sort", Value: "openedAt", Usage: "Sort alerts by <key> ('openedAt', 'status' or 'type')"},
+				cli.BoolFlag{Name: "reverse", Usage: "Reverse the sort order"},
+				cli.IntFlag{Name: "limit", Value: 0, Usage: "Show only the first <N> alerts. 0 means no limit"},
 				cli.BoolTFlag{Name: "color, c", Usage: "Colorize output. default: true"},
+				outFlag,
+				cli.StringFlag{Name: "template", Value: "", Usage: "Render each alert by the Go template <template>"},
+				cli.StringFlag{Name: "field", Value: "", Usage: "Print only values at the dotted <path> of the json output line by line (e.g. '.[].id')"},
+				cli.StringFlag{Name: "format, f", Value: "table", Usage: "Output format ('table', 'tsv', 'json', 'jsonl' or 'markdown')"},
+				cli.BoolFlag{Name: "exit-code-by-severity", Usage: "Exit with code 2 if CRITICAL alerts are open, 1 if WARNING ones are, and 0 otherwise"},
+				cli.BoolFlag{Name: "include-closed", Usage: "List closed alerts opened between --from and --to too"},
+				cli.StringFlag{Name: "from", Value: "168h", Usage: "List closed alerts opened at or after <time> with --include-closed"},
+				cli.StringFlag{Name: "to", Value: "", Usage: "List closed alerts opened before <time> with --include-closed. The default is now"},
 			},
 		},
 		{
 			Name:      "close",
 			Usage:     "close alerts",
-			ArgsUsage: "<alertIds....>",
+			ArgsUsage: "[--reason | -r <reason>] [--message-match <regexp> [--status <status>] [--type <type>] [--dry-run]] <alertIds....>",
 			Description: `
     Closes alerts. Multiple alert IDs can be specified.
+    With --message-match, closes all open alerts whose message or monitor name matches <regexp>
+    instead of the specified IDs. --status and --type narrow down the alerts further.
 `,
 			Action: doAlertsClose,
 			Flags: []cli.Flag{
 				cli.StringFlag{Name: "reason, r", Value: "", Usage: "Reason of closing alert."},
+				cli.StringFlag{Name: "message-match", Value: "", Usage: "Close open alerts whose message or monitor name matches <regexp>."},
+				cli.StringSliceFlag{
+					Name:  "status",
+					Value: &cli.StringSlice{},
+					Usage: "Close only alerts of <status> with --message-match. Multiple choices are allowed.",
+				},
+				cli.StringSliceFlag{
+					Name:  "type",
+					Value: &cli.StringSlice{},
+					Usage: "Close only alerts of monitor <type> with --message-match. Multiple choices are allowed.",
+				},
+				cli.BoolFlag{Name: "dry-run, d", Usage: "Show which alerts are closed, but not close."},
 				cli.BoolFlag{Name: "verbose, v", Usage: "Verbose output mode"},
 			},
 		},
+		commandAlertsUpdate,
+		commandAlertsStats,
+		{
+			Name:      "watch",
+			Usage:     "watch alerts",
+			ArgsUsage: "[--interval | -i <duration>] [--status <status>] [--type <type>] [--color | -c]",
+			Description: `
+    Polls open alerts every <duration> until interrupted, and prints alerts opened and closed since the previous poll
+    line by line, prefixed by '+' and '-' respectively. Open alerts at the start are printed as opened.
+`,
+			Action: doAlertsWatch,
+			Flags: []cli.Flag{
+				cli.DurationFlag{Name: "interval, i", Value: 30 * time.Second, Usage: "Polling interval."},
+				cli.StringSliceFlag{
+					Name:  "status",
+					Value: &cli.StringSlice{},
+					Usage: "Watch only alerts of <status>. Multiple choices are allowed.",
+				},
+				cli.StringSliceFlag{
+					Name:  "type",
+					Value: &cli.StringSlice{},
+					Usage: "Watch only alerts of monitor <type>. Multiple choices are allowed.",
+				},
+				cli.BoolTFlag{Name: "color, c", Usage: "Colorize output. default: true"},
+			},
+		},
 	},
 }
 
@@ -67,10 +148,24 @@ type alertSet struct {
 }
 
 func joinMonitorsAndHosts(client *mkr.Client, alerts []*mkr.Alert) []*alertSet {
+	joiner, err := newAlertJoiner(client)
+	logger.DieIf(err)
+	return joiner.join(alerts)
+}
+
+// alertJoiner joins alerts with their hosts and monitors fetched at once, to join alerts fetched page by page
+type alertJoiner struct {
+	hosts    map[string]*mkr.Host
+	monitors map[string]mkr.Monitor
+}
+
+func newAlertJoiner(client *mkr.Client) (*alertJoiner, error) {
 	hostsJSON, err := client.FindHosts(&mkr.FindHostsParam{
 		Statuses: []string{"working", "standby", "poweroff", "maintenance"},
 	})
-	logger.DieIf(err)
+	if err != nil {
+		return nil, err
+	}
 
 	hosts := map[string]*mkr.Host{}
 	for _, host := range hostsJSON {
@@ -78,18 +173,23 @@ func joinMonitorsAndHosts(client *mkr.Client, alerts []*mkr.Alert) []*alertSet {
 	}
 
 	monitorsJSON, err := client.FindMonitors()
-	logger.DieIf(err)
+	if err != nil {
+		return nil, err
+	}
 
 	monitors := map[string]mkr.Monitor{}
 	for _, monitor := range monitorsJSON {
 		monitors[monitor.MonitorID()] = monitor
 	}
+	return &alertJoiner{hosts: hosts, monitors: monitors}, nil
+}
 
+func (j *alertJoiner) join(alerts []*mkr.Alert) []*alertSet {
 	alertSets := []*alertSet{}
 	for _, alert := range alerts {
 		alertSets = append(
 			alertSets,
-			&alertSet{Alert: alert, Host: hosts[alert.HostID], Monitor: monitors[alert.MonitorID]},
+			&alertSet{Alert: alert, Host: j.hosts[alert.HostID], Monitor: j.monitors[alert.MonitorID]},
 		)
 	}
 	return alertSets
@@ -201,7 +301,7 @@ func formatJoinedAlert(alertSet *alertSet, colorize bool) string {
 			statusMsg = "UNKNOWN "
 		}
 	}
-	return fmt.Sprintf("%s %s %s %s%s", alert.ID, time.Unix(alert.OpenedAt, 0).Format(layout), statusMsg, monitorMsg, hostMsg)
+	return fmt.Sprintf("%s %s %s %s%s", alert.ID, outputTimeFormat.human(time.Unix(alert.OpenedAt, 0), layout), statusMsg, monitorMsg, hostMsg)
 }
 
 var expressionNewlinePattern = regexp.MustCompile(`\s*[\r\n]+\s*`)
@@ -216,20 +316,114 @@ func doAlertsRetrieve(c *cli.Context) error {
 
 	alerts, err := client.FindAlerts()
 	logger.DieIf(err)
-	PrettyPrintJSON(alerts)
+	logger.DieIf(PrettyPrintJSONOrField(alerts, c.String("field")))
 	return nil
 }
 
 func doAlertsList(c *cli.Context) error {
 	filterServices := c.StringSlice("service")
 	filterStatuses := c.StringSlice("host-status")
+	format := c.String("format")
+	if format != "table" && format != "tsv" && format != "json" && format != "jsonl" && format != "markdown" {
+		return cli.NewExitError(fmt.Sprintf("unknown format: %s", format), 1)
+	}
+	sortKey := c.String("sort")
+	if _, ok := alertSortKeys[sortKey]; !ok {
+		return cli.NewExitError(fmt.Sprintf("unknown sort key: %s", sortKey), 1)
+	}
+	var tmpl *template.Template
+	if s := c.String("template"); s != "" {
+		var err error
+		if tmpl, err = parseItemTemplate(s); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+	field := c.String("field")
+	if field != "" {
+		if (c.IsSet("format") && format != "json") || tmpl != nil {
+			return cli.NewExitError("--field can't be used with formats other than json or --template", 1)
+		}
+		if _, err := parseFieldSelector(field); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		format = "json"
+	}
+	if format == "jsonl" && tmpl == nil && (sortKey != "openedAt" || c.Bool("reverse")) {
+		return cli.NewExitError("--format jsonl outputs alerts in the fetched order, and --sort and --reverse can't be used", 1)
+	}
+	var from, to time.Time
+	if c.Bool("include-closed") {
+		now := time.Now()
+		var err error
+		if from, err = parseTimeOrDuration(c.String("from"), now); err != nil {
+			return cli.NewExitError(fmt.Sprintf("invalid --from: %s", err), 1)
+		}
+		to = now
+		if s := c.String("to"); s != "" {
+			if to, err = parseTimeOrDuration(s, now); err != nil {
+				return cli.NewExitError(fmt.Sprintf("invalid --to: %s", err), 1)
+			}
+		}
+	}
 	client := newMackerelFromContext(c)
 
-	alerts, err := client.FindAlerts()
+	if format == "jsonl" && tmpl == nil {
+		var exitCode int
+		logger.DieIf(writeOutput(c.String("out"), func(w io.Writer) error {
+			var err error
+			exitCode, err = streamAlertsJSONLines(w, client, filterServices, filterStatuses, c.Int("limit"), !c.Bool("exit-code-by-severity"), c.Bool("include-closed"), from, to)
+			return err
+		}))
+		if c.Bool("exit-code-by-severity") && exitCode != 0 {
+			os.Exit(exitCode)
+		}
+		return nil
+	}
+
+	alerts, closedAts, err := findAlertsToList(client, c.Bool("include-closed"), from, to)
 	logger.DieIf(err)
-	joinedAlerts := joinMonitorsAndHosts(client, alerts)
+	filtered := filterAlertSetsByServicesAndHostStatuses(joinMonitorsAndHosts(client, alerts), filterServices, filterStatuses)
+	exitCode := alertsSeverityExitCode(filtered)
+	filtered = limitAlertSets(sortAlertSets(filtered, sortKey, c.Bool("reverse")), c.Int("limit"))
+
+	out := c.String("out")
+	logger.DieIf(writeOutput(out, func(w io.Writer) error {
+		if tmpl != nil {
+			return renderItems(w, tmpl, filtered)
+		}
+		switch format {
+		case "tsv":
+			printAlertsTSV(w, filtered, closedAts)
+		case "json":
+			return fprettyPrintJSONOrField(w, setAlertRecordsClosedAt(buildAlertRecords(filtered), closedAts), field)
+		case "markdown":
+			fprintMarkdownTable(w, alertRecordColumnsWithClosedAt(closedAts), alertRecordRows(filtered, closedAts, true))
+		default:
+			colorize := c.BoolT("color") && isStdoutPath(out)
+			if colorize {
+				w = color.Output
+			}
+			for _, joinAlert := range filtered {
+				line := formatJoinedAlert(joinAlert, colorize)
+				if closedAt, ok := closedAts[joinAlert.Alert.ID]; ok {
+					line += fmt.Sprintf(" (closed at %s)", outputTimeFormat.human(time.Unix(closedAt, 0), "2006-01-02 15:04:05"))
+				}
+				fmt.Fprintln(w, line)
+			}
+		}
+		return nil
+	}))
+	if c.Bool("exit-code-by-severity") && exitCode != 0 {
+		os.Exit(exitCode)
+	}
+	return nil
+}
 
-	for _, joinAlert := range joinedAlerts {
+// filterAlertSetsByServicesAndHostStatuses keeps alerts of any of the services and of hosts in any of the statuses.
+// Empty services or statuses match any alert.
+func filterAlertSetsByServicesAndHostStatuses(alertSets []*alertSet, filterServices, filterStatuses []string) []*alertSet {
+	var filtered []*alertSet
+	for _, joinAlert := range alertSets {
 		if len(filterServices) > 0 {
 			found := false
 			for _, filterService := range filterServices {
@@ -262,23 +456,307 @@ func doAlertsList(c *cli.Context) error {
 				continue
 			}
 		}
-		fmt.Fprintln(color.Output, formatJoinedAlert(joinAlert, c.BoolT("color")))
+		filtered = append(filtered, joinAlert)
 	}
-	return nil
+	return filtered
+}
+
+// streamAlertsJSONLines outputs alerts listed by findAlertsToList as JSON Lines in the fetched order (newest first),
+// writing each page as soon as it's fetched not to buffer all alerts. At most limit alerts are output unless it's zero,
+// and no more page is requested after the limit if stopAtLimit. The exit code by severity of all listed alerts is returned.
+func streamAlertsJSONLines(w io.Writer, client *mkr.Client, filterServices, filterStatuses []string, limit int, stopAtLimit, includeClosed bool, from, to time.Time) (int, error) {
+	joiner, err := newAlertJoiner(client)
+	if err != nil {
+		return 0, err
+	}
+	exitCode, count := 0, 0
+	emit := func(alerts []*mkr.Alert, closedAts map[string]int64) (bool, error) {
+		filtered := filterAlertSetsByServicesAndHostStatuses(joiner.join(alerts), filterServices, filterStatuses)
+		if code := alertsSeverityExitCode(filtered); code > exitCode {
+			exitCode = code
+		}
+		for _, record := range setAlertRecordsClosedAt(buildAlertRecords(filtered), closedAts) {
+			if limit > 0 && count >= limit {
+				break
+			}
+			if err := fprintJSONLine(w, record); err != nil {
+				return false, err
+			}
+			count++
+		}
+		return !stopAtLimit || limit <= 0 || count < limit, nil
+	}
+
+	more := true
+	err = forEachAlertsPage(client, false, func(page []*closableAlert) (bool, error) {
+		alerts := make([]*mkr.Alert, len(page))
+		for i, a := range page {
+			alerts[i] = a.Alert
+		}
+		var emitErr error
+		more, emitErr = emit(alerts, nil)
+		return more, emitErr
+	})
+	if err != nil || !more || !includeClosed {
+		return exitCode, err
+	}
+	err = forEachAlertsPageOpenedBetween(client, from, to, func(page []*closableAlert) (bool, error) {
+		var alerts []*mkr.Alert
+		closedAts := map[string]int64{}
+		for _, a := range page {
+			if a.isClosed() {
+				alerts = append(alerts, a.Alert)
+				closedAts[a.Alert.ID] = a.ClosedAt
+			}
+		}
+		return emit(alerts, closedAts)
+	})
+	return exitCode, err
+}
+
+// findAlertsToList returns open alerts, and closed ones opened in [from, to) if includeClosed.
+// The times when the closed alerts were closed are returned by their IDs.
+func findAlertsToList(client *mkr.Client, includeClosed bool, from, to time.Time) ([]*mkr.Alert, map[string]int64, error) {
+	alerts, err := client.FindAlerts()
+	if err != nil || !includeClosed {
+		return alerts, nil, err
+	}
+	closables, err := findClosableAlertsOpenedBetween(client, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	closedAts := map[string]int64{}
+	for _, a := range closables {
+		if a.isClosed() {
+			alerts = append(alerts, a.Alert)
+			closedAts[a.Alert.ID] = a.ClosedAt
+		}
+	}
+	return alerts, closedAts, nil
+}
+
+// alertsSeverityExitCode returns 2 if any alert is CRITICAL, 1 if any alert is WARNING, and 0 otherwise
+func alertsSeverityExitCode(alertSets []*alertSet) int {
+	code := 0
+	for _, alertSet := range alertSets {
+		switch alertSet.Alert.Status {
+		case "CRITICAL":
+			return 2
+		case "WARNING":
+			code = 1
+		}
+	}
+	return code
+}
+
+var alertStatusOrder = map[string]int{"CRITICAL": 0, "WARNING": 1, "UNKNOWN": 2, "OK": 3}
+
+// alertSortKeys are comparators of alerts in the default order of each key
+var alertSortKeys = map[string]func(a, b *mkr.Alert) bool{
+	"openedAt": func(a, b *mkr.Alert) bool { return a.OpenedAt > b.OpenedAt },
+	"status":   func(a, b *mkr.Alert) bool { return alertStatusOrder[a.Status] < alertStatusOrder[b.Status] },
+	"type":     func(a, b *mkr.Alert) bool { return a.Type < b.Type },
+}
+
+// sortAlertSets sorts alerts by the key, breaking ties by openedAt (newest first) and ID to be deterministic
+func sortAlertSets(alertSets []*alertSet, key string, reverse bool) []*alertSet {
+	less := alertSortKeys[key]
+	sorted := append([]*alertSet{}, alertSets...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Alert, sorted[j].Alert
+		if reverse {
+			a, b = b, a
+		}
+		if less(a, b) || less(b, a) {
+			return less(a, b)
+		}
+		if a.OpenedAt != b.OpenedAt {
+			return a.OpenedAt > b.OpenedAt
+		}
+		return a.ID < b.ID
+	})
+	return sorted
+}
+
+func limitAlertSets(alertSets []*alertSet, limit int) []*alertSet {
+	if limit > 0 && len(alertSets) > limit {
+		return alertSets[:limit]
+	}
+	return alertSets
+}
+
+// alertRecord is the flat representation of an alert for machine-readable formats
+type alertRecord struct {
+	ID          string  `json:"id"`
+	Status      string  `json:"status"`
+	Type        string  `json:"type"`
+	MonitorName string  `json:"monitorName"`
+	HostID      string  `json:"hostId"`
+	OpenedAt    string  `json:"openedAt"`
+	ClosedAt    string  `json:"closedAt,omitempty"`
+	Value       float64 `json:"value"`
+}
+
+func buildAlertRecords(alertSets []*alertSet) []*alertRecord {
+	records := make([]*alertRecord, 0, len(alertSets))
+	for _, alertSet := range alertSets {
+		alert := alertSet.Alert
+		monitorName := ""
+		if alertSet.Monitor != nil {
+			monitorName = alertSet.Monitor.MonitorName()
+		}
+		records = append(records, &alertRecord{
+			ID:          alert.ID,
+			Status:      alert.Status,
+			Type:        alert.Type,
+			MonitorName: monitorName,
+			HostID:      alert.HostID,
+			OpenedAt:    outputTimeFormat.machine(time.Unix(alert.OpenedAt, 0).UTC(), time.RFC3339),
+			Value:       alert.Value,
+		})
+	}
+	return records
+}
+
+// alertRecordColumns are the names of the fields of alertRecord in the order of alertRecordRows
+var alertRecordColumns = []string{"ID", "STATUS", "TYPE", "MONITOR NAME", "HOST ID", "OPENED AT", "VALUE"}
+
+// alertRecordColumnsWithClosedAt returns alertRecordColumns with the column of closedAt if closedAts isn't nil
+func alertRecordColumnsWithClosedAt(closedAts map[string]int64) []string {
+	if closedAts == nil {
+		return alertRecordColumns
+	}
+	return append(alertRecordColumns[:len(alertRecordColumns):len(alertRecordColumns)], "CLOSED AT")
+}
+
+// alertRecordRows returns the rows of the records, where times are formatted for humans if human is true
+// and in the machine format (RFC3339 or epoch) otherwise.
+// If closedAts isn't nil, the time each alert was closed is added to the rows, which is empty for open alerts.
+func alertRecordRows(alertSets []*alertSet, closedAts map[string]int64, human bool) [][]string {
+	records := setAlertRecordsClosedAt(buildAlertRecords(alertSets), closedAts)
+	rows := make([][]string, 0, len(records))
+	for i, r := range records {
+		openedAt := r.OpenedAt
+		if human {
+			openedAt = outputTimeFormat.human(time.Unix(alertSets[i].Alert.OpenedAt, 0).UTC(), time.RFC3339)
+		}
+		row := []string{
+			r.ID, r.Status, r.Type, r.MonitorName, r.HostID, openedAt, strconv.FormatFloat(r.Value, 'f', -1, 64),
+		}
+		if closedAts != nil {
+			closedAt := r.ClosedAt
+			if human && closedAt != "" {
+				closedAt = outputTimeFormat.human(time.Unix(closedAts[r.ID], 0).UTC(), time.RFC3339)
+			}
+			row = append(row, closedAt)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// setAlertRecordsClosedAt sets closedAt of the records of closed alerts
+func setAlertRecordsClosedAt(records []*alertRecord, closedAts map[string]int64) []*alertRecord {
+	for _, r := range records {
+		if closedAt, ok := closedAts[r.ID]; ok {
+			r.ClosedAt = outputTimeFormat.machine(time.Unix(closedAt, 0).UTC(), time.RFC3339)
+		}
+	}
+	return records
+}
+
+func printAlertsTSV(w io.Writer, alertSets []*alertSet, closedAts map[string]int64) {
+	for _, row := range alertRecordRows(alertSets, closedAts, false) {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+}
+
+// alertMatcher matches alerts by the message pattern, statuses and types.
+// Each condition is combined with AND, and an empty condition matches any alert.
+type alertMatcher struct {
+	messagePattern *regexp.Regexp
+	statuses       []string
+	types          []string
+}
+
+func (m *alertMatcher) match(alertSet *alertSet) bool {
+	alert := alertSet.Alert
+	if m.messagePattern != nil {
+		monitorName := ""
+		if alertSet.Monitor != nil {
+			monitorName = alertSet.Monitor.MonitorName()
+		}
+		if !m.messagePattern.MatchString(alert.Message) && !m.messagePattern.MatchString(monitorName) {
+			return false
+		}
+	}
+	if len(m.statuses) > 0 && !containsString(m.statuses, alert.Status) {
+		return false
+	}
+	if len(m.types) > 0 && !containsString(m.types, alert.Type) {
+		return false
+	}
+	return true
+}
+
+func filterAlerts(alertSets []*alertSet, matcher *alertMatcher) []*alertSet {
+	var filtered []*alertSet
+	for _, alertSet := range alertSets {
+		if matcher.match(alertSet) {
+			filtered = append(filtered, alertSet)
+		}
+	}
+	return filtered
+}
+
+func containsString(xs []string, x string) bool {
+	for _, s := range xs {
+		if s == x {
+			return true
+		}
+	}
+	return false
 }
 
 func doAlertsClose(c *cli.Context) error {
 	isVerbose := c.Bool("verbose")
+	isDryRun := c.Bool("dry-run")
 	argAlertIDs := c.Args()
 	reason := c.String("reason")
+	messageMatch := c.String("message-match")
 
-	if len(argAlertIDs) < 1 {
-		cli.ShowCommandHelp(c, "alerts")
+	if (len(argAlertIDs) < 1) == (messageMatch == "") {
+		cli.ShowCommandHelp(c, "close")
 		os.Exit(1)
 	}
 
 	client := newMackerelFromContext(c)
-	for _, alertID := range argAlertIDs {
+
+	alertIDs := []string(argAlertIDs)
+	if messageMatch != "" {
+		pattern, err := regexp.Compile(messageMatch)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("invalid --message-match: %s", err), 1)
+		}
+		alerts, err := client.FindAlerts()
+		logger.DieIf(err)
+		matched := filterAlerts(joinMonitorsAndHosts(client, alerts), &alertMatcher{
+			messagePattern: pattern,
+			statuses:       c.StringSlice("status"),
+			types:          c.StringSlice("type"),
+		})
+		alertIDs = nil
+		for _, alertSet := range matched {
+			alertIDs = append(alertIDs, alertSet.Alert.ID)
+		}
+		logger.Log("info", fmt.Sprintf("%d alerts matched.", len(alertIDs)))
+	}
+
+	for _, alertID := range alertIDs {
+		if isDryRun {
+			logger.Log("info", fmt.Sprintf("Alert %s will be closed.", alertID))
+			continue
+		}
 		alert, err := client.CloseAlert(alertID, reason)
 		logger.DieIf(err)
 
@@ -289,3 +767,89 @@ func doAlertsClose(c *cli.Context) error {
 	}
 	return nil
 }
+
+// alertWatcher prints differences of open alerts between polls
+type alertWatcher struct {
+	fetch    func() ([]*alertSet, error)
+	matcher  *alertMatcher
+	colorize bool
+	previous []*alertSet
+}
+
+// poll fetches open alerts, and prints alerts opened and closed since the previous poll
+func (aw *alertWatcher) poll(w io.Writer) error {
+	alertSets, err := aw.fetch()
+	if err != nil {
+		return err
+	}
+	current := filterAlerts(alertSets, aw.matcher)
+
+	currentIDs := map[string]bool{}
+	for _, alertSet := range current {
+		currentIDs[alertSet.Alert.ID] = true
+	}
+	previousIDs := map[string]bool{}
+	for _, alertSet := range aw.previous {
+		previousIDs[alertSet.Alert.ID] = true
+		if !currentIDs[alertSet.Alert.ID] {
+			fmt.Fprintln(w, "- "+formatJoinedAlert(alertSet, aw.colorize))
+		}
+	}
+	for _, alertSet := range current {
+		if !previousIDs[alertSet.Alert.ID] {
+			fmt.Fprintln(w, "+ "+formatJoinedAlert(alertSet, aw.colorize))
+		}
+	}
+	aw.previous = current
+	return nil
+}
+
+// findAlertSets fetches open alerts joined with their hosts and monitors.
+// Unlike joinMonitorsAndHosts, failures to fetch hosts and monitors are returned so that the caller can retry.
+func findAlertSets(client *mkr.Client) ([]*alertSet, error) {
+	alerts, err := client.FindAlerts()
+	if err != nil {
+		return nil, err
+	}
+	joiner, err := newAlertJoiner(client)
+	if err != nil {
+		return nil, err
+	}
+	return joiner.join(alerts), nil
+}
+
+func doAlertsWatch(c *cli.Context) error {
+	interval := c.Duration("interval")
+	if interval <= 0 {
+		return cli.NewExitError(fmt.Sprintf("interval should be positive: %s", interval), 1)
+	}
+	client := newMackerelFromContext(c)
+
+	watcher := &alertWatcher{
+		fetch: func() ([]*alertSet, error) {
+			return findAlertSets(client)
+		},
+		matcher: &alertMatcher{
+			statuses: c.StringSlice("status"),
+			types:    c.StringSlice("type"),
+		},
+		colorize: c.BoolT("color"),
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := watcher.poll(color.Output); err != nil {
+			logger.Log("error", err.Error())
+		}
+		select {
+		case <-ticker.C:
+		case <-sigCh:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandAlertsStats = cli.Command{
+	Name:      "stats",
+	Usage:     "count alerts by monitor and type",
+	ArgsUsage: "[--from <time>] [--to <time>] [--output | -o <format>]",
+	Description: `
+    Count alerts opened between <from> and <to>, including closed ones, by monitor and by type with the total.
+    <from> and <to> are durations before now (e.g. '168h') or absolute times (RFC3339 or YYYY-MM-DD).
+    They default to a week ago and now.
+    Requests "GET /api/v0/alerts?withClosed=true" until reaching <from>, and "GET /api/v0/monitors" for monitor names.
+`,
+	Action: doAlertsStats,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "from", Value: "168h", Usage: "Count alerts opened at or after <time>"},
+		cli.StringFlag{Name: "to", Value: "", Usage: "Count alerts opened before <time>. The default is now"},
+		cli.StringFlag{Name: "output, o", Value: "table", Usage: "Output format ('table' or 'json')"},
+	},
+}
+
+// closableAlert is an alert with the time when it was closed, which mkr.Alert doesn't have
+type closableAlert struct {
+	*mkr.Alert
+	ClosedAt int64 `json:"closedAt,omitempty"`
+}
+
+func (a *closableAlert) isClosed() bool {
+	return a.Alert.Status == "OK" || a.ClosedAt != 0
+}
+
+// findAlertsOpenedBetween returns alerts including closed ones opened in [from, to).
+func findAlertsOpenedBetween(client *mkr.Client, from, to time.Time) ([]*mkr.Alert, error) {
+	closables, err := findClosableAlertsOpenedBetween(client, from, to)
+	if err != nil {
+		return nil, err
+	}
+	alerts := make([]*mkr.Alert, len(closables))
+	for i, a := range closables {
+		alerts[i] = a.Alert
+	}
+	return alerts, nil
+}
+
+// findClosableAlertsOpenedBetween is similar to findAlertsOpenedBetween, but returns closedAt too.
+func findClosableAlertsOpenedBetween(client *mkr.Client, from, to time.Time) ([]*closableAlert, error) {
+	var alerts []*closableAlert
+	err := forEachAlertsPageOpenedBetween(client, from, to, func(page []*closableAlert) (bool, error) {
+		alerts = append(alerts, page...)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// forEachAlertsPageOpenedBetween calls fn with alerts including closed ones opened in [from, to) page by page,
+// until fn returns false. Alerts are returned from the newest, so pages are requested until an alert older than from appears.
+func forEachAlertsPageOpenedBetween(client *mkr.Client, from, to time.Time, fn func(alerts []*closableAlert) (bool, error)) error {
+	return forEachAlertsPage(client, true, func(page []*closableAlert) (bool, error) {
+		var alerts []*closableAlert
+		reached := false
+		for _, alert := range page {
+			openedAt := time.Unix(alert.Alert.OpenedAt, 0)
+			if openedAt.Before(from) {
+				reached = true
+				continue
+			}
+			if openedAt.Before(to) {
+				alerts = append(alerts, alert)
+			}
+		}
+		more, err := fn(alerts)
+		return more && !reached, err
+	})
+}
+
+// forEachAlertsPage requests "GET /api/v0/alerts" page by page, including closed alerts if withClosed,
+// and calls fn with the alerts of each page until fn returns false or no page remains.
+func forEachAlertsPage(client *mkr.Client, withClosed bool, fn func(alerts []*closableAlert) (bool, error)) error {
+	nextID := ""
+	for {
+		query := url.Values{}
+		if withClosed {
+			query.Set("withClosed", "true")
+		}
+		if nextID != "" {
+			query.Set("nextId", nextID)
+		}
+		path := "/api/v0/alerts"
+		if len(query) > 0 {
+			path += "?" + query.Encode()
+		}
+		var data struct {
+			Alerts []*closableAlert `json:"alerts"`
+			NextID string           `json:"nextId"`
+		}
+		if err := requestJSON(client, http.MethodGet, path, nil, &data); err != nil {
+			return err
+		}
+		more, err := fn(data.Alerts)
+		if err != nil || !more || data.NextID == "" {
+			return err
+		}
+		nextID = data.NextID
+	}
+}
+
+type alertMonitorCount struct {
+	MonitorID   string `json:"monitorId"`
+	MonitorName string `json:"monitorName"`
+	Type        string `json:"type"`
+	Count       int    `json:"count"`
+}
+
+type alertTypeCount struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+type alertsStats struct {
+	From      string               `json:"from"`
+	To        string               `json:"to"`
+	ByMonitor []*alertMonitorCount `json:"byMonitor"`
+	ByType    []*alertTypeCount    `json:"byType"`
+	Total     int                  `json:"total"`
+}
+
+// countAlerts counts alerts by monitor and type, sorted by the counts (the most first) and the names.
+// monitorNames maps monitor IDs to names, and the ID is used for deleted monitors.
+func countAlerts(alerts []*mkr.Alert, monitorNames map[string]string) (byMonitor []*alertMonitorCount, byType []*alertTypeCount) {
+	monitors := map[string]*alertMonitorCount{}
+	types := map[string]*alertTypeCount{}
+	for _, alert := range alerts {
+		m, ok := monitors[alert.MonitorID]
+		if !ok {
+			name, ok := monitorNames[alert.MonitorID]
+			if !ok {
+				name = alert.MonitorID
+			}
+			m = &alertMonitorCount{MonitorID: alert.MonitorID, MonitorName: name, Type: alert.Type}
+			monitors[alert.MonitorID] = m
+			byMonitor = append(byMonitor, m)
+		}
+		m.Count++
+		t, ok := types[alert.Type]
+		if !ok {
+			t = &alertTypeCount{Type: alert.Type}
+			types[alert.Type] = t
+			byType = append(byType, t)
+		}
+		t.Count++
+	}
+	sort.Slice(byMonitor, func(i, j int) bool {
+		if byMonitor[i].Count != byMonitor[j].Count {
+			return byMonitor[i].Count > byMonitor[j].Count
+		}
+		return byMonitor[i].MonitorName < byMonitor[j].MonitorName
+	})
+	sort.Slice(byType, func(i, j int) bool {
+		if byType[i].Count != byType[j].Count {
+			return byType[i].Count > byType[j].Count
+		}
+		return byType[i].Type < byType[j].Type
+	})
+	return byMonitor, byType
+}
+
+func printAlertsStats(w io.Writer, stats *alertsStats) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "MONITOR\tTYPE\tCOUNT")
+	for _, m := range stats.ByMonitor {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", m.MonitorName, m.Type, m.Count)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tCOUNT")
+	for _, t := range stats.ByType {
+		fmt.Fprintf(tw, "%s\t%d\n", t.Type, t.Count)
+	}
+	fmt.Fprintf(tw, "total\t%d\n", stats.Total)
+	tw.Flush()
+}
+
+func doAlertsStats(c *cli.Context) error {
+	output := c.String("output")
+	if output != "table" && output != "json" {
+		return cli.NewExitError(fmt.Sprintf("unknown output format: %s", output), 1)
+	}
+	now := time.Now()
+	from, err := parseTimeOrDuration(c.String("from"), now)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("invalid --from: %s", err), 1)
+	}
+	to := now
+	if s := c.String("to"); s != "" {
+		if to, err = parseTimeOrDuration(s, now); err != nil {
+			return cli.NewExitError(fmt.Sprintf("invalid --to: %s", err), 1)
+		}
+	}
+
+	client := newMackerelFromContext(c)
+	alerts, err := findAlertsOpenedBetween(client, from, to)
+	logger.DieIf(err)
+	monitors, err := findRawMonitors(client)
+	logger.DieIf(err)
+	monitorNames := map[string]string{}
+	for _, m := range monitors {
+		monitorNames[m.id()] = m.name()
+	}
+
+	stats := &alertsStats{From: outputTimeFormat.machine(from, time.RFC3339), To: outputTimeFormat.machine(to, time.RFC3339), Total: len(alerts)}
+	stats.ByMonitor, stats.ByType = countAlerts(alerts, monitorNames)
+	if output == "json" {
+		PrettyPrintJSON(stats)
+	} else {
+		printAlertsStats(os.Stdout, stats)
+	}
+	return nil
+}
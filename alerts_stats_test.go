@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAlertsStats(t *testing.T) {
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("withClosed") != "true" {
+			t.Errorf("closed alerts should be requested")
+		}
+		switch req.URL.Query().Get("nextId") {
+		case "":
+			fmt.Fprint(w, `{"alerts":[
+				{"id":"a6","status":"CRITICAL","monitorId":"m1","type":"host","openedAt":1500009000},
+				{"id":"a5","status":"OK","monitorId":"m2","type":"connectivity","openedAt":1500008000},
+				{"id":"a4","status":"OK","monitorId":"m1","type":"host","openedAt":1500007000}
+			],"nextId":"a4"}`)
+		case "a4":
+			fmt.Fprint(w, `{"alerts":[
+				{"id":"a3","status":"OK","monitorId":"m3","type":"host","openedAt":1500006000},
+				{"id":"a2","status":"OK","monitorId":"m1","type":"host","openedAt":1500005000},
+				{"id":"a1","status":"OK","monitorId":"m2","type":"connectivity","openedAt":1400000000}
+			],"nextId":"a1"}`)
+		default:
+			t.Errorf("alerts older than --from should not be requested")
+		}
+	})
+	defer ts.Close()
+
+	// a6 is opened after --to and a1 is opened before --from
+	alerts, err := findAlertsOpenedBetween(client, time.Unix(1500000000, 0), time.Unix(1500009000, 0))
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(alerts) != 4 {
+		t.Fatalf("4 alerts should be found but got %d", len(alerts))
+	}
+
+	stats := &alertsStats{Total: len(alerts)}
+	stats.ByMonitor, stats.ByType = countAlerts(alerts, map[string]string{"m1": "cpu", "m2": "connectivity"})
+	var buf bytes.Buffer
+	printAlertsStats(&buf, stats)
+	want := `MONITOR       TYPE          COUNT
+cpu           host          2
+connectivity  connectivity  1
+m3            host          1
+
+TYPE          COUNT
+host          3
+connectivity  1
+total         4
+`
+	if buf.String() != want {
+		t.Errorf("stats should be:\n%s\nbut got:\n%s", want, buf.String())
+	}
+}
@@ -1,6 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -70,3 +76,323 @@ func TestFormatJoinedAlert(t *testing.T) {
 		}
 	}
 }
+
+func TestFilterAlerts(t *testing.T) {
+	alertSets := []*alertSet{
+		{
+			&mkr.Alert{ID: "2tZhm", Type: "external", Status: "CRITICAL", MonitorID: "5rXR3", Message: "connection refused"},
+			nil,
+			&mkr.MonitorExternalHTTP{ID: "5rXR3", Type: "external", Name: "Example Domain"},
+		},
+		{
+			&mkr.Alert{ID: "2tZhn", Type: "host", Status: "WARNING", HostID: "3XYyG", MonitorID: "5rXR4"},
+			&mkr.Host{ID: "3XYyG", Name: "app.example.com"},
+			&mkr.MonitorHostMetric{ID: "5rXR4", Type: "host", Name: "connection count"},
+		},
+		{
+			&mkr.Alert{ID: "2tZho", Type: "host", Status: "CRITICAL", HostID: "3XYyG", MonitorID: "5rXR5"},
+			&mkr.Host{ID: "3XYyG", Name: "app.example.com"},
+			&mkr.MonitorHostMetric{ID: "5rXR5", Type: "host", Name: "loadavg5"},
+		},
+		{
+			&mkr.Alert{ID: "2tZhp", Type: "check", Status: "CRITICAL", HostID: "3XYyG", Message: "Connection timed out"},
+			&mkr.Host{ID: "3XYyG", Name: "app.example.com"},
+			nil,
+		},
+	}
+
+	testCases := []struct {
+		name    string
+		matcher *alertMatcher
+		want    []string
+	}{
+		{"message or monitor name", &alertMatcher{messagePattern: regexp.MustCompile(`^conn`)}, []string{"2tZhm", "2tZhn"}},
+		{"case insensitive", &alertMatcher{messagePattern: regexp.MustCompile(`(?i)^conn`)}, []string{"2tZhm", "2tZhn", "2tZhp"}},
+		{"with status", &alertMatcher{messagePattern: regexp.MustCompile(`^conn`), statuses: []string{"CRITICAL"}}, []string{"2tZhm"}},
+		{"with type", &alertMatcher{messagePattern: regexp.MustCompile(`(?i)^conn`), types: []string{"host", "check"}}, []string{"2tZhn", "2tZhp"}},
+	}
+
+	for _, testCase := range testCases {
+		var ids []string
+		for _, alertSet := range filterAlerts(alertSets, testCase.matcher) {
+			ids = append(ids, alertSet.Alert.ID)
+		}
+		if !reflect.DeepEqual(ids, testCase.want) {
+			t.Errorf("%s: alerts to close should be %v but got %v", testCase.name, testCase.want, ids)
+		}
+	}
+}
+
+func TestPrintAlertsTSV(t *testing.T) {
+	alertSets := []*alertSet{
+		{
+			&mkr.Alert{ID: "2tZhm", Type: "host", Status: "CRITICAL", HostID: "3XYyG", MonitorID: "5rXR3", Value: 15.7, OpenedAt: 200},
+			&mkr.Host{ID: "3XYyG", Name: "app.example.com", Status: "working"},
+			&mkr.MonitorHostMetric{ID: "5rXR3", Type: "host", Name: "All::loadavg5", Metric: "loadavg5", Critical: 12.0, Operator: ">"},
+		},
+		{
+			&mkr.Alert{ID: "2tZhn", Type: "external", Status: "WARNING", MonitorID: "5rXR4", Value: 3000, OpenedAt: 1500000000},
+			nil,
+			&mkr.MonitorExternalHTTP{ID: "5rXR4", Type: "external", Name: "example.com"},
+		},
+	}
+
+	var buf bytes.Buffer
+	printAlertsTSV(&buf, alertSets, nil)
+	want := "2tZhm\tCRITICAL\thost\tAll::loadavg5\t3XYyG\t1970-01-01T00:03:20Z\t15.7\n" +
+		"2tZhn\tWARNING\texternal\texample.com\t\t2017-07-14T02:40:00Z\t3000\n"
+	if got := buf.String(); got != want {
+		t.Errorf("tsv output should be:\n%q\nbut got:\n%q", want, got)
+	}
+
+	defer func(f timeFormat) { outputTimeFormat = f }(outputTimeFormat)
+	outputTimeFormat = timeFormatPresets["local"]
+	buf.Reset()
+	printAlertsTSV(&buf, alertSets, nil)
+	if got := buf.String(); got != want {
+		t.Errorf("tsv output should be in RFC3339 regardless of --time-format local:\n%q\nbut got:\n%q", want, got)
+	}
+	if rows := alertRecordRows(alertSets, nil, true); rows[1][5] != time.Unix(1500000000, 0).Local().Format("2006-01-02 15:04:05 MST") {
+		t.Errorf("openedAt in the markdown table should follow --time-format but got %q", rows[1][5])
+	}
+}
+
+func TestPrintAlertsTSV_closedAt(t *testing.T) {
+	alertSets := []*alertSet{
+		{&mkr.Alert{ID: "2tZhm", Type: "connectivity", Status: "CRITICAL", HostID: "3XYyG", OpenedAt: 1500000000}, nil, nil},
+		{&mkr.Alert{ID: "2tZhn", Type: "connectivity", Status: "OK", HostID: "3XYyG", OpenedAt: 1500000000}, nil, nil},
+	}
+	closedAts := map[string]int64{"2tZhn": 1500000600}
+
+	var buf bytes.Buffer
+	printAlertsTSV(&buf, alertSets, closedAts)
+	want := "2tZhm\tCRITICAL\tconnectivity\t\t3XYyG\t2017-07-14T02:40:00Z\t0\t\n" +
+		"2tZhn\tOK\tconnectivity\t\t3XYyG\t2017-07-14T02:40:00Z\t0\t2017-07-14T02:50:00Z\n"
+	if got := buf.String(); got != want {
+		t.Errorf("tsv output should be:\n%q\nbut got:\n%q", want, got)
+	}
+
+	var md bytes.Buffer
+	fprintMarkdownTable(&md, alertRecordColumnsWithClosedAt(closedAts), alertRecordRows(alertSets, closedAts, true))
+	if !strings.Contains(md.String(), "| CLOSED AT |") || !strings.Contains(md.String(), "| 2017-07-14T02:50:00Z |") {
+		t.Errorf("the markdown table should have the CLOSED AT column but got:\n%s", md.String())
+	}
+	if len(alertRecordColumns) != 7 {
+		t.Errorf("alertRecordColumns should not be modified but got %v", alertRecordColumns)
+	}
+}
+
+func TestFindAlertSets(t *testing.T) {
+	monitorsFail := true
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/v0/alerts":
+			fmt.Fprint(w, `{"alerts":[{"id":"a1","status":"CRITICAL","monitorId":"m1","type":"host","hostId":"3XYyG","openedAt":1500000000}]}`)
+		case "/api/v0/hosts":
+			fmt.Fprint(w, `{"hosts":[{"id":"3XYyG","name":"app01"}]}`)
+		case "/api/v0/monitors":
+			if monitorsFail {
+				http.Error(w, `{"error":{"message":"internal server error"}}`, http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, `{"monitors":[{"id":"m1","type":"host","name":"cpu"}]}`)
+		}
+	})
+	defer ts.Close()
+
+	if _, err := findAlertSets(client); err == nil {
+		t.Errorf("the failure to fetch monitors should be returned")
+	}
+	monitorsFail = false
+	alertSets, err := findAlertSets(client)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(alertSets) != 1 || alertSets[0].Host == nil || alertSets[0].Monitor == nil {
+		t.Errorf("the alert should be joined with its host and monitor but got %+v", alertSets)
+	}
+}
+
+func TestAlertWatcherPoll(t *testing.T) {
+	alert1 := &alertSet{
+		&mkr.Alert{ID: "2tZhm", Type: "connectivity", Status: "CRITICAL", HostID: "3XYyG", MonitorID: "5rXR3", OpenedAt: 100},
+		nil,
+		&mkr.MonitorConnectivity{ID: "5rXR3", Type: "connectivity", Name: "connectivity"},
+	}
+	alert2 := &alertSet{
+		&mkr.Alert{ID: "2tZhn", Type: "host", Status: "WARNING", MonitorID: "5rXR4", Value: 9.0, OpenedAt: 200},
+		nil,
+		&mkr.MonitorHostMetric{ID: "5rXR4", Type: "host", Name: "loadavg5", Metric: "loadavg5", Warning: 8.0, Critical: 12.0, Operator: ">"},
+	}
+	polls := [][]*alertSet{{alert1}, {alert1, alert2}, {alert2}}
+
+	watcher := &alertWatcher{
+		fetch: func() ([]*alertSet, error) {
+			alertSets := polls[0]
+			polls = polls[1:]
+			return alertSets, nil
+		},
+		matcher: &alertMatcher{},
+	}
+
+	var buf bytes.Buffer
+	watcher.poll(&buf)
+	buf.Reset()
+
+	watcher.poll(&buf)
+	if want, got := "+ "+formatJoinedAlert(alert2, false)+"\n", buf.String(); got != want {
+		t.Errorf("the opened alert should be printed:\n%q\nbut got:\n%q", want, got)
+	}
+	buf.Reset()
+
+	watcher.poll(&buf)
+	if want, got := "- "+formatJoinedAlert(alert1, false)+"\n", buf.String(); got != want {
+		t.Errorf("the closed alert should be printed:\n%q\nbut got:\n%q", want, got)
+	}
+}
+
+func TestSortAlertSets(t *testing.T) {
+	var alertSets []*alertSet
+	for _, alert := range []*mkr.Alert{
+		{ID: "2tZhm", Status: "WARNING", Type: "host", OpenedAt: 300},
+		{ID: "2tZhn", Status: "CRITICAL", Type: "connectivity", OpenedAt: 100},
+		{ID: "2tZho", Status: "CRITICAL", Type: "host", OpenedAt: 400},
+		{ID: "2tZhp", Status: "UNKNOWN", Type: "expression", OpenedAt: 200},
+	} {
+		alertSets = append(alertSets, &alertSet{Alert: alert})
+	}
+
+	testCases := []struct {
+		key     string
+		reverse bool
+		limit   int
+		want    []string
+	}{
+		{"openedAt", false, 2, []string{"2tZho", "2tZhm"}},
+		{"openedAt", true, 0, []string{"2tZhn", "2tZhp", "2tZhm", "2tZho"}},
+		{"status", false, 3, []string{"2tZho", "2tZhn", "2tZhm"}},
+		{"type", false, 0, []string{"2tZhn", "2tZhp", "2tZho", "2tZhm"}},
+	}
+
+	for _, testCase := range testCases {
+		var got []string
+		for _, alertSet := range limitAlertSets(sortAlertSets(alertSets, testCase.key, testCase.reverse), testCase.limit) {
+			got = append(got, alertSet.Alert.ID)
+		}
+		if !reflect.DeepEqual(got, testCase.want) {
+			t.Errorf("alerts sorted by %s (reverse: %t, limit: %d) should be %v but got %v", testCase.key, testCase.reverse, testCase.limit, testCase.want, got)
+		}
+	}
+}
+
+func TestAlertsSeverityExitCode(t *testing.T) {
+	testCases := []struct {
+		statuses []string
+		want     int
+	}{
+		{[]string{}, 0},
+		{[]string{"UNKNOWN", "OK"}, 0},
+		{[]string{"WARNING", "UNKNOWN"}, 1},
+		{[]string{"WARNING", "CRITICAL", "WARNING"}, 2},
+		{[]string{"CRITICAL"}, 2},
+	}
+
+	for _, testCase := range testCases {
+		var alertSets []*alertSet
+		for i, status := range testCase.statuses {
+			alertSets = append(alertSets, &alertSet{Alert: &mkr.Alert{ID: fmt.Sprintf("2tZh%d", i), Status: status}})
+		}
+		if got := alertsSeverityExitCode(alertSets); got != testCase.want {
+			t.Errorf("the exit code for %v should be %d but got %d", testCase.statuses, testCase.want, got)
+		}
+	}
+}
+
+func TestFindAlertsToList(t *testing.T) {
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("withClosed") != "true" {
+			fmt.Fprint(w, `{"alerts":[{"id":"a3","status":"CRITICAL","monitorId":"m1","type":"host","openedAt":1500003000}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"alerts":[
+			{"id":"a3","status":"CRITICAL","monitorId":"m1","type":"host","openedAt":1500003000},
+			{"id":"a2","status":"OK","monitorId":"m1","type":"host","openedAt":1500002000,"closedAt":1500002500},
+			{"id":"a1","status":"OK","monitorId":"m2","type":"connectivity","openedAt":1400000000,"closedAt":1400000500}
+		]}`)
+	})
+	defer ts.Close()
+
+	alerts, closedAts, err := findAlertsToList(client, false, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].ID != "a3" || len(closedAts) != 0 {
+		t.Errorf("only open alerts should be listed without includeClosed but got %+v", alerts)
+	}
+
+	alerts, closedAts, err = findAlertsToList(client, true, time.Unix(1500000000, 0), time.Unix(1500009000, 0))
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(alerts) != 2 || alerts[0].ID != "a3" || alerts[1].ID != "a2" {
+		t.Fatalf("open alerts and closed ones opened in the range should be listed but got %+v", alerts)
+	}
+	if closedAts["a2"] != 1500002500 || len(closedAts) != 1 {
+		t.Errorf("closedAt of a2 should be 1500002500 but got %v", closedAts)
+	}
+}
+
+func TestStreamAlertsJSONLines(t *testing.T) {
+	var out bytes.Buffer
+	var linesBeforeLastPage int
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/v0/hosts":
+			fmt.Fprint(w, `{"hosts":[]}`)
+		case "/api/v0/monitors":
+			fmt.Fprint(w, `{"monitors":[{"id":"m1","type":"host","name":"cpu"}]}`)
+		default:
+			if req.URL.Query().Get("withClosed") == "true" {
+				fmt.Fprint(w, `{"alerts":[
+					{"id":"a3","status":"CRITICAL","monitorId":"m1","type":"host","openedAt":1500003000},
+					{"id":"a2","status":"OK","monitorId":"m1","type":"host","openedAt":1500002000,"closedAt":1500002500}
+				]}`)
+				return
+			}
+			if req.URL.Query().Get("nextId") == "" {
+				fmt.Fprint(w, `{"alerts":[{"id":"a5","status":"WARNING","monitorId":"m1","type":"host","openedAt":1500005000}],"nextId":"a4"}`)
+				return
+			}
+			linesBeforeLastPage = bytes.Count(out.Bytes(), []byte("\n"))
+			fmt.Fprint(w, `{"alerts":[{"id":"a3","status":"CRITICAL","monitorId":"m1","type":"host","openedAt":1500003000}]}`)
+		}
+	})
+	defer ts.Close()
+
+	exitCode, err := streamAlertsJSONLines(&out, client, nil, nil, 0, true, true, time.Unix(1500000000, 0), time.Unix(1500009000, 0))
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if linesBeforeLastPage != 1 {
+		t.Errorf("the first page should be output before the next page is fetched but got %d lines", linesBeforeLastPage)
+	}
+	lines := regexp.MustCompile(`"id":"(a\d)"`).FindAllStringSubmatch(out.String(), -1)
+	var ids []string
+	for _, l := range lines {
+		ids = append(ids, l[1])
+	}
+	if want := []string{"a5", "a3", "a2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("open alerts and closed ones should be output in order %v but got %v:\n%s", want, ids, out.String())
+	}
+	if exitCode != 2 {
+		t.Errorf("the exit code should be 2 but got %d", exitCode)
+	}
+
+	out.Reset()
+	if _, err := streamAlertsJSONLines(&out, client, nil, nil, 1, true, false, time.Time{}, time.Time{}); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if n := bytes.Count(out.Bytes(), []byte("\n")); n != 1 {
+		t.Errorf("only an alert should be output with the limit but got %d", n)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandAlertsUpdate = cli.Command{
+	Name:      "update",
+	Usage:     "update memos of alerts",
+	ArgsUsage: "--memo | -m <text> [--reason | -r <reason>] <alertId | ->...",
+	Description: `
+    Update the memo of open alerts to record who is handling them. Multiple alert IDs can be specified.
+    With --reason, "Reason: <reason>" is appended to the memo as another line.
+    With "-", IDs are read from stdin line by line.
+    Requests "PUT /api/v0/alerts/<alertId>".
+`,
+	Action: doAlertsUpdate,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "memo, m", Value: "", Usage: "The memo of alerts."},
+		cli.StringFlag{Name: "reason, r", Value: "", Usage: "The reason appended to the memo."},
+	},
+}
+
+// alertMemo builds the memo from --memo and --reason
+func alertMemo(memo, reason string) string {
+	lines := []string{}
+	if memo != "" {
+		lines = append(lines, memo)
+	}
+	if reason != "" {
+		lines = append(lines, "Reason: "+reason)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// updateAlertMemo updates the memo of the open alert
+func updateAlertMemo(client *mkr.Client, alertID, memo string) error {
+	path := "/api/v0/alerts/" + url.PathEscape(alertID)
+	var alert mkr.Alert
+	if err := requestJSON(client, http.MethodGet, path, nil, &alert); err != nil {
+		if apiErr, ok := err.(*mkr.APIError); ok && apiErr.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("alert %s is not found", alertID)
+		}
+		return err
+	}
+	if alert.Status == "OK" {
+		return fmt.Errorf("alert %s is already closed", alertID)
+	}
+	return requestJSON(client, http.MethodPut, path, map[string]string{"memo": memo}, nil)
+}
+
+func doAlertsUpdate(c *cli.Context) error {
+	memo := alertMemo(c.String("memo"), c.String("reason"))
+	if memo == "" || len(c.Args()) < 1 {
+		cli.ShowCommandHelp(c, "update")
+		os.Exit(1)
+	}
+	alertIDs, err := readIDsFromArgs(c.Args(), os.Stdin, strings.TrimSpace)
+	logger.DieIf(err)
+
+	client := newMackerelFromContext(c)
+	failed := 0
+	for _, alertID := range alertIDs {
+		if logger.ErrorIf(updateAlertMemo(client, alertID, memo)) {
+			failed++
+			continue
+		}
+		logger.Log("updated", alertID)
+	}
+	if failed > 0 {
+		return cli.NewExitError(fmt.Sprintf("failed to update %d alerts", failed), 1)
+	}
+	return nil
+}
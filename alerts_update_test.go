@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestUpdateAlertMemo(t *testing.T) {
+	memos := map[string]string{}
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/v0/alerts/2tZhm":
+			if req.Method == http.MethodPut {
+				var payload map[string]string
+				json.NewDecoder(req.Body).Decode(&payload)
+				memos["2tZhm"] = payload["memo"]
+			}
+			fmt.Fprint(w, `{"id":"2tZhm","status":"CRITICAL","monitorId":"2cSZzK3XfmG","type":"connectivity","hostId":"2u4PP3TJqbu"}`)
+		case "/api/v0/alerts/2tZhn":
+			fmt.Fprint(w, `{"id":"2tZhn","status":"OK","monitorId":"2cSZzK3XfmG","type":"connectivity","hostId":"2u4PP3TJqbu"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"Alert not found"}}`)
+		}
+	})
+	defer ts.Close()
+
+	memo := alertMemo("investigating by alice", "disk full")
+	if err := updateAlertMemo(client, "2tZhm", memo); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if want := "investigating by alice\nReason: disk full"; memos["2tZhm"] != want {
+		t.Errorf("memo should be %q but got %q", want, memos["2tZhm"])
+	}
+
+	if err := updateAlertMemo(client, "2tZhn", memo); err == nil || err.Error() != "alert 2tZhn is already closed" {
+		t.Errorf("should raise error for the closed alert but got %v", err)
+	}
+	if err := updateAlertMemo(client, "2tZho", memo); err == nil || err.Error() != "alert 2tZho is not found" {
+		t.Errorf("should raise error for the nonexistent alert but got %v", err)
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"time"
+
 	mkr "github.com/mackerelio/mackerel-client-go"
 	"github.com/mackerelio/mkr/logger"
 	"gopkg.in/urfave/cli.v1"
@@ -38,15 +41,20 @@ var commandAnnotations = cli.Command{
 		{
 			Name:      "list",
 			Usage:     "list annotations",
-			ArgsUsage: "[--from <from>] [--to <to>] [--service -s <service>]",
+			ArgsUsage: "[--from <from>] [--to <to>] [--after <time>] [--before <time>] [--service -s <service>]",
 			Description: `
     Shows annotations by service name and duration (from and to)
+    With --after and/or --before, shows only annotations which are strictly within the range.
+    They accept RFC3339 (e.g. 2017-11-01T09:00:00+09:00) or date (e.g. 2017-11-01) in local time,
+    and they are used as --from and --to if omitted.
 `,
 			Action: doAnnotationsList,
 			Flags: []cli.Flag{
 				cli.StringFlag{Name: "service, s", Usage: "Service name for annotation"},
 				cli.IntFlag{Name: "from", Usage: "Starting time (epoch seconds)"},
 				cli.IntFlag{Name: "to", Usage: "Ending time (epoch seconds)"},
+				cli.StringFlag{Name: "after", Usage: "Show only annotations starting at or after <time>"},
+				cli.StringFlag{Name: "before", Usage: "Show only annotations ending at or before <time>"},
 			},
 		},
 		{
@@ -83,6 +91,7 @@ var commandAnnotations = cli.Command{
 				cli.StringFlag{Name: "id", Usage: "Graph annotation ID"},
 			},
 		},
+		commandAnnotationsDiff,
 	},
 }
 
@@ -133,6 +142,31 @@ func doAnnotationsList(c *cli.Context) error {
 	from := c.Int64("from")
 	to := c.Int64("to")
 
+	var after, before int64
+	if s := c.String("after"); s != "" {
+		t, err := parseAbsoluteTime(s)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("invalid --after: %s", err), 1)
+		}
+		after = t.Unix()
+		if from == 0 {
+			from = after
+		}
+	}
+	if s := c.String("before"); s != "" {
+		t, err := parseAbsoluteTime(s)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("invalid --before: %s", err), 1)
+		}
+		before = t.Unix()
+		if to == 0 {
+			to = before
+		}
+	}
+	if after != 0 && before != 0 && after > before {
+		return cli.NewExitError("--after should not be later than --before.", 1)
+	}
+
 	if service == "" {
 		_ = cli.ShowCommandHelp(c, "list")
 		return cli.NewExitError("`service` is a required field to list graph annotations.", 1)
@@ -151,10 +185,50 @@ func doAnnotationsList(c *cli.Context) error {
 	client := newMackerelFromContext(c)
 	annotations, err := client.FindGraphAnnotations(service, from, to)
 	logger.DieIf(err)
-	PrettyPrintJSON(annotations)
+	PrettyPrintJSON(filterAnnotationsInRange(annotations, after, before))
 	return nil
 }
 
+// filterAnnotationsInRange returns annotations which start at or after `after`
+// and end at or before `before`. Zero means no bound.
+func filterAnnotationsInRange(annotations []mkr.GraphAnnotation, after, before int64) []mkr.GraphAnnotation {
+	filtered := []mkr.GraphAnnotation{}
+	for _, annotation := range annotations {
+		if after != 0 && annotation.From < after {
+			continue
+		}
+		if before != 0 && annotation.To > before {
+			continue
+		}
+		filtered = append(filtered, annotation)
+	}
+	return filtered
+}
+
+var absoluteTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseAbsoluteTime parses RFC3339 or date string. Local time is used if the time zone is omitted.
+func parseAbsoluteTime(s string) (time.Time, error) {
+	for _, layout := range absoluteTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as RFC3339 or date (YYYY-MM-DD)", s)
+}
+
+// parseTimeOrDuration parses a duration before now (e.g. "24h"), or an absolute time by parseAbsoluteTime
+func parseTimeOrDuration(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := parseAbsoluteTime(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse %q as a duration, RFC3339 or date (YYYY-MM-DD)", s)
+	}
+	return t, nil
+}
+
 func doAnnotationsUpdate(c *cli.Context) error {
 	annotationID := c.String("id")
 	title := c.String("title")
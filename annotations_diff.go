@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandAnnotationsDiff = cli.Command{
+	Name:      "diff",
+	Usage:     "diff expected annotations",
+	ArgsUsage: "--service | -s <service> --file-path | -F <file> [--exit-code | -e] [--apply]",
+	Description: `
+    Show difference between expected graph annotations in <file> and annotations of <service>,
+    within the window from the earliest start to the latest end of the expected annotations.
+    <file> is a JSON file like {"graphAnnotations": [{"title": "...", "description": "...", "from": 1509500000, "to": 1509503600, "roles": [...]}]}.
+    Annotations are matched by their titles and starting times, and shown prefixed by '+' (missing), '-' (extra)
+    or '~' (changed). With --apply, missing annotations are created. Extra and changed ones are left untouched.
+`,
+	Action: doAnnotationsDiff,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "service, s", Usage: "Service name for annotations"},
+		cli.StringFlag{Name: "file-path, F", Value: "", Usage: "Filename of expected annotations"},
+		cli.BoolFlag{Name: "exit-code, e", Usage: "Make mkr exit with code 1 if there are differences and 0 if there aren't. This is similar to diff(1)"},
+		cli.BoolFlag{Name: "apply", Usage: "Create missing annotations"},
+	},
+}
+
+func loadExpectedAnnotations(r io.Reader) ([]mkr.GraphAnnotation, error) {
+	var data struct {
+		GraphAnnotations []mkr.GraphAnnotation `json:"graphAnnotations"`
+	}
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, err
+	}
+	for _, a := range data.GraphAnnotations {
+		if a.Title == "" || a.From == 0 || a.To == 0 {
+			return nil, fmt.Errorf("title, from and to are required for expected annotations")
+		}
+	}
+	return data.GraphAnnotations, nil
+}
+
+// annotationKey is the stable key to match annotations, which doesn't depend on IDs
+func annotationKey(a mkr.GraphAnnotation) string {
+	return a.Title + "\t" + strconv.FormatInt(a.From, 10)
+}
+
+// annotationsWindow returns the range covering all annotations
+func annotationsWindow(annotations []mkr.GraphAnnotation) (from, to int64) {
+	for i, a := range annotations {
+		if i == 0 || a.From < from {
+			from = a.From
+		}
+		if a.To > to {
+			to = a.To
+		}
+	}
+	return from, to
+}
+
+type annotationsDiff struct {
+	missing []mkr.GraphAnnotation
+	extra   []mkr.GraphAnnotation
+	changed []mkr.GraphAnnotation
+}
+
+func (d *annotationsDiff) empty() bool {
+	return len(d.missing) == 0 && len(d.extra) == 0 && len(d.changed) == 0
+}
+
+// diffAnnotations compares annotations by annotationKey. Changed annotations are those of remote.
+func diffAnnotations(expected, remote []mkr.GraphAnnotation) *annotationsDiff {
+	d := &annotationsDiff{}
+	remoteByKey := map[string]mkr.GraphAnnotation{}
+	for _, a := range remote {
+		remoteByKey[annotationKey(a)] = a
+	}
+	expectedKeys := map[string]bool{}
+	for _, e := range expected {
+		key := annotationKey(e)
+		expectedKeys[key] = true
+		r, ok := remoteByKey[key]
+		if !ok {
+			d.missing = append(d.missing, e)
+			continue
+		}
+		if r.Description != e.Description || r.To != e.To || !reflect.DeepEqual(sortedStrings(r.Roles), sortedStrings(e.Roles)) {
+			d.changed = append(d.changed, r)
+		}
+	}
+	for _, r := range remote {
+		if !expectedKeys[annotationKey(r)] {
+			d.extra = append(d.extra, r)
+		}
+	}
+	return d
+}
+
+func sortedStrings(xs []string) []string {
+	sorted := append([]string{}, xs...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func formatAnnotation(a mkr.GraphAnnotation) string {
+	return fmt.Sprintf("%q (%s - %s)", a.Title, outputTimeFormat.human(time.Unix(a.From, 0), time.RFC3339), outputTimeFormat.human(time.Unix(a.To, 0), time.RFC3339))
+}
+
+func printAnnotationsDiff(w io.Writer, d *annotationsDiff) {
+	fmt.Fprintf(w, "Summary: %d missing, %d extra, %d changed\n\n", len(d.missing), len(d.extra), len(d.changed))
+	for _, a := range d.missing {
+		fmt.Fprintln(w, "+ "+formatAnnotation(a))
+	}
+	for _, a := range d.extra {
+		fmt.Fprintln(w, "- "+formatAnnotation(a))
+	}
+	for _, a := range d.changed {
+		fmt.Fprintln(w, "~ "+formatAnnotation(a))
+	}
+}
+
+func doAnnotationsDiff(c *cli.Context) error {
+	service := c.String("service")
+	filePath := c.String("file-path")
+	if service == "" || filePath == "" {
+		_ = cli.ShowCommandHelp(c, "diff")
+		return cli.NewExitError("`service` and `file-path` are required fields to diff graph annotations.", 1)
+	}
+
+	f, err := os.Open(filePath)
+	logger.DieIf(err)
+	expected, err := loadExpectedAnnotations(f)
+	f.Close()
+	logger.DieIf(err)
+	if len(expected) == 0 {
+		return nil
+	}
+
+	client := newMackerelFromContext(c)
+	from, to := annotationsWindow(expected)
+	remote, err := client.FindGraphAnnotations(service, from, to)
+	logger.DieIf(err)
+
+	d := diffAnnotations(expected, remote)
+	printAnnotationsDiff(os.Stdout, d)
+
+	if c.Bool("apply") {
+		for _, a := range d.missing {
+			a.Service = service
+			_, err := client.CreateGraphAnnotation(&a)
+			logger.DieIf(err)
+			logger.Log("created", formatAnnotation(a))
+		}
+		return nil
+	}
+	if c.Bool("exit-code") && !d.empty() {
+		os.Exit(1)
+	}
+	return nil
+}
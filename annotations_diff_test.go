@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestDiffAnnotations(t *testing.T) {
+	expected, err := loadExpectedAnnotations(strings.NewReader(`{"graphAnnotations": [
+		{"title": "maintenance", "description": "weekly", "from": 1509500000, "to": 1509503600, "roles": ["db"]},
+		{"title": "maintenance", "description": "weekly", "from": 1510104800, "to": 1510108400, "roles": ["db"]},
+		{"title": "release", "from": 1509600000, "to": 1509600600}
+	]}`))
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if from, to := annotationsWindow(expected); from != 1509500000 || to != 1510108400 {
+		t.Errorf("the window should be [1509500000, 1510108400] but got [%d, %d]", from, to)
+	}
+
+	remote := []mkr.GraphAnnotation{
+		{ID: "a1", Title: "maintenance", Description: "weekly", From: 1509500000, To: 1509503600, Service: "blog", Roles: []string{"db"}},
+		{ID: "a2", Title: "release", Description: "v1.2.0", From: 1509600000, To: 1509600600, Service: "blog"},
+		{ID: "a3", Title: "incident", From: 1509700000, To: 1509710000, Service: "blog"},
+	}
+	d := diffAnnotations(expected, remote)
+	if len(d.missing) != 1 || d.missing[0].From != 1510104800 {
+		t.Errorf("the second maintenance should be missing but got %v", d.missing)
+	}
+	if len(d.extra) != 1 || d.extra[0].ID != "a3" {
+		t.Errorf("the incident should be extra but got %v", d.extra)
+	}
+	if len(d.changed) != 1 || d.changed[0].ID != "a2" {
+		t.Errorf("the release should be changed but got %v", d.changed)
+	}
+
+	var buf bytes.Buffer
+	printAnnotationsDiff(&buf, d)
+	if !strings.HasPrefix(buf.String(), "Summary: 1 missing, 1 extra, 1 changed\n") || !strings.Contains(buf.String(), `+ "maintenance"`) {
+		t.Errorf("the missing annotation should be shown but got:\n%s", buf.String())
+	}
+
+	if d := diffAnnotations(expected[:1], remote[:1]); !d.empty() {
+		t.Errorf("there should be no difference but got %v", d)
+	}
+
+	if _, err := loadExpectedAnnotations(strings.NewReader(`{"graphAnnotations": [{"title": "no time"}]}`)); err == nil {
+		t.Errorf("should raise error for annotations without from and to")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestFilterAnnotationsInRange(t *testing.T) {
+	annotations := []mkr.GraphAnnotation{
+		{ID: "before", From: 100, To: 200},
+		{ID: "overlap", From: 250, To: 350},
+		{ID: "within", From: 300, To: 400},
+		{ID: "after", From: 600, To: 700},
+	}
+
+	testCases := []struct {
+		after  int64
+		before int64
+		want   []string
+	}{
+		{300, 500, []string{"within"}},
+		{250, 0, []string{"overlap", "within", "after"}},
+		{0, 350, []string{"before", "overlap"}},
+		{0, 0, []string{"before", "overlap", "within", "after"}},
+	}
+
+	for _, testCase := range testCases {
+		ids := []string{}
+		for _, annotation := range filterAnnotationsInRange(annotations, testCase.after, testCase.before) {
+			ids = append(ids, annotation.ID)
+		}
+		if !reflect.DeepEqual(ids, testCase.want) {
+			t.Errorf("annotations in [%d, %d] should be %v but got %v", testCase.after, testCase.before, testCase.want, ids)
+		}
+	}
+}
+
+func TestParseAbsoluteTime(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  time.Time
+	}{
+		{"2017-11-01T09:00:00+09:00", time.Date(2017, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"2017-11-01", time.Date(2017, 11, 1, 0, 0, 0, 0, time.Local)},
+		{"2017-11-01T12:30:00", time.Date(2017, 11, 1, 12, 30, 0, 0, time.Local)},
+	}
+
+	for _, testCase := range testCases {
+		got, err := parseAbsoluteTime(testCase.input)
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+		if !got.Equal(testCase.want) {
+			t.Errorf("parseAbsoluteTime(%q) should be %s but got %s", testCase.input, testCase.want, got)
+		}
+	}
+
+	if _, err := parseAbsoluteTime("yesterday"); err == nil {
+		t.Error("should raise error for an invalid time")
+	}
+}
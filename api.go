@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+// requestJSON requests the Mackerel API which mackerel-client-go doesn't support yet.
+// payload is encoded as a request body unless nil, and the response body is decoded into v unless nil.
+// path can contain a query string (e.g. "/api/v0/alerts?withClosed=true").
+func requestJSON(client *mkr.Client, method, path string, payload interface{}, v interface{}) error {
+	return doRequestJSON(client, method, path, payload, v, false)
+}
+
+// requestGzipJSON is similar to requestJSON, but the request body is compressed by gzip.
+func requestGzipJSON(client *mkr.Client, method, path string, payload interface{}, v interface{}) error {
+	return doRequestJSON(client, method, path, payload, v, true)
+}
+
+func doRequestJSON(client *mkr.Client, method, path string, payload interface{}, v interface{}, gzipped bool) error {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		if gzipped {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			if _, err := zw.Write(data); err != nil {
+				return err
+			}
+			if err := zw.Close(); err != nil {
+				return err
+			}
+			data = buf.Bytes()
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, client.BaseURL.ResolveReference(ref).String(), body)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+		if gzipped {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+
+	resp, err := client.Request(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return newAPIError(resp)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// newAPIError builds an error from the error response such as {"error":{"message":"..."}}
+func newAPIError(resp *http.Response) error {
+	var data struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	message := http.StatusText(resp.StatusCode)
+	if err := json.NewDecoder(resp.Body).Decode(&data); err == nil && data.Error.Message != "" {
+		message = data.Error.Message
+	}
+	return &mkr.APIError{StatusCode: resp.StatusCode, Message: message}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+)
+
+// batchResult is the result of an action on a host in a batch operation
+type batchResult struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+type batchSummary struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+// batchReport is the output of batch operations with -o json, so that scripts can handle partial failures
+type batchReport struct {
+	Results []*batchResult `json:"results"`
+	Summary batchSummary   `json:"summary"`
+}
+
+func newBatchReport() *batchReport {
+	return &batchReport{Results: []*batchResult{}}
+}
+
+// add records the result of the action on the host, which failed if err is not nil
+func (r *batchReport) add(id, action string, err error) {
+	result := &batchResult{ID: id, Action: action, OK: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+		r.Summary.Failed++
+	} else {
+		r.Summary.Succeeded++
+	}
+	r.Results = append(r.Results, result)
+}
+
+// merge appends the results of other to the report
+func (r *batchReport) merge(other *batchReport) {
+	r.Results = append(r.Results, other.Results...)
+	r.Summary.Succeeded += other.Summary.Succeeded
+	r.Summary.Failed += other.Summary.Failed
+}
+
+func (r *batchReport) print(w io.Writer) {
+	fprettyPrintJSON(w, r)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/httpclient"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandChannels = cli.Command{
+	Name:  "channels",
+	Usage: "List/Test notification channels and their references",
+	Description: `
+    List notification channels, or send a test notification through a channel.
+    Requests APIs under "/api/v0/channels". See https://mackerel.io/api-docs/entry/channels .
+`,
+	Action: doChannelsList,
+	Subcommands: []cli.Command{
+		{
+			Name:      "list",
+			Usage:     "list channels",
+			ArgsUsage: "[--mask-secrets] [--out <path>]",
+			Description: `
+    Shows notification channels. With --mask-secrets, webhook URLs are replaced by '***'.
+`,
+			Action: doChannelsList,
+			Flags: append([]cli.Flag{
+				outFlag,
+			}, maskSecretsFlags(false)...),
+		},
+		{
+			Name:      "test",
+			Usage:     "test a channel",
+			ArgsUsage: "<channelId>",
+			Description: `
+    Sends a test notification through the channel identified with <channelId>.
+    Mackerel API has no endpoint for test notifications, so mkr posts a test message to the
+    URL of the channel by itself. Only 'slack' and 'webhook' channels are supported.
+`,
+			Action: doChannelsTest,
+		},
+		commandChannelsRefs,
+	},
+}
+
+// channel represents a notification channel.
+// Fields other than id, name and type are returned only for email, slack and webhook channels.
+type channel struct {
+	ID                string           `json:"id"`
+	Name              string           `json:"name"`
+	Type              string           `json:"type"`
+	Emails            []string         `json:"emails,omitempty"`
+	UserIDs           []string         `json:"userIds,omitempty"`
+	URL               string           `json:"url,omitempty"`
+	Mentions          *channelMentions `json:"mentions,omitempty"`
+	EnabledGraphImage *bool            `json:"enabledGraphImage,omitempty"`
+	Events            []string         `json:"events,omitempty"`
+}
+
+type channelMentions struct {
+	OK       string `json:"ok,omitempty"`
+	Warning  string `json:"warning,omitempty"`
+	Critical string `json:"critical,omitempty"`
+}
+
+func findChannels(client *mkr.Client) ([]*channel, error) {
+	var data struct {
+		Channels []*channel `json:"channels"`
+	}
+	if err := requestJSON(client, http.MethodGet, "/api/v0/channels", nil, &data); err != nil {
+		return nil, err
+	}
+	return data.Channels, nil
+}
+
+func doChannelsList(c *cli.Context) error {
+	channels, err := findChannels(newMackerelFromContext(c))
+	logger.DieIf(err)
+	if shouldMaskSecrets(c, false) {
+		channels = maskChannelsSecrets(channels)
+	}
+	logger.DieIf(writeOutput(c.String("out"), func(w io.Writer) error {
+		fprettyPrintJSON(w, channels)
+		return nil
+	}))
+	return nil
+}
+
+// errChannelTestUnsupported is returned for channels which mkr can't send test notifications through
+type errChannelTestUnsupported struct {
+	channel *channel
+}
+
+func (e *errChannelTestUnsupported) Error() string {
+	return fmt.Sprintf("test notification is unsupported for channel '%s' (type: %s)", e.channel.Name, e.channel.Type)
+}
+
+var channelTestClient = httpclient.New(10 * time.Second)
+
+// testChannel posts a test message to the URL of the channel
+func testChannel(ch *channel) error {
+	const message = "This is a test notification from mkr."
+
+	var payload interface{}
+	switch ch.Type {
+	case "slack":
+		payload = map[string]string{"text": message}
+	case "webhook":
+		payload = map[string]string{"event": "test", "message": message}
+	default:
+		return &errChannelTestUnsupported{ch}
+	}
+	if ch.URL == "" {
+		return fmt.Errorf("channel '%s' has no url", ch.Name)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := channelTestClient.Post(ch.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("test notification to channel '%s' failed: %s", ch.Name, resp.Status)
+	}
+	return nil
+}
+
+func doChannelsTest(c *cli.Context) error {
+	channelID := c.Args().First()
+	if channelID == "" {
+		cli.ShowCommandHelp(c, "test")
+		return cli.NewExitError("specify a channel ID.", 1)
+	}
+
+	channels, err := findChannels(newMackerelFromContext(c))
+	logger.DieIf(err)
+
+	for _, ch := range channels {
+		if ch.ID != channelID {
+			continue
+		}
+		if err := testChannel(ch); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		logger.Log("info", fmt.Sprintf("Test notification is sent through channel '%s'.", ch.Name))
+		return nil
+	}
+	return cli.NewExitError(fmt.Sprintf("channel %s is not found.", channelID), 1)
+}
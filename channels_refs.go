@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandChannelsRefs = cli.Command{
+	Name:      "refs",
+	Usage:     "list monitors notifying a channel",
+	ArgsUsage: "[--output | -o <format>] <channelId>",
+	Description: `
+    Shows monitors whose alerts are notified through the channel identified with <channelId>, with the notification
+    groups which connect them. Monitors reach a channel through groups including the channel directly or via child groups.
+    Note that monitors notified through the default notification group are not listed.
+    Requests "GET /api/v0/notification-groups" and "GET /api/v0/monitors".
+    See https://mackerel.io/api-docs/entry/notification-groups .
+`,
+	Action: doChannelsRefs,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "output, o", Value: "table", Usage: "Output format ('table' or 'json')"},
+	},
+}
+
+type notificationGroup struct {
+	ID                        string   `json:"id"`
+	Name                      string   `json:"name"`
+	ChildNotificationGroupIDs []string `json:"childNotificationGroupIds"`
+	ChildChannelIDs           []string `json:"childChannelIds"`
+	Monitors                  []struct {
+		ID string `json:"id"`
+	} `json:"monitors"`
+}
+
+func findNotificationGroups(client *mkr.Client) ([]*notificationGroup, error) {
+	var data struct {
+		NotificationGroups []*notificationGroup `json:"notificationGroups"`
+	}
+	if err := requestJSON(client, http.MethodGet, "/api/v0/notification-groups", nil, &data); err != nil {
+		return nil, err
+	}
+	return data.NotificationGroups, nil
+}
+
+// channelRef is a monitor notifying the channel through the notification group
+type channelRef struct {
+	MonitorID         string `json:"monitorId"`
+	MonitorName       string `json:"monitorName"`
+	NotificationGroup string `json:"notificationGroup"`
+}
+
+// groupsReachingChannel returns groups including the channel directly or via their child groups
+func groupsReachingChannel(groups []*notificationGroup, channelID string) []*notificationGroup {
+	byID := map[string]*notificationGroup{}
+	for _, g := range groups {
+		byID[g.ID] = g
+	}
+	reaches := map[string]bool{}
+	var visit func(g *notificationGroup, visiting map[string]bool) bool
+	visit = func(g *notificationGroup, visiting map[string]bool) bool {
+		if r, ok := reaches[g.ID]; ok {
+			return r
+		}
+		if visiting[g.ID] {
+			return false
+		}
+		visiting[g.ID] = true
+		r := containsString(g.ChildChannelIDs, channelID)
+		for _, childID := range g.ChildNotificationGroupIDs {
+			if child, ok := byID[childID]; ok && visit(child, visiting) {
+				r = true
+			}
+		}
+		reaches[g.ID] = r
+		return r
+	}
+
+	var reaching []*notificationGroup
+	for _, g := range groups {
+		if visit(g, map[string]bool{}) {
+			reaching = append(reaching, g)
+		}
+	}
+	return reaching
+}
+
+// findChannelRefs returns monitors in groups reaching the channel, sorted by monitor names
+func findChannelRefs(groups []*notificationGroup, monitors []rawMonitor, channelID string) []*channelRef {
+	names := map[string]string{}
+	for _, m := range monitors {
+		names[m.id()] = m.name()
+	}
+	refs := []*channelRef{}
+	for _, g := range groupsReachingChannel(groups, channelID) {
+		for _, m := range g.Monitors {
+			refs = append(refs, &channelRef{MonitorID: m.ID, MonitorName: names[m.ID], NotificationGroup: g.Name})
+		}
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		if refs[i].MonitorName != refs[j].MonitorName {
+			return refs[i].MonitorName < refs[j].MonitorName
+		}
+		return refs[i].NotificationGroup < refs[j].NotificationGroup
+	})
+	return refs
+}
+
+func printChannelRefs(w io.Writer, refs []*channelRef) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "MONITOR ID\tMONITOR NAME\tNOTIFICATION GROUP")
+	for _, ref := range refs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", ref.MonitorID, ref.MonitorName, ref.NotificationGroup)
+	}
+	tw.Flush()
+}
+
+func doChannelsRefs(c *cli.Context) error {
+	channelID := c.Args().First()
+	if channelID == "" {
+		cli.ShowCommandHelp(c, "refs")
+		return cli.NewExitError("specify a channel ID.", 1)
+	}
+	output := c.String("output")
+	if output != "table" && output != "json" {
+		return cli.NewExitError(fmt.Sprintf("unknown output format: %s", output), 1)
+	}
+
+	client := newMackerelFromContext(c)
+	groups, err := findNotificationGroups(client)
+	logger.DieIf(err)
+	monitors, err := findRawMonitors(client)
+	logger.DieIf(err)
+
+	refs := findChannelRefs(groups, monitors, channelID)
+	if output == "json" {
+		PrettyPrintJSON(refs)
+	} else {
+		printChannelRefs(os.Stdout, refs)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestFindChannelRefs(t *testing.T) {
+	var groups []*notificationGroup
+	json.Unmarshal([]byte(`[
+		{"id": "g1", "name": "ops", "childChannelIds": ["ch1"], "monitors": [{"id": "m1"}]},
+		{"id": "g2", "name": "escalation", "childNotificationGroupIds": ["g1"], "monitors": [{"id": "m2"}]},
+		{"id": "g3", "name": "dev", "childChannelIds": ["ch2"], "monitors": [{"id": "m3"}]},
+		{"id": "g4", "name": "loop", "childNotificationGroupIds": ["g5"], "monitors": [{"id": "m3"}]},
+		{"id": "g5", "name": "loop2", "childNotificationGroupIds": ["g4"]}
+	]`), &groups)
+	monitors := []rawMonitor{
+		{"id": "m1", "name": "cpu"},
+		{"id": "m2", "name": "disk"},
+		{"id": "m3", "name": "memory"},
+	}
+
+	refs := findChannelRefs(groups, monitors, "ch1")
+	if len(refs) != 2 {
+		t.Fatalf("2 monitors should refer to the channel but got %d", len(refs))
+	}
+	if refs[0].MonitorName != "cpu" || refs[0].NotificationGroup != "ops" {
+		t.Errorf("cpu should refer to the channel directly but got %+v", refs[0])
+	}
+	if refs[1].MonitorName != "disk" || refs[1].NotificationGroup != "escalation" {
+		t.Errorf("disk should refer to the channel via the child group but got %+v", refs[1])
+	}
+
+	var buf bytes.Buffer
+	printChannelRefs(&buf, refs)
+	want := "MONITOR ID  MONITOR NAME  NOTIFICATION GROUP\nm1          cpu           ops\nm2          disk          escalation\n"
+	if buf.String() != want {
+		t.Errorf("the table should be:\n%s\nbut got:\n%s", want, buf.String())
+	}
+
+	if refs := findChannelRefs(groups, monitors, "ch9"); len(refs) != 0 {
+		t.Errorf("no monitors should refer to the unknown channel but got %d", len(refs))
+	}
+}
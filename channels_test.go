@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTestChannel(t *testing.T) {
+	var received map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewDecoder(req.Body).Decode(&received)
+	}))
+	defer ts.Close()
+
+	// supported channel
+	if err := testChannel(&channel{ID: "2Xx1", Name: "webhook", Type: "webhook", URL: ts.URL}); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if received["event"] != "test" {
+		t.Errorf("test payload should be posted, but got %v", received)
+	}
+
+	received = nil
+	if err := testChannel(&channel{ID: "2Xx2", Name: "slack", Type: "slack", URL: ts.URL}); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if received["text"] == "" {
+		t.Errorf("slack message should be posted, but got %v", received)
+	}
+
+	// unsupported channel
+	received = nil
+	err := testChannel(&channel{ID: "2Xx3", Name: "ops", Type: "email", Emails: []string{"ops@example.com"}})
+	if _, ok := err.(*errChannelTestUnsupported); !ok {
+		t.Errorf("should raise unsupported error, but got %v", err)
+	}
+	if received != nil {
+		t.Errorf("nothing should be posted, but got %v", received)
+	}
+}
+
+func TestTestChannel_failure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	if err := testChannel(&channel{ID: "2Xx1", Name: "webhook", Type: "webhook", URL: ts.URL}); err == nil {
+		t.Error("should raise error when the webhook responds with an error status")
+	}
+}
@@ -2,17 +2,29 @@ package main
 
 import (
 	"bufio"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
 	"text/template"
 	"time"
 
 	"github.com/Songmu/prompter"
 	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/httpclient"
 	"github.com/mackerelio/mkr/logger"
 	"github.com/mackerelio/mkr/plugin"
+	isatty "github.com/mattn/go-isatty"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -38,43 +50,86 @@ OPTIONS:
 var Commands = []cli.Command{
 	commandStatus,
 	commandHosts,
+	commandFind,
+	commandInterfaces,
+	commandSummary,
 	commandCreate,
 	commandUpdate,
 	commandThrow,
 	commandMetrics,
+	commandMetricNames,
 	commandFetch,
 	commandRetire,
 	commandServices,
+	commandRoles,
 	commandMonitors,
 	commandAlerts,
 	commandDashboards,
 	commandAnnotations,
+	commandChannels,
+	commandWait,
+	commandCompletion,
+	commandDoctor,
+	commandExport,
+	commandImport,
 	plugin.CommandPlugin,
 }
 
 var commandStatus = cli.Command{
 	Name:      "status",
 	Usage:     "Show the host",
-	ArgsUsage: "[--verbose | -v] <hostId>",
+	ArgsUsage: "[--verbose | -v] [--field <path>] [--template <template>] [--watch [--interval | -n <duration>]] (<hostId> | -)",
 	Description: `
-    Show the information of the host identified with <hostId>.
+    Show the information of the host identified with <hostId>. With "-", the host ID is read from stdin.
+    With --watch, the screen is cleared and the host is shown again every <duration> until interrupted like watch(1).
+    --watch is ignored if the output is not a terminal.
+    With --template, the host (the fields of the verbose output) is rendered by the Go template <template>,
+    where "join" and "default" functions are available (e.g. '{{.Name}} {{.GetRoleFullnames | join ","}}').
     Requests "GET /api/v0/hosts/<hostId>". See https://mackerel.io/api-docs/entry/hosts#get .
 `,
 	Action: doStatus,
 	Flags: []cli.Flag{
 		cli.BoolFlag{Name: "verbose, v", Usage: "Verbose output mode"},
+		cli.StringFlag{Name: "field", Value: "", Usage: "Print only values at the dotted <path> line by line (e.g. '.name')"},
+		cli.StringFlag{Name: "template", Value: "", Usage: "Render the host by the Go template <template>"},
+		cli.BoolFlag{Name: "watch", Usage: "Refresh the host periodically until interrupted"},
+		cli.DurationFlag{Name: "interval, n", Value: 2 * time.Second, Usage: "Refreshing interval with --watch"},
 	},
 }
 
 var commandHosts = cli.Command{
 	Name:      "hosts",
 	Usage:     "List hosts",
-	ArgsUsage: "[--verbose | -v] [--name | -n <name>] [--service | -s <service>] [[--role | -r <role>]...] [[--status | --st <status>]...]",
+	ArgsUsage: "[--verbose | -v] [--name | -n <name>] [--service | -s <service>] [[--role | -r <role>]...] [[--status | --st <status>]...] [--include-retired | --exclude-retired] [--created-since <time>] [--created-before <time>] [[--label <key=value>]...] [--filter <expr>] [--ids-only] [--ipv6] [--group-by (role | meta.<key>)] [--output | -o <format>] [--field <path>] [--template <template>] [--out <path>]",
 	Description: `
     List the information of the hosts refined by host name, service name, role name and/or status.
+    By default, hosts flagged as retired are not listed. With --include-retired, poweroff hosts
+    (all statuses are requested unless --status is specified) and retired hosts are listed too.
+    With --exclude-retired, both retired and poweroff hosts are never listed.
+    --created-since and --created-before filter hosts by the creation time, which is a duration before now (e.g. '24h')
+    or an absolute time (RFC3339 or YYYY-MM-DD).
+    With -o jsonl, each host is output as a line of JSON instead of a JSON array.
+    With -o markdown, hosts are output as a Markdown table with the same columns as -o table.
+    With --field <path>, only values at the dotted <path> of the JSON output are printed line by line (e.g. '.[].name'),
+    and it can't be used with other outputs, --format, --template, --group-by or --ids-only.
+    With --ipv6, IPv6 addresses of interfaces are shown in "ipv6Addresses" or the "IPV6 ADDRESSES" column of the table.
+    With --template, each host (the fields of the verbose output) is rendered by the Go template <template>,
+    where "join" and "default" functions are available (e.g. '{{.ID}} {{.DisplayName | default .Name}}').
+    With --group-by role, hosts are listed under each role with the number of them.
+    A host belonging to multiple roles appears under each role.
+    --label and --group-by meta.<key> refer to the host meta, where nested keys are addressed with dots
+    (e.g. '--label cloud.region=us-east-1' and '--group-by meta.datacenter').
+    --filter <expr> filters hosts by an expression of id, name, displayName, status, service, role and meta.<key>
+    compared with quoted strings by == and !=, combined by &&, || and parentheses
+    (e.g. --filter 'role == "web:app" && (status == "working" || meta.cloud.region != "us-east-1")').
+    role and service match any of the roles and services of the host.
+    With "diff" subcommand, shows difference of hosts between Mackerel and an inventory file.
     Requests "GET /api/v0/hosts.json". See https://mackerel.io/api-docs/entry/hosts#list .
 `,
 	Action: doHosts,
+	Subcommands: []cli.Command{
+		commandHostsDiff,
+	},
 	Flags: []cli.Flag{
 		cli.StringFlag{Name: "name, n", Value: "", Usage: "List hosts only matched with <name>"},
 		cli.StringFlag{Name: "service, s", Value: "", Usage: "List hosts only belonging to <service>"},
@@ -88,7 +143,24 @@ var commandHosts = cli.Command{
 			Value: &cli.StringSlice{},
 			Usage: "List hosts only matched <status>. Multiple choices are allowed.",
 		},
+		cli.BoolFlag{Name: "include-retired", Usage: "List retired and poweroff hosts too"},
+		cli.BoolFlag{Name: "exclude-retired", Usage: "Never list retired and poweroff hosts"},
+		cli.StringFlag{Name: "created-since", Value: "", Usage: "List hosts created at or after <time>"},
+		cli.StringFlag{Name: "created-before", Value: "", Usage: "List hosts created before <time>"},
+		cli.BoolFlag{Name: "ids-only", Usage: "Print only host IDs line by line"},
+		cli.StringSliceFlag{
+			Name:  "label",
+			Value: &cli.StringSlice{},
+			Usage: "List hosts only whose meta has <value> at the dotted <key>. Multiple choices are allowed.",
+		},
+		cli.StringFlag{Name: "filter", Value: "", Usage: "List hosts only matching the expression <expr>"},
+		cli.BoolFlag{Name: "ipv6", Usage: "Show IPv6 addresses of interfaces too"},
+		cli.StringFlag{Name: "group-by", Value: "", Usage: "Group hosts by 'role' or 'meta.<key>'. Output a map of the keys to hosts with '-o json'"},
+		cli.StringFlag{Name: "output, o", Value: "json", Usage: "Output format ('json', 'jsonl', 'table' or 'markdown')"},
 		cli.StringFlag{Name: "format, f", Value: "", Usage: "Output format template"},
+		cli.StringFlag{Name: "template", Value: "", Usage: "Render each host by the Go template <template>"},
+		cli.StringFlag{Name: "field", Value: "", Usage: "Print only values at the dotted <path> line by line (e.g. '.[].name')"},
+		outFlag,
 		cli.BoolFlag{Name: "verbose, v", Usage: "Verbose output mode"},
 	},
 }
@@ -96,9 +168,11 @@ var commandHosts = cli.Command{
 var commandCreate = cli.Command{
 	Name:      "create",
 	Usage:     "Create a new host",
-	ArgsUsage: "[--status | -st <status>] [--roleFullname | -R <service:role>] [--customIdentifier <customIdentifier>] <hostName>",
+	ArgsUsage: "[--status | -st <status>] [--roleFullname | -R <service:role>] [--customIdentifier <customIdentifier>] [--id-only | --output | -o json] <hostName>",
 	Description: `
     Create a new host with status, roleFullname and/or customIdentifier.
+    With --id-only, only the ID of the created host is output, e.g. host_id=$(mkr create --id-only app01).
+    With -o json, the created host is output in JSON. Informational messages are not output in both cases.
     Requests "POST /api/v0/hosts". See https://mackerel.io/api-docs/entry/hosts#create .
 `,
 	Action: doCreate,
@@ -110,20 +184,28 @@ var commandCreate = cli.Command{
 			Usage: "Multiple choices are allowed. ex. My-Service:proxy, My-Service:db-master",
 		},
 		cli.StringFlag{Name: "customIdentifier", Value: "", Usage: "CustomIdentifier for the Host"},
+		cli.BoolFlag{Name: "id-only", Usage: "Print only the ID of the created host"},
+		cli.StringFlag{Name: "output, o", Value: "", Usage: "Output the created host in the format ('json')"},
 	},
 }
 
 var commandUpdate = cli.Command{
 	Name:      "update",
 	Usage:     "Update the host",
-	ArgsUsage: "[--name | -n <name>] [--displayName <displayName>] [--status | -st <status>] [--roleFullname | -R <service:role>] [--overwriteRoles | -o] [<hostIds...>]",
+	ArgsUsage: "[--name | -n <name>] [--displayName <displayName>] [--status | -st <status>] [--roleFullname | -R <service:role>] [--overwriteRoles | -o] [--retry-on-conflict <N>] [--force] [--output json] [<hostIds...> | -]",
 	Description: `
-    Update the host identified with <hostId>.
+    Update the host identified with <hostId>. With "-", host IDs are read from stdin line by line.
+    The API is not called if the host already has the specified status, roles and names, unless --force is given.
+    The status should be one of working, standby, maintenance and poweroff, and retired hosts can't change the status,
+    which is checked before calling the API unless --force is given (only the status name is checked with --force).
+    With --output json, all hosts are updated even if some of them fail, and the result of each host
+    ({"id", "action", "ok", "error"}) and the summary ({"succeeded", "failed"}) are output in JSON.
+    The action is "skip" for hosts which need no change, and mkr exits with 1 if any of them fails.
     Requests "PUT /api/v0/hosts/<hostId>". See https://mackerel.io/api-docs/entry/hosts#update-information .
 `,
 	Action: doUpdate,
 	Flags: []cli.Flag{
-		cli.StringFlag{Name: "name, n", Value: "", Usage: "Update hostname."},
+		cli.StringFlag{Name: "name, n", Value: "", Usage: "Update hostname (rename the host)."},
 		cli.StringFlag{Name: "displayName", Value: "", Usage: "Update displayName."},
 		cli.StringFlag{Name: "status, st", Value: "", Usage: "Update status."},
 		cli.StringSliceFlag{
@@ -132,29 +214,74 @@ var commandUpdate = cli.Command{
 			Usage: "Update rolefullname.",
 		},
 		cli.BoolFlag{Name: "overwriteRoles, o", Usage: "Overwrite roles instead of adding specified roles."},
+		cli.IntFlag{Name: "retry-on-conflict", Value: 0, Usage: "Refetch the host and retry the update up to <N> times on 409 Conflict."},
+		cli.BoolFlag{Name: "force", Usage: "Update the host even if nothing is changed."},
+		cli.StringFlag{Name: "output", Value: "", Usage: "Output the result of each host in the format ('json')"},
 	},
 }
 
 var commandThrow = cli.Command{
 	Name:      "throw",
 	Usage:     "Post metric values",
-	ArgsUsage: "[--host | -H <hostId>] [--service | -s <service>] stdin",
+	ArgsUsage: "[--host | -H <hostId>] [--host-name <hostName>] [--local [--id-file <path>]] [--service | -s <service>] [(--stream | --follow <file>) [--flush-interval <duration>] [--batch-size <N>]] [--chunk-size <N> [--continue-on-error]] [--gzip] [--rate --state-file <path> [--on-reset skip|zero]] [--prefix <prefix>] [--dry-run] (stdin | --name <metricName> (--value <value> [--time <time>] | --aggregate <func> [[--role <role>]...]))",
 	Description: `
     Post metric values to 'host metric' or 'service metric'.
     Output format of metric values are compatible with that of a Sensu plugin.
+    With --local, host metric values are posted to the host running mackerel-agent, whose ID is read from
+    the id file under the root of the agent (--id-file overrides the path of the id file).
+    With --stream, metric values are posted periodically as lines arrive, instead of waiting for EOF.
+    With --follow <file>, lines appended to <file> are posted in the same way like "tail -f",
+    following the file even if it is truncated or rotated.
+    With --dry-run, metric values which would be posted are output and malformed lines are reported, without calling the API.
+    With --name and --value, the single metric value is posted instead of reading stdin, at --time, which defaults to now.
+    Times of metric values are epoch seconds, RFC3339, 'now' or offsets from now with the sign (e.g. '-5m' or '+1h').
+    With --service, --name and --aggregate, the latest values of the host metric <metricName> of all hosts in the service
+    (or only in the --role roles of it) are combined by <func> ('sum', 'avg', 'max' or 'min'), and posted as the single
+    service metric value of the same name, at the newest time of the values. Hosts without the value are ignored.
+    Metric values from stdin are posted in chunks of --chunk-size values sequentially, and the posting stops at
+    the first failed chunk unless --continue-on-error.
+    With --rate, values are treated as counters and their per-second rates are posted instead. The previous values
+    are kept in --state-file, which is updated only after the rates are posted, and decreased counters post nothing
+    or zero according to --on-reset. With --dry-run, the rates are output without updating --state-file.
+    With --prefix, <prefix> and a dot are prepended to the name of every metric value, after "custom." if the name has it
+    (e.g. "custom.foo" becomes "custom.<prefix>.foo"). Metric values whose resulting names are invalid are not posted.
     Requests "POST /api/v0/tsdb". See https://mackerel.io/api-docs/entry/host-metrics#post .
 `,
 	Action: doThrow,
 	Flags: []cli.Flag{
 		cli.StringFlag{Name: "host, H", Value: "", Usage: "Post host metric values to <hostID>."},
+		cli.StringFlag{Name: "host-name", Value: "", Usage: "Post host metric values to the host named <hostName>, instead of --host."},
+		cli.BoolFlag{Name: "local", Usage: "Post host metric values to the local host of mackerel-agent, instead of --host."},
+		cli.StringFlag{Name: "id-file", Value: "", Usage: "Read the host ID for --local from <path>. The default is the id file under the root of mackerel-agent."},
 		cli.StringFlag{Name: "service, s", Value: "", Usage: "Post service metric values to <service>."},
+		cli.StringFlag{Name: "name", Value: "", Usage: "Post the single metric value named <metricName> instead of reading stdin."},
+		cli.StringFlag{Name: "value", Value: "", Usage: "The value of the metric specified by --name."},
+		cli.StringFlag{Name: "time", Value: "", Usage: "The time of the metric specified by --name in epoch seconds, RFC3339, 'now' or an offset like '-5m'. The default is now."},
+		cli.StringFlag{Name: "aggregate", Value: "", Usage: "Post the <func> ('sum', 'avg', 'max' or 'min') of the latest values of --name of hosts in --service."},
+		cli.StringSliceFlag{
+			Name:  "role",
+			Value: &cli.StringSlice{},
+			Usage: "Aggregate values of hosts only in <role> of --service with --aggregate. Multiple choices are allowed.",
+		},
+		cli.BoolFlag{Name: "stream", Usage: "Post metric values in batches as they arrive on stdin."},
+		cli.StringFlag{Name: "follow", Value: "", Usage: "Post metric values in batches as they are appended to <file>, instead of reading stdin."},
+		cli.DurationFlag{Name: "flush-interval", Value: 10 * time.Second, Usage: "The interval to post buffered metric values with --stream or --follow."},
+		cli.IntFlag{Name: "batch-size", Value: 100, Usage: "Post buffered metric values when <N> values are buffered with --stream or --follow."},
+		cli.IntFlag{Name: "chunk-size", Value: defaultThrowChunkSize, Usage: "Post metric values from stdin in chunks of <N> values."},
+		cli.BoolFlag{Name: "continue-on-error", Usage: "Post the remaining chunks even if a chunk fails to be posted."},
+		cli.BoolFlag{Name: "gzip", Usage: "Compress the request body by gzip. Retried without compression if the server rejects it."},
+		cli.BoolFlag{Name: "rate", Usage: "Post per-second rates of counter values."},
+		cli.StringFlag{Name: "state-file", Value: "", Usage: "Keep previous counter values for --rate in <path>."},
+		cli.StringFlag{Name: "on-reset", Value: rateResetSkip, Usage: "Post nothing ('skip') or zero ('zero') for decreased counters with --rate."},
+		cli.StringFlag{Name: "prefix", Value: "", Usage: "Prepend <prefix> and a dot to the names of metric values."},
+		cli.BoolFlag{Name: "dry-run", Usage: "Parse metric values from stdin and show them, but not post."},
 	},
 }
 
 var commandMetrics = cli.Command{
 	Name:      "metrics",
 	Usage:     "Fetch metric values",
-	ArgsUsage: "[--host | -H <hostId>] [--service | -s <service>] [--name | -n <metricName>] --from int --to int",
+	ArgsUsage: "[--host | -H <hostId>] [--service | -s <service>] [--name | -n <metricName>] [--sparkline] --from int --to int",
 	Description: `
     Fetch metric values of 'host metric' or 'service metric'.
     Requests "/api/v0/hosts/<hostId>/metrics" or "/api/v0/services/<serviceName>/tsdb".
@@ -167,16 +294,23 @@ var commandMetrics = cli.Command{
 		cli.StringFlag{Name: "name, n", Value: "", Usage: "The name of the metric for which you want to obtain the metric."},
 		cli.Int64Flag{Name: "from", Usage: "The first of the period for which you want to obtain the metric. (epoch seconds)"},
 		cli.Int64Flag{Name: "to", Usage: "The end of the period for which you want to obtain the metric. (epoch seconds)"},
+		cli.BoolFlag{Name: "sparkline", Usage: "Render the metric values as a sparkline. Raw values are output if the terminal can't display unicode."},
 	},
 }
 
 var commandFetch = cli.Command{
 	Name:      "fetch",
 	Usage:     "Fetch latest metric values",
-	ArgsUsage: "[--name | -n <metricName>] hostIds...",
+	ArgsUsage: "[--name | -n <metricName>] (hostIds... [--concurrency <N>] | --service | -s <service> [--from <from>] [--to <to>] [--output | -o <format>])",
 	Description: `
     Fetch latest metric values about the hosts.
     Requests "GET /api/v0/tsdb/latest". See https://mackerel.io/api-docs/entry/host-metrics#get-latest .
+    Hosts are requested by 100 per request, and up to <N> requests are sent concurrently with --concurrency.
+    Hosts whose requests fail are reported after the output.
+
+    With --service, fetch data points of the service metric <metricName> between <from> and <to>,
+    which default to the last hour, and print them as "time<TAB>value" lines or JSON.
+    Requests "GET /api/v0/services/<service>/metrics". See https://mackerel.io/api-docs/entry/service-metrics#get .
 `,
 	Action: doFetch,
 	Flags: []cli.Flag{
@@ -185,39 +319,59 @@ var commandFetch = cli.Command{
 			Value: &cli.StringSlice{},
 			Usage: "Fetch metric values identified with <name>. Required. Multiple choices are allowed. ",
 		},
+		cli.IntFlag{Name: "concurrency", Value: 1, Usage: "The number of concurrent requests for hosts."},
+		cli.StringFlag{Name: "service, s", Value: "", Usage: "Fetch service metric values of <service>."},
+		cli.Int64Flag{Name: "from", Usage: "The first of the period of service metric values. (epoch seconds) The default is an hour before <to>."},
+		cli.Int64Flag{Name: "to", Usage: "The end of the period of service metric values. (epoch seconds) The default is now."},
+		cli.StringFlag{Name: "output, o", Value: "tsv", Usage: "Output format of service metric values ('tsv' or 'json')"},
 	},
 }
 
 var commandRetire = cli.Command{
 	Name:      "retire",
 	Usage:     "Retire hosts",
-	ArgsUsage: "[--force] hostIds...",
+	ArgsUsage: "[--force] [--retry-on-conflict <N>] [--ignore-missing] [--poweroff-first [--grace-period <duration>]] [--output | -o json] (hostIds... | -)",
 	Description: `
     Retire host identified by <hostId>. Be careful because this is an irreversible operation.
+    With "-", host IDs are read from stdin line by line, which requires --force.
+    Lines read from stdin are parsed in the same way for status and update: the first column of each line is
+    the host ID and the rest is ignored, so the output of "mkr hosts -o table" can be piped as it is.
+    Blank lines, comment lines starting with "#" and the header line of the table are skipped.
+    With --poweroff-first, the hosts are set to poweroff at first, and retired after <duration> of the grace period.
+    With -o json, all hosts are retired even if some of them fail, and the result of each host
+    ({"id", "action", "ok", "error"}) and the summary ({"succeeded", "failed"}) are output in JSON.
+    The action is "skip" for missing hosts with --ignore-missing, and mkr exits with 1 if any of them fails.
     Requests POST /api/v0/hosts/<hostId>/retire parallelly. See https://mackerel.io/api-docs/entry/hosts#retire .
 `,
 	Action: doRetire,
 	Flags: []cli.Flag{
 		cli.BoolFlag{Name: "force", Usage: "Force retirement without confirmation."},
+		cli.IntFlag{Name: "retry-on-conflict", Value: 0, Usage: "Retry the retirement up to <N> times on 409 Conflict."},
+		cli.BoolFlag{Name: "ignore-missing", Usage: "Treat hosts which are not found or already retired as retired."},
+		cli.BoolFlag{Name: "poweroff-first", Usage: "Set the hosts to poweroff, and retire them after the grace period."},
+		cli.DurationFlag{Name: "grace-period", Value: 5 * time.Minute, Usage: "The period between poweroff and retirement with --poweroff-first."},
+		cli.StringFlag{Name: "output, o", Value: "", Usage: "Output the result of each host in the format ('json')"},
 	},
 }
 
 var commandServices = cli.Command{
 	Name:      "services",
 	Usage:     "List services",
-	ArgsUsage: "",
+	ArgsUsage: "[--out <path>]",
 	Description: `
     List the information of the services.
     Requests "GET /api/v0/services". See https://mackerel.io/api-docs/entry/services#list.
 `,
 	Action: doServices,
-	Flags:  []cli.Flag{},
+	Flags: []cli.Flag{
+		outFlag,
+	},
 }
 
 func newMackerelFromContext(c *cli.Context) *mkr.Client {
 	confFile := c.GlobalString("conf")
 	apiBase := c.GlobalString("apibase")
-	apiKey := LoadApikeyFromEnvOrConfig(confFile)
+	apiKey := LoadApikeyForCommand(confFile, commandNameFromContext(c))
 	if apiKey == "" {
 		logger.Log("error", `
     MACKEREL_APIKEY environment variable is not set. (Try "export MACKEREL_APIKEY='<Your apikey>'")
@@ -229,16 +383,134 @@ func newMackerelFromContext(c *cli.Context) *mkr.Client {
 		apiBase = LoadApibaseFromConfigWithFallback(confFile)
 	}
 
-	mackerel, err := mkr.NewClientWithOptions(apiKey, apiBase, os.Getenv("DEBUG") != "")
+	logger.Debug(fmt.Sprintf("API base: %s", apiBase))
+	mackerel, err := mkr.NewClientWithOptions(apiKey, apiBase, false)
 	logger.DieIf(err)
 
+	configureClient(mackerel, c.GlobalString("user-agent"), requestID)
+	if os.Getenv("DEBUG") != "" || logger.IsDebug() {
+		setClientVerbose(mackerel)
+	}
+	logger.Debug(fmt.Sprintf("Request ID: %s", requestID))
+
 	return mackerel
 }
 
+// commandNameFromContext returns the name of the top-level command, such as "throw" for "mkr throw".
+// Subcommands share the name of the parent.
+func commandNameFromContext(c *cli.Context) string {
+	name := c.Command.HelpName
+	if name == "" {
+		// the context of a command with subcommands has the name in the app name (e.g. "mkr alerts")
+		name = c.App.Name
+	}
+	fields := strings.Fields(name)
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
+
+const requestIDHeader = "X-Request-Id"
+
+// requestID is attached to all API requests in an invocation, to correlate them in server-side logs
+var requestID = newRequestID()
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// configureClient sets the User-Agent and the request ID header to the client,
+// and makes it reuse connections by the shared transport. userAgent is appended to the default User-Agent of mkr.
+// The HTTP client is replaced only if it uses the default transport, keeping its timeout,
+// not to drop the HTTP client customized by the caller, such as the verbose one.
+func configureClient(client *mkr.Client, userAgent, requestID string) {
+	if hc := client.HTTPClient; hc == nil {
+		client.HTTPClient = httpclient.New(0)
+	} else if hc.Transport == nil || hc.Transport == http.DefaultTransport {
+		client.HTTPClient = httpclient.New(hc.Timeout)
+	}
+	client.UserAgent = fmt.Sprintf("mkr/%s", version)
+	if userAgent != "" {
+		client.UserAgent += " " + userAgent
+	}
+	if requestID != "" {
+		if client.AdditionalHeaders == nil {
+			client.AdditionalHeaders = http.Header{}
+		}
+		client.AdditionalHeaders.Set(requestIDHeader, requestID)
+	}
+}
+
+// setClientVerbose makes the client dump requests and responses with the API key redacted.
+// Verbose of mackerel-client-go isn't used since it dumps the API key as it is.
+func setClientVerbose(client *mkr.Client) {
+	client.Verbose = false
+	client.HTTPClient = httpclient.NewVerbose(0, func(dump string) { log.Print(dump) })
+}
+
+// validateHostStatusTransition checks the transition of the host to the status which the API surely rejects.
+// The host may be nil if it's not fetched, and then only the status is checked.
+func validateHostStatusTransition(host *mkr.Host, status string) error {
+	if !containsString(hostStatuses, status) {
+		return fmt.Errorf("unknown host status %q: it should be one of %s", status, strings.Join(hostStatuses, ", "))
+	}
+	if host != nil && host.IsRetired {
+		return fmt.Errorf("the host is retired, and retired hosts can't be %s", status)
+	}
+	return nil
+}
+
+// readIDsFromArgs replaces "-" in args with IDs read from r line by line, which are extracted by idOfLine.
+// Lines whose extracted IDs are empty are skipped.
+func readIDsFromArgs(args []string, r io.Reader, idOfLine func(line string) string) ([]string, error) {
+	var ids []string
+	for _, arg := range args {
+		if arg != "-" {
+			ids = append(ids, arg)
+			continue
+		}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if id := idOfLine(scanner.Text()); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// hostIDOfLine returns the first whitespace-separated column of the line as the host ID, ignoring the rest,
+// so that the output of "mkr hosts -o table" can be read. Comment lines and the header line have no ID.
+func hostIDOfLine(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || fields[0] == "ID" {
+		return ""
+	}
+	return fields[0]
+}
+
 func doStatus(c *cli.Context) error {
 	confFile := c.GlobalString("conf")
 	argHostID := c.Args().Get(0)
 	isVerbose := c.Bool("verbose")
+	optField := c.String("field")
+
+	if argHostID == "-" {
+		ids, err := readIDsFromArgs(c.Args()[:1], os.Stdin, hostIDOfLine)
+		logger.DieIf(err)
+		if len(ids) != 1 {
+			return cli.NewExitError(fmt.Sprintf("a host ID should be read from stdin, but got %d", len(ids)), 1)
+		}
+		argHostID = ids[0]
+	}
 
 	if argHostID == "" {
 		if argHostID = LoadHostIDFromConfig(confFile); argHostID == "" {
@@ -246,66 +518,317 @@ func doStatus(c *cli.Context) error {
 			os.Exit(1)
 		}
 	}
+	var tmpl *template.Template
+	if s := c.String("template"); s != "" {
+		var err error
+		if tmpl, err = parseItemTemplate(s); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
 
-	host, err := newMackerelFromContext(c).FindHost(argHostID)
-	logger.DieIf(err)
-
-	if isVerbose {
-		PrettyPrintJSON(host)
-	} else {
-		format := &HostFormat{
-			ID:            host.ID,
-			Name:          host.Name,
-			DisplayName:   host.DisplayName,
-			Status:        host.Status,
-			RoleFullnames: host.GetRoleFullnames(),
-			IsRetired:     host.IsRetired,
-			CreatedAt:     host.DateStringFromCreatedAt(),
-			IPAddresses:   host.IPAddresses(),
+	client := newMackerelFromContext(c)
+	render := func(w io.Writer) error {
+		host, err := client.FindHost(argHostID)
+		if err != nil {
+			return err
+		}
+		if tmpl != nil {
+			return renderItems(w, tmpl, host)
+		} else if isVerbose {
+			return fprettyPrintJSONOrField(w, host, optField)
 		}
+		return fprettyPrintJSONOrField(w, newHostFormat(host), optField)
+	}
+
+	if c.Bool("watch") && isatty.IsTerminal(os.Stdout.Fd()) {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigCh)
 
-		PrettyPrintJSON(format)
+		watcher := &statusWatcher{render: render, title: "mkr status " + argHostID, interval: c.Duration("interval"), now: time.Now}
+		if err := watcher.run(os.Stdout, sigCh, 0); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
 	}
+	logger.DieIf(render(os.Stdout))
 	return nil
 }
 
 func doHosts(c *cli.Context) error {
 	isVerbose := c.Bool("verbose")
+	optField := c.String("field")
+	includeRetired := c.Bool("include-retired")
+	excludeRetired := c.Bool("exclude-retired")
+
+	if includeRetired && excludeRetired {
+		return cli.NewExitError("--include-retired and --exclude-retired cannot be specified at the same time.", 1)
+	}
+
+	output := c.String("output")
+	if output != "json" && output != "jsonl" && output != "table" && output != "markdown" {
+		return cli.NewExitError(fmt.Sprintf("unknown output format: %s", output), 1)
+	}
+	groupBy := c.String("group-by")
+	if groupBy != "" && groupBy != "role" && !strings.HasPrefix(groupBy, groupByMetaPrefix) {
+		return cli.NewExitError(fmt.Sprintf("unknown group-by key: %s", groupBy), 1)
+	}
+	labels, err := parseHostLabels(c.StringSlice("label"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	var filter *hostFilter
+	if s := c.String("filter"); s != "" {
+		if filter, err = parseHostFilter(s); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+	var tmpl *template.Template
+	if s := c.String("template"); s != "" {
+		var err error
+		if tmpl, err = parseItemTemplate(s); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+	if optField != "" {
+		if output != "json" || c.String("format") != "" || tmpl != nil || groupBy != "" || c.Bool("ids-only") {
+			return cli.NewExitError("--field can't be used with outputs other than json, --format, --template, --group-by or --ids-only", 1)
+		}
+		if _, err := parseFieldSelector(optField); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	now := time.Now()
+	var createdSince, createdBefore time.Time
+	if s := c.String("created-since"); s != "" {
+		t, err := parseTimeOrDuration(s, now)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("invalid --created-since: %s", err), 1)
+		}
+		createdSince = t
+	}
+	if s := c.String("created-before"); s != "" {
+		t, err := parseTimeOrDuration(s, now)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("invalid --created-before: %s", err), 1)
+		}
+		createdBefore = t
+	}
+
+	statuses := c.StringSlice("status")
+	if includeRetired && len(statuses) == 0 {
+		statuses = hostStatuses
+	}
 
-	hosts, err := newMackerelFromContext(c).FindHosts(&mkr.FindHostsParam{
+	client := newMackerelFromContext(c)
+	param := &mkr.FindHostsParam{
 		Name:     c.String("name"),
 		Service:  c.String("service"),
 		Roles:    c.StringSlice("role"),
-		Statuses: c.StringSlice("status"),
-	})
+		Statuses: statuses,
+	}
+	// the hosts are requested once, and fields which mackerel-client-go doesn't decode are decoded from the response
+	resp, err := findHostsResponse(client, param)
+	logger.DieIf(err)
+	hosts, err := resp.hosts()
 	logger.DieIf(err)
+	var ipv6Addrs hostIPv6Addresses
+	if c.Bool("ipv6") {
+		ipv6Addrs, err = resp.ipv6Addresses()
+		logger.DieIf(err)
+	}
+	var metas hostMetas
+	if len(labels) > 0 || strings.HasPrefix(groupBy, groupByMetaPrefix) || (filter != nil && filter.usesMeta) {
+		metas, err = resp.metas()
+		logger.DieIf(err)
+	}
+	hosts = filterRetiredHosts(hosts, includeRetired, excludeRetired)
+	hosts = filterHostsByCreatedAt(hosts, createdSince, createdBefore)
+	hosts = filterHostsByLabels(hosts, metas, labels)
+	hosts = filterHostsByFilter(hosts, metas, filter)
 
 	format := c.String("format")
-	if format != "" {
-		t := template.Must(template.New("format").Parse(format))
-		err := t.Execute(os.Stdout, hosts)
-		logger.DieIf(err)
-	} else if isVerbose {
-		PrettyPrintJSON(hosts)
-	} else {
-		var hostsFormat []*HostFormat
-		for _, host := range hosts {
-			format := &HostFormat{
-				ID:            host.ID,
-				Name:          host.Name,
-				DisplayName:   host.DisplayName,
-				Status:        host.Status,
-				RoleFullnames: host.GetRoleFullnames(),
-				IsRetired:     host.IsRetired,
-				CreatedAt:     host.DateStringFromCreatedAt(),
-				IPAddresses:   host.IPAddresses(),
+	logger.DieIf(writeOutput(c.String("out"), func(w io.Writer) error {
+		if c.Bool("ids-only") {
+			printHostIDs(w, hosts)
+		} else if tmpl != nil {
+			return renderItems(w, tmpl, hosts)
+		} else if groupBy != "" {
+			var groups hostGroups
+			if groupBy == "role" {
+				groups = groupHostsByRole(hosts)
+			} else {
+				groups = groupHostsByMeta(hosts, metas, strings.TrimPrefix(groupBy, groupByMetaPrefix))
+			}
+			// the grouped output is human-readable unless json is specified explicitly
+			if c.IsSet("output") && output == "json" {
+				fprettyPrintJSON(w, groups.byKey())
+			} else {
+				printHostGroups(w, groups)
+			}
+		} else if output == "table" {
+			printHostsTable(w, hosts, ipv6Addrs)
+		} else if output == "markdown" {
+			header, rows := hostsTableRows(hosts, ipv6Addrs)
+			fprintMarkdownTable(w, header, rows)
+		} else if format != "" {
+			t := template.Must(template.New("format").Parse(format))
+			return t.Execute(w, hosts)
+		} else if isVerbose {
+			if output == "jsonl" {
+				return fprintJSONLines(w, hosts)
 			}
-			hostsFormat = append(hostsFormat, format)
+			return fprettyPrintJSONOrField(w, hosts, optField)
+		} else {
+			var hostsFormat []*HostFormat
+			for _, host := range hosts {
+				hostFormat := newHostFormat(host)
+				hostFormat.IPv6Addresses = ipv6Addrs[host.ID]
+				hostsFormat = append(hostsFormat, hostFormat)
+			}
+			if output == "jsonl" {
+				return fprintJSONLines(w, hostsFormat)
+			}
+			return fprettyPrintJSONOrField(w, hostsFormat, optField)
 		}
+		return nil
+	}))
+	return nil
+}
 
-		PrettyPrintJSON(hostsFormat)
+// filterRetiredHosts filters out retired hosts unless includeRetired,
+// and also poweroff hosts if excludeRetired.
+func filterRetiredHosts(hosts []*mkr.Host, includeRetired, excludeRetired bool) []*mkr.Host {
+	if includeRetired {
+		return hosts
+	}
+	filtered := make([]*mkr.Host, 0, len(hosts))
+	for _, host := range hosts {
+		if host.IsRetired || (excludeRetired && host.Status == "poweroff") {
+			continue
+		}
+		filtered = append(filtered, host)
+	}
+	return filtered
+}
+
+// filterHostsByCreatedAt filters hosts created in [since, before).
+// A zero time means the range is unbounded on the side.
+func filterHostsByCreatedAt(hosts []*mkr.Host, since, before time.Time) []*mkr.Host {
+	filtered := make([]*mkr.Host, 0, len(hosts))
+	for _, host := range hosts {
+		createdAt := time.Unix(int64(host.CreatedAt), 0)
+		if !since.IsZero() && createdAt.Before(since) {
+			continue
+		}
+		if !before.IsZero() && !createdAt.Before(before) {
+			continue
+		}
+		filtered = append(filtered, host)
+	}
+	return filtered
+}
+
+// hostsTableRows returns the header and rows of the hosts table. The IPv6 column is added if ipv6Addrs is not nil.
+func hostsTableRows(hosts []*mkr.Host, ipv6Addrs hostIPv6Addresses) ([]string, [][]string) {
+	header := []string{"ID", "NAME", "STATUS", "ROLES", "CREATED AT"}
+	if ipv6Addrs != nil {
+		header = append(header, "IPV6 ADDRESSES")
+	}
+	rows := make([][]string, 0, len(hosts))
+	for _, host := range hosts {
+		row := []string{
+			host.ID, host.Name, host.Status, strings.Join(host.GetRoleFullnames(), ","),
+			outputTimeFormat.human(time.Unix(int64(host.CreatedAt), 0), hostCreatedAtLayout),
+		}
+		if ipv6Addrs != nil {
+			row = append(row, ipv6Addrs.joined(host.ID))
+		}
+		rows = append(rows, row)
+	}
+	return header, rows
+}
+
+// printHostsTable prints hosts as a table. The IPv6 column is added if ipv6Addrs is not nil.
+func printHostsTable(w io.Writer, hosts []*mkr.Host, ipv6Addrs hostIPv6Addresses) {
+	header, rows := hostsTableRows(hosts, ipv6Addrs)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+}
+
+// hostGroup is hosts which have the same key, such as a role
+type hostGroup struct {
+	key   string
+	hosts []*mkr.Host
+}
+
+type hostGroups []*hostGroup
+
+// groupHosts groups hosts by keys of each host, and sorts groups by the keys.
+// A host having multiple keys appears in each group.
+func groupHosts(hosts []*mkr.Host, keysOf func(*mkr.Host) []string) hostGroups {
+	groups := map[string]*hostGroup{}
+	for _, host := range hosts {
+		for _, key := range keysOf(host) {
+			if _, ok := groups[key]; !ok {
+				groups[key] = &hostGroup{key: key}
+			}
+			groups[key].hosts = append(groups[key].hosts, host)
+		}
+	}
+
+	result := make(hostGroups, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].key < result[j].key
+	})
+	return result
+}
+
+// groupHostsByRole groups hosts by their roles. A host belonging to multiple roles appears in each role.
+func groupHostsByRole(hosts []*mkr.Host) hostGroups {
+	return groupHosts(hosts, func(host *mkr.Host) []string {
+		if roleFullnames := host.GetRoleFullnames(); len(roleFullnames) > 0 {
+			return roleFullnames
+		}
+		return []string{noRoleName}
+	})
+}
+
+func (groups hostGroups) byKey() map[string][]*HostFormat {
+	m := make(map[string][]*HostFormat, len(groups))
+	for _, g := range groups {
+		hostsFormat := make([]*HostFormat, 0, len(g.hosts))
+		for _, host := range g.hosts {
+			hostsFormat = append(hostsFormat, newHostFormat(host))
+		}
+		m[g.key] = hostsFormat
+	}
+	return m
+}
+
+func printHostGroups(w io.Writer, groups hostGroups) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, g := range groups {
+		fmt.Fprintf(tw, "%s (%d)\n", g.key, len(g.hosts))
+		for _, host := range g.hosts {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", host.ID, host.Name, host.Status)
+		}
+	}
+	tw.Flush()
+}
+
+func printHostIDs(w io.Writer, hosts []*mkr.Host) {
+	for _, host := range hosts {
+		fmt.Fprintln(w, host.ID)
 	}
-	return nil
 }
 
 func doCreate(c *cli.Context) error {
@@ -318,6 +841,15 @@ func doCreate(c *cli.Context) error {
 		cli.ShowCommandHelp(c, "create")
 		os.Exit(1)
 	}
+	idOnly := c.Bool("id-only")
+	output := c.String("output")
+	if output != "" && output != "json" {
+		return cli.NewExitError(fmt.Sprintf("unknown output format: %s", output), 1)
+	}
+	if idOnly || output != "" {
+		// informational messages are suppressed not to be mixed with the output for scripts
+		logger.SetLevel(logger.LevelQuiet)
+	}
 
 	client := newMackerelFromContext(c)
 
@@ -335,17 +867,41 @@ func doCreate(c *cli.Context) error {
 		logger.DieIf(err)
 		logger.Log("updated", fmt.Sprintf("%s %s", hostID, optStatus))
 	}
+	logger.DieIf(printCreatedHost(os.Stdout, client, hostID, idOnly, output))
+	return nil
+}
+
+// printCreatedHost outputs only the ID of the created host if idOnly, or the host in JSON if output is "json"
+func printCreatedHost(w io.Writer, client *mkr.Client, hostID string, idOnly bool, output string) error {
+	if idOnly {
+		_, err := fmt.Fprintln(w, hostID)
+		return err
+	}
+	if output == "json" {
+		host, err := client.FindHost(hostID)
+		if err != nil {
+			return err
+		}
+		fprettyPrintJSON(w, host)
+	}
 	return nil
 }
 
 func doUpdate(c *cli.Context) error {
 	confFile := c.GlobalString("conf")
-	argHostIDs := c.Args()
+	argHostIDs, err := readIDsFromArgs(c.Args(), os.Stdin, hostIDOfLine)
+	logger.DieIf(err)
 	optName := c.String("name")
 	optDisplayName := c.String("displayName")
 	optStatus := c.String("status")
 	optRoleFullnames := c.StringSlice("roleFullname")
 	overwriteRoles := c.Bool("overwriteRoles")
+	retries := c.Int("retry-on-conflict")
+	force := c.Bool("force")
+	output := c.String("output")
+	if output != "" && output != "json" {
+		return cli.NewExitError(fmt.Sprintf("unknown output format: %s", output), 1)
+	}
 
 	if len(argHostIDs) < 1 {
 		argHostIDs = make([]string, 1)
@@ -355,6 +911,12 @@ func doUpdate(c *cli.Context) error {
 		}
 	}
 
+	if c.IsSet("name") && optName == "" {
+		logger.Log("update", "the new host name should not be empty.")
+		cli.ShowCommandHelp(c, "update")
+		os.Exit(1)
+	}
+
 	needUpdateHostStatus := optStatus != ""
 	needUpdateRolesInHostUpdate := !overwriteRoles && len(optRoleFullnames) > 0
 	needUpdateHost := (optName != "" || optDisplayName != "" || overwriteRoles || needUpdateRolesInHostUpdate)
@@ -367,112 +929,509 @@ func doUpdate(c *cli.Context) error {
 
 	client := newMackerelFromContext(c)
 
-	for _, hostID := range argHostIDs {
-		if needUpdateHostStatus {
-			err := client.UpdateHostStatus(hostID, optStatus)
-			logger.DieIf(err)
-		}
+	// updateOne updates the host, and returns whether it is changed
+	updateOne := func(hostID string) (bool, error) {
+		changed := false
 
-		if overwriteRoles {
-			err := client.UpdateHostRoleFullnames(hostID, optRoleFullnames)
-			logger.DieIf(err)
+		var host *mkr.Host
+		if !force && (needUpdateHostStatus || overwriteRoles) {
+			var err error
+			if host, err = client.FindHost(hostID); err != nil {
+				return false, err
+			}
 		}
 
-		if needUpdateHost {
-			host, err := client.FindHost(hostID)
-			logger.DieIf(err)
-			meta := host.Meta
-			name := ""
-			if optName == "" {
-				name = host.Name
-			} else {
-				name = optName
+		if needUpdateHostStatus && (host == nil || host.Status != optStatus) {
+			if err := validateHostStatusTransition(host, optStatus); err != nil {
+				return false, err
 			}
-			displayname := ""
-			if optDisplayName == "" {
-				displayname = host.DisplayName
-			} else {
-				displayname = optDisplayName
+			err := retryOnConflict(retries, func() error {
+				return client.UpdateHostStatus(hostID, optStatus)
+			})
+			if err != nil {
+				return changed, err
 			}
-			param := &mkr.UpdateHostParam{
-				Name:        name,
-				DisplayName: displayname,
-				Meta:        meta,
+			changed = true
+		}
+
+		if overwriteRoles && (host == nil || !sameStringSet(host.GetRoleFullnames(), optRoleFullnames)) {
+			err := retryOnConflict(retries, func() error {
+				return client.UpdateHostRoleFullnames(hostID, optRoleFullnames)
+			})
+			if err != nil {
+				return changed, err
 			}
+			changed = true
+		}
+
+		if needUpdateHost {
+			var roleFullnames []string
 			if needUpdateRolesInHostUpdate {
-				param.RoleFullnames = optRoleFullnames
+				roleFullnames = optRoleFullnames
+			}
+			err := retryOnConflict(retries, func() error {
+				updated, err := updateHostInfo(client, hostID, optName, optDisplayName, roleFullnames, force)
+				changed = changed || updated
+				return err
+			})
+			if err != nil {
+				return changed, err
 			}
-			_, err = client.UpdateHost(hostID, param)
-			logger.DieIf(err)
 		}
+		return changed, nil
+	}
+
+	if output == "json" {
+		report := newBatchReport()
+		for _, hostID := range argHostIDs {
+			changed, err := updateOne(hostID)
+			action := "update"
+			if err == nil && !changed {
+				action = "skip"
+			}
+			report.add(hostID, action, err)
+		}
+		report.print(os.Stdout)
+		if report.Summary.Failed > 0 {
+			os.Exit(1)
+		}
+		return nil
+	}
 
-		logger.Log("updated", hostID)
+	for _, hostID := range argHostIDs {
+		changed, err := updateOne(hostID)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("%s: %s", hostID, err), 1)
+		}
+		if changed {
+			logger.Log("updated", hostID)
+		} else {
+			logger.Log("", fmt.Sprintf("%s: no change", hostID))
+		}
 	}
 	return nil
 }
 
-func doThrow(c *cli.Context) error {
-	optHostID := c.String("host")
-	optService := c.String("service")
+// updateHostInfo fetches the current host and applies the changes to it, and returns whether the host is updated.
+// The host is fetched every time so that the changes can be reapplied on retries.
+// The update is skipped if it changes nothing, unless force is true.
+func updateHostInfo(client *mkr.Client, hostID, optName, optDisplayName string, roleFullnames []string, force bool) (bool, error) {
+	host, err := client.FindHost(hostID)
+	if err != nil {
+		return false, err
+	}
+	param := buildUpdateHostParam(host, optName, optDisplayName)
+	if len(roleFullnames) > 0 {
+		param.RoleFullnames = roleFullnames
+	}
+	if !force && !hostInfoChanged(host, param) {
+		return false, nil
+	}
+	_, err = client.UpdateHost(hostID, param)
+	return err == nil, err
+}
 
-	var metricValues []*(mkr.MetricValue)
+// hostInfoChanged returns whether updating the host with param changes the name, displayName or roles.
+// Roles in param are added to the current roles, so they are unchanged if the host already has them all.
+func hostInfoChanged(host *mkr.Host, param *mkr.UpdateHostParam) bool {
+	if host.Name != param.Name || host.DisplayName != param.DisplayName {
+		return true
+	}
+	current := host.GetRoleFullnames()
+	for _, roleFullname := range param.RoleFullnames {
+		if !containsString(current, roleFullname) {
+			return true
+		}
+	}
+	return false
+}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		line := scanner.Text()
+func sameStringSet(xs, ys []string) bool {
+	for _, x := range xs {
+		if !containsString(ys, x) {
+			return false
+		}
+	}
+	for _, y := range ys {
+		if !containsString(xs, y) {
+			return false
+		}
+	}
+	return true
+}
 
-		// name, value, timestamp
-		// ex.) tcp.CLOSING 0 1397031808
-		items := strings.Fields(line)
-		if len(items) != 3 {
-			continue
+// the interval between retries on 409 Conflict, replaced in tests
+var conflictRetryInterval = 500 * time.Millisecond
+
+// retryOnConflict calls fn and retries it up to `retries` times while the API responds 409 Conflict.
+func retryOnConflict(retries int, fn func() error) error {
+	for i := 0; ; i++ {
+		err := fn()
+		if apiErr, ok := err.(*mkr.APIError); !ok || apiErr.StatusCode != http.StatusConflict || i >= retries {
+			return err
 		}
-		value, err := strconv.ParseFloat(items[1], 64)
-		if err != nil {
-			logger.Log("warning", fmt.Sprintf("Failed to parse values: %s", err))
-			continue
+		logger.Log("warning", fmt.Sprintf("conflicted, retrying (%d/%d): %s", i+1, retries, err))
+		time.Sleep(conflictRetryInterval)
+	}
+}
+
+// buildUpdateHostParam builds the parameter to update the host,
+// keeping current values except for the name and displayName to be changed.
+func buildUpdateHostParam(host *mkr.Host, optName, optDisplayName string) *mkr.UpdateHostParam {
+	name := host.Name
+	if optName != "" {
+		name = optName
+	}
+	displayName := host.DisplayName
+	if optDisplayName != "" {
+		displayName = optDisplayName
+	}
+	return &mkr.UpdateHostParam{
+		Name:        name,
+		DisplayName: displayName,
+		Meta:        host.Meta,
+		Interfaces:  host.Interfaces,
+	}
+}
+
+func doThrow(c *cli.Context) error {
+	optHostID := c.String("host")
+	optService := c.String("service")
+
+	if c.Bool("local") {
+		if optHostID != "" || c.String("host-name") != "" {
+			return cli.NewExitError("--local can't be used with --host or --host-name", 1)
 		}
-		time, err := strconv.ParseInt(items[2], 10, 64)
+		hostID, err := LoadLocalHostID(c.GlobalString("conf"), c.String("id-file"))
 		if err != nil {
-			logger.Log("warning", fmt.Sprintf("Failed to parse values: %s", err))
-			continue
+			return cli.NewExitError(err.Error(), 1)
 		}
+		optHostID = hostID
+	}
 
-		name := items[0]
-		if optHostID != "" && !strings.HasPrefix(name, "custom.") {
-			name = "custom." + name
+	optAggregate := c.String("aggregate")
+	if optAggregate != "" {
+		if _, ok := metricAggregators[optAggregate]; !ok {
+			return cli.NewExitError(fmt.Sprintf("unknown aggregate function: %s (%s)", optAggregate, strings.Join(metricAggregatorNames(), ", ")), 1)
 		}
+		if optHostID != "" || c.String("host-name") != "" || c.Bool("local") || optService == "" || c.String("name") == "" {
+			return cli.NewExitError("--aggregate requires --service and --name, and can't be used for host metrics", 1)
+		}
+	}
 
-		metricValue := &mkr.MetricValue{
-			Name:  name,
-			Value: value,
-			Time:  time,
+	optPrefix := c.String("prefix")
+	if optPrefix != "" {
+		if err := validateMetricNamePrefix(optPrefix); err != nil {
+			return cli.NewExitError(err.Error(), 1)
 		}
+	}
 
-		metricValues = append(metricValues, metricValue)
+	if c.Bool("rate") && c.String("state-file") == "" {
+		return cli.NewExitError("--state-file is required with --rate", 1)
+	}
+
+	if c.Bool("dry-run") {
+		var rate *rateConverter
+		if c.Bool("rate") {
+			if optHostID == "" && c.String("host-name") != "" {
+				return cli.NewExitError("--dry-run with --rate requires --host or --service, since the host ID is needed to read --state-file", 1)
+			}
+			target := optHostID
+			if target == "" {
+				target = optService
+			}
+			var err error
+			rate, err = newRateConverter(c.String("state-file"), target, c.String("on-reset"))
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+		}
+		return throwDryRun(os.Stdin, os.Stdout, os.Stderr, optHostID != "" || c.String("host-name") != "", optPrefix, rate)
 	}
-	logger.ErrorIf(scanner.Err())
 
 	client := newMackerelFromContext(c)
 
-	if optHostID != "" {
-		err := client.PostHostMetricValuesByHostID(optHostID, metricValues)
+	if optHostName := c.String("host-name"); optHostName != "" && optHostID == "" {
+		hostID, err := newHostIDResolver(client).resolve(optHostName)
 		logger.DieIf(err)
+		optHostID = hostID
+	}
 
-		for _, metric := range metricValues {
-			logger.Log("thrown", fmt.Sprintf("%s '%s\t%f\t%d'", optHostID, metric.Name, metric.Value, metric.Time))
+	var target string
+	var post func([]*mkr.MetricValue) error
+	if optHostID != "" {
+		target = optHostID
+		post = func(metricValues []*mkr.MetricValue) error {
+			return client.PostHostMetricValuesByHostID(optHostID, metricValues)
 		}
 	} else if optService != "" {
-		err := client.PostServiceMetricValues(optService, metricValues)
-		logger.DieIf(err)
-
-		for _, metric := range metricValues {
-			logger.Log("thrown", fmt.Sprintf("%s '%s\t%f\t%d'", optService, metric.Name, metric.Value, metric.Time))
+		target = optService
+		post = func(metricValues []*mkr.MetricValue) error {
+			return client.PostServiceMetricValues(optService, metricValues)
 		}
 	} else {
 		cli.ShowCommandHelp(c, "throw")
 		os.Exit(1)
 	}
+	if c.Bool("gzip") {
+		uncompressed := post
+		post = func(metricValues []*mkr.MetricValue) error {
+			return postMetricValuesGzip(client, optHostID, optService, metricValues, uncompressed)
+		}
+	}
+	var rate *rateConverter
+	if c.Bool("rate") {
+		var err error
+		rate, err = newRateConverter(c.String("state-file"), target, c.String("on-reset"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+	postAndLog := func(metricValues []*mkr.MetricValue) error {
+		if optPrefix != "" {
+			metricValues = prefixMetricValues(metricValues, optPrefix)
+			if len(metricValues) == 0 {
+				return nil
+			}
+		}
+		if rate != nil {
+			// the state is saved only after the values are posted, not to lose the values failed to be posted
+			var points map[string]*ratePoint
+			metricValues, points = rate.convert(metricValues)
+			if len(metricValues) > 0 {
+				if err := post(metricValues); err != nil {
+					return err
+				}
+			}
+			rate.advance(points)
+			logger.ErrorIf(rate.save())
+		} else if err := post(metricValues); err != nil {
+			return err
+		}
+		for _, metric := range metricValues {
+			logger.Log("thrown", fmt.Sprintf("%s '%s\t%f\t%d'", target, metric.Name, metric.Value, metric.Time))
+		}
+		return nil
+	}
+
+	if optAggregate != "" {
+		metricValue, err := fetchAndAggregateMetric(client, optService, c.StringSlice("role"), c.String("name"), optAggregate)
+		logger.DieIf(err)
+		logger.DieIf(postAndLog([]*mkr.MetricValue{metricValue}))
+		return nil
+	}
+
+	if optName := c.String("name"); optName != "" {
+		metricValue, err := metricValueFromFlags(optName, c.String("value"), c.String("time"), optHostID != "", time.Now())
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		logger.DieIf(postAndLog([]*mkr.MetricValue{metricValue}))
+		return nil
+	}
+
+	if optFollow := c.String("follow"); c.Bool("stream") || optFollow != "" {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGTERM, os.Interrupt)
+		defer signal.Stop(sigCh)
+
+		var r io.Reader = os.Stdin
+		if optFollow != "" {
+			follower, err := newFileFollower(optFollow, time.Second, nil)
+			logger.DieIf(err)
+			defer follower.Close()
+			r = follower
+		}
+		streamer := &metricStreamer{
+			post:          postAndLog,
+			flushInterval: c.Duration("flush-interval"),
+			batchSize:     c.Int("batch-size"),
+			hostMetric:    optHostID != "",
+			maxBuffered:   streamMaxBuffered,
+		}
+		logger.DieIf(streamer.run(r, sigCh))
+		return nil
+	}
+
+	var metricValues []*(mkr.MetricValue)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		metricValue, err := parseMetricLine(scanner.Text(), optHostID != "")
+		if err != nil {
+			warnMalformedMetricLine(err)
+			continue
+		}
+		if metricValue != nil {
+			metricValues = append(metricValues, metricValue)
+		}
+	}
+	logger.ErrorIf(scanner.Err())
+
+	logger.DieIf(postInChunks(postAndLog, metricValues, c.Int("chunk-size"), c.Bool("continue-on-error")))
+	return nil
+}
+
+// hostIDResolver resolves host names to IDs, caching results within an invocation
+type hostIDResolver struct {
+	client *mkr.Client
+	cache  map[string]string
+}
+
+func newHostIDResolver(client *mkr.Client) *hostIDResolver {
+	return &hostIDResolver{client: client, cache: map[string]string{}}
+}
+
+// resolve returns the ID of the host named `name`, and raises an error if no or multiple hosts have the name.
+func (r *hostIDResolver) resolve(name string) (string, error) {
+	if hostID, ok := r.cache[name]; ok {
+		return hostID, nil
+	}
+	hosts, err := r.client.FindHosts(&mkr.FindHostsParam{Name: name})
+	if err != nil {
+		return "", err
+	}
+	switch len(hosts) {
+	case 0:
+		return "", fmt.Errorf("host named '%s' is not found", name)
+	case 1:
+		r.cache[name] = hosts[0].ID
+		return hosts[0].ID, nil
+	}
+	var hostIDs []string
+	for _, host := range hosts {
+		hostIDs = append(hostIDs, host.ID)
+	}
+	return "", fmt.Errorf("host name '%s' is ambiguous: %s", name, strings.Join(hostIDs, ", "))
+}
+
+var errMetricLineFields = fmt.Errorf("a metric line should consist of name, value and timestamp")
+
+// parseMetricLine parses a line of metric value. nil is returned for a blank line.
+// The name of a host metric is prefixed by "custom." if it isn't.
+func parseMetricLine(line string, hostMetric bool) (*mkr.MetricValue, error) {
+	// name, value, timestamp
+	// ex.) tcp.CLOSING 0 1397031808
+	items := strings.Fields(line)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	if len(items) != 3 {
+		return nil, errMetricLineFields
+	}
+	value, err := strconv.ParseFloat(items[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse values: %s", err)
+	}
+	epoch, err := parseMetricTime(items[2], time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse values: %s", err)
+	}
+
+	name := items[0]
+	if hostMetric && !strings.HasPrefix(name, "custom.") {
+		name = "custom." + name
+	}
+
+	return &mkr.MetricValue{
+		Name:  name,
+		Value: value,
+		Time:  epoch,
+	}, nil
+}
+
+// parseMetricTime parses the time of a metric value into epoch seconds.
+// It accepts epoch seconds, RFC3339, "now" and offsets from now with the sign (e.g. "-5m" or "+1h").
+func parseMetricTime(s string, now time.Time) (int64, error) {
+	if s == "now" {
+		return now.Unix(), nil
+	}
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time offset: %q", s)
+		}
+		return now.Add(d).Unix(), nil
+	}
+	if epoch, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return epoch, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: %q (it should be epoch seconds, RFC3339, 'now' or an offset like '-5m')", s)
+	}
+	return t.Unix(), nil
+}
+
+// metricValueFromFlags builds a metric value from flags of throw.
+// t is in a format of parseMetricTime, and now is used if t is empty.
+func metricValueFromFlags(name, value, t string, hostMetric bool, now time.Time) (*mkr.MetricValue, error) {
+	if value == "" {
+		return nil, fmt.Errorf("--value is required with --name")
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --value: %s", value)
+	}
+
+	epoch := now.Unix()
+	if t != "" {
+		if epoch, err = parseMetricTime(t, now); err != nil {
+			return nil, fmt.Errorf("invalid --time: %s", err)
+		}
+	}
+
+	if hostMetric && !strings.HasPrefix(name, "custom.") {
+		name = "custom." + name
+	}
+	return &mkr.MetricValue{Name: name, Value: v, Time: epoch}, nil
+}
+
+// warnMalformedMetricLine logs the error of parseMetricLine.
+// Lines without 3 fields are ignored silently as ever.
+func warnMalformedMetricLine(err error) {
+	if err != errMetricLineFields {
+		logger.Log("warning", err.Error())
+	}
+}
+
+// throwDryRun outputs metric values parsed from r to w without posting them,
+// and reports malformed lines to errW. Names are prefixed by prefix unless it's empty,
+// and values are converted to rates if rate is not nil.
+func throwDryRun(r io.Reader, w, errW io.Writer, hostMetric bool, prefix string, rate *rateConverter) error {
+	malformed := 0
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		metricValue, err := parseMetricLine(line, hostMetric)
+		if err == nil && metricValue != nil && prefix != "" {
+			metricValue.Name, err = prefixMetricName(metricValue.Name, prefix)
+		}
+		if err != nil {
+			malformed++
+			fmt.Fprintf(errW, "line %d: %s: %q\n", lineNo, err, line)
+			continue
+		}
+		if metricValue == nil {
+			continue
+		}
+		metricValues := []*mkr.MetricValue{metricValue}
+		if rate != nil {
+			// the state file is read but never written
+			var points map[string]*ratePoint
+			metricValues, points = rate.convert(metricValues)
+			rate.advance(points)
+		}
+		for _, v := range metricValues {
+			fmt.Fprintf(w, "%s\t%v\t%d\n", v.Name, v.Value, v.Time)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if malformed > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d malformed lines found", malformed), 1)
+	}
 	return nil
 }
 
@@ -500,20 +1459,24 @@ func doMetrics(c *cli.Context) error {
 
 	client := newMackerelFromContext(c)
 
+	var metricValue []mkr.MetricValue
+	var err error
 	if optHostID != "" {
-		metricValue, err := client.FetchHostMetricValues(optHostID, optMetricName, from, to)
+		metricValue, err = client.FetchHostMetricValues(optHostID, optMetricName, from, to)
 		logger.DieIf(err)
-
-		PrettyPrintJSON(metricValue)
 	} else if optService != "" {
-		metricValue, err := client.FetchServiceMetricValues(optService, optMetricName, from, to)
+		metricValue, err = client.FetchServiceMetricValues(optService, optMetricName, from, to)
 		logger.DieIf(err)
-
-		PrettyPrintJSON(metricValue)
 	} else {
 		cli.ShowCommandHelp(c, "metrics")
 		os.Exit(1)
 	}
+
+	if c.Bool("sparkline") && terminalSupportsUnicode() {
+		fmt.Println(formatSparkline(metricValue))
+	} else {
+		PrettyPrintJSON(metricValue)
+	}
 	return nil
 }
 
@@ -521,29 +1484,163 @@ func doFetch(c *cli.Context) error {
 	argHostIDs := c.Args()
 	optMetricNames := c.StringSlice("name")
 
+	if optService := c.String("service"); optService != "" {
+		if len(optMetricNames) != 1 {
+			cli.ShowCommandHelp(c, "fetch")
+			os.Exit(1)
+		}
+		return doFetchServiceMetricValues(c, optService, optMetricNames[0])
+	}
+
 	if len(argHostIDs) < 1 || len(optMetricNames) < 1 {
 		cli.ShowCommandHelp(c, "fetch")
 		os.Exit(1)
 	}
 
+	client := newMackerelFromContext(c)
+	var progress io.Writer
+	if isatty.IsTerminal(os.Stderr.Fd()) {
+		progress = os.Stderr
+	}
+	fetcher := &latestMetricValuesFetcher{
+		fetch:       client.FetchLatestMetricValues,
+		chunkSize:   fetchChunkSize,
+		concurrency: c.Int("concurrency"),
+		progress:    progress,
+	}
+	allMetricValues, errs := fetcher.run(argHostIDs, optMetricNames)
+
+	PrettyPrintJSON(allMetricValues)
+	if len(errs) > 0 {
+		for _, hostID := range argHostIDs {
+			if err, ok := errs[hostID]; ok {
+				logger.Log("error", fmt.Sprintf("%s: %s", hostID, err))
+			}
+		}
+		return cli.NewExitError(fmt.Sprintf("failed to fetch metric values of %d hosts", len(errs)), 1)
+	}
+	return nil
+}
+
+// Fetches 100 hosts per one request (to avoid URL maximum length).
+const fetchChunkSize = 100
+
+// latestMetricValuesFetcher fetches latest metric values of hosts by chunks with bounded concurrency
+type latestMetricValuesFetcher struct {
+	fetch       func(hostIDs []string, metricNames []string) (mkr.LatestMetricValues, error)
+	chunkSize   int
+	concurrency int
+	// the progress is written if not nil
+	progress io.Writer
+}
+
+// run returns metric values of all hosts, and errors of hosts whose requests failed
+func (f *latestMetricValuesFetcher) run(hostIDs []string, metricNames []string) (mkr.LatestMetricValues, map[string]error) {
+	concurrency := f.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	chunks := split(hostIDs, f.chunkSize)
+	type chunkResult struct {
+		metricValues mkr.LatestMetricValues
+		err          error
+	}
+	results := make([]chunkResult, len(chunks))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	fetched := 0
+	sem := make(chan struct{}, concurrency)
+	for i, chunk := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, chunk []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			metricValues, err := f.fetch(chunk, metricNames)
+			results[i] = chunkResult{metricValues, err}
+
+			mu.Lock()
+			defer mu.Unlock()
+			fetched += len(chunk)
+			if f.progress != nil {
+				fmt.Fprintf(f.progress, "\rFetched %d/%d hosts", fetched, len(hostIDs))
+			}
+		}(i, chunk)
+	}
+	wg.Wait()
+	if f.progress != nil && len(chunks) > 0 {
+		fmt.Fprintln(f.progress)
+	}
+
 	allMetricValues := make(mkr.LatestMetricValues)
-	// Fetches 100 hosts per one request (to avoid URL maximum length).
-	for _, hostIds := range split(argHostIDs, 100) {
-		metricValues, err := newMackerelFromContext(c).FetchLatestMetricValues(hostIds, optMetricNames)
-		logger.DieIf(err)
-		for key := range metricValues {
-			allMetricValues[key] = metricValues[key]
+	errs := map[string]error{}
+	for i, result := range results {
+		if result.err != nil {
+			for _, hostID := range chunks[i] {
+				errs[hostID] = result.err
+			}
+			continue
+		}
+		for key := range result.metricValues {
+			allMetricValues[key] = result.metricValues[key]
 		}
 	}
+	return allMetricValues, errs
+}
 
-	PrettyPrintJSON(allMetricValues)
+// the default period of fetched service metric values
+const defaultFetchPeriod = time.Hour
+
+func doFetchServiceMetricValues(c *cli.Context, service, name string) error {
+	output := c.String("output")
+	if output != "tsv" && output != "json" {
+		return cli.NewExitError(fmt.Sprintf("unknown output format: %s", output), 1)
+	}
+
+	from, to := fetchPeriod(c.Int64("from"), c.Int64("to"), time.Now())
+	metricValues, err := newMackerelFromContext(c).FetchServiceMetricValues(service, name, from, to)
+	logger.DieIf(err)
+
+	if output == "json" {
+		PrettyPrintJSON(metricValues)
+	} else {
+		printMetricValuesTSV(os.Stdout, metricValues)
+	}
 	return nil
 }
 
+// fetchPeriod fills zero values of from and to with the default period until now
+func fetchPeriod(from, to int64, now time.Time) (int64, int64) {
+	if to == 0 {
+		to = now.Unix()
+	}
+	if from == 0 {
+		from = to - int64(defaultFetchPeriod/time.Second)
+	}
+	return from, to
+}
+
+// printMetricValuesTSV prints metric values as "time<TAB>value" lines
+func printMetricValuesTSV(w io.Writer, metricValues []mkr.MetricValue) {
+	for _, v := range metricValues {
+		fmt.Fprintf(w, "%d\t%v\n", v.Time, v.Value)
+	}
+}
+
 func doRetire(c *cli.Context) error {
 	confFile := c.GlobalString("conf")
 	force := c.Bool("force")
-	argHostIDs := c.Args()
+	retries := c.Int("retry-on-conflict")
+	if containsString(c.Args(), "-") && !force {
+		return cli.NewExitError("--force is required to read host IDs from stdin, which can't be used for the confirmation.", 1)
+	}
+	output := c.String("output")
+	if output != "" && output != "json" {
+		return cli.NewExitError(fmt.Sprintf("unknown output format: %s", output), 1)
+	}
+	argHostIDs, err := readIDsFromArgs(c.Args(), os.Stdin, hostIDOfLine)
+	logger.DieIf(err)
 
 	if len(argHostIDs) < 1 {
 		argHostIDs = make([]string, 1)
@@ -559,19 +1656,129 @@ func doRetire(c *cli.Context) error {
 	}
 
 	client := newMackerelFromContext(c)
+	if output == "json" {
+		// the report is the only output of -o json, and the results of hosts are in it instead of logs
+		logger.SetLevel(logger.LevelQuiet)
+		report := newBatchReport()
+		if c.Bool("poweroff-first") {
+			report, argHostIDs = poweroffHostsReporting(client, argHostIDs, c.Duration("grace-period"), retries, c.Bool("ignore-missing"))
+		}
+		report.merge(retireHostsReporting(client, argHostIDs, retries, c.Bool("ignore-missing")))
+		report.print(os.Stdout)
+		if report.Summary.Failed > 0 {
+			os.Exit(1)
+		}
+		return nil
+	}
+	if c.Bool("poweroff-first") {
+		logger.DieIf(poweroffHostsBeforeRetirement(client, argHostIDs, c.Duration("grace-period"), retries, c.Bool("ignore-missing")))
+	}
+	logger.DieIf(retireHosts(client, argHostIDs, retries, c.Bool("ignore-missing")))
+	return nil
+}
 
-	for _, hostID := range argHostIDs {
-		err := client.RetireHost(hostID)
-		logger.DieIf(err)
+// sleep for the grace period, which is replaced in tests
+var sleepGracePeriod = time.Sleep
+
+// poweroffHostsBeforeRetirement sets hosts to poweroff, and waits for the grace period.
+// If ignoreMissing is true, hosts which are not found are skipped as retireHosts does.
+func poweroffHostsBeforeRetirement(client *mkr.Client, hostIDs []string, gracePeriod time.Duration, retries int, ignoreMissing bool) error {
+	for _, hostID := range hostIDs {
+		skipped, err := poweroffHost(client, hostID, retries, ignoreMissing)
+		if err != nil {
+			return err
+		}
+		if skipped {
+			logger.Log("warning", fmt.Sprintf("%s is not found, skipped", hostID))
+			continue
+		}
+		logger.Log("updated", fmt.Sprintf("%s poweroff", hostID))
+	}
+	if gracePeriod > 0 {
+		logger.Log("", fmt.Sprintf("waiting %s before retirement", gracePeriod))
+		sleepGracePeriod(gracePeriod)
+	}
+	return nil
+}
+
+// poweroffHostsReporting sets all hosts to poweroff even if some of them fail, and waits for the grace period.
+// It reports the hosts failed to be powered off, and returns the other hosts to be retired.
+func poweroffHostsReporting(client *mkr.Client, hostIDs []string, gracePeriod time.Duration, retries int, ignoreMissing bool) (*batchReport, []string) {
+	report := newBatchReport()
+	var poweredOff []string
+	for _, hostID := range hostIDs {
+		if _, err := poweroffHost(client, hostID, retries, ignoreMissing); err != nil {
+			report.add(hostID, "poweroff", err)
+			continue
+		}
+		poweredOff = append(poweredOff, hostID)
+	}
+	if gracePeriod > 0 && len(poweredOff) > 0 {
+		sleepGracePeriod(gracePeriod)
+	}
+	return report, poweredOff
+}
+
+// poweroffHost sets the host to poweroff, and returns whether it is skipped because it is not found and ignoreMissing is true
+func poweroffHost(client *mkr.Client, hostID string, retries int, ignoreMissing bool) (bool, error) {
+	err := retryOnConflict(retries, func() error {
+		return client.UpdateHostStatus(hostID, "poweroff")
+	})
+	if apiErr, ok := err.(*mkr.APIError); ok && apiErr.StatusCode == http.StatusNotFound && ignoreMissing {
+		return true, nil
+	}
+	return false, err
+}
+
+// retireHosts retires hosts in order, and stops at the first error.
+// If ignoreMissing is true, hosts which are not found (including already retired ones) are skipped.
+func retireHosts(client *mkr.Client, hostIDs []string, retries int, ignoreMissing bool) error {
+	for _, hostID := range hostIDs {
+		skipped, err := retireHost(client, hostID, retries, ignoreMissing)
+		if err != nil {
+			return err
+		}
+		if skipped {
+			logger.Log("warning", fmt.Sprintf("%s is not found or already retired, skipped", hostID))
+			continue
+		}
 
 		logger.Log("retired", hostID)
 	}
 	return nil
 }
 
+// retireHostsReporting retires all hosts even if some of them fail, and reports the result of each host
+func retireHostsReporting(client *mkr.Client, hostIDs []string, retries int, ignoreMissing bool) *batchReport {
+	report := newBatchReport()
+	for _, hostID := range hostIDs {
+		skipped, err := retireHost(client, hostID, retries, ignoreMissing)
+		action := "retire"
+		if skipped {
+			action = "skip"
+		}
+		report.add(hostID, action, err)
+	}
+	return report
+}
+
+// retireHost retires the host, and returns whether it is skipped because it is not found and ignoreMissing is true
+func retireHost(client *mkr.Client, hostID string, retries int, ignoreMissing bool) (bool, error) {
+	err := retryOnConflict(retries, func() error {
+		return client.RetireHost(hostID)
+	})
+	if apiErr, ok := err.(*mkr.APIError); ok && apiErr.StatusCode == http.StatusNotFound && ignoreMissing {
+		return true, nil
+	}
+	return false, err
+}
+
 func doServices(c *cli.Context) error {
 	services, err := newMackerelFromContext(c).FindServices()
 	logger.DieIf(err)
-	PrettyPrintJSON(services)
+	logger.DieIf(writeOutput(c.String("out"), func(w io.Writer) error {
+		fprettyPrintJSON(w, services)
+		return nil
+	}))
 	return nil
 }
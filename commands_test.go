@@ -1,12 +1,89 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/httpclient"
 	"gopkg.in/urfave/cli.v1"
 )
 
+// newTestClient starts a stub server of the Mackerel API handled by handler, and returns a client of it.
+// The server has to be closed by the caller.
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*mkr.Client, *httptest.Server) {
+	ts := httptest.NewServer(handler)
+	client, err := mkr.NewClientWithOptions("dummy-key", ts.URL, false)
+	if err != nil {
+		ts.Close()
+		t.Fatalf("should not raise error: %v", err)
+	}
+	return client, ts
+}
+
+// runTestCommand runs the command with args against a stub server of the Mackerel API handled by handler.
+// cli.ExitError doesn't exit the test process, and is returned instead.
+func runTestCommand(t *testing.T, command cli.Command, handler http.HandlerFunc, args ...string) error {
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "mkr-command")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	origAPIKey := os.Getenv("MACKEREL_APIKEY")
+	os.Setenv("MACKEREL_APIKEY", "dummy-key")
+	defer os.Setenv("MACKEREL_APIKEY", origAPIKey)
+	origOsExiter, origErrWriter := cli.OsExiter, cli.ErrWriter
+	cli.OsExiter, cli.ErrWriter = func(int) {}, ioutil.Discard
+	defer func() { cli.OsExiter, cli.ErrWriter = origOsExiter, origErrWriter }()
+
+	app := cli.NewApp()
+	app.Name = "mkr"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "conf", Value: filepath.Join(dir, "not_exists.conf")},
+		cli.StringFlag{Name: "apibase"},
+		cli.StringFlag{Name: "user-agent"},
+	}
+	app.Commands = []cli.Command{command}
+	return app.Run(append([]string{"mkr", "--apibase", ts.URL}, args...))
+}
+
+// captureStdout returns what f writes to os.Stdout
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	done := make(chan string)
+	go func() {
+		out, _ := ioutil.ReadAll(r)
+		done <- string(out)
+	}()
+
+	origStdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = origStdout }()
+	f()
+	w.Close()
+	return <-done
+}
+
 func TestCommands_requirements(t *testing.T) {
 	var cs, subcs []cli.Command
 	for _, c := range Commands {
@@ -36,3 +113,988 @@ func TestCommands_requirements(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildUpdateHostParam(t *testing.T) {
+	host := &mkr.Host{
+		ID:          "3XYyG",
+		Name:        "app01.example.com",
+		DisplayName: "app01",
+		Meta:        mkr.HostMeta{AgentVersion: "0.48.0"},
+		Interfaces:  []mkr.Interface{{Name: "eth0", IPAddress: "10.0.0.1"}},
+	}
+
+	param := buildUpdateHostParam(host, "app99.example.com", "")
+
+	expected := &mkr.UpdateHostParam{
+		Name:        "app99.example.com",
+		DisplayName: "app01",
+		Meta:        mkr.HostMeta{AgentVersion: "0.48.0"},
+		Interfaces:  []mkr.Interface{{Name: "eth0", IPAddress: "10.0.0.1"}},
+	}
+	if !reflect.DeepEqual(param, expected) {
+		t.Errorf("only the name should be changed in the payload:\n%#v\nbut got:\n%#v", expected, param)
+	}
+}
+
+func TestFilterRetiredHosts(t *testing.T) {
+	hosts := []*mkr.Host{
+		{ID: "working", Status: "working"},
+		{ID: "poweroff", Status: "poweroff"},
+		{ID: "retired", Status: "poweroff", IsRetired: true},
+	}
+
+	testCases := []struct {
+		name           string
+		includeRetired bool
+		excludeRetired bool
+		want           []string
+	}{
+		{"default", false, false, []string{"working", "poweroff"}},
+		{"include retired", true, false, []string{"working", "poweroff", "retired"}},
+		{"exclude retired", false, true, []string{"working"}},
+	}
+
+	for _, testCase := range testCases {
+		var ids []string
+		for _, host := range filterRetiredHosts(hosts, testCase.includeRetired, testCase.excludeRetired) {
+			ids = append(ids, host.ID)
+		}
+		if !reflect.DeepEqual(ids, testCase.want) {
+			t.Errorf("%s: hosts should be %v but got %v", testCase.name, testCase.want, ids)
+		}
+	}
+}
+
+func TestPrintHostIDs(t *testing.T) {
+	hosts := []*mkr.Host{
+		{ID: "3XYyG", Name: "app01.example.com", Status: "working"},
+		{ID: "3XYyH", Name: "app02.example.com", Status: "working", IsRetired: true},
+		{ID: "3XYyI", Name: "app03.example.com", Status: "standby"},
+	}
+
+	var buf bytes.Buffer
+	printHostIDs(&buf, filterRetiredHosts(hosts, false, false))
+
+	if want, got := "3XYyG\n3XYyI\n", buf.String(); got != want {
+		t.Errorf("should print only filtered ids:\n%s\nbut got:\n%s", want, got)
+	}
+}
+
+func TestConfigureClient(t *testing.T) {
+	var header http.Header
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		header = req.Header
+		fmt.Fprint(w, `{"services":[]}`)
+	})
+	defer ts.Close()
+
+	configureClient(client, "deploy-bot/1.0", "0123456789abcdef")
+
+	if _, err := client.FindServices(); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if want, got := "mkr/"+version+" deploy-bot/1.0", header.Get("User-Agent"); got != want {
+		t.Errorf("User-Agent should be %q but got %q", want, got)
+	}
+	if want, got := "0123456789abcdef", header.Get("X-Request-Id"); got != want {
+		t.Errorf("X-Request-Id should be %q but got %q", want, got)
+	}
+}
+
+func TestConfigureClient_customHTTPClient(t *testing.T) {
+	client, _ := mkr.NewClientWithOptions("dummy-key", "https://api.example.com", false)
+	custom := &http.Client{Transport: &http.Transport{}}
+	client.HTTPClient = custom
+	configureClient(client, "", "")
+	if client.HTTPClient != custom {
+		t.Errorf("the customized HTTP client should be kept")
+	}
+
+	client.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	configureClient(client, "", "")
+	if client.HTTPClient.Transport != httpclient.Transport || client.HTTPClient.Timeout != 5*time.Second {
+		t.Errorf("the HTTP client with the default transport should be replaced keeping the timeout")
+	}
+}
+
+func TestSetClientVerbose(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"services":[]}`)
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	client, _ := mkr.NewClientWithOptions("secret-api-key", ts.URL, true)
+	configureClient(client, "", "")
+	setClientVerbose(client)
+	if _, err := client.FindServices(); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "GET /api/v0/services") || !strings.Contains(buf.String(), "X-Api-Key: ***") {
+		t.Errorf("the request should be logged with the API key redacted but got:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "secret-api-key") {
+		t.Errorf("the API key should not be logged but got:\n%s", buf.String())
+	}
+}
+
+func TestUpdateHostInfo_retryOnConflict(t *testing.T) {
+	defer func(d time.Duration) { conflictRetryInterval = d }(conflictRetryInterval)
+	conflictRetryInterval = 0
+
+	var gets, puts int
+	var lastBody map[string]interface{}
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "GET":
+			gets++
+			fmt.Fprintf(w, `{"host":{"id":"3XYyG","name":"app01","displayName":"app %d","meta":{}}}`, gets)
+		case "PUT":
+			puts++
+			if puts == 1 {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, `{"error":{"message":"conflict"}}`)
+				return
+			}
+			json.NewDecoder(req.Body).Decode(&lastBody)
+			fmt.Fprint(w, `{"id":"3XYyG"}`)
+		}
+	})
+	defer ts.Close()
+
+	err := retryOnConflict(2, func() error {
+		_, err := updateHostInfo(client, "3XYyG", "app02", "", []string{"foo:app"}, false)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if gets != 2 || puts != 2 {
+		t.Errorf("the host should be refetched and updated twice but got %d GETs and %d PUTs", gets, puts)
+	}
+	if lastBody["name"] != "app02" || lastBody["displayName"] != "app 2" {
+		t.Errorf("the change should be reapplied to the refetched host but got %v", lastBody)
+	}
+}
+
+func TestRetryOnConflict_exhausted(t *testing.T) {
+	defer func(d time.Duration) { conflictRetryInterval = d }(conflictRetryInterval)
+	conflictRetryInterval = 0
+
+	calls := 0
+	err := retryOnConflict(2, func() error {
+		calls++
+		return &mkr.APIError{StatusCode: http.StatusConflict, Message: "conflict"}
+	})
+	if err == nil {
+		t.Errorf("should raise error after retries are exhausted")
+	}
+	if calls != 3 {
+		t.Errorf("fn should be called 3 times but got %d", calls)
+	}
+
+	calls = 0
+	retryOnConflict(2, func() error {
+		calls++
+		return &mkr.APIError{StatusCode: http.StatusNotFound, Message: "not found"}
+	})
+	if calls != 1 {
+		t.Errorf("fn should not be retried on errors other than conflict but called %d times", calls)
+	}
+}
+
+func TestUpdateHostInfo_noChange(t *testing.T) {
+	puts := 0
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "GET":
+			fmt.Fprint(w, `{"host":{"id":"3XYyG","name":"app01","meta":{},"roles":{"foo":["app","batch"]}}}`)
+		case "PUT":
+			puts++
+			fmt.Fprint(w, `{"id":"3XYyG"}`)
+		}
+	})
+	defer ts.Close()
+
+	updated, err := updateHostInfo(client, "3XYyG", "", "", []string{"foo:batch", "foo:app"}, false)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if updated || puts != 0 {
+		t.Errorf("the host should not be updated when roles already match, but got %d PUTs", puts)
+	}
+
+	updated, err = updateHostInfo(client, "3XYyG", "", "", []string{"foo:app"}, true)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if !updated || puts != 1 {
+		t.Errorf("the host should be updated with force, but got %d PUTs", puts)
+	}
+
+	updated, err = updateHostInfo(client, "3XYyG", "", "", []string{"foo:web"}, false)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if !updated || puts != 2 {
+		t.Errorf("the host should be updated when a role is added, but got %d PUTs", puts)
+	}
+}
+
+func TestRetireHosts_ignoreMissing(t *testing.T) {
+	var retired []string
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/v0/hosts/3XYyG/retire", "/api/v0/hosts/3XYyI/retire":
+			retired = append(retired, req.URL.Path)
+			fmt.Fprint(w, `{"success":true}`)
+		case "/api/v0/hosts/3XYyH/retire":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"Host Not Found."}}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":{"message":"Internal Server Error"}}`)
+		}
+	})
+	defer ts.Close()
+
+	if err := retireHosts(client, []string{"3XYyG", "3XYyH", "3XYyI"}, 0, true); err != nil {
+		t.Errorf("should not raise error for an already retired host: %v", err)
+	}
+	if len(retired) != 2 {
+		t.Errorf("hosts after the missing one should be retired but got %v", retired)
+	}
+
+	if err := retireHosts(client, []string{"3XYyH"}, 0, false); err == nil {
+		t.Errorf("should raise error for a missing host without ignoreMissing")
+	}
+	if err := retireHosts(client, []string{"3XYyJ"}, 0, true); err == nil {
+		t.Errorf("should raise error other than not found even with ignoreMissing")
+	}
+}
+
+func TestRetireHostsReporting(t *testing.T) {
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/v0/hosts/3XYyG/retire", "/api/v0/hosts/3XYyJ/retire":
+			fmt.Fprint(w, `{"success":true}`)
+		case "/api/v0/hosts/3XYyH/retire":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"Host Not Found."}}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":{"message":"Internal Server Error"}}`)
+		}
+	})
+	defer ts.Close()
+
+	report := retireHostsReporting(client, []string{"3XYyG", "3XYyH", "3XYyI", "3XYyJ"}, 0, true)
+	want := []struct {
+		id     string
+		action string
+		ok     bool
+	}{
+		{"3XYyG", "retire", true},
+		{"3XYyH", "skip", true},
+		{"3XYyI", "retire", false},
+		{"3XYyJ", "retire", true},
+	}
+	if len(report.Results) != len(want) {
+		t.Fatalf("all hosts should be reported even after a failure but got %d results", len(report.Results))
+	}
+	for i, w := range want {
+		r := report.Results[i]
+		if r.ID != w.id || r.Action != w.action || r.OK != w.ok || (r.Error == "") != w.ok {
+			t.Errorf("result %d should be %+v but got %+v", i, w, r)
+		}
+	}
+	if report.Summary.Succeeded != 3 || report.Summary.Failed != 1 {
+		t.Errorf("summary should be 3 succeeded and 1 failed but got %+v", report.Summary)
+	}
+
+	var buf bytes.Buffer
+	report.print(&buf)
+	var got struct {
+		Results []map[string]interface{} `json:"results"`
+		Summary map[string]int           `json:"summary"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("the report should be JSON but got %q: %v", buf.String(), err)
+	}
+	if _, ok := got.Results[2]["error"]; !ok {
+		t.Errorf("the failed result should have the error but got %v", got.Results[2])
+	}
+	if _, ok := got.Results[0]["error"]; ok {
+		t.Errorf("the succeeded result should not have the error but got %v", got.Results[0])
+	}
+	if got.Summary["succeeded"] != 3 || got.Summary["failed"] != 1 {
+		t.Errorf("the summary should be output but got %v", got.Summary)
+	}
+}
+
+func TestHostIDResolver(t *testing.T) {
+	requests := 0
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		switch req.URL.Query().Get("name") {
+		case "app01":
+			fmt.Fprint(w, `{"hosts":[{"id":"3XYyG","name":"app01"}]}`)
+		case "app02":
+			fmt.Fprint(w, `{"hosts":[{"id":"3XYyH","name":"app02"},{"id":"3XYyI","name":"app02"}]}`)
+		default:
+			fmt.Fprint(w, `{"hosts":[]}`)
+		}
+	})
+	defer ts.Close()
+
+	resolver := newHostIDResolver(client)
+
+	for i := 0; i < 2; i++ {
+		hostID, err := resolver.resolve("app01")
+		if err != nil {
+			t.Errorf("should not raise error for a unique name: %v", err)
+		}
+		if hostID != "3XYyG" {
+			t.Errorf("host ID should be 3XYyG but got %s", hostID)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("the lookup should be cached but requested %d times", requests)
+	}
+
+	if _, err := resolver.resolve("app02"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("should raise error for an ambiguous name but got %v", err)
+	}
+	if _, err := resolver.resolve("app03"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("should raise error for a missing name but got %v", err)
+	}
+}
+
+func TestThrowDryRun(t *testing.T) {
+	input := strings.Join([]string{
+		"tcp.CLOSING 0 1397031808",
+		"",
+		"tcp.ESTABLISHED 12.5 1397031808",
+		"tcp.LISTEN 1397031808",
+		"tcp.TIME_WAIT NaN? 1397031808",
+	}, "\n")
+
+	var out, errOut bytes.Buffer
+	err := throwDryRun(strings.NewReader(input), &out, &errOut, true, "", nil)
+	if err == nil {
+		t.Errorf("should raise error for malformed lines")
+	}
+
+	want := "custom.tcp.CLOSING\t0\t1397031808\ncustom.tcp.ESTABLISHED\t12.5\t1397031808\n"
+	if got := out.String(); got != want {
+		t.Errorf("parsed metric values should be:\n%s\nbut got:\n%s", want, got)
+	}
+	for _, line := range []string{"line 4:", "line 5:"} {
+		if !strings.Contains(errOut.String(), line) {
+			t.Errorf("malformed %s should be reported but got:\n%s", line, errOut.String())
+		}
+	}
+
+	out.Reset()
+	errOut.Reset()
+	if err := throwDryRun(strings.NewReader("foo.bar 1 1397031808\n"), &out, &errOut, false, "", nil); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if got := out.String(); got != "foo.bar\t1\t1397031808\n" {
+		t.Errorf("service metric name should not be prefixed but got %q", got)
+	}
+}
+
+func TestFilterHostsByCreatedAt(t *testing.T) {
+	hosts := []*mkr.Host{
+		{ID: "3XYyG", CreatedAt: 1500000000},
+		{ID: "3XYyH", CreatedAt: 1500003600},
+		{ID: "3XYyI", CreatedAt: 1500007200},
+		{ID: "3XYyJ", CreatedAt: 1500010800},
+	}
+	now := time.Unix(1500010800, 0)
+
+	testCases := []struct {
+		since, before string
+		want          []string
+	}{
+		{"", "", []string{"3XYyG", "3XYyH", "3XYyI", "3XYyJ"}},
+		{"2h", "", []string{"3XYyH", "3XYyI", "3XYyJ"}},
+		{"", "1h", []string{"3XYyG", "3XYyH"}},
+		{"2017-07-14T03:40:00Z", "2017-07-14T05:40:00Z", []string{"3XYyH", "3XYyI"}},
+	}
+
+	for _, testCase := range testCases {
+		var since, before time.Time
+		if testCase.since != "" {
+			since, _ = parseTimeOrDuration(testCase.since, now)
+		}
+		if testCase.before != "" {
+			before, _ = parseTimeOrDuration(testCase.before, now)
+		}
+		var got []string
+		for _, host := range filterHostsByCreatedAt(hosts, since, before) {
+			got = append(got, host.ID)
+		}
+		if !reflect.DeepEqual(got, testCase.want) {
+			t.Errorf("hosts created in [%q, %q) should be %v but got %v", testCase.since, testCase.before, testCase.want, got)
+		}
+	}
+
+	if _, err := parseTimeOrDuration("yesterday", now); err == nil {
+		t.Errorf("should raise error for an invalid time")
+	}
+}
+
+func TestFetchServiceMetricValues(t *testing.T) {
+	var query url.Values
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v0/services/blog/metrics" {
+			t.Errorf("request path should be /api/v0/services/blog/metrics but got %s", req.URL.Path)
+		}
+		query = req.URL.Query()
+		fmt.Fprint(w, `{"metrics":[{"time":1500007200,"value":1.5},{"time":1500007260,"value":2}]}`)
+	})
+	defer ts.Close()
+
+	from, to := fetchPeriod(0, 0, time.Unix(1500010800, 0))
+	metricValues, err := client.FetchServiceMetricValues("blog", "custom.access.count", from, to)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if query.Get("name") != "custom.access.count" || query.Get("from") != "1500007200" || query.Get("to") != "1500010800" {
+		t.Errorf("query should request the last hour of custom.access.count but got %v", query)
+	}
+
+	var buf bytes.Buffer
+	printMetricValuesTSV(&buf, metricValues)
+	if want := "1500007200\t1.5\n1500007260\t2\n"; buf.String() != want {
+		t.Errorf("output should be %q but got %q", want, buf.String())
+	}
+}
+
+func TestDoFetchServiceMetricValues(t *testing.T) {
+	var query url.Values
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v0/services/blog/metrics" {
+			t.Errorf("request path should be /api/v0/services/blog/metrics but got %s", req.URL.Path)
+		}
+		query = req.URL.Query()
+		fmt.Fprint(w, `{"metrics":[{"time":1500007200,"value":1.5},{"time":1500007260,"value":2}]}`)
+	}
+
+	testCases := []struct {
+		args []string
+		want string
+	}{
+		{
+			args: []string{"fetch", "-s", "blog", "-n", "custom.access.count", "--from", "1500007200", "--to", "1500010800"},
+			want: "1500007200\t1.5\n1500007260\t2\n",
+		},
+		{
+			args: []string{"fetch", "-s", "blog", "-n", "custom.access.count", "--from", "1500007200", "--to", "1500010800", "-o", "json"},
+			want: `[
+    {
+        "time": 1500007200,
+        "value": 1.5
+    },
+    {
+        "time": 1500007260,
+        "value": 2
+    }
+]
+`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		query = nil
+		var err error
+		out := captureStdout(t, func() {
+			err = runTestCommand(t, commandFetch, handler, testCase.args...)
+		})
+		if err != nil {
+			t.Fatalf("%v should not raise error: %v", testCase.args, err)
+		}
+		if query.Get("name") != "custom.access.count" || query.Get("from") != "1500007200" || query.Get("to") != "1500010800" {
+			t.Errorf("query should request custom.access.count between --from and --to but got %v", query)
+		}
+		if out != testCase.want {
+			t.Errorf("output of %v should be:\n%s\nbut got:\n%s", testCase.args, testCase.want, out)
+		}
+	}
+
+	if err := runTestCommand(t, commandFetch, handler, "fetch", "-s", "blog", "-n", "custom.access.count", "-o", "csv"); err == nil {
+		t.Errorf("should raise error for an unknown output format")
+	}
+}
+
+func TestGroupHostsByRole(t *testing.T) {
+	hosts := []*mkr.Host{
+		{ID: "3XYyG", Name: "app01", Status: "working", Roles: mkr.Roles{"foo": {"app"}}},
+		{ID: "3XYyH", Name: "app02", Status: "standby", Roles: mkr.Roles{"foo": {"app", "batch"}}},
+		{ID: "3XYyI", Name: "db01", Status: "working", Roles: mkr.Roles{"foo": {"batch"}}},
+		{ID: "3XYyJ", Name: "standalone", Status: "working"},
+	}
+
+	groups := groupHostsByRole(hosts)
+	got := map[string][]string{}
+	var roles []string
+	for _, g := range groups {
+		roles = append(roles, g.key)
+		for _, host := range g.hosts {
+			got[g.key] = append(got[g.key], host.ID)
+		}
+	}
+	if want := []string{"(no role)", "foo:app", "foo:batch"}; !reflect.DeepEqual(roles, want) {
+		t.Errorf("roles should be %v but got %v", want, roles)
+	}
+	want := map[string][]string{
+		"(no role)": {"3XYyJ"},
+		"foo:app":   {"3XYyG", "3XYyH"},
+		"foo:batch": {"3XYyH", "3XYyI"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groups should be %v but got %v", want, got)
+	}
+
+	var buf bytes.Buffer
+	printHostGroups(&buf, groups)
+	expected := `(no role) (1)
+  3XYyJ  standalone  working
+foo:app (2)
+  3XYyG  app01  working
+  3XYyH  app02  standby
+foo:batch (2)
+  3XYyH  app02  standby
+  3XYyI  db01   working
+`
+	if buf.String() != expected {
+		t.Errorf("output should be:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+
+	if m := groups.byKey(); len(m["foo:batch"]) != 2 || m["foo:batch"][0].Name != "app02" {
+		t.Errorf("json output should map roles to hosts but got %v", m)
+	}
+}
+
+func TestMetricValueFromFlags(t *testing.T) {
+	var posted []map[string]interface{}
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v0/tsdb" {
+			t.Errorf("request path should be /api/v0/tsdb but got %s", req.URL.Path)
+		}
+		json.NewDecoder(req.Body).Decode(&posted)
+		fmt.Fprint(w, `{"success":true}`)
+	})
+	defer ts.Close()
+
+	now := time.Unix(1500010800, 0)
+	metricValue, err := metricValueFromFlags("tcp.CLOSING", "1.5", "2017-07-14T04:00:00Z", true, now)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if err := client.PostHostMetricValuesByHostID("3XYyG", []*mkr.MetricValue{metricValue}); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(posted) != 1 || posted[0]["hostId"] != "3XYyG" || posted[0]["name"] != "custom.tcp.CLOSING" || posted[0]["value"] != 1.5 || posted[0]["time"] != 1500004800.0 {
+		t.Errorf("the metric value specified by flags should be posted but got %v", posted)
+	}
+
+	if metricValue, _ := metricValueFromFlags("foo.bar", "2", "1500000000", false, now); metricValue.Time != 1500000000 || metricValue.Name != "foo.bar" {
+		t.Errorf("epoch time should be used but got %+v", metricValue)
+	}
+	metricValue, err = metricValueFromFlags("tcp.CLOSING", "2", "-10m", true, now)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if err := client.PostHostMetricValuesByHostID("3XYyG", []*mkr.MetricValue{metricValue}); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(posted) != 1 || posted[0]["time"] != 1500010200.0 {
+		t.Errorf("the relative time should be resolved against now but got %v", posted)
+	}
+	if metricValue, _ := metricValueFromFlags("foo.bar", "2", "", false, now); metricValue.Time != now.Unix() {
+		t.Errorf("time should default to now but got %d", metricValue.Time)
+	}
+	for _, flags := range [][2]string{{"", ""}, {"high", ""}, {"1", "yesterday"}} {
+		if _, err := metricValueFromFlags("foo.bar", flags[0], flags[1], false, now); err == nil {
+			t.Errorf("metricValueFromFlags(%q, %q) should raise error", flags[0], flags[1])
+		}
+	}
+}
+
+func TestDoThrow_flags(t *testing.T) {
+	var path string
+	var posted []map[string]interface{}
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+		posted = nil
+		json.NewDecoder(req.Body).Decode(&posted)
+		fmt.Fprint(w, `{"success":true}`)
+	}
+
+	testCases := []struct {
+		args     []string
+		wantPath string
+		want     map[string]interface{}
+	}{
+		{
+			args:     []string{"throw", "--host", "3XYyG", "--name", "tcp.CLOSING", "--value", "1.5", "--time", "2017-07-14T04:00:00Z"},
+			wantPath: "/api/v0/tsdb",
+			want:     map[string]interface{}{"hostId": "3XYyG", "name": "custom.tcp.CLOSING", "value": 1.5, "time": 1500004800.0},
+		},
+		{
+			args:     []string{"throw", "--service", "blog", "--name", "access.count", "--value", "2", "--time", "1500000000"},
+			wantPath: "/api/v0/services/blog/tsdb",
+			want:     map[string]interface{}{"name": "access.count", "value": 2.0, "time": 1500000000.0},
+		},
+	}
+
+	for _, testCase := range testCases {
+		path, posted = "", nil
+		if err := runTestCommand(t, commandThrow, handler, testCase.args...); err != nil {
+			t.Fatalf("%v should not raise error: %v", testCase.args, err)
+		}
+		if path != testCase.wantPath {
+			t.Errorf("request path of %v should be %s but got %s", testCase.args, testCase.wantPath, path)
+		}
+		if len(posted) != 1 || !reflect.DeepEqual(posted[0], testCase.want) {
+			t.Errorf("%v should post %v but got %v", testCase.args, testCase.want, posted)
+		}
+	}
+
+	path = ""
+	if err := runTestCommand(t, commandThrow, handler, "throw", "--host", "3XYyG", "--name", "tcp.CLOSING", "--value", "high"); err == nil {
+		t.Errorf("should raise error for an invalid --value")
+	}
+	if path != "" {
+		t.Errorf("nothing should be posted for an invalid --value but got a request to %s", path)
+	}
+}
+
+func TestParseMetricTime(t *testing.T) {
+	now := time.Unix(1500010800, 0)
+	testCases := []struct {
+		s    string
+		want int64
+	}{
+		{"1500000000", 1500000000},
+		{"2017-07-14T04:00:00Z", 1500004800},
+		{"now", 1500010800},
+		{"-10m", 1500010200},
+		{"+1h", 1500014400},
+	}
+	for _, testCase := range testCases {
+		got, err := parseMetricTime(testCase.s, now)
+		if err != nil {
+			t.Errorf("parseMetricTime(%q) should not raise error: %v", testCase.s, err)
+			continue
+		}
+		if got != testCase.want {
+			t.Errorf("parseMetricTime(%q) should be %d but got %d", testCase.s, testCase.want, got)
+		}
+	}
+	for _, s := range []string{"10m", "-10", "-ten minutes", "yesterday"} {
+		if _, err := parseMetricTime(s, now); err == nil || !strings.Contains(err.Error(), s) {
+			t.Errorf("parseMetricTime(%q) should raise error with the value but got %v", s, err)
+		}
+	}
+
+	metricValue, err := parseMetricLine("tcp.CLOSING\t1\t-10m", false)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if want := time.Now().Add(-10 * time.Minute).Unix(); metricValue.Time < want-5 || metricValue.Time > want {
+		t.Errorf("the time of the line should be 10 minutes ago (%d) but got %d", want, metricValue.Time)
+	}
+}
+
+func TestLatestMetricValuesFetcher(t *testing.T) {
+	var hostIDs []string
+	for i := 0; i < 95; i++ {
+		hostIDs = append(hostIDs, fmt.Sprintf("host%02d", i))
+	}
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	fetcher := &latestMetricValuesFetcher{
+		fetch: func(hostIDs []string, metricNames []string) (mkr.LatestMetricValues, error) {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+
+			if hostIDs[0] == "host20" {
+				return nil, fmt.Errorf("Internal Server Error")
+			}
+			metricValues := make(mkr.LatestMetricValues)
+			for _, hostID := range hostIDs {
+				metricValues[hostID] = map[string]*mkr.MetricValue{"loadavg5": {Name: "loadavg5", Value: 1.0}}
+			}
+			return metricValues, nil
+		},
+		chunkSize:   10,
+		concurrency: 3,
+	}
+
+	metricValues, errs := fetcher.run(hostIDs, []string{"loadavg5"})
+	if maxInFlight > 3 {
+		t.Errorf("concurrent requests should be at most 3 but got %d", maxInFlight)
+	}
+	if len(metricValues) != 85 {
+		t.Errorf("metric values of 85 hosts should be fetched but got %d", len(metricValues))
+	}
+	if len(errs) != 10 || errs["host20"] == nil || errs["host29"] == nil {
+		t.Errorf("errors of the failed chunk should be reported but got %v", errs)
+	}
+	if _, ok := metricValues["host94"]; !ok {
+		t.Errorf("metric values of the last chunk should be fetched")
+	}
+}
+
+func TestPoweroffHostsBeforeRetirement(t *testing.T) {
+	var requests []string
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		request := req.Method + " " + req.URL.Path
+		if strings.HasSuffix(req.URL.Path, "/status") {
+			var payload map[string]string
+			json.NewDecoder(req.Body).Decode(&payload)
+			request += " " + payload["status"]
+		}
+		requests = append(requests, request)
+		fmt.Fprint(w, `{"success":true}`)
+	})
+	defer ts.Close()
+
+	origSleep := sleepGracePeriod
+	defer func() { sleepGracePeriod = origSleep }()
+	var slept time.Duration
+	sleepGracePeriod = func(d time.Duration) {
+		slept = d
+		requests = append(requests, "sleep")
+	}
+
+	hostIDs := []string{"3XYyG", "3XYyH"}
+	if err := poweroffHostsBeforeRetirement(client, hostIDs, time.Minute, 0, false); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if err := retireHosts(client, hostIDs, 0, false); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+
+	expected := []string{
+		"POST /api/v0/hosts/3XYyG/status poweroff",
+		"POST /api/v0/hosts/3XYyH/status poweroff",
+		"sleep",
+		"POST /api/v0/hosts/3XYyG/retire",
+		"POST /api/v0/hosts/3XYyH/retire",
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("requests should be %v but got %v", expected, requests)
+	}
+	if slept != time.Minute {
+		t.Errorf("grace period should be 1m but got %s", slept)
+	}
+}
+
+func TestPoweroffHostsBeforeRetirement_ignoreMissing(t *testing.T) {
+	var requests []string
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		if strings.Contains(req.URL.Path, "/3XYyG/") {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"Host Not Found."}}`)
+			return
+		}
+		fmt.Fprint(w, `{"success":true}`)
+	})
+	defer ts.Close()
+
+	hostIDs := []string{"3XYyG", "3XYyH"}
+	if err := poweroffHostsBeforeRetirement(client, hostIDs, 0, 0, false); err == nil {
+		t.Errorf("should raise error for the missing host without ignoreMissing")
+	}
+
+	requests = nil
+	if err := poweroffHostsBeforeRetirement(client, hostIDs, 0, 0, true); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	expected := []string{"POST /api/v0/hosts/3XYyG/status", "POST /api/v0/hosts/3XYyH/status"}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("requests should be %v but got %v", expected, requests)
+	}
+}
+
+func TestPoweroffHostsReporting(t *testing.T) {
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/v0/hosts/3XYyG/status":
+			fmt.Fprint(w, `{"success":true}`)
+		case "/api/v0/hosts/3XYyH/status":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"Host Not Found."}}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":{"message":"Internal Server Error"}}`)
+		}
+	})
+	defer ts.Close()
+
+	origSleep := sleepGracePeriod
+	defer func() { sleepGracePeriod = origSleep }()
+	sleepGracePeriod = func(time.Duration) {}
+
+	report, hostIDs := poweroffHostsReporting(client, []string{"3XYyG", "3XYyH", "3XYyI"}, time.Minute, 0, true)
+	if want := []string{"3XYyG", "3XYyH"}; !reflect.DeepEqual(hostIDs, want) {
+		t.Errorf("hosts to be retired should be %v but got %v", want, hostIDs)
+	}
+	if len(report.Results) != 1 || report.Results[0].ID != "3XYyI" || report.Results[0].Action != "poweroff" || report.Results[0].OK {
+		t.Errorf("only the host failed to be powered off should be reported but got %+v", report.Results)
+	}
+
+	report.merge(retireHostsReporting(client, nil, 0, true))
+	if report.Summary.Failed != 1 {
+		t.Errorf("the failure should be kept after merged but got %+v", report.Summary)
+	}
+}
+
+func TestHostsResponseIPv6Addresses(t *testing.T) {
+	requested := 0
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		requested++
+		if req.URL.Query().Get("service") != "blog" {
+			t.Errorf("service should be requested but got %v", req.URL.Query())
+		}
+		fmt.Fprint(w, `{"hosts":[{
+			"id":"3XYyG","name":"app01","status":"working","roles":{"blog":["app"]},"createdAt":1500000000,
+			"interfaces":[
+				{"name":"eth0","ipAddress":"10.0.0.1","ipv6Addresses":["2001:db8::1","fe80::1"]},
+				{"name":"eth1","ipAddress":"192.168.0.1"}
+			]
+		}]}`)
+	})
+	defer ts.Close()
+
+	resp, err := findHostsResponse(client, &mkr.FindHostsParam{Service: "blog"})
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	hosts, err := resp.hosts()
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	ipv6Addrs, err := resp.ipv6Addresses()
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if requested != 1 {
+		t.Errorf("the hosts should be requested once but got %d requests", requested)
+	}
+
+	hostFormat := newHostFormat(hosts[0])
+	hostFormat.IPv6Addresses = ipv6Addrs[hosts[0].ID]
+	if hostFormat.IPAddresses["eth0"] != "10.0.0.1" || hostFormat.IPAddresses["eth1"] != "192.168.0.1" {
+		t.Errorf("IPv4 addresses should be shown but got %v", hostFormat.IPAddresses)
+	}
+	if want := map[string][]string{"eth0": {"2001:db8::1", "fe80::1"}}; !reflect.DeepEqual(hostFormat.IPv6Addresses, want) {
+		t.Errorf("IPv6 addresses should be %v but got %v", want, hostFormat.IPv6Addresses)
+	}
+
+	var buf bytes.Buffer
+	printHostsTable(&buf, hosts, ipv6Addrs)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !strings.HasSuffix(lines[0], "IPV6 ADDRESSES") || !strings.HasSuffix(lines[1], "2001:db8::1,fe80::1") {
+		t.Errorf("the table should have the IPv6 column but got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	printHostsTable(&buf, hosts, nil)
+	if strings.Contains(buf.String(), "IPV6") {
+		t.Errorf("the table should not have the IPv6 column by default but got:\n%s", buf.String())
+	}
+}
+
+func TestPrintCreatedHost(t *testing.T) {
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v0/hosts/3XYyG" {
+			t.Errorf("unexpected request: %s", req.URL.Path)
+		}
+		fmt.Fprint(w, `{"host":{"id":"3XYyG","name":"app01.example.com","status":"working"}}`)
+	})
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	if err := printCreatedHost(&buf, client, "3XYyG", true, ""); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if buf.String() != "3XYyG\n" {
+		t.Errorf("only the host id should be output but got %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := printCreatedHost(&buf, client, "3XYyG", false, "json"); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	var host mkr.Host
+	if err := json.Unmarshal(buf.Bytes(), &host); err != nil || host.ID != "3XYyG" || host.Name != "app01.example.com" {
+		t.Errorf("the created host should be output in JSON but got %q (%v)", buf.String(), err)
+	}
+
+	buf.Reset()
+	if err := printCreatedHost(&buf, client, "3XYyG", false, ""); err != nil || buf.Len() != 0 {
+		t.Errorf("nothing should be output by default but got %q", buf.String())
+	}
+}
+
+func TestReadIDsFromArgs_hostIDOfLine(t *testing.T) {
+	stdin := strings.NewReader(`ID     NAME               STATUS   ROLES    CREATED AT
+3XYyG  app01.example.com  working  foo:app  Jan  1, 2017 at 12:00am (UTC)
+
+# db servers
+  3XYyH  db01.example.com  standby
+3XYyJ
+`)
+	ids, err := readIDsFromArgs([]string{"3XYyA", "-"}, stdin, hostIDOfLine)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	want := []string{"3XYyA", "3XYyG", "3XYyH", "3XYyJ"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("host IDs should be %v but got %v", want, ids)
+	}
+}
+
+func TestValidateHostStatusTransition(t *testing.T) {
+	testCases := []struct {
+		host   *mkr.Host
+		status string
+		valid  bool
+	}{
+		{&mkr.Host{ID: "3XYyG", Status: "standby"}, "working", true},
+		{&mkr.Host{ID: "3XYyG", Status: "working"}, "poweroff", true},
+		{nil, "maintenance", true},
+		{&mkr.Host{ID: "3XYyG", Status: "poweroff", IsRetired: true}, "working", false},
+		{&mkr.Host{ID: "3XYyG", Status: "working"}, "retired", false},
+		{nil, "Working", false},
+	}
+
+	for _, testCase := range testCases {
+		err := validateHostStatusTransition(testCase.host, testCase.status)
+		if testCase.valid && err != nil {
+			t.Errorf("the transition to %s of %+v should be valid but got %v", testCase.status, testCase.host, err)
+		}
+		if !testCase.valid && err == nil {
+			t.Errorf("the transition to %s of %+v should be rejected", testCase.status, testCase.host)
+		}
+	}
+}
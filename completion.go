@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandCompletion = cli.Command{
+	Name:      "completion",
+	Usage:     "Output a shell completion script",
+	ArgsUsage: "<bash | zsh | fish>",
+	Description: `
+    Output a completion script of subcommands and flags for bash, zsh or fish.
+    Host IDs are also completed for status, update and retire by "mkr hosts --ids-only" when the API is available.
+    Example: source <(mkr completion bash)
+`,
+	Action: doCompletion,
+}
+
+// commands which take host IDs as arguments
+var hostIDCompletionCommands = []string{"mkr status", "mkr update", "mkr retire"}
+
+// completionNode is a command and its candidates of the next word
+type completionNode struct {
+	path        string
+	subcommands []cli.Command
+	flags       []cli.Flag
+}
+
+func collectCompletionNodes(path string, commands []cli.Command, flags []cli.Flag) []*completionNode {
+	nodes := []*completionNode{{path: path, subcommands: commands, flags: flags}}
+	for _, command := range commands {
+		nodes = append(nodes, collectCompletionNodes(path+" "+command.Name, command.Subcommands, command.Flags)...)
+	}
+	return nodes
+}
+
+// flagNames returns names of the flag with dashes, such as "--verbose" and "-v"
+func flagNames(flag cli.Flag) []string {
+	var names []string
+	for _, name := range strings.Split(flag.GetName(), ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 1 {
+			names = append(names, "-"+name)
+		} else {
+			names = append(names, "--"+name)
+		}
+	}
+	return names
+}
+
+func flagUsage(flag cli.Flag) string {
+	switch f := flag.(type) {
+	case cli.BoolFlag:
+		return f.Usage
+	case cli.StringFlag:
+		return f.Usage
+	case cli.StringSliceFlag:
+		return f.Usage
+	case cli.IntFlag:
+		return f.Usage
+	case cli.Int64Flag:
+		return f.Usage
+	case cli.DurationFlag:
+		return f.Usage
+	}
+	return ""
+}
+
+// words returns all candidates of the next word
+func (n *completionNode) words() []string {
+	var words []string
+	for _, command := range n.subcommands {
+		words = append(words, command.Name)
+	}
+	for _, flag := range n.flags {
+		words = append(words, flagNames(flag)...)
+	}
+	return words
+}
+
+func (n *completionNode) subcommandNames() []string {
+	var names []string
+	for _, command := range n.subcommands {
+		names = append(names, command.Name)
+	}
+	return names
+}
+
+func doCompletion(c *cli.Context) error {
+	shell := c.Args().First()
+	if shell == "" {
+		cli.ShowCommandHelp(c, "completion")
+		os.Exit(1)
+	}
+	return writeCompletion(os.Stdout, shell, c.App.Commands, c.App.Flags)
+}
+
+func writeCompletion(w io.Writer, shell string, commands []cli.Command, flags []cli.Flag) error {
+	nodes := collectCompletionNodes("mkr", commands, flags)
+	switch shell {
+	case "bash":
+		fmt.Fprint(w, "# bash completion for mkr\n\n")
+		writeShellCompletionFunctions(w, nodes)
+		fmt.Fprint(w, bashCompletionMain)
+	case "zsh":
+		fmt.Fprint(w, "#compdef mkr\n\n")
+		writeShellCompletionFunctions(w, nodes)
+		fmt.Fprint(w, zshCompletionMain)
+	case "fish":
+		writeFishCompletion(w, nodes)
+	default:
+		return cli.NewExitError(fmt.Sprintf("unsupported shell: %s", shell), 1)
+	}
+	return nil
+}
+
+// writeShellCompletionFunctions outputs functions shared by bash and zsh,
+// which return candidates and subcommands of the command path.
+func writeShellCompletionFunctions(w io.Writer, nodes []*completionNode) {
+	fmt.Fprint(w, "__mkr_words() {\n    case \"$1\" in\n")
+	for _, n := range nodes {
+		fmt.Fprintf(w, "    %q) echo %q ;;\n", n.path, strings.Join(n.words(), " "))
+	}
+	fmt.Fprint(w, "    esac\n}\n\n")
+
+	fmt.Fprint(w, "__mkr_subcommands() {\n    case \"$1\" in\n")
+	for _, n := range nodes {
+		if len(n.subcommands) > 0 {
+			fmt.Fprintf(w, "    %q) echo %q ;;\n", n.path, strings.Join(n.subcommandNames(), " "))
+		}
+	}
+	fmt.Fprint(w, "    esac\n}\n\n")
+
+	fmt.Fprint(w, "__mkr_host_ids() {\n    case \"$1\" in\n")
+	fmt.Fprintf(w, "    %s) mkr hosts --ids-only 2>/dev/null ;;\n", quoteShellPatterns(hostIDCompletionCommands))
+	fmt.Fprint(w, "    esac\n}\n\n")
+}
+
+func quoteShellPatterns(patterns []string) string {
+	quoted := make([]string, len(patterns))
+	for i, p := range patterns {
+		quoted[i] = fmt.Sprintf("%q", p)
+	}
+	return strings.Join(quoted, "|")
+}
+
+const bashCompletionMain = `_mkr() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local cmd="mkr" word i
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        word="${COMP_WORDS[i]}"
+        if [[ " $(__mkr_subcommands "$cmd") " == *" $word "* ]]; then
+            cmd="$cmd $word"
+        fi
+    done
+    local words="$(__mkr_words "$cmd")"
+    if [[ "$cur" != -* ]]; then
+        words="$words $(__mkr_host_ids "$cmd")"
+    fi
+    COMPREPLY=($(compgen -W "$words" -- "$cur"))
+}
+complete -F _mkr mkr
+`
+
+const zshCompletionMain = `_mkr() {
+    local cmd="mkr" word i
+    for ((i = 2; i < CURRENT; i++)); do
+        word="${words[i]}"
+        if [[ " $(__mkr_subcommands "$cmd") " == *" $word "* ]]; then
+            cmd="$cmd $word"
+        fi
+    done
+    local -a candidates
+    candidates=(${=$(__mkr_words "$cmd")})
+    if [[ "$PREFIX" != -* ]]; then
+        candidates+=(${=$(__mkr_host_ids "$cmd")})
+    fi
+    compadd -- $candidates
+}
+compdef _mkr mkr
+`
+
+func writeFishCompletion(w io.Writer, nodes []*completionNode) {
+	fmt.Fprint(w, "# fish completion for mkr\n\ncomplete -c mkr -f\n")
+	for _, n := range nodes {
+		condition := fishCondition(n.path)
+		for _, command := range n.subcommands {
+			fmt.Fprintf(w, "complete -c mkr -n %s -a %s -d %s\n", fishQuote(condition), command.Name, fishQuote(command.Usage))
+		}
+		for _, flag := range n.flags {
+			var opts []string
+			for _, name := range flagNames(flag) {
+				if strings.HasPrefix(name, "--") {
+					opts = append(opts, "-l "+strings.TrimPrefix(name, "--"))
+				} else {
+					opts = append(opts, "-s "+strings.TrimPrefix(name, "-"))
+				}
+			}
+			if n.path == "mkr" {
+				fmt.Fprintf(w, "complete -c mkr %s -d %s\n", strings.Join(opts, " "), fishQuote(flagUsage(flag)))
+			} else {
+				fmt.Fprintf(w, "complete -c mkr -n %s %s -d %s\n", fishQuote(condition), strings.Join(opts, " "), fishQuote(flagUsage(flag)))
+			}
+		}
+	}
+	var names []string
+	for _, path := range hostIDCompletionCommands {
+		names = append(names, strings.TrimPrefix(path, "mkr "))
+	}
+	fmt.Fprintf(w, "complete -c mkr -n %s -a '(mkr hosts --ids-only 2>/dev/null)'\n", fishQuote("__fish_seen_subcommand_from "+strings.Join(names, " ")))
+}
+
+// fishCondition returns the condition that the command line is at the command path
+func fishCondition(path string) string {
+	words := strings.Fields(path)[1:]
+	if len(words) == 0 {
+		return "__fish_use_subcommand"
+	}
+	return "__fish_seen_subcommand_from " + words[len(words)-1]
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+func TestWriteCompletion(t *testing.T) {
+	globalFlags := []cli.Flag{cli.StringFlag{Name: "conf", Usage: "Config file path"}}
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var buf bytes.Buffer
+		if err := writeCompletion(&buf, shell, Commands, globalFlags); err != nil {
+			t.Errorf("writeCompletion(%q) should not raise error: %v", shell, err)
+			continue
+		}
+		script := buf.String()
+		for _, command := range Commands {
+			if !strings.Contains(script, command.Name) {
+				t.Errorf("completion script for %s should contain %q", shell, command.Name)
+			}
+		}
+		for _, word := range []string{"--conf", "install", "ids-only"} {
+			if !strings.Contains(script, word) {
+				t.Errorf("completion script for %s should contain %q", shell, word)
+			}
+		}
+	}
+
+	if err := writeCompletion(&bytes.Buffer{}, "tcsh", Commands, globalFlags); err == nil {
+		t.Errorf("writeCompletion should raise error for an unsupported shell")
+	}
+}
+
+func TestFlagNames(t *testing.T) {
+	testCases := []struct {
+		flag cli.Flag
+		want string
+	}{
+		{cli.BoolFlag{Name: "verbose, v"}, "--verbose -v"},
+		{cli.StringFlag{Name: "status, st"}, "--status --st"},
+		{cli.StringFlag{Name: "field"}, "--field"},
+	}
+	for _, testCase := range testCases {
+		if got := strings.Join(flagNames(testCase.flag), " "); got != testCase.want {
+			t.Errorf("flagNames should be %q but got %q", testCase.want, got)
+		}
+	}
+}
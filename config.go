@@ -1,10 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/mackerelio/mackerel-agent/config"
 )
 
@@ -15,7 +18,11 @@ func idFilePath(root string) string {
 }
 
 func loadHostID(root string) (string, error) {
-	content, err := ioutil.ReadFile(idFilePath(root))
+	return loadHostIDFile(idFilePath(root))
+}
+
+func loadHostIDFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
 	if err != nil {
 		return "", err
 	}
@@ -59,6 +66,36 @@ func LoadApikeyFromEnvOrConfig(conffile string) string {
 	return key
 }
 
+// commandConfig is the settings for a command in the [commands.<command>] section of the config file,
+// which take precedence over the top-level settings for the command only.
+type commandConfig struct {
+	Apikey string `toml:"apikey"`
+}
+
+func loadCommandConfig(conffile, command string) *commandConfig {
+	var conf struct {
+		Commands map[string]*commandConfig `toml:"commands"`
+	}
+	if _, err := toml.DecodeFile(conffile, &conf); err != nil {
+		return nil
+	}
+	return conf.Commands[command]
+}
+
+// LoadApikeyForCommand gets the apikey for the command. The precedence is:
+// 1. MACKEREL_APIKEY environment variable
+// 2. apikey in the [commands.<command>] section of the config file
+// 3. apikey in the top level of the config file
+func LoadApikeyForCommand(conffile, command string) string {
+	if apiKey := os.Getenv("MACKEREL_APIKEY"); apiKey != "" {
+		return apiKey
+	}
+	if commandConf := loadCommandConfig(conffile, command); commandConf != nil && commandConf.Apikey != "" {
+		return commandConf.Apikey
+	}
+	return LoadApikeyFromConfig(conffile)
+}
+
 // LoadHostIDFromConfig gets localhost's hostID from conf.Root (ex. /var/lib/mackerel/id) if it's installed mackerel-agent on localhost
 func LoadHostIDFromConfig(conffile string) string {
 	conf, err := config.LoadConfig(conffile)
@@ -71,3 +108,27 @@ func LoadHostIDFromConfig(conffile string) string {
 	}
 	return hostID
 }
+
+// LoadLocalHostID gets localhost's hostID from idFile, or from the id file under conf.Root if idFile is empty.
+// Unlike LoadHostIDFromConfig, the reason is returned as an error if the hostID is not available.
+func LoadLocalHostID(conffile, idFile string) (string, error) {
+	if idFile == "" {
+		root := config.DefaultConfig.Root
+		if conf, err := config.LoadConfig(conffile); err == nil && conf.Root != "" {
+			root = conf.Root
+		}
+		idFile = idFilePath(root)
+	}
+	content, err := loadHostIDFile(idFile)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("the host id file %s is not found. Is mackerel-agent running on this host?", idFile)
+	}
+	if err != nil {
+		return "", err
+	}
+	hostID := strings.TrimSpace(content)
+	if hostID == "" {
+		return "", fmt.Errorf("the host id file %s is empty", idFile)
+	}
+	return hostID, nil
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -76,3 +79,48 @@ func TestLoadHostIDFromConfig(t *testing.T) {
 		t.Error("should be 9876ABCD")
 	}
 }
+
+func TestLoadApikeyForCommand(t *testing.T) {
+	os.Setenv("MACKEREL_APIKEY", "")
+
+	conffile := "test/mackerel-agent-commands.conf"
+
+	if apiKey := LoadApikeyForCommand(conffile, "throw"); apiKey != "WRITEONLY1234" {
+		t.Error("should be WRITEONLY1234 for throw")
+	}
+	if apiKey := LoadApikeyForCommand(conffile, "hosts"); apiKey != "123456ABCD" {
+		t.Error("should be 123456ABCD for commands without their own section")
+	}
+	if apiKey := LoadApikeyForCommand("test/mackerel-agent.conf", "throw"); apiKey != "123456ABCD" {
+		t.Error("should be 123456ABCD without [commands.throw] section")
+	}
+
+	os.Setenv("MACKEREL_APIKEY", "ENV_API_KEY")
+	defer os.Setenv("MACKEREL_APIKEY", "")
+	if apiKey := LoadApikeyForCommand(conffile, "throw"); apiKey != "ENV_API_KEY" {
+		t.Error("MACKEREL_APIKEY should take precedence over the config file")
+	}
+}
+
+func TestLoadLocalHostID(t *testing.T) {
+	if hostID, err := LoadLocalHostID("test/mackerel-agent.conf", ""); err != nil || hostID != "9876ABCD" {
+		t.Errorf("should be 9876ABCD but got %q (%v)", hostID, err)
+	}
+
+	dir, err := ioutil.TempDir("", "mkr-id")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	idFile := filepath.Join(dir, "id")
+	ioutil.WriteFile(idFile, []byte("3XYyG\n"), 0644)
+
+	if hostID, err := LoadLocalHostID("test/mackerel-agent.conf", idFile); err != nil || hostID != "3XYyG" {
+		t.Errorf("the id file should take precedence, and should be 3XYyG but got %q (%v)", hostID, err)
+	}
+
+	_, err = LoadLocalHostID("test/mackerel-agent.conf", filepath.Join(dir, "not_exists"))
+	if err == nil || !strings.Contains(err.Error(), "is not found") {
+		t.Errorf("should raise error for the missing id file but got %v", err)
+	}
+}
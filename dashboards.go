@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/url"
 	"strconv"
@@ -22,14 +23,25 @@ var commandDashboards = cli.Command{
 		{
 			Name:      "generate",
 			Usage:     "Generate custom dashboard",
-			ArgsUsage: "[--print | -p] <file>",
+			ArgsUsage: "[--print | -p] (<file> | --service <service> [--roles <role>]... [--metrics <graph_name>]... [--columns <N>] [--height <height>] [--width <width>] [--out <path>])",
 			Description: `
     A custom dashboard is registered from a yaml file.
+    With --service instead of <file>, a starter dashboard is generated, which has a section of role graphs
+    for each of --roles (all roles of the service by default) with the graphs of --metrics in <N> columns.
+    The default metrics are loadavg5, cpu, memory, disk and interface.
+    With --out, the definition is written to <path> in the yaml format of <file> to be customized, instead of registered.
     Requests "POST /api/v0/dashboards". See https://mackerel.io/ja/api-docs/entry/dashboards#create.
 `,
 			Action: doGenerateDashboards,
 			Flags: []cli.Flag{
 				cli.BoolFlag{Name: "print, p", Usage: "markdown is output in standard output."},
+				cli.StringFlag{Name: "service, s", Usage: "Generate a starter dashboard for <service> instead of reading <file>"},
+				cli.StringSliceFlag{Name: "roles, r", Value: &cli.StringSlice{}, Usage: "Roles of the service to show graphs. Multiple choices are allowed. The default is all roles"},
+				cli.StringSliceFlag{Name: "metrics, m", Value: &cli.StringSlice{}, Usage: "Graph names shown for each role. Multiple choices are allowed"},
+				cli.IntFlag{Name: "columns", Value: 2, Usage: "The number of graphs in a row of the starter dashboard"},
+				cli.IntFlag{Name: "height", Value: 200, Usage: "The height of graphs of the starter dashboard"},
+				cli.IntFlag{Name: "width", Value: 400, Usage: "The width of graphs of the starter dashboard"},
+				cli.StringFlag{Name: "out", Usage: "Write the starter dashboard definition to <path> instead of registering it. '-' means stdout"},
 			},
 		},
 	},
@@ -39,11 +51,11 @@ type graphsConfig struct {
 	ConfigVersion   string             `yaml:"config_version"`
 	Title           string             `yaml:"title"`
 	URLPath         string             `yaml:"url_path"`
-	Format          string             `yaml:"format"`
-	Height          int                `yaml:"height"`
-	Width           int                `yaml:"width"`
-	HostGraphFormat []*hostGraphFormat `yaml:"host_graphs"`
-	GraphFormat     []*graphFormat     `yaml:"graphs"`
+	Format          string             `yaml:"format,omitempty"`
+	Height          int                `yaml:"height,omitempty"`
+	Width           int                `yaml:"width,omitempty"`
+	HostGraphFormat []*hostGraphFormat `yaml:"host_graphs,omitempty"`
+	GraphFormat     []*graphFormat     `yaml:"graphs,omitempty"`
 }
 
 type hostGraphFormat struct {
@@ -60,16 +72,16 @@ type graphFormat struct {
 }
 
 type graphDef struct {
-	HostID      string `yaml:"host_id"`
-	ServiceName string `yaml:"service_name"`
-	RoleName    string `yaml:"role_name"`
-	Query       string `yaml:"query"`
-	GraphName   string `yaml:"graph_name"`
-	GraphTitle  string `yaml:"title"`
-	Unit        string `yaml:"unit"`
-	Period      string `yaml:"period"`
-	Stacked     bool   `yaml:"stacked"`
-	Simplified  bool   `yaml:"simplified"`
+	HostID      string `yaml:"host_id,omitempty"`
+	ServiceName string `yaml:"service_name,omitempty"`
+	RoleName    string `yaml:"role_name,omitempty"`
+	Query       string `yaml:"query,omitempty"`
+	GraphName   string `yaml:"graph_name,omitempty"`
+	GraphTitle  string `yaml:"title,omitempty"`
+	Unit        string `yaml:"unit,omitempty"`
+	Period      string `yaml:"period,omitempty"`
+	Stacked     bool   `yaml:"stacked,omitempty"`
+	Simplified  bool   `yaml:"simplified,omitempty"`
 }
 
 func (g graphDef) isHostGraph() bool {
@@ -360,23 +372,80 @@ func makeImageMarkdown(orgName string, g baseGraph) string {
 	return fmt.Sprintf("[![graph](%s)](%s)", g.getURL(orgName, true), g.getPermalink(orgName))
 }
 
-func doGenerateDashboards(c *cli.Context) error {
-	isStdout := c.Bool("print")
+// the graphs of each role in a starter dashboard by default
+var defaultStarterDashboardMetrics = []string{"loadavg5", "cpu", "memory", "disk", "interface"}
 
-	argFilePath := c.Args()
-	if len(argFilePath) < 1 {
-		cli.ShowCommandHelp(c, "generate")
-		return cli.NewExitError("specify a yaml file.", 1)
+// generateStarterDashboardConfig returns the dashboard definition with a section of the graphs for each role
+func generateStarterDashboardConfig(service string, roles, metrics []string, columns, height, width int) *graphsConfig {
+	if len(metrics) == 0 {
+		metrics = defaultStarterDashboardMetrics
+	}
+	yml := &graphsConfig{
+		ConfigVersion: "0.9",
+		Title:         service + " overview",
+		URLPath:       service + "-overview",
+		Format:        "iframe",
+		Height:        height,
+		Width:         width,
 	}
+	for _, role := range roles {
+		g := &graphFormat{Headline: service + ":" + role, ColumnCount: columns}
+		for _, metric := range metrics {
+			g.GraphDefs = append(g.GraphDefs, &graphDef{ServiceName: service, RoleName: role, GraphName: metric, Period: "1h"})
+		}
+		yml.GraphFormat = append(yml.GraphFormat, g)
+	}
+	return yml
+}
 
-	buf, err := ioutil.ReadFile(argFilePath[0])
-	logger.DieIf(err)
+func doGenerateDashboards(c *cli.Context) error {
+	isStdout := c.Bool("print")
+	client := newMackerelFromContext(c)
 
-	yml := graphsConfig{}
-	err = yaml.Unmarshal(buf, &yml)
-	logger.DieIf(err)
+	var yml graphsConfig
+	if service := c.String("service"); service != "" {
+		if len(c.Args()) > 0 {
+			return cli.NewExitError("<file> and --service cannot be specified together.", 1)
+		}
+		if c.Int("columns") < 1 {
+			return cli.NewExitError(fmt.Sprintf("--columns should be positive: %d", c.Int("columns")), 1)
+		}
+		roles := c.StringSlice("roles")
+		if len(roles) == 0 {
+			services, err := client.FindServices()
+			logger.DieIf(err)
+			for _, s := range services {
+				if s.Name == service {
+					roles = s.Roles
+				}
+			}
+			if len(roles) == 0 {
+				return cli.NewExitError(fmt.Sprintf("service %s is not found or has no roles.", service), 1)
+			}
+		}
+		yml = *generateStarterDashboardConfig(service, roles, c.StringSlice("metrics"), c.Int("columns"), c.Int("height"), c.Int("width"))
+		if out := c.String("out"); out != "" {
+			data, err := yaml.Marshal(yml)
+			logger.DieIf(err)
+			logger.DieIf(writeOutput(out, func(w io.Writer) error {
+				_, err := w.Write(data)
+				return err
+			}))
+			return nil
+		}
+	} else {
+		argFilePath := c.Args()
+		if len(argFilePath) < 1 {
+			cli.ShowCommandHelp(c, "generate")
+			return cli.NewExitError("specify a yaml file.", 1)
+		}
 
-	client := newMackerelFromContext(c)
+		buf, err := ioutil.ReadFile(argFilePath[0])
+		logger.DieIf(err)
+
+		err = yaml.Unmarshal(buf, &yml)
+		logger.DieIf(err)
+	}
 
 	org, err := client.GetOrg()
 	logger.DieIf(err)
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -191,3 +193,36 @@ func TestGenerateMarkDown(t *testing.T) {
 		t.Errorf("output should be:\n%s\nbut:\n%s", expected, actual)
 	}
 }
+
+func TestGenerateStarterDashboardConfig(t *testing.T) {
+	metrics := []string{"loadavg5", "cpu", "memory"}
+	yml := generateStarterDashboardConfig("hoge", []string{"api", "db"}, metrics, 2, 200, 400)
+
+	if yml.ConfigVersion != "0.9" || yml.URLPath != "hoge-overview" {
+		t.Errorf("the dashboard should be a valid definition but got %+v", yml)
+	}
+	if len(yml.GraphFormat) != 2 {
+		t.Fatalf("a section should be generated for each role but got %d", len(yml.GraphFormat))
+	}
+	for i, role := range []string{"api", "db"} {
+		g := yml.GraphFormat[i]
+		if g.Headline != "hoge:"+role || g.ColumnCount != 2 {
+			t.Errorf("the section of %s should have the headline and 2 columns but got %+v", role, g)
+		}
+		md, err := generateGraphsMarkdownFactory(g, yml.Format, yml.Height, yml.Width)
+		if err != nil {
+			t.Fatalf("should not raise error: %v", err)
+		}
+		generated := md.generate("orgname")
+		for _, metric := range metrics {
+			widget := fmt.Sprintf("https://mackerel.io/embed/orgs/orgname/services/hoge/%s?graph=%s&", role, metric)
+			if strings.Count(generated, widget) != 1 {
+				t.Errorf("the section of %s should have a graph of %s but got:\n%s", role, metric, generated)
+			}
+		}
+	}
+
+	if got := generateStarterDashboardConfig("hoge", []string{"api"}, nil, 1, 200, 400); len(got.GraphFormat[0].GraphDefs) != len(defaultStarterDashboardMetrics) {
+		t.Errorf("the default metrics should be used but got %d graphs", len(got.GraphFormat[0].GraphDefs))
+	}
+}
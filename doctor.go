@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mackerelio/mackerel-agent/config"
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"github.com/mackerelio/mkr/plugin"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandDoctor = cli.Command{
+	Name:      "doctor",
+	Usage:     "Check the configuration of mkr",
+	ArgsUsage: "[--prefix <prefix>] [--output | -o <format>]",
+	Description: `
+    Check whether mkr is configured correctly, and print the result of each check with pass, warn or fail:
+    the config file, the API key, the reachability and latency of the API, and the writability of the plugin directory.
+    The API key is validated by "GET /api/v0/org". Checks continue even if the API is unreachable.
+    Exits with nonzero status if any check fails.
+`,
+	Action: doDoctor,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "prefix", Usage: "The plugin directory to check. The default is /opt/mackerel-agent/plugins"},
+		cli.StringFlag{Name: "output, o", Value: "text", Usage: "Output format ('text' or 'json')"},
+	},
+}
+
+// statuses of doctor checks
+const (
+	doctorPass = "pass"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+)
+
+// the latency of the API regarded as slow
+var doctorSlowLatency = time.Second
+
+type doctorCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func checkConfigFile(conffile string) *doctorCheck {
+	check := &doctorCheck{Name: "config file"}
+	if _, err := os.Stat(conffile); err != nil {
+		check.Status = doctorWarn
+		check.Message = fmt.Sprintf("%s is not found. Settings are taken from environment variables and flags", conffile)
+		return check
+	}
+	if _, err := config.LoadConfig(conffile); err != nil {
+		check.Status = doctorFail
+		check.Message = fmt.Sprintf("failed to parse %s: %s", conffile, err)
+		return check
+	}
+	check.Status = doctorPass
+	check.Message = conffile
+	return check
+}
+
+func checkAPIKey(apiKey string) *doctorCheck {
+	check := &doctorCheck{Name: "API key"}
+	if apiKey == "" {
+		check.Status = doctorFail
+		check.Message = "API key is not found in MACKEREL_APIKEY environment variable nor the config file"
+		return check
+	}
+	check.Status = doctorPass
+	check.Message = "API key is found"
+	return check
+}
+
+// checkAPI requests a cheap authenticated API, which validates the API key and tells the latency
+func checkAPI(client *mkr.Client) *doctorCheck {
+	check := &doctorCheck{Name: "API"}
+	var org struct {
+		Name string `json:"name"`
+	}
+	start := time.Now()
+	err := requestJSON(client, http.MethodGet, "/api/v0/org", nil, &org)
+	latency := time.Since(start)
+	if apiErr, ok := err.(*mkr.APIError); ok && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+		check.Status = doctorFail
+		check.Message = fmt.Sprintf("API key is invalid: %s", apiErr.Message)
+		return check
+	}
+	if err != nil {
+		check.Status = doctorFail
+		check.Message = fmt.Sprintf("%s is unreachable: %s", client.BaseURL, err)
+		return check
+	}
+	check.Status = doctorPass
+	if latency > doctorSlowLatency {
+		check.Status = doctorWarn
+	}
+	check.Message = fmt.Sprintf("organization %s (%s, %s)", org.Name, client.BaseURL, latency.Round(time.Millisecond))
+	return check
+}
+
+func checkPluginDir(prefix string) *doctorCheck {
+	check := &doctorCheck{Name: "plugin directory"}
+	pluginDir, err := plugin.CheckPluginDir(prefix)
+	if err != nil {
+		check.Status = doctorFail
+		check.Message = fmt.Sprintf("not writable: %s", err)
+		return check
+	}
+	check.Status = doctorPass
+	check.Message = pluginDir
+	return check
+}
+
+func printDoctorChecks(w io.Writer, checks []*doctorCheck) {
+	for _, check := range checks {
+		fmt.Fprintf(w, "[%s] %s: %s\n", check.Status, check.Name, check.Message)
+	}
+}
+
+func doDoctor(c *cli.Context) error {
+	output := c.String("output")
+	if output != "text" && output != "json" {
+		return cli.NewExitError(fmt.Sprintf("unknown output format: %s", output), 1)
+	}
+	confFile := c.GlobalString("conf")
+
+	checks := []*doctorCheck{checkConfigFile(confFile)}
+	apiKey := LoadApikeyForCommand(confFile, commandNameFromContext(c))
+	checks = append(checks, checkAPIKey(apiKey))
+	if apiKey != "" {
+		apiBase := c.GlobalString("apibase")
+		if apiBase == "" {
+			apiBase = LoadApibaseFromConfigWithFallback(confFile)
+		}
+		client, err := mkr.NewClientWithOptions(apiKey, apiBase, false)
+		if err != nil {
+			checks = append(checks, &doctorCheck{Name: "API", Status: doctorFail, Message: err.Error()})
+		} else {
+			configureClient(client, c.GlobalString("user-agent"), requestID)
+			if logger.IsDebug() {
+				setClientVerbose(client)
+			}
+			checks = append(checks, checkAPI(client))
+		}
+	}
+	checks = append(checks, checkPluginDir(c.String("prefix")))
+
+	if output == "json" {
+		PrettyPrintJSON(checks)
+	} else {
+		printDoctorChecks(os.Stdout, checks)
+	}
+	for _, check := range checks {
+		if check.Status == doctorFail {
+			os.Exit(1)
+		}
+	}
+	return nil
+}
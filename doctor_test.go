@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestCheckConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkr-doctor")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	broken := filepath.Join(dir, "broken.conf")
+	ioutil.WriteFile(broken, []byte("apikey = \n"), 0644)
+
+	testCases := []struct {
+		conffile string
+		status   string
+	}{
+		{"test/mackerel-agent.conf", doctorPass},
+		{filepath.Join(dir, "not_exists.conf"), doctorWarn},
+		{broken, doctorFail},
+	}
+	for _, testCase := range testCases {
+		if check := checkConfigFile(testCase.conffile); check.Status != testCase.status {
+			t.Errorf("status of %s should be %s but got %s: %s", testCase.conffile, testCase.status, check.Status, check.Message)
+		}
+	}
+}
+
+func TestCheckPluginDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkr-doctor")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if check := checkPluginDir(dir); check.Status != doctorPass || check.Message != dir {
+		t.Errorf("the plugin directory should pass but got %s: %s", check.Status, check.Message)
+	}
+	if files, _ := ioutil.ReadDir(filepath.Join(dir, "work")); len(files) != 0 {
+		t.Errorf("files written in the check should be removed but got %d files", len(files))
+	}
+
+	// a file blocks creating the plugin directory
+	file := filepath.Join(dir, "file")
+	ioutil.WriteFile(file, []byte{}, 0644)
+	if check := checkPluginDir(file); check.Status != doctorFail {
+		t.Errorf("the plugin directory should fail but got %s: %s", check.Status, check.Message)
+	}
+}
+
+func TestCheckAPI(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Api-Key") != "valid-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":{"message":"Authentication failed"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"name":"example-org"}`)
+	}))
+	defer ts.Close()
+
+	client, _ := mkr.NewClientWithOptions("valid-key", ts.URL, false)
+	if check := checkAPI(client); check.Status != doctorPass {
+		t.Errorf("the API check should pass but got %s: %s", check.Status, check.Message)
+	}
+
+	client, _ = mkr.NewClientWithOptions("invalid-key", ts.URL, false)
+	if check := checkAPI(client); check.Status != doctorFail {
+		t.Errorf("the API check should fail with an invalid API key but got %s: %s", check.Status, check.Message)
+	}
+
+	if check := checkAPIKey(""); check.Status != doctorFail {
+		t.Errorf("the API key check should fail without an API key but got %s", check.Status)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/httpclient"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandExport = cli.Command{
+	Name:      "export",
+	Usage:     "Export monitors, dashboards, channels and downtimes",
+	ArgsUsage: "--out <dir> [--include-secrets] [--only-changed]",
+	Description: `
+    Export monitors, dashboards, channels and downtimes to monitors.json, dashboards.json, channels.json
+    and downtimes.json under <dir>.
+    Each file is written atomically, and items are sorted by their IDs so that the files can be managed by git.
+    Secrets, which are URLs of channels and header values of external monitors, are replaced by "***"
+    unless --include-secrets.
+    With --only-changed, files whose JSON contents are the same as the exported ones, ignoring the order of keys
+    and the formatting, are left as they are, so that unchanged files don't make noise in git.
+`,
+	Action: doExport,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "out", Value: "", Usage: "Export files to <dir>"},
+		cli.BoolFlag{Name: "include-secrets", Usage: "Export secrets as they are"},
+		cli.BoolFlag{Name: "only-changed", Usage: "Rewrite only files whose contents are changed"},
+	},
+}
+
+var commandImport = cli.Command{
+	Name:      "import",
+	Usage:     "Import monitors and dashboards exported by mkr export",
+	ArgsUsage: "[--confirm] <dir>",
+	Description: `
+    Create or update monitors and dashboards in the files under <dir> exported by "mkr export".
+    Monitors are matched by IDs or names, and dashboards by IDs or URL paths.
+    Items containing redacted secrets are skipped. Channels are not imported because the API can't create them,
+    and downtimes are not either since they are for the time exported.
+    Without --confirm, only the actions are shown.
+`,
+	Action: doImport,
+	Flags: []cli.Flag{
+		cli.BoolFlag{Name: "confirm", Usage: "Apply the actions"},
+	},
+}
+
+// bundleResource is a kind of configuration exported into a file
+type bundleResource struct {
+	file string
+	key  string
+	path string
+	// nameKey identifies items without IDs on import. The resource isn't imported if empty.
+	nameKey string
+	redact  func(item map[string]interface{})
+}
+
+var bundleResources = []*bundleResource{
+	{file: "monitors.json", key: "monitors", path: "/api/v0/monitors", nameKey: "name", redact: redactMonitor},
+	{file: "dashboards.json", key: "dashboards", path: "/api/v0/dashboards", nameKey: "urlPath"},
+	{file: "channels.json", key: "channels", path: "/api/v0/channels", redact: redactChannel},
+	{file: "downtimes.json", key: "downtimes", path: "/api/v0/downtimes"},
+}
+
+func redactMonitor(item map[string]interface{}) {
+	headers, _ := item["headers"].([]interface{})
+	for _, header := range headers {
+		if h, ok := header.(map[string]interface{}); ok && httpclient.IsSensitiveHeader(fmt.Sprint(h["name"])) {
+			h["value"] = redactedValue
+		}
+	}
+}
+
+func redactChannel(item map[string]interface{}) {
+	if _, ok := item["url"]; ok {
+		item["url"] = redactedValue
+	}
+}
+
+func (r *bundleResource) fetch(client *mkr.Client) ([]map[string]interface{}, error) {
+	var data map[string][]map[string]interface{}
+	if err := requestJSON(client, http.MethodGet, r.path, nil, &data); err != nil {
+		return nil, err
+	}
+	items := data[r.key]
+	sort.SliceStable(items, func(i, j int) bool {
+		return fmt.Sprint(items[i]["id"]) < fmt.Sprint(items[j]["id"])
+	})
+	return items, nil
+}
+
+func (r *bundleResource) load(dir string) ([]map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, r.file))
+	if err != nil {
+		return nil, err
+	}
+	var data map[string][]map[string]interface{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", r.file, err)
+	}
+	return data[r.key], nil
+}
+
+// exportBundle writes all resources under dir, and returns the paths of written files.
+// With onlyChanged, files having the same contents are not rewritten.
+func exportBundle(client *mkr.Client, dir string, includeSecrets, onlyChanged bool) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, r := range bundleResources {
+		items, err := r.fetch(client)
+		if err != nil {
+			return files, fmt.Errorf("failed to fetch %s: %s", r.key, err)
+		}
+		if !includeSecrets && r.redact != nil {
+			for _, item := range items {
+				r.redact(item)
+			}
+		}
+		file := filepath.Join(dir, r.file)
+		data := JSONMarshalIndent(map[string]interface{}{r.key: items}, "", "    ") + "\n"
+		if onlyChanged && sameJSONFile(file, data) {
+			continue
+		}
+		if err := writeOutput(file, func(w io.Writer) error {
+			_, err := io.WriteString(w, data)
+			return err
+		}); err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// sameJSONFile returns whether the file exists and has the JSON which is the same as data after decoded
+func sameJSONFile(file, data string) bool {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	var existing, exported interface{}
+	if err := json.Unmarshal(content, &existing); err != nil {
+		return false
+	}
+	if err := json.Unmarshal([]byte(data), &exported); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(existing, exported)
+}
+
+// containsRedacted returns whether v contains the redacted value at any depth
+func containsRedacted(v interface{}) bool {
+	switch v := v.(type) {
+	case string:
+		return v == redactedValue
+	case []interface{}:
+		for _, e := range v {
+			if containsRedacted(e) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, e := range v {
+			if containsRedacted(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// importBundle creates or updates items in the files under dir.
+// Actions are written to w, and applied only if confirm is true.
+func importBundle(client *mkr.Client, dir string, confirm bool, w io.Writer) error {
+	for _, r := range bundleResources {
+		if r.nameKey == "" {
+			continue
+		}
+		locals, err := r.load(dir)
+		if err != nil {
+			return err
+		}
+		remotes, err := r.fetch(client)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %s", r.key, err)
+		}
+
+		for _, local := range locals {
+			name := fmt.Sprint(local[r.nameKey])
+			if containsRedacted(local) {
+				logger.Log("warning", fmt.Sprintf("%s %q contains redacted secrets, skipped", r.key, name))
+				continue
+			}
+			payload := map[string]interface{}{}
+			for k, v := range local {
+				if k != "id" {
+					payload[k] = v
+				}
+			}
+
+			var remote map[string]interface{}
+			for _, m := range remotes {
+				if (local["id"] != nil && m["id"] == local["id"]) || (local["id"] == nil && fmt.Sprint(m[r.nameKey]) == name) {
+					remote = m
+					break
+				}
+			}
+			method, path, action := http.MethodPost, r.path, "create"
+			if remote != nil {
+				id := remote["id"]
+				delete(remote, "id")
+				if reflect.DeepEqual(remote, payload) {
+					continue
+				}
+				method, path, action = http.MethodPut, r.path+"/"+url.PathEscape(fmt.Sprint(id)), "update"
+			}
+			fmt.Fprintf(w, "%s %s %q\n", action, r.key, name)
+			if confirm {
+				if err := requestJSON(client, method, path, payload, nil); err != nil {
+					return fmt.Errorf("failed to %s %s %q: %s", action, r.key, name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func doExport(c *cli.Context) error {
+	dir := c.String("out")
+	if dir == "" {
+		cli.ShowCommandHelp(c, "export")
+		os.Exit(1)
+	}
+	files, err := exportBundle(newMackerelFromContext(c), dir, c.Bool("include-secrets"), c.Bool("only-changed"))
+	logger.DieIf(err)
+	for _, file := range files {
+		logger.Log("info", fmt.Sprintf("exported to %s", file))
+	}
+	return nil
+}
+
+func doImport(c *cli.Context) error {
+	dir := c.Args().First()
+	if dir == "" {
+		cli.ShowCommandHelp(c, "import")
+		os.Exit(1)
+	}
+	confirm := c.Bool("confirm")
+	logger.DieIf(importBundle(newMackerelFromContext(c), dir, confirm, os.Stdout))
+	if !confirm {
+		logger.Log("info", "nothing is applied. Specify --confirm to apply the actions.")
+	}
+	return nil
+}
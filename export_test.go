@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func newExportTestClient(t *testing.T, requests *[]string) (*mkr.Client, *httptest.Server) {
+	return newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		*requests = append(*requests, req.Method+" "+req.URL.Path)
+		switch req.URL.Path {
+		case "/api/v0/monitors":
+			fmt.Fprint(w, `{"monitors":[
+				{"id":"3Xb","type":"external","name":"blog","url":"https://example.com/","headers":[{"name":"X-Token","value":"secret"}]},
+				{"id":"3Xa","type":"host","name":"cpu","metric":"cpu%","operator":">","warning":80}
+			]}`)
+		case "/api/v0/dashboards":
+			fmt.Fprint(w, `{"dashboards":[{"id":"2Yc","title":"Top","urlPath":"top","bodyMarkdown":"# top"}]}`)
+		case "/api/v0/channels":
+			fmt.Fprint(w, `{"channels":[{"id":"1Zd","name":"slack","type":"slack","url":"https://hooks.slack.com/services/secret"},{"id":"1Zc","name":"mail","type":"email","emails":["a@example.com"]}]}`)
+		case "/api/v0/downtimes":
+			fmt.Fprint(w, `{"downtimes":[{"id":"4Wf","name":"maintenance","start":1500000000,"duration":60}]}`)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	})
+}
+
+func TestExportBundle(t *testing.T) {
+	var requests []string
+	client, ts := newExportTestClient(t, &requests)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "mkr-export")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files, err := exportBundle(client, dir, false, false)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	want := []string{filepath.Join(dir, "monitors.json"), filepath.Join(dir, "dashboards.json"), filepath.Join(dir, "channels.json"), filepath.Join(dir, "downtimes.json")}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Errorf("files should be %v but got %v", want, files)
+	}
+
+	monitors, _ := ioutil.ReadFile(want[0])
+	if strings.Index(string(monitors), `"3Xa"`) > strings.Index(string(monitors), `"3Xb"`) {
+		t.Errorf("monitors should be sorted by ids but got:\n%s", monitors)
+	}
+	if strings.Contains(string(monitors), "secret") || !strings.Contains(string(monitors), `"value": "***"`) {
+		t.Errorf("header values should be redacted but got:\n%s", monitors)
+	}
+	channels, _ := ioutil.ReadFile(want[2])
+	if strings.Contains(string(channels), "secret") || !strings.Contains(string(channels), `"url": "***"`) {
+		t.Errorf("channel urls should be redacted but got:\n%s", channels)
+	}
+	if n := strings.Count(string(channels), redactedValue); n != 1 {
+		t.Errorf("only channels with urls should be redacted but got %d redactions:\n%s", n, channels)
+	}
+	if dashboards, _ := ioutil.ReadFile(want[1]); !strings.Contains(string(dashboards), `"urlPath": "top"`) {
+		t.Errorf("dashboards should be exported but got:\n%s", dashboards)
+	}
+	if downtimes, _ := ioutil.ReadFile(want[3]); !strings.Contains(string(downtimes), `"name": "maintenance"`) {
+		t.Errorf("downtimes should be exported but got:\n%s", downtimes)
+	}
+
+	if _, err := exportBundle(client, dir, true, false); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if channels, _ := ioutil.ReadFile(want[2]); !strings.Contains(string(channels), "hooks.slack.com/services/secret") {
+		t.Errorf("secrets should be exported with includeSecrets but got:\n%s", channels)
+	}
+}
+
+func TestExportBundle_onlyChanged(t *testing.T) {
+	var requests []string
+	client, ts := newExportTestClient(t, &requests)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "mkr-export")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the same monitors with keys in another order and formatting
+	monitorsFile := filepath.Join(dir, "monitors.json")
+	content := `{"monitors":[{"name":"cpu","id":"3Xa","type":"host","metric":"cpu%","operator":">","warning":80},` +
+		`{"headers":[{"value":"***","name":"X-Token"}],"id":"3Xb","type":"external","name":"blog","url":"https://example.com/"}]}`
+	if err := ioutil.WriteFile(monitorsFile, []byte(content), 0644); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(monitorsFile, past, past)
+
+	files, err := exportBundle(client, dir, false, true)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	want := []string{filepath.Join(dir, "dashboards.json"), filepath.Join(dir, "channels.json"), filepath.Join(dir, "downtimes.json")}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Errorf("files should be %v but got %v", want, files)
+	}
+	if got, _ := ioutil.ReadFile(monitorsFile); string(got) != content {
+		t.Errorf("the unchanged file should not be rewritten but got:\n%s", got)
+	}
+	if fi, err := os.Stat(monitorsFile); err != nil || !fi.ModTime().Equal(past) {
+		t.Errorf("the modification time of the unchanged file should be kept but got %v", fi.ModTime())
+	}
+
+	files, _ = exportBundle(client, dir, true, true)
+	if len(files) != 2 || files[0] != monitorsFile {
+		t.Errorf("changed files should be rewritten but got %v", files)
+	}
+}
+
+func TestImportBundle(t *testing.T) {
+	var requests []string
+	client, ts := newExportTestClient(t, &requests)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "mkr-export")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := exportBundle(client, dir, false, false); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "dashboards.json"), []byte(`{"dashboards":[
+		{"id":"2Yc","title":"Top","urlPath":"top","bodyMarkdown":"# new top"},
+		{"title":"New","urlPath":"new","bodyMarkdown":"# new"}
+	]}`), 0644)
+
+	var buf bytes.Buffer
+	requests = nil
+	if err := importBundle(client, dir, false, &buf); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	want := "update dashboards \"top\"\ncreate dashboards \"new\"\n"
+	if buf.String() != want {
+		t.Errorf("actions should be:\n%s\nbut got:\n%s", want, buf.String())
+	}
+	for _, r := range requests {
+		if !strings.HasPrefix(r, "GET ") {
+			t.Errorf("nothing should be applied without confirm but got %s", r)
+		}
+	}
+
+	buf.Reset()
+	requests = nil
+	if err := importBundle(client, dir, true, &buf); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	wantRequests := "GET /api/v0/monitors,GET /api/v0/dashboards,PUT /api/v0/dashboards/2Yc,POST /api/v0/dashboards"
+	if got := strings.Join(requests, ","); got != wantRequests {
+		t.Errorf("requests should be %s but got %s", wantRequests, got)
+	}
+}
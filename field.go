@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// fieldSelector represents a minimal jq-like path, such as `.[].name`.
+// Only dotted object keys and the array wildcard `[]` are supported.
+type fieldSelector []string
+
+// the token which matches every element of an array
+const fieldWildcard = "[]"
+
+func parseFieldSelector(path string) (fieldSelector, error) {
+	if !strings.HasPrefix(path, ".") {
+		return nil, fmt.Errorf("invalid field path %q: it should start with '.'", path)
+	}
+	var selector fieldSelector
+	if path == "." {
+		return selector, nil
+	}
+	for _, token := range strings.Split(path[1:], ".") {
+		key := token
+		wildcard := false
+		if strings.HasSuffix(token, fieldWildcard) {
+			key = strings.TrimSuffix(token, fieldWildcard)
+			wildcard = true
+		}
+		if strings.ContainsAny(key, "[]") || (key == "" && !wildcard) {
+			return nil, fmt.Errorf("invalid field path %q: unexpected token %q", path, token)
+		}
+		if key != "" {
+			selector = append(selector, key)
+		}
+		if wildcard {
+			selector = append(selector, fieldWildcard)
+		}
+	}
+	return selector, nil
+}
+
+// extract returns values at the selector in src.
+// src is converted to generic JSON values at first, so json tags are used as keys.
+func (s fieldSelector) extract(src interface{}) ([]interface{}, error) {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{v}
+	for _, token := range s {
+		var next []interface{}
+		for _, value := range values {
+			if token == fieldWildcard {
+				a, ok := value.([]interface{})
+				if !ok {
+					return nil, fmt.Errorf("cannot iterate over non-array value with '[]'")
+				}
+				next = append(next, a...)
+				continue
+			}
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("cannot look up field %q in non-object value", token)
+			}
+			fv, ok := m[token]
+			if !ok {
+				return nil, fmt.Errorf("field %q is not found", token)
+			}
+			next = append(next, fv)
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// printFields outputs values at the field path line by line.
+// Strings are printed as they are, and other values are printed as JSON.
+func printFields(w io.Writer, src interface{}, path string) error {
+	selector, err := parseFieldSelector(path)
+	if err != nil {
+		return err
+	}
+	values, err := selector.extract(src)
+	if err != nil {
+		return fmt.Errorf("failed to extract field %q: %s", path, err)
+	}
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			fmt.Fprintln(w, s)
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, replaceAngleBrackets(string(data)))
+	}
+	return nil
+}
+
+// PrettyPrintJSONOrField outputs indented json, or only values at the field path if it is specified.
+func PrettyPrintJSONOrField(src interface{}, path string) error {
+	return fprettyPrintJSONOrField(os.Stdout, src, path)
+}
+
+// fprettyPrintJSONOrField is similar to PrettyPrintJSONOrField, but outputs to w.
+func fprettyPrintJSONOrField(w io.Writer, src interface{}, path string) error {
+	if path == "" {
+		fprettyPrintJSON(w, src)
+		return nil
+	}
+	return printFields(w, src, path)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+func TestPrintFields(t *testing.T) {
+	hosts := []*HostFormat{
+		{ID: "3XYyG", Name: "app01.example.com", Status: "working", RoleFullnames: []string{"foo:app"}},
+		{ID: "3XYyH", Name: "app02.example.com", Status: "standby", RoleFullnames: []string{"foo:app", "foo:batch"}},
+	}
+
+	testCases := []struct {
+		path string
+		want string
+	}{
+		{".[].name", "app01.example.com\napp02.example.com\n"},
+		{".[].roleFullnames[]", "foo:app\nfoo:app\nfoo:batch\n"},
+		{".[].isRetired", "false\nfalse\n"},
+	}
+
+	for _, testCase := range testCases {
+		var buf bytes.Buffer
+		if err := printFields(&buf, hosts, testCase.path); err != nil {
+			t.Errorf("printFields(%q) should not raise error: %v", testCase.path, err)
+		}
+		if got := buf.String(); got != testCase.want {
+			t.Errorf("printFields(%q) should be:\n%s\nbut got:\n%s", testCase.path, testCase.want, got)
+		}
+	}
+}
+
+func TestPrintFields_error(t *testing.T) {
+	hosts := []*HostFormat{{ID: "3XYyG", Name: "app01.example.com"}}
+
+	for _, path := range []string{"name", ".[].", ".[0].name", ".name", ".[].unknown[]", ".[].name[]"} {
+		var buf bytes.Buffer
+		if err := printFields(&buf, hosts, path); err == nil {
+			t.Errorf("printFields(%q) should raise error", path)
+		}
+	}
+}
+
+// runFieldTestCommand runs the command with args against the stub server, and returns the output written by --out.
+func runFieldTestCommand(t *testing.T, command cli.Command, handler http.HandlerFunc, args ...string) (string, error) {
+	dir, err := ioutil.TempDir("", "mkr-field")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.txt")
+
+	if err := runTestCommand(t, command, handler, append(args, "--out", path)...); err != nil {
+		return "", err
+	}
+	content, _ := ioutil.ReadFile(path)
+	return string(content), nil
+}
+
+func TestHosts_field(t *testing.T) {
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"hosts":[{"id":"3XYyG","name":"app01.example.com","status":"working"},{"id":"3XYyH","name":"app02.example.com","status":"standby"}]}`)
+	}
+
+	out, err := runFieldTestCommand(t, commandHosts, handler, "hosts", "--field", ".[].name")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if want := "app01.example.com\napp02.example.com\n"; out != want {
+		t.Errorf("output should be:\n%s\nbut got:\n%s", want, out)
+	}
+
+	for _, args := range [][]string{
+		{"hosts", "--field", ".[].name", "--format", "{{range .}}{{.ID}}{{end}}"},
+		{"hosts", "--field", ".[].name", "-o", "table"},
+		{"hosts", "--field", ".[].name", "--ids-only"},
+	} {
+		if _, err := runFieldTestCommand(t, commandHosts, handler, args...); err == nil {
+			t.Errorf("%v should raise error", args)
+		}
+	}
+}
+
+func TestAlertsList_field(t *testing.T) {
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/v0/hosts":
+			fmt.Fprint(w, `{"hosts":[]}`)
+		case "/api/v0/monitors":
+			fmt.Fprint(w, `{"monitors":[{"id":"m1","type":"host","name":"cpu"}]}`)
+		default:
+			fmt.Fprint(w, `{"alerts":[
+				{"id":"a2","status":"CRITICAL","monitorId":"m1","type":"host","openedAt":1500002000},
+				{"id":"a1","status":"WARNING","monitorId":"m1","type":"host","openedAt":1500001000}
+			]}`)
+		}
+	}
+	alertsList := commandAlerts.Subcommands[0]
+
+	for _, args := range [][]string{
+		{"list", "--field", ".[].id"},
+		{"list", "--format", "json", "--field", ".[].id"},
+	} {
+		out, err := runFieldTestCommand(t, alertsList, handler, args...)
+		if err != nil {
+			t.Fatalf("%v should not raise error: %v", args, err)
+		}
+		if want := "a2\na1\n"; out != want {
+			t.Errorf("output of %v should be:\n%s\nbut got:\n%s", args, want, out)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"list", "--field", ".[].id", "--format", "tsv"},
+		{"list", "--field", ".[].id", "--template", "{{.Alert.ID}}"},
+		{"list", "--field", ".[]."},
+	} {
+		if _, err := runFieldTestCommand(t, alertsList, handler, args...); err == nil {
+			t.Errorf("%v should raise error", args)
+		}
+	}
+}
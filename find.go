@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandFind = cli.Command{
+	Name:      "find",
+	Usage:     "Find hosts by a custom identifier",
+	ArgsUsage: "--custom-identifier <customIdentifier> [--ids-only] [--output | -o <format>] [--out <path>]",
+	Description: `
+    Find hosts which have <customIdentifier>, such as an instance ID of a cloud service, and show their IDs and names.
+    Exits with nonzero status if no hosts match.
+    Requests "GET /api/v0/hosts?customIdentifier=<customIdentifier>". See https://mackerel.io/api-docs/entry/hosts#list .
+`,
+	Action: doFind,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "custom-identifier", Value: "", Usage: "Find hosts which have <customIdentifier>."},
+		cli.BoolFlag{Name: "ids-only", Usage: "Print only host IDs line by line"},
+		cli.StringFlag{Name: "output, o", Value: "table", Usage: "Output format ('table' or 'json')"},
+		outFlag,
+	},
+}
+
+func findHostsByCustomIdentifier(client *mkr.Client, customIdentifier string) ([]*mkr.Host, error) {
+	var data struct {
+		Hosts []*mkr.Host `json:"hosts"`
+	}
+	path := "/api/v0/hosts?customIdentifier=" + url.QueryEscape(customIdentifier)
+	if err := requestJSON(client, "GET", path, nil, &data); err != nil {
+		return nil, err
+	}
+	if len(data.Hosts) == 0 {
+		return nil, fmt.Errorf("no hosts have the custom identifier '%s'", customIdentifier)
+	}
+	return data.Hosts, nil
+}
+
+func printHostsIDAndName(w io.Writer, hosts []*mkr.Host) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME")
+	for _, host := range hosts {
+		fmt.Fprintf(tw, "%s\t%s\n", host.ID, host.Name)
+	}
+	tw.Flush()
+}
+
+func doFind(c *cli.Context) error {
+	customIdentifier := c.String("custom-identifier")
+	if customIdentifier == "" {
+		cli.ShowCommandHelp(c, "find")
+		os.Exit(1)
+	}
+	output := c.String("output")
+	if output != "table" && output != "json" {
+		return cli.NewExitError(fmt.Sprintf("unknown output format: %s", output), 1)
+	}
+
+	hosts, err := findHostsByCustomIdentifier(newMackerelFromContext(c), customIdentifier)
+	logger.DieIf(err)
+
+	logger.DieIf(writeOutput(c.String("out"), func(w io.Writer) error {
+		switch {
+		case c.Bool("ids-only"):
+			printHostIDs(w, hosts)
+		case output == "json":
+			var hostsFormat []*HostFormat
+			for _, host := range hosts {
+				hostsFormat = append(hostsFormat, newHostFormat(host))
+			}
+			fprettyPrintJSON(w, hostsFormat)
+		default:
+			printHostsIDAndName(w, hosts)
+		}
+		return nil
+	}))
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestFindHostsByCustomIdentifier(t *testing.T) {
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v0/hosts" {
+			t.Errorf("request path should be /api/v0/hosts but got %s", req.URL.Path)
+		}
+		switch req.URL.Query().Get("customIdentifier") {
+		case "i-0123456789abcdef0":
+			fmt.Fprint(w, `{"hosts":[{"id":"3XYyG","name":"app01.example.com"}]}`)
+		default:
+			fmt.Fprint(w, `{"hosts":[]}`)
+		}
+	})
+	defer ts.Close()
+
+	hosts, err := findHostsByCustomIdentifier(client, "i-0123456789abcdef0")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	var buf bytes.Buffer
+	printHostsIDAndName(&buf, hosts)
+	if want, got := "ID     NAME\n3XYyG  app01.example.com\n", buf.String(); got != want {
+		t.Errorf("output should be:\n%s\nbut got:\n%s", want, got)
+	}
+
+	if _, err := findHostsByCustomIdentifier(client, "i-unknown"); err == nil {
+		t.Errorf("should raise error if no hosts match")
+	}
+}
@@ -3,9 +3,13 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
 	"strings"
+	"time"
 
+	mkr "github.com/mackerelio/mackerel-client-go"
 	"github.com/mackerelio/mkr/logger"
 )
 
@@ -20,11 +24,83 @@ type HostFormat struct {
 	IsRetired     bool              `json:"isRetired"` // 'omitempty' regard boolean 'false' as empty.
 	CreatedAt     string            `json:"createdAt,omitempty"`
 	IPAddresses   map[string]string `json:"ipAddresses,omitempty"`
+	// IPv6Addresses are included only if they are requested
+	IPv6Addresses map[string][]string `json:"ipv6Addresses,omitempty"`
+}
+
+// the layout of createdAt of hosts, which is the same as DateStringFromCreatedAt
+const hostCreatedAtLayout = "Jan 2, 2006 at 3:04pm (MST)"
+
+// newHostFormat builds HostFormat from the host
+func newHostFormat(host *mkr.Host) *HostFormat {
+	return &HostFormat{
+		ID:            host.ID,
+		Name:          host.Name,
+		DisplayName:   host.DisplayName,
+		Status:        host.Status,
+		RoleFullnames: host.GetRoleFullnames(),
+		IsRetired:     host.IsRetired,
+		CreatedAt:     outputTimeFormat.machine(time.Unix(int64(host.CreatedAt), 0), hostCreatedAtLayout),
+		IPAddresses:   host.IPAddresses(),
+	}
 }
 
 // PrettyPrintJSON output indented json via stdout.
 func PrettyPrintJSON(src interface{}) {
-	fmt.Fprintln(os.Stdout, JSONMarshalIndent(src, "", "    "))
+	fprettyPrintJSON(os.Stdout, src)
+}
+
+// fprettyPrintJSON outputs indented json to w.
+func fprettyPrintJSON(w io.Writer, src interface{}) {
+	fmt.Fprintln(w, JSONMarshalIndent(src, "", "    "))
+}
+
+// fprintJSONLines outputs each element of the slice items as a line of compact json (JSON Lines),
+// so that consumers can process items one by one without buffering the whole output.
+func fprintJSONLines(w io.Writer, items interface{}) error {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("JSON Lines output requires a list but got %s", v.Kind())
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := fprintJSONLine(w, v.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fprintJSONLine outputs the item as a line of compact json, to output items one by one as they are fetched
+func fprintJSONLine(w io.Writer, item interface{}) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, replaceAngleBrackets(string(data)))
+	return err
+}
+
+// markdownCellReplacer escapes pipes and line breaks, which would break a row of a Markdown table
+var markdownCellReplacer = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+// fprintMarkdownTable outputs the rows as a Markdown table with the header.
+func fprintMarkdownTable(w io.Writer, header []string, rows [][]string) {
+	writeRow := func(cells []string) {
+		escaped := make([]string, len(cells))
+		for i, cell := range cells {
+			escaped[i] = markdownCellReplacer.Replace(cell)
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(escaped, " | "))
+	}
+	writeRow(header)
+	separator := make([]string, len(header))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	writeRow(separator)
+	for _, row := range rows {
+		writeRow(row)
+	}
 }
 
 // JSONMarshalIndent call json.MarshalIndent and replace encoded angle brackets
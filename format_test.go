@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestFprintJSONLines(t *testing.T) {
+	hosts := []*HostFormat{
+		{ID: "3XYyG", Name: "app01.example.com", Status: "working", RoleFullnames: []string{"foo:app"}},
+		{ID: "3XYyH", Name: "app02.example.com", Status: "standby", Memo: "<memo>"},
+		{ID: "3XYyJ", Name: "db01.example.com", Status: "working", IPAddresses: map[string]string{"eth0": "10.0.0.1"}},
+	}
+
+	var buf bytes.Buffer
+	if err := fprintJSONLines(&buf, hosts); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(hosts) {
+		t.Fatalf("the number of lines should be %d but got %d:\n%s", len(hosts), len(lines), buf.String())
+	}
+	for i, line := range lines {
+		var host HostFormat
+		if err := json.Unmarshal([]byte(line), &host); err != nil {
+			t.Errorf("line %d should be valid JSON but got %q: %v", i+1, line, err)
+			continue
+		}
+		if host.ID != hosts[i].ID || host.Memo != hosts[i].Memo {
+			t.Errorf("line %d should be the host %s but got %q", i+1, hosts[i].ID, line)
+		}
+	}
+
+	if err := fprintJSONLines(&buf, hosts[0]); err == nil {
+		t.Errorf("should raise error for a non-list value")
+	}
+}
+
+func TestFprintMarkdownTable(t *testing.T) {
+	hosts := []*mkr.Host{
+		{ID: "3XYyG", Name: "app01.example.com", Status: "working", CreatedAt: 1483196400, Roles: mkr.Roles{"foo": []string{"app"}}},
+		{ID: "3XYyH", Name: "app|02", Status: "standby", CreatedAt: 1483282800},
+	}
+
+	var buf bytes.Buffer
+	header, rows := hostsTableRows(hosts, nil)
+	fprintMarkdownTable(&buf, header, rows)
+	want := fmt.Sprintf(`| ID | NAME | STATUS | ROLES | CREATED AT |
+| --- | --- | --- | --- | --- |
+| 3XYyG | app01.example.com | working | foo:app | %s |
+| 3XYyH | app\|02 | standby |  | %s |
+`, hosts[0].DateStringFromCreatedAt(), hosts[1].DateStringFromCreatedAt())
+	if buf.String() != want {
+		t.Errorf("the table should be:\n%s\nbut got:\n%s", want, buf.String())
+	}
+
+	for i, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if cells := strings.Count(strings.Replace(line, `\|`, "", -1), "|") - 1; cells != len(header) {
+			t.Errorf("line %d should have %d cells but got %d: %q", i+1, len(header), cells, line)
+		}
+	}
+
+	buf.Reset()
+	fprintMarkdownTable(&buf, []string{"MEMO"}, [][]string{{"line1\nline2"}})
+	if want := "| MEMO |\n| --- |\n| line1<br>line2 |\n"; buf.String() != want {
+		t.Errorf("line breaks should be escaped:\n%s\nbut got:\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandHostsDiff = cli.Command{
+	Name:      "diff",
+	Usage:     "diff hosts with an inventory file",
+	ArgsUsage: "[--exit-code | -e] <inventory.json>",
+	Description: `
+    Show difference of hosts between Mackerel and an inventory file, by host name and roles.
+    The inventory file is a JSON array of hosts having "name" and "roleFullnames", which
+    is the same format as the output of 'mkr hosts'. Retired hosts are not compared.
+`,
+	Action: doHostsDiff,
+	Flags: []cli.Flag{
+		cli.BoolFlag{Name: "exit-code, e", Usage: "Make mkr exit with code 1 if there are differences and 0 if there aren't. This is similar to diff(1)"},
+	},
+}
+
+type hostRolesDiff struct {
+	name        string
+	remoteRoles []string
+	localRoles  []string
+}
+
+type hostsDiff struct {
+	onlyRemote []*HostFormat
+	onlyLocal  []*HostFormat
+	roles      []*hostRolesDiff
+}
+
+func (d *hostsDiff) isEmpty() bool {
+	return len(d.onlyRemote) == 0 && len(d.onlyLocal) == 0 && len(d.roles) == 0
+}
+
+func loadHostsInventory(filePath string) ([]*HostFormat, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var hosts []*HostFormat
+	if err := json.NewDecoder(f).Decode(&hosts); err != nil {
+		return nil, err
+	}
+	for i, host := range hosts {
+		if host.Name == "" {
+			return nil, fmt.Errorf("host #%d in %s should have 'name'", i, filePath)
+		}
+	}
+	return hosts, nil
+}
+
+func sortedRoles(roles []string) []string {
+	sorted := append([]string{}, roles...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func diffHosts(remote, local []*HostFormat) *hostsDiff {
+	localByName := map[string]*HostFormat{}
+	for _, host := range local {
+		localByName[host.Name] = host
+	}
+	remoteNames := map[string]bool{}
+
+	d := &hostsDiff{}
+	for _, r := range remote {
+		remoteNames[r.Name] = true
+		l, ok := localByName[r.Name]
+		if !ok {
+			d.onlyRemote = append(d.onlyRemote, r)
+			continue
+		}
+		remoteRoles, localRoles := sortedRoles(r.RoleFullnames), sortedRoles(l.RoleFullnames)
+		if !reflect.DeepEqual(remoteRoles, localRoles) {
+			d.roles = append(d.roles, &hostRolesDiff{r.Name, remoteRoles, localRoles})
+		}
+	}
+	for _, l := range local {
+		if !remoteNames[l.Name] {
+			d.onlyLocal = append(d.onlyLocal, l)
+		}
+	}
+
+	sort.Slice(d.onlyRemote, func(i, j int) bool { return d.onlyRemote[i].Name < d.onlyRemote[j].Name })
+	sort.Slice(d.onlyLocal, func(i, j int) bool { return d.onlyLocal[i].Name < d.onlyLocal[j].Name })
+	sort.Slice(d.roles, func(i, j int) bool { return d.roles[i].name < d.roles[j].name })
+	return d
+}
+
+func printHostsDiff(w io.Writer, d *hostsDiff) {
+	fmt.Fprintf(w, "Summary: %d only remote, %d only local, %d roles mismatch\n\n", len(d.onlyRemote), len(d.onlyLocal), len(d.roles))
+	for _, host := range d.onlyRemote {
+		fmt.Fprintf(w, "-%s [%s]\n", host.Name, strings.Join(sortedRoles(host.RoleFullnames), ", "))
+	}
+	for _, host := range d.onlyLocal {
+		fmt.Fprintf(w, "+%s [%s]\n", host.Name, strings.Join(sortedRoles(host.RoleFullnames), ", "))
+	}
+	for _, r := range d.roles {
+		fmt.Fprintf(w, " %s\n-  [%s]\n+  [%s]\n", r.name, strings.Join(r.remoteRoles, ", "), strings.Join(r.localRoles, ", "))
+	}
+}
+
+func doHostsDiff(c *cli.Context) error {
+	filePath := c.Args().First()
+	if filePath == "" {
+		cli.ShowCommandHelp(c, "diff")
+		return cli.NewExitError("specify an inventory file.", 1)
+	}
+
+	local, err := loadHostsInventory(filePath)
+	logger.DieIf(err)
+
+	hosts, err := newMackerelFromContext(c).FindHosts(&mkr.FindHostsParam{Statuses: hostStatuses})
+	logger.DieIf(err)
+	var remote []*HostFormat
+	for _, host := range filterRetiredHosts(hosts, false, false) {
+		remote = append(remote, &HostFormat{ID: host.ID, Name: host.Name, RoleFullnames: host.GetRoleFullnames()})
+	}
+
+	d := diffHosts(remote, local)
+	printHostsDiff(os.Stdout, d)
+	if c.Bool("exit-code") && !d.isEmpty() {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDiffHosts(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	tmpFile.WriteString(`[
+    {"name": "app01.example.com", "roleFullnames": ["foo:app"]},
+    {"name": "app02.example.com", "roleFullnames": ["foo:batch", "foo:app"]},
+    {"name": "db01.example.com", "roleFullnames": ["foo:db"]}
+]`)
+	tmpFile.Close()
+
+	local, err := loadHostsInventory(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	remote := []*HostFormat{
+		{ID: "1", Name: "app01.example.com", RoleFullnames: []string{"foo:app"}},
+		{ID: "2", Name: "app02.example.com", RoleFullnames: []string{"foo:app", "foo:db"}},
+		{ID: "3", Name: "stray.example.com", RoleFullnames: []string{"foo:app"}},
+	}
+
+	d := diffHosts(remote, local)
+	if d.isEmpty() {
+		t.Fatal("should detect differences")
+	}
+
+	var buf bytes.Buffer
+	printHostsDiff(&buf, d)
+	want := `Summary: 1 only remote, 1 only local, 1 roles mismatch
+
+-stray.example.com [foo:app]
++db01.example.com [foo:db]
+ app02.example.com
+-  [foo:app, foo:db]
++  [foo:app, foo:batch]
+`
+	if got := buf.String(); got != want {
+		t.Errorf("diff should be:\n%s\nbut got:\n%s", want, got)
+	}
+
+	if d := diffHosts(remote[:1], local[:1]); !d.isEmpty() {
+		t.Error("should not detect differences between same hosts")
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+// hostFilter is an expression of --filter, such as `role == "web:app" && (status == "working" || meta.region != "us")`.
+// Fields are compared with strings by == and !=, and comparisons are combined by &&, || and parentheses.
+type hostFilter struct {
+	root     hostFilterNode
+	usesMeta bool
+}
+
+type hostFilterNode interface {
+	match(host *mkr.Host, metas hostMetas) bool
+}
+
+type hostFilterAnd struct{ left, right hostFilterNode }
+
+func (n *hostFilterAnd) match(host *mkr.Host, metas hostMetas) bool {
+	return n.left.match(host, metas) && n.right.match(host, metas)
+}
+
+type hostFilterOr struct{ left, right hostFilterNode }
+
+func (n *hostFilterOr) match(host *mkr.Host, metas hostMetas) bool {
+	return n.left.match(host, metas) || n.right.match(host, metas)
+}
+
+// hostFilterComparison matches hosts which have (or don't have with !=) the value in the field.
+// role and service have all roles and services of the host, and a missing meta key has no value.
+type hostFilterComparison struct {
+	field  string
+	negate bool
+	value  string
+}
+
+// fields of hosts available in --filter, in addition to meta.<key>
+var hostFilterFields = []string{"id", "name", "displayName", "status", "service", "role"}
+
+func (n *hostFilterComparison) match(host *mkr.Host, metas hostMetas) bool {
+	var values []string
+	switch n.field {
+	case "id":
+		values = []string{host.ID}
+	case "name":
+		values = []string{host.Name}
+	case "displayName":
+		values = []string{host.DisplayName}
+	case "status":
+		values = []string{host.Status}
+	case "service":
+		for service := range host.Roles {
+			values = append(values, service)
+		}
+	case "role":
+		values = host.GetRoleFullnames()
+	default:
+		if v, ok := metas.metaValue(host.ID, strings.TrimPrefix(n.field, groupByMetaPrefix)); ok {
+			values = []string{v}
+		}
+	}
+	return containsString(values, n.value) != n.negate
+}
+
+func (f *hostFilter) match(host *mkr.Host, metas hostMetas) bool {
+	return f.root.match(host, metas)
+}
+
+// filterHostsByFilter returns hosts matching the filter. All hosts are returned if it is nil.
+func filterHostsByFilter(hosts []*mkr.Host, metas hostMetas, f *hostFilter) []*mkr.Host {
+	if f == nil {
+		return hosts
+	}
+	var filtered []*mkr.Host
+	for _, host := range hosts {
+		if f.match(host, metas) {
+			filtered = append(filtered, host)
+		}
+	}
+	return filtered
+}
+
+type hostFilterTokenKind int
+
+const (
+	hostFilterEOF hostFilterTokenKind = iota
+	hostFilterIdent
+	hostFilterString
+	hostFilterOperator
+)
+
+type hostFilterToken struct {
+	kind hostFilterTokenKind
+	text string
+	pos  int
+}
+
+func (t hostFilterToken) String() string {
+	if t.kind == hostFilterEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// hostFilterParser is a recursive descent parser of the grammar:
+//
+//	expr       = and ("||" and)*
+//	and        = primary ("&&" primary)*
+//	primary    = "(" expr ")" | comparison
+//	comparison = field ("==" | "!=") string
+type hostFilterParser struct {
+	src      string
+	tokens   []hostFilterToken
+	index    int
+	usesMeta bool
+}
+
+func parseHostFilter(src string) (*hostFilter, error) {
+	p := &hostFilterParser{src: src}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != hostFilterEOF {
+		return nil, p.errorAt(t.pos, fmt.Sprintf("unexpected %s", t))
+	}
+	return &hostFilter{root: root, usesMeta: p.usesMeta}, nil
+}
+
+// errorAt returns the error pointing at the position of the expression
+func (p *hostFilterParser) errorAt(pos int, message string) error {
+	return fmt.Errorf("invalid filter at column %d: %s\n    %s\n    %s^", pos+1, message, p.src, strings.Repeat(" ", pos))
+}
+
+func isHostFilterIdentChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func (p *hostFilterParser) tokenize() error {
+	src := p.src
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			p.tokens = append(p.tokens, hostFilterToken{hostFilterOperator, src[i : i+1], i})
+			i++
+		case strings.HasPrefix(src[i:], "==") || strings.HasPrefix(src[i:], "!=") ||
+			strings.HasPrefix(src[i:], "&&") || strings.HasPrefix(src[i:], "||"):
+			p.tokens = append(p.tokens, hostFilterToken{hostFilterOperator, src[i : i+2], i})
+			i += 2
+		case c == '"':
+			j := i + 1
+			for ; j < len(src) && src[j] != '"'; j++ {
+				if src[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(src) {
+				return p.errorAt(i, "unterminated string")
+			}
+			s, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return p.errorAt(i, fmt.Sprintf("invalid string %s", src[i:j+1]))
+			}
+			p.tokens = append(p.tokens, hostFilterToken{hostFilterString, s, i})
+			i = j + 1
+		case isHostFilterIdentChar(c):
+			j := i
+			for j < len(src) && isHostFilterIdentChar(src[j]) {
+				j++
+			}
+			p.tokens = append(p.tokens, hostFilterToken{hostFilterIdent, src[i:j], i})
+			i = j
+		default:
+			return p.errorAt(i, fmt.Sprintf("unexpected character %q", c))
+		}
+	}
+	p.tokens = append(p.tokens, hostFilterToken{hostFilterEOF, "", len(src)})
+	return nil
+}
+
+func (p *hostFilterParser) peek() hostFilterToken {
+	return p.tokens[p.index]
+}
+
+func (p *hostFilterParser) next() hostFilterToken {
+	t := p.tokens[p.index]
+	if t.kind != hostFilterEOF {
+		p.index++
+	}
+	return t
+}
+
+func (p *hostFilterParser) isOperator(op string) bool {
+	t := p.peek()
+	return t.kind == hostFilterOperator && t.text == op
+}
+
+func (p *hostFilterParser) parseOr() (hostFilterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &hostFilterOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *hostFilterParser) parseAnd() (hostFilterNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("&&") {
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &hostFilterAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *hostFilterParser) parsePrimary() (hostFilterNode, error) {
+	if p.isOperator("(") {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOperator(")") {
+			t := p.peek()
+			return nil, p.errorAt(t.pos, fmt.Sprintf("expected \")\" but got %s", t))
+		}
+		p.next()
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *hostFilterParser) parseComparison() (hostFilterNode, error) {
+	field := p.next()
+	if field.kind != hostFilterIdent {
+		return nil, p.errorAt(field.pos, fmt.Sprintf("expected a field but got %s", field))
+	}
+	if strings.HasPrefix(field.text, groupByMetaPrefix) && len(field.text) > len(groupByMetaPrefix) {
+		p.usesMeta = true
+	} else if !containsString(hostFilterFields, field.text) {
+		return nil, p.errorAt(field.pos, fmt.Sprintf("unknown field %s. It should be one of %s or meta.<key>", field, strings.Join(hostFilterFields, ", ")))
+	}
+	op := p.next()
+	if op.kind != hostFilterOperator || (op.text != "==" && op.text != "!=") {
+		return nil, p.errorAt(op.pos, fmt.Sprintf("expected == or != but got %s", op))
+	}
+	value := p.next()
+	if value.kind != hostFilterString {
+		return nil, p.errorAt(value.pos, fmt.Sprintf("expected a quoted string but got %s", value))
+	}
+	return &hostFilterComparison{field: field.text, negate: op.text == "!=", value: value.text}, nil
+}
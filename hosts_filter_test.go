@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestFilterHostsByFilter(t *testing.T) {
+	hosts := []*mkr.Host{
+		{ID: "3XYyG", Name: "app01", Status: "working", Roles: mkr.Roles{"web": []string{"app"}}},
+		{ID: "3XYyH", Name: "app02", Status: "standby", Roles: mkr.Roles{"web": []string{"app"}}},
+		{ID: "3XYyJ", Name: "app03", Status: "standby", Roles: mkr.Roles{"web": []string{"app", "batch"}}},
+		{ID: "3XYyK", Name: "db01", Status: "working", Roles: mkr.Roles{"web": []string{"db"}}},
+	}
+	metas := hostMetas{
+		"3XYyG": {"region": "us"},
+		"3XYyH": {"region": "us"},
+		"3XYyJ": {"region": "eu"},
+		"3XYyK": {"region": "us"},
+	}
+
+	testCases := []struct {
+		expr string
+		want []string
+	}{
+		{`role == "web:app" && status == "working" && meta.region == "us"`, []string{"3XYyG"}},
+		{`role == "web:app" && (status == "working" || meta.region != "us")`, []string{"3XYyG", "3XYyJ"}},
+		{`status == "working" || role == "web:batch" && name != "app03"`, []string{"3XYyG", "3XYyK"}},
+		{`role != "web:app" || meta.unknown == ""`, []string{"3XYyK"}},
+		{`service == "web" && meta.region != "eu"`, []string{"3XYyG", "3XYyH", "3XYyK"}},
+	}
+
+	for _, testCase := range testCases {
+		f, err := parseHostFilter(testCase.expr)
+		if err != nil {
+			t.Errorf("parseHostFilter(%q) should not raise error: %v", testCase.expr, err)
+			continue
+		}
+		var got []string
+		for _, host := range filterHostsByFilter(hosts, metas, f) {
+			got = append(got, host.ID)
+		}
+		if !reflect.DeepEqual(got, testCase.want) {
+			t.Errorf("hosts filtered by %q should be %v but got %v", testCase.expr, testCase.want, got)
+		}
+	}
+}
+
+func TestParseHostFilter_error(t *testing.T) {
+	testCases := []struct {
+		expr   string
+		column string
+	}{
+		{`status == "working" && `, "column 24"},
+		{`status = "working"`, "column 8"},
+		{`(status == "working"`, "column 21"},
+		{`status == working`, "column 11"},
+		{`region == "us"`, "column 1"},
+		{`status == "working" role == "web:app"`, "column 21"},
+		{`name == "app`, "column 9"},
+	}
+
+	for _, testCase := range testCases {
+		_, err := parseHostFilter(testCase.expr)
+		if err == nil {
+			t.Errorf("parseHostFilter(%q) should raise error", testCase.expr)
+			continue
+		}
+		if !strings.Contains(err.Error(), testCase.column) {
+			t.Errorf("the error of parseHostFilter(%q) should point at %s but got: %v", testCase.expr, testCase.column, err)
+		}
+	}
+}
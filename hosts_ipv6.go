@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+// hostIPv6Addresses maps host IDs to IPv6 addresses of each interface of the hosts
+type hostIPv6Addresses map[string]map[string][]string
+
+// hostsResponse is the response of "GET /api/v0/hosts" as it is, from which the hosts and their fields
+// which mackerel-client-go doesn't decode are decoded, not to request the hosts multiple times.
+type hostsResponse json.RawMessage
+
+// findHostsResponse requests hosts with the same parameters as FindHosts.
+func findHostsResponse(client *mkr.Client, param *mkr.FindHostsParam) (hostsResponse, error) {
+	query := url.Values{}
+	if param.Name != "" {
+		query.Set("name", param.Name)
+	}
+	if param.Service != "" {
+		query.Set("service", param.Service)
+	}
+	for _, role := range param.Roles {
+		query.Add("role", role)
+	}
+	for _, status := range param.Statuses {
+		query.Add("status", status)
+	}
+	path := "/api/v0/hosts"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var raw json.RawMessage
+	if err := requestJSON(client, http.MethodGet, path, nil, &raw); err != nil {
+		return nil, err
+	}
+	return hostsResponse(raw), nil
+}
+
+// hosts decodes the hosts as FindHosts does
+func (r hostsResponse) hosts() ([]*mkr.Host, error) {
+	var data struct {
+		Hosts []*mkr.Host `json:"hosts"`
+	}
+	if err := json.Unmarshal(r, &data); err != nil {
+		return nil, err
+	}
+	return data.Hosts, nil
+}
+
+// ipv6Addresses decodes IPv6 addresses of interfaces of the hosts
+func (r hostsResponse) ipv6Addresses() (hostIPv6Addresses, error) {
+	var data struct {
+		Hosts []struct {
+			ID         string `json:"id"`
+			Interfaces []struct {
+				Name          string   `json:"name"`
+				IPv6Addresses []string `json:"ipv6Addresses"`
+			} `json:"interfaces"`
+		} `json:"hosts"`
+	}
+	if err := json.Unmarshal(r, &data); err != nil {
+		return nil, err
+	}
+
+	addrs := make(hostIPv6Addresses, len(data.Hosts))
+	for _, host := range data.Hosts {
+		for _, iface := range host.Interfaces {
+			if len(iface.IPv6Addresses) == 0 {
+				continue
+			}
+			if addrs[host.ID] == nil {
+				addrs[host.ID] = map[string][]string{}
+			}
+			addrs[host.ID][iface.Name] = iface.IPv6Addresses
+		}
+	}
+	return addrs, nil
+}
+
+// joined returns IPv6 addresses of the host joined by "," in the order of interface names
+func (addrs hostIPv6Addresses) joined(hostID string) string {
+	var names []string
+	for name := range addrs[hostID] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var joined []string
+	for _, name := range names {
+		joined = append(joined, addrs[hostID][name]...)
+	}
+	return strings.Join(joined, ",")
+}
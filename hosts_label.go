@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+// the prefix of --group-by keys for the host meta
+const groupByMetaPrefix = "meta."
+
+// the group of hosts which don't have the meta key
+const noLabelValue = "(none)"
+
+// hostMetas maps host IDs to their meta as generic JSON values,
+// which include keys unknown to mackerel-client-go.
+type hostMetas map[string]map[string]interface{}
+
+// metas decodes the meta of the hosts
+func (r hostsResponse) metas() (hostMetas, error) {
+	var data struct {
+		Hosts []struct {
+			ID   string                 `json:"id"`
+			Meta map[string]interface{} `json:"meta"`
+		} `json:"hosts"`
+	}
+	if err := json.Unmarshal(r, &data); err != nil {
+		return nil, err
+	}
+	metas := make(hostMetas, len(data.Hosts))
+	for _, host := range data.Hosts {
+		metas[host.ID] = host.Meta
+	}
+	return metas, nil
+}
+
+// lookupDotted returns the value at the dotted path (e.g. "cloud.region") in nested objects.
+// false is returned if any key on the path is missing.
+func lookupDotted(v interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// hostLabel is a condition of --label in the form of <path>=<value>
+type hostLabel struct {
+	path  string
+	value string
+}
+
+func parseHostLabels(labels []string) ([]*hostLabel, error) {
+	var parsed []*hostLabel
+	for _, label := range labels {
+		kv := strings.SplitN(label, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid label %q: it should be in the form of <key>=<value>", label)
+		}
+		parsed = append(parsed, &hostLabel{path: strings.TrimPrefix(kv[0], groupByMetaPrefix), value: kv[1]})
+	}
+	return parsed, nil
+}
+
+// metaValue returns the value at the path of the host meta as a string
+func (metas hostMetas) metaValue(hostID, path string) (string, bool) {
+	v, ok := lookupDotted(map[string]interface{}(metas[hostID]), path)
+	if !ok || v == nil {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// filterHostsByLabels returns hosts whose meta matches all labels
+func filterHostsByLabels(hosts []*mkr.Host, metas hostMetas, labels []*hostLabel) []*mkr.Host {
+	if len(labels) == 0 {
+		return hosts
+	}
+	var filtered []*mkr.Host
+	for _, host := range hosts {
+		matched := true
+		for _, label := range labels {
+			if v, ok := metas.metaValue(host.ID, label.path); !ok || v != label.value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			filtered = append(filtered, host)
+		}
+	}
+	return filtered
+}
+
+// groupHostsByMeta groups hosts by the value at the path of their meta
+func groupHostsByMeta(hosts []*mkr.Host, metas hostMetas, path string) hostGroups {
+	return groupHosts(hosts, func(host *mkr.Host) []string {
+		if v, ok := metas.metaValue(host.ID, path); ok {
+			return []string{v}
+		}
+		return []string{noLabelValue}
+	})
+}
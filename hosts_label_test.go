@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestFilterAndGroupHostsByMeta(t *testing.T) {
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"hosts":[
+			{"id":"3XYyG","meta":{"datacenter":"tokyo","cloud":{"region":"us-east-1"}}},
+			{"id":"3XYyH","meta":{"datacenter":"osaka","cloud":{"region":"us-east-1"}}},
+			{"id":"3XYyI","meta":{"datacenter":"tokyo","cloud":"none"}},
+			{"id":"3XYyJ","meta":{}}
+		]}`)
+	})
+	defer ts.Close()
+
+	resp, err := findHostsResponse(client, &mkr.FindHostsParam{})
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	metas, err := resp.metas()
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	hosts := []*mkr.Host{{ID: "3XYyG"}, {ID: "3XYyH"}, {ID: "3XYyI"}, {ID: "3XYyJ"}}
+
+	labels, err := parseHostLabels([]string{"cloud.region=us-east-1"})
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	var got []string
+	for _, host := range filterHostsByLabels(hosts, metas, labels) {
+		got = append(got, host.ID)
+	}
+	if want := []string{"3XYyG", "3XYyH"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts filtered by the nested key should be %v but got %v", want, got)
+	}
+
+	groups := map[string][]string{}
+	for _, g := range groupHostsByMeta(hosts, metas, "datacenter") {
+		for _, host := range g.hosts {
+			groups[g.key] = append(groups[g.key], host.ID)
+		}
+	}
+	want := map[string][]string{"(none)": {"3XYyJ"}, "osaka": {"3XYyH"}, "tokyo": {"3XYyG", "3XYyI"}}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("groups should be %v but got %v", want, groups)
+	}
+
+	if _, err := parseHostLabels([]string{"datacenter"}); err == nil {
+		t.Errorf("should raise error for a label without value")
+	}
+}
@@ -0,0 +1,54 @@
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"time"
+)
+
+// DumpTransport dumps requests and responses by Log, such as the verbose mode of mackerel-client-go does,
+// but values of sensitive headers are redacted in the dumps and in errors of Base.
+type DumpTransport struct {
+	Base http.RoundTripper
+	Log  func(dump string)
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *DumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var secrets []string
+	for name, values := range req.Header {
+		if !IsSensitiveHeader(name) {
+			continue
+		}
+		for _, value := range values {
+			if value != "" {
+				secrets = append(secrets, value)
+			}
+		}
+	}
+	redact := func(s string) string {
+		for _, secret := range secrets {
+			s = strings.Replace(s, secret, Redacted, -1)
+		}
+		return s
+	}
+
+	if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+		t.Log(redact(string(dump)))
+	}
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, errors.New(redact(err.Error()))
+	}
+	if dump, err := httputil.DumpResponse(resp, true); err == nil {
+		t.Log(redact(string(dump)))
+	}
+	return resp, nil
+}
+
+// NewVerbose returns an HTTP client similar to New, but it dumps requests and responses by log
+func NewVerbose(timeout time.Duration, log func(dump string)) *http.Client {
+	return &http.Client{Transport: &DumpTransport{Base: Transport, Log: log}, Timeout: timeout}
+}
@@ -0,0 +1,52 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, errors.New("failed to request with " + req.Header.Get("X-Api-Key"))
+}
+
+func TestDumpTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if got := req.Header.Get("X-Api-Key"); got != "secret-api-key" {
+			t.Errorf("the API key should be sent as it is but got %q", got)
+		}
+		io.WriteString(w, `{"services":[]}`)
+	}))
+	defer ts.Close()
+
+	var dumps []string
+	client := NewVerbose(0, func(dump string) { dumps = append(dumps, dump) })
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v0/services", nil)
+	req.Header.Set("X-Api-Key", "secret-api-key")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	resp.Body.Close()
+
+	log := strings.Join(dumps, "\n")
+	if len(dumps) != 2 || !strings.Contains(log, "GET /api/v0/services") || !strings.Contains(log, `{"services":[]}`) {
+		t.Errorf("the request and the response should be dumped but got:\n%s", log)
+	}
+	if !strings.Contains(log, "X-Api-Key: ***") || strings.Contains(log, "secret-api-key") {
+		t.Errorf("the API key should be redacted but got:\n%s", log)
+	}
+
+	client = &http.Client{Transport: &DumpTransport{Base: failingTransport{}, Log: func(string) {}}}
+	req, _ = http.NewRequest(http.MethodGet, ts.URL+"/api/v0/services", nil)
+	req.Header.Set("X-Api-Key", "secret-api-key")
+	_, err = client.Do(req)
+	if err == nil || strings.Contains(err.Error(), "secret-api-key") {
+		t.Errorf("the API key should be redacted in the error but got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package httpclient
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNew_reuseConnections(t *testing.T) {
+	var conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, `{"success":true}`)
+	}))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	for i := 0; i < 10; i++ {
+		// clients share the transport, as commands create their own clients
+		resp, err := New(0).Get(ts.URL)
+		if err != nil {
+			t.Fatalf("should not raise error: %v", err)
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if got := atomic.LoadInt32(&conns); got != 1 {
+		t.Errorf("the connection should be reused across sequential requests but %d connections are made", got)
+	}
+}
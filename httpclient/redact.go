@@ -0,0 +1,14 @@
+package httpclient
+
+import "regexp"
+
+// Redacted is the replacement of credentials in dumps and errors, and of secrets in outputs of mkr
+const Redacted = "***"
+
+// names of headers whose values are credentials, such as X-Api-Key, Authorization and Cookie
+var sensitiveHeaderPattern = regexp.MustCompile(`(?i)(auth|cookie|token|secret|key|password)`)
+
+// IsSensitiveHeader returns whether values of the header are credentials to be redacted
+func IsSensitiveHeader(name string) bool {
+	return sensitiveHeaderPattern.MatchString(name)
+}
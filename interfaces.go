@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandInterfaces = cli.Command{
+	Name:      "interfaces",
+	Usage:     "Show network interfaces of the host",
+	ArgsUsage: "[--output | -o <format>] <hostId>",
+	Description: `
+    Show name, IPv4 addresses, IPv6 addresses and MAC address of each network interface of the host.
+    Requests "GET /api/v0/hosts/<hostId>". See https://mackerel.io/api-docs/entry/hosts#get .
+`,
+	Action: doInterfaces,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "output, o", Value: "table", Usage: "Output format ('table' or 'json')"},
+	},
+}
+
+// hostInterface is a network interface of a host, including fields which mackerel-client-go doesn't decode
+type hostInterface struct {
+	Name          string   `json:"name"`
+	IPv4Addresses []string `json:"ipv4Addresses"`
+	IPv6Addresses []string `json:"ipv6Addresses"`
+	MacAddress    string   `json:"macAddress"`
+}
+
+func findHostInterfaces(client *mkr.Client, hostID string) ([]*hostInterface, error) {
+	var data struct {
+		Host struct {
+			Interfaces []struct {
+				hostInterface
+				// IPAddress is reported by old agents instead of ipv4Addresses
+				IPAddress string `json:"ipAddress"`
+			} `json:"interfaces"`
+		} `json:"host"`
+	}
+	if err := requestJSON(client, http.MethodGet, "/api/v0/hosts/"+url.PathEscape(hostID), nil, &data); err != nil {
+		return nil, err
+	}
+	ifaces := make([]*hostInterface, 0, len(data.Host.Interfaces))
+	for _, i := range data.Host.Interfaces {
+		iface := i.hostInterface
+		if len(iface.IPv4Addresses) == 0 && i.IPAddress != "" {
+			iface.IPv4Addresses = []string{i.IPAddress}
+		}
+		ifaces = append(ifaces, &iface)
+	}
+	return ifaces, nil
+}
+
+func printInterfacesTable(w io.Writer, ifaces []*hostInterface) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tIPV4 ADDRESSES\tIPV6 ADDRESSES\tMAC ADDRESS")
+	for _, iface := range ifaces {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", iface.Name, strings.Join(iface.IPv4Addresses, ","), strings.Join(iface.IPv6Addresses, ","), iface.MacAddress)
+	}
+	tw.Flush()
+}
+
+func doInterfaces(c *cli.Context) error {
+	hostID := c.Args().First()
+	if hostID == "" {
+		cli.ShowCommandHelp(c, "interfaces")
+		os.Exit(1)
+	}
+	output := c.String("output")
+	if output != "table" && output != "json" {
+		return cli.NewExitError(fmt.Sprintf("unknown output format: %s", output), 1)
+	}
+
+	ifaces, err := findHostInterfaces(newMackerelFromContext(c), hostID)
+	logger.DieIf(err)
+	if output == "json" {
+		PrettyPrintJSON(ifaces)
+	} else {
+		printInterfacesTable(os.Stdout, ifaces)
+	}
+	return nil
+}
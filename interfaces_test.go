@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFindHostInterfaces(t *testing.T) {
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v0/hosts/3XYyG" {
+			t.Errorf("unexpected request: %s", req.URL.Path)
+		}
+		fmt.Fprint(w, `{"host":{"id":"3XYyG","name":"app01","interfaces":[
+			{"name":"eth0","ipv4Addresses":["10.0.0.1"],"ipv6Addresses":["fe80::1","2001:db8::1"],"macAddress":"02:42:ac:11:00:02"},
+			{"name":"eth1","ipAddress":"192.168.0.1","macAddress":"02:42:ac:11:00:03"}
+		]}}`)
+	})
+	defer ts.Close()
+
+	ifaces, err := findHostInterfaces(client, "3XYyG")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(ifaces) != 2 {
+		t.Fatalf("2 interfaces should be found but got %d", len(ifaces))
+	}
+	if got := strings.Join(ifaces[1].IPv4Addresses, ","); got != "192.168.0.1" {
+		t.Errorf("ipAddress should be used as the IPv4 address but got %q", got)
+	}
+
+	var buf bytes.Buffer
+	printInterfacesTable(&buf, ifaces)
+	want := `NAME  IPV4 ADDRESSES  IPV6 ADDRESSES       MAC ADDRESS
+eth0  10.0.0.1        fe80::1,2001:db8::1  02:42:ac:11:00:02
+eth1  192.168.0.1                          02:42:ac:11:00:03
+`
+	if buf.String() != want {
+		t.Errorf("the table should be:\n%s\nbut got:\n%s", want, buf.String())
+	}
+}
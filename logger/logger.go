@@ -3,7 +3,9 @@ package logger
 // We borrow this code from github.com/motemen/ghq/utils
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	colorine "github.com/motemen/go-colorine"
 )
@@ -14,6 +16,8 @@ var logger = &colorine.Logger{
 
 		"error": colorine.Error,
 
+		"debug": colorine.Verbose,
+
 		"":        colorine.Info,
 		"created": colorine.Info,
 		"updated": colorine.Info,
@@ -22,9 +26,59 @@ var logger = &colorine.Logger{
 	},
 }
 
+// output is replaced in tests
+var output = func(prefix, message string) {
+	logger.Log(prefix, message)
+}
+
+// Level is the threshold of log messages to be output
+type Level int
+
+// Log levels. Messages with "error" or "warning" prefix are output at any level.
+const (
+	LevelQuiet Level = iota
+	LevelInfo
+	LevelDebug
+)
+
+var level = LevelInfo
+
+// SetLevel sets the log level
+func SetLevel(l Level) {
+	level = l
+}
+
+// IsDebug returns whether debug messages are output
+func IsDebug() bool {
+	return level >= LevelDebug
+}
+
+// ParseLevel parses a level name such as "quiet", "info" and "debug"
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "quiet", "error":
+		return LevelQuiet, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "debug", "verbose":
+		return LevelDebug, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level: %s", name)
+}
+
 // Log outputs `message` with `prefix` by go-colorine
 func Log(prefix, message string) {
-	logger.Log(prefix, message)
+	if level < LevelInfo && prefix != "error" && prefix != "warning" {
+		return
+	}
+	output(prefix, message)
+}
+
+// Debug outputs `message` only if the log level is debug
+func Debug(message string) {
+	if IsDebug() {
+		output("debug", message)
+	}
 }
 
 // ErrorIf outputs log if `err` occurs.
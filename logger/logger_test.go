@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"testing"
+)
+
+func captureOutput(f func()) []string {
+	orig := output
+	defer func() { output = orig }()
+
+	var lines []string
+	output = func(prefix, message string) {
+		lines = append(lines, prefix+" "+message)
+	}
+	f()
+	return lines
+}
+
+func TestLevel(t *testing.T) {
+	defer SetLevel(LevelInfo)
+
+	testCases := []struct {
+		level Level
+		want  []string
+	}{
+		{LevelQuiet, []string{"error failed", "warning careful"}},
+		{LevelInfo, []string{"created 3XYyG", "error failed", "warning careful"}},
+		{LevelDebug, []string{"created 3XYyG", "debug GET /api/v0/hosts", "error failed", "warning careful"}},
+	}
+
+	for _, testCase := range testCases {
+		SetLevel(testCase.level)
+		lines := captureOutput(func() {
+			Log("created", "3XYyG")
+			Debug("GET /api/v0/hosts")
+			Log("error", "failed")
+			Log("warning", "careful")
+		})
+		if len(lines) != len(testCase.want) {
+			t.Errorf("level %d: should output %v but got %v", testCase.level, testCase.want, lines)
+			continue
+		}
+		for i := range lines {
+			if lines[i] != testCase.want[i] {
+				t.Errorf("level %d: should output %v but got %v", testCase.level, testCase.want, lines)
+				break
+			}
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]Level{"": LevelInfo, "quiet": LevelQuiet, "INFO": LevelInfo, "debug": LevelDebug} {
+		l, err := ParseLevel(name)
+		if err != nil || l != want {
+			t.Errorf("ParseLevel(%q) should be %d but got %d (%v)", name, want, l, err)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("ParseLevel should raise error for an unknown level")
+	}
+}
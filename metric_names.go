@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandMetricNames = cli.Command{
+	Name:      "metric-names",
+	Usage:     "List metric names",
+	ArgsUsage: "(--host | -H <hostId> | --service | -s <service>) [--match <regexp>] [--output | -o <format>]",
+	Description: `
+    List names of host metrics of <hostId>, or names of service metrics of <service>, in alphabetical order.
+    With --match, only names matching <regexp> are listed.
+    Requests "GET /api/v0/hosts/<hostId>/metric-names" or "GET /api/v0/services/<service>/metric-names".
+    See https://mackerel.io/api-docs/entry/hosts#metric-names, https://mackerel.io/api-docs/entry/services#metric-names .
+`,
+	Action: doMetricNames,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "host, H", Value: "", Usage: "List metric names of <hostID>"},
+		cli.StringFlag{Name: "service, s", Value: "", Usage: "List metric names of <service>"},
+		cli.StringFlag{Name: "match", Value: "", Usage: "List only metric names matching the regular expression <regexp>"},
+		cli.StringFlag{Name: "output, o", Value: "text", Usage: "Output format ('text' or 'json')"},
+	},
+}
+
+// findMetricNames returns sorted metric names of the host, or of the service if hostID is empty
+func findMetricNames(client *mkr.Client, hostID, service string) ([]string, error) {
+	path := "/api/v0/hosts/" + url.PathEscape(hostID) + "/metric-names"
+	if hostID == "" {
+		path = "/api/v0/services/" + url.PathEscape(service) + "/metric-names"
+	}
+	var data struct {
+		Names []string `json:"names"`
+	}
+	if err := requestJSON(client, http.MethodGet, path, nil, &data); err != nil {
+		return nil, err
+	}
+	sort.Strings(data.Names)
+	return data.Names, nil
+}
+
+func filterMetricNames(names []string, pattern *regexp.Regexp) []string {
+	filtered := []string{}
+	for _, name := range names {
+		if pattern == nil || pattern.MatchString(name) {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
+
+func printMetricNames(w io.Writer, names []string, output string) {
+	if output == "json" {
+		fprettyPrintJSON(w, names)
+		return
+	}
+	for _, name := range names {
+		fmt.Fprintln(w, name)
+	}
+}
+
+func doMetricNames(c *cli.Context) error {
+	hostID := c.String("host")
+	service := c.String("service")
+	if (hostID == "") == (service == "") {
+		cli.ShowCommandHelp(c, "metric-names")
+		os.Exit(1)
+	}
+	output := c.String("output")
+	if output != "text" && output != "json" {
+		return cli.NewExitError(fmt.Sprintf("unknown output format: %s", output), 1)
+	}
+	var pattern *regexp.Regexp
+	if s := c.String("match"); s != "" {
+		var err error
+		if pattern, err = regexp.Compile(s); err != nil {
+			return cli.NewExitError(fmt.Sprintf("invalid --match: %s", err), 1)
+		}
+	}
+
+	names, err := findMetricNames(newMackerelFromContext(c), hostID, service)
+	logger.DieIf(err)
+	printMetricNames(os.Stdout, filterMetricNames(names, pattern), output)
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFindMetricNames_service(t *testing.T) {
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v0/services/blog/metric-names" {
+			t.Errorf("unexpected request: %s", req.URL.Path)
+		}
+		fmt.Fprint(w, `{"names":["response.time","access.count","response.count"]}`)
+	})
+	defer ts.Close()
+
+	names, err := findMetricNames(client, "", "blog")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if got := strings.Join(names, ","); got != "access.count,response.count,response.time" {
+		t.Errorf("metric names should be sorted but got %s", got)
+	}
+
+	var buf bytes.Buffer
+	printMetricNames(&buf, filterMetricNames(names, regexp.MustCompile(`^response\.`)), "text")
+	if want := "response.count\nresponse.time\n"; buf.String() != want {
+		t.Errorf("filtered metric names should be:\n%s\nbut got:\n%s", want, buf.String())
+	}
+
+	buf.Reset()
+	printMetricNames(&buf, filterMetricNames(names, regexp.MustCompile(`^unknown`)), "json")
+	if want := "[]\n"; buf.String() != want {
+		t.Errorf("no metric names should be output as an empty array but got %q", buf.String())
+	}
+}
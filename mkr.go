@@ -23,11 +23,45 @@ func main() {
 			Value: config.DefaultConfig.Conffile,
 			Usage: "Config file path",
 		},
+		cli.StringFlag{
+			Name:   "config",
+			EnvVar: "MKR_CONFIG",
+			Usage:  "Config file path, which takes precedence over --conf and must exist",
+		},
 		cli.StringFlag{
 			Name: "apibase",
 			// this default value is set in config.LoadApibaseFromConfigWithFallback
 			Usage: fmt.Sprintf("API Base (default: \"%s\")", config.DefaultConfig.Apibase),
 		},
+		cli.StringFlag{
+			Name:   "user-agent",
+			EnvVar: "MKR_USER_AGENT",
+			Usage:  "Append <user-agent> to the User-Agent header of API requests",
+		},
+		cli.BoolFlag{
+			Name:  "quiet, q",
+			Usage: "Suppress informational messages. Errors are still output",
+		},
+		cli.BoolFlag{
+			Name:  "verbose",
+			Usage: "Output debug messages such as request URLs",
+		},
+		cli.StringFlag{
+			Name:   "time-format",
+			EnvVar: "MKR_TIME_FORMAT",
+			Usage:  "Format times in human readable output by 'rfc3339', 'local', 'epoch' or a Go layout such as '2006-01-02 15:04' in UTC except 'local'. Only 'epoch' changes json",
+		},
+	}
+	app.Before = func(c *cli.Context) error {
+		level, err := resolveLogLevel(c.Bool("quiet"), c.Bool("verbose"), os.Getenv("MKR_LOG_LEVEL"))
+		if err != nil {
+			return err
+		}
+		logger.SetLevel(level)
+		if outputTimeFormat, err = parseTimeFormat(c.String("time-format")); err != nil {
+			return err
+		}
+		return applyConfigFlag(c)
 	}
 
 	cpu := runtime.NumCPU()
@@ -39,3 +73,28 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// resolveLogLevel decides the log level from the global flags,
+// and falls back to the MKR_LOG_LEVEL environment variable.
+func resolveLogLevel(quiet, verbose bool, env string) (logger.Level, error) {
+	if verbose {
+		return logger.LevelDebug, nil
+	}
+	if quiet {
+		return logger.LevelQuiet, nil
+	}
+	return logger.ParseLevel(env)
+}
+
+// applyConfigFlag replaces --conf by --config (or MKR_CONFIG) if specified, so that all commands load it.
+// Unlike --conf, which is ignored if the file doesn't exist, a missing file is an error.
+func applyConfigFlag(c *cli.Context) error {
+	path := c.String("config")
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("failed to load the config file specified by --config: %s", err)
+	}
+	return c.Set("conf", path)
+}
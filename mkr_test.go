@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+func TestResolveLogLevel(t *testing.T) {
+	testCases := []struct {
+		quiet   bool
+		verbose bool
+		env     string
+		want    logger.Level
+	}{
+		{false, false, "", logger.LevelInfo},
+		{true, false, "", logger.LevelQuiet},
+		{false, true, "", logger.LevelDebug},
+		{false, false, "debug", logger.LevelDebug},
+		{true, false, "debug", logger.LevelQuiet},
+		{false, true, "quiet", logger.LevelDebug},
+	}
+
+	for _, testCase := range testCases {
+		level, err := resolveLogLevel(testCase.quiet, testCase.verbose, testCase.env)
+		if err != nil {
+			t.Errorf("should not raise error: %v", err)
+		}
+		if level != testCase.want {
+			t.Errorf("resolveLogLevel(%t, %t, %q) should be %d but got %d", testCase.quiet, testCase.verbose, testCase.env, testCase.want, level)
+		}
+	}
+
+	if _, err := resolveLogLevel(false, false, "loud"); err == nil {
+		t.Error("should raise error for an unknown MKR_LOG_LEVEL")
+	}
+}
+
+func TestApplyConfigFlag(t *testing.T) {
+	origAPIKey := os.Getenv("MACKEREL_APIKEY")
+	os.Setenv("MACKEREL_APIKEY", "")
+	defer os.Setenv("MACKEREL_APIKEY", origAPIKey)
+	run := func(args ...string) (string, error) {
+		var apiKey string
+		app := cli.NewApp()
+		app.Flags = []cli.Flag{
+			cli.StringFlag{Name: "conf", Value: "test/not_exists.conf"},
+			cli.StringFlag{Name: "config", EnvVar: "MKR_CONFIG"},
+		}
+		app.Before = applyConfigFlag
+		app.Commands = []cli.Command{{
+			Name: "apikey",
+			Action: func(c *cli.Context) error {
+				apiKey = LoadApikeyFromConfig(c.GlobalString("conf"))
+				return nil
+			},
+		}}
+		err := app.Run(append([]string{"mkr"}, args...))
+		return apiKey, err
+	}
+
+	if apiKey, err := run("--config", "test/mackerel-agent.conf", "apikey"); err != nil || apiKey != "123456ABCD" {
+		t.Errorf("the config file should be loaded from --config, and the apikey should be 123456ABCD but got %q (%v)", apiKey, err)
+	}
+
+	origConfig := os.Getenv("MKR_CONFIG")
+	os.Setenv("MKR_CONFIG", "test/mackerel-agent-commands.conf")
+	defer os.Setenv("MKR_CONFIG", origConfig)
+	if apiKey, err := run("apikey"); err != nil || apiKey == "" {
+		t.Errorf("the config file should be loaded from MKR_CONFIG but got %q (%v)", apiKey, err)
+	}
+
+	if _, err := run("--config", "test/not_exists.conf", "apikey"); err == nil {
+		t.Errorf("should raise error for the missing config file")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"reflect"
 	"strings"
@@ -24,70 +23,93 @@ var commandMonitors = cli.Command{
     Requests APIs under "/api/v0/monitors". See https://mackerel.io/api-docs/entry/monitors .
 `,
 	Action: doMonitorsList,
+	Flags: []cli.Flag{
+		outFlag,
+	},
 	Subcommands: []cli.Command{
 		{
 			Name:      "pull",
 			Usage:     "pull rules",
-			ArgsUsage: "[--file-path | -F <file>] [--verbose | -v]",
+			ArgsUsage: "[--file-path | -F <file> | --split-dir <dir>] [--strip-ids] [--mask-secrets] [--verbose | -v]",
 			Description: `
     Pull monitor rules from Mackerel server and save them to a file. The file can be specified by filepath argument <file>. The default is 'monitors.json'.
+    With --strip-ids, the ids of monitors are removed, so the file can be pushed to any organization as a template.
+    Monitors without ids are matched by their names on push, and created if they don't exist.
+    With --mask-secrets, sensitive header values of external monitors are replaced by '***' to share the file.
+    Note that monitors with the masked values in the file are skipped on push.
+    With --split-dir, each monitor is saved to its own file in <dir>, named by the slug of the monitor name
+    such as 'cpu-usage.json', and files of monitors no longer existing are removed.
+    It fails if <dir> has json files other than monitors.
 `,
 			Action: doMonitorsPull,
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				cli.StringFlag{Name: "file-path, F", Value: "", Usage: "Filename to store monitor rule definitions. default: monitors.json"},
+				splitDirFlag,
+				cli.BoolFlag{Name: "strip-ids", Usage: "Remove ids of monitors to make a portable template"},
 				cli.BoolFlag{Name: "verbose, v", Usage: "Verbose output mode"},
-			},
+			}, maskSecretsFlags(false)...),
 		},
 		{
 			Name:  "diff",
 			Usage: "diff rules",
 			Description: `
     Show difference of monitor rules between Mackerel and a file. The file can be specified by filepath argument <file>. The default is 'monitors.json'.
+    Sensitive header values of external monitors, such as Authorization, are shown as '***' unless --no-mask-secrets.
+    Only <N> unchanged lines around each change of a monitor are shown with --diff-context (3 by default) like diff -U,
+    and omitted lines are shown as '...'. A negative <N> shows all lines.
 `,
-			ArgsUsage: "[--file-path | -F <file>]",
+			ArgsUsage: "[--file-path | -F <file> | --split-dir <dir>] [--diff-context <N>] [--no-mask-secrets]",
 			Action:    doMonitorsDiff,
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				cli.BoolFlag{Name: "exit-code, e", Usage: "Make mkr exit with code 1 if there are differences and 0 if there aren't. This is similar to diff(1)"},
 				cli.StringFlag{Name: "file-path, F", Value: "", Usage: "Filename to store monitor rule definitions. default: monitors.json"},
+				splitDirFlag,
 				cli.BoolFlag{Name: "reverse", Usage: "The difference on the remote server is represented by plus and the difference on the local file is represented by minus"},
-			},
+				cli.IntFlag{Name: "diff-context", Value: 3, Usage: "Show <N> unchanged lines around each change. A negative value shows all lines"},
+			}, maskSecretsFlags(true)...),
 		},
 		{
 			Name:      "push",
 			Usage:     "push rules",
-			ArgsUsage: "[--dry-run | -d] [--file-path | -F <file>] [--verbose | -v]",
+			ArgsUsage: "[--dry-run | -d] [--file-path | -F <file> | --split-dir <dir> [--prune]] [--verbose | -v]",
 			Description: `
     Push monitor rules stored in a file to Mackerel. The file can be specified by filepath argument <file>. The default is 'monitors.json'.
+    With --split-dir, the rules are read from all json files in <dir> saved by "mkr monitors pull --split-dir".
+    Rules only on Mackerel, such as ones whose files are deleted, are deleted only with --prune then.
 `,
 			Action: doMonitorsPush,
 			Flags: []cli.Flag{
 				cli.StringFlag{Name: "file-path, F", Value: "", Usage: "Filename to store monitor rule definitions. default: monitors.json"},
+				splitDirFlag,
+				cli.BoolFlag{Name: "prune", Usage: "With --split-dir, delete rules which have no files in <dir>"},
 				cli.BoolFlag{Name: "dry-run, d", Usage: "Show which apis are called, but not execute."},
 				cli.BoolFlag{Name: "verbose, v", Usage: "Verbose output mode"},
 			},
 		},
+		commandMonitorsDisable,
+		commandMonitorsEnable,
+		commandMonitorsSet,
+		commandMonitorsValidate,
+		commandMonitorsTree,
+		commandMonitorsImport,
 	},
 }
 
+var splitDirFlag = cli.StringFlag{Name: "split-dir", Usage: "Directory to store monitor rule definitions one file per monitor, instead of --file-path"}
+
 func monitorSaveRules(rules []mkr.Monitor, optFilePath string) error {
 	filePath := "monitors.json"
 	if optFilePath != "" {
 		filePath = optFilePath
 	}
-	file, err := os.Create(filePath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer file.Close()
 
 	monitors := map[string]interface{}{"monitors": rules}
 	data := JSONMarshalIndent(monitors, "", "    ") + "\n"
 
-	_, err = file.WriteString(data)
-	if err != nil {
+	return writeOutput(filePath, func(w io.Writer) error {
+		_, err := io.WriteString(w, data)
 		return err
-	}
-	return nil
+	})
 }
 
 func monitorLoadRules(optFilePath string) ([]mkr.Monitor, error) {
@@ -130,6 +152,7 @@ func decodeMonitors(r io.Reader) ([]mkr.Monitor, error) {
 func decodeMonitor(mes json.RawMessage) (mkr.Monitor, error) {
 	var typeData struct {
 		Type string `json:"type"`
+		Name string `json:"name"`
 	}
 	if err := json.Unmarshal(mes, &typeData); err != nil {
 		return nil, err
@@ -146,6 +169,8 @@ func decodeMonitor(mes json.RawMessage) (mkr.Monitor, error) {
 		m = &mkr.MonitorExternalHTTP{}
 	case "expression":
 		m = &mkr.MonitorExpression{}
+	default:
+		return nil, fmt.Errorf("Monitor '%s' has unsupported type: '%s'", typeData.Name, typeData.Type)
 	}
 	if err := json.Unmarshal(mes, m); err != nil {
 		return nil, err
@@ -157,18 +182,36 @@ func doMonitorsList(c *cli.Context) error {
 	monitors, err := newMackerelFromContext(c).FindMonitors()
 	logger.DieIf(err)
 
-	PrettyPrintJSON(monitors)
+	logger.DieIf(writeOutput(c.String("out"), func(w io.Writer) error {
+		fprettyPrintJSON(w, monitors)
+		return nil
+	}))
 	return nil
 }
 
 func doMonitorsPull(c *cli.Context) error {
 	isVerbose := c.Bool("verbose")
 	filePath := c.String("file-path")
+	splitDir := c.String("split-dir")
+	if filePath != "" && splitDir != "" {
+		return cli.NewExitError("--file-path and --split-dir cannot be specified together", 1)
+	}
 
 	monitors, err := newMackerelFromContext(c).FindMonitors()
 	logger.DieIf(err)
 
-	monitorSaveRules(monitors, filePath)
+	if c.Bool("strip-ids") {
+		stripMonitorIDs(monitors)
+	}
+	if shouldMaskSecrets(c, false) {
+		monitors = maskMonitorsSecrets(monitors)
+	}
+	if splitDir != "" {
+		logger.DieIf(monitorSaveSplitDir(monitors, splitDir))
+		filePath = splitDir
+	} else {
+		logger.DieIf(monitorSaveRules(monitors, filePath))
+	}
 
 	if isVerbose {
 		PrettyPrintJSON(monitors)
@@ -181,6 +224,15 @@ func doMonitorsPull(c *cli.Context) error {
 	return nil
 }
 
+// stripMonitorIDs removes ids of monitors, which are specific to the organization
+func stripMonitorIDs(monitors []mkr.Monitor) {
+	for _, monitor := range monitors {
+		if f := reflect.ValueOf(monitor).Elem().FieldByName("ID"); f.IsValid() && f.Kind() == reflect.String {
+			f.SetString("")
+		}
+	}
+}
+
 func stringifyMonitor(a mkr.Monitor, prefix string) string {
 	return prefix + JSONMarshalIndent(a, prefix, "  ") + ","
 }
@@ -204,6 +256,43 @@ func diffMonitor(a mkr.Monitor, b mkr.Monitor) string {
 	return strings.TrimRight(result, "\n") + ","
 }
 
+// the line which replaces omitted unchanged lines of a diff
+const diffOmittedLine = " ..."
+
+// trimDiffContext keeps only `context` unchanged lines around changed lines of the diff by diffMonitor,
+// such as diff -U, and replaces the others by diffOmittedLine. All lines are kept if context is negative.
+// The "name" line of the monitor is always kept to tell which monitor the diff is of.
+func trimDiffContext(diff string, context int) string {
+	if context < 0 || diff == "" {
+		return diff
+	}
+	lines := strings.Split(diff, "\n")
+	keep := make([]bool, len(lines))
+	for i, l := range lines {
+		if strings.HasPrefix(l, `   "name":`) {
+			keep[i] = true
+			continue
+		}
+		if !strings.HasPrefix(l, "+") && !strings.HasPrefix(l, "-") {
+			continue
+		}
+		for j := i - context; j <= i+context; j++ {
+			if 0 <= j && j < len(lines) {
+				keep[j] = true
+			}
+		}
+	}
+	var trimmed []string
+	for i, l := range lines {
+		if keep[i] {
+			trimmed = append(trimmed, l)
+		} else if i == 0 || keep[i-1] {
+			trimmed = append(trimmed, diffOmittedLine)
+		}
+	}
+	return strings.Join(trimmed, "\n")
+}
+
 func filterIDLine(s string) string {
 	lines := strings.Split(s, "\n")
 	filtered := make([]string, 0, len(lines))
@@ -301,18 +390,39 @@ type monitorDiff struct {
 
 func checkMonitorsDiff(c *cli.Context) monitorDiff {
 	filePath := c.String("file-path")
-
-	var monitorDiff monitorDiff
+	splitDir := c.String("split-dir")
+	if filePath != "" && splitDir != "" {
+		logger.DieIf(fmt.Errorf("--file-path and --split-dir cannot be specified together"))
+	}
 
 	monitorsRemote, err := newMackerelFromContext(c).FindMonitors()
 	logger.DieIf(err)
-	flagNameUniquenessRemote, err := validateRules(monitorsRemote, "remote rules")
+
+	var monitorsLocal []mkr.Monitor
+	if splitDir != "" {
+		monitorsLocal, err = monitorLoadSplitDir(splitDir)
+	} else {
+		monitorsLocal, err = monitorLoadRules(filePath)
+	}
 	logger.DieIf(err)
 
-	monitorsLocal, err := monitorLoadRules(filePath)
+	monitorDiff, err := diffMonitorRules(monitorsRemote, monitorsLocal)
 	logger.DieIf(err)
+	return monitorDiff
+}
+
+// diffMonitorRules matches local rules with remote ones by ids, or by names if they are unique
+func diffMonitorRules(monitorsRemote, monitorsLocal []mkr.Monitor) (monitorDiff, error) {
+	var monitorDiff monitorDiff
+
+	flagNameUniquenessRemote, err := validateRules(monitorsRemote, "remote rules")
+	if err != nil {
+		return monitorDiff, err
+	}
 	flagNameUniquenessLocal, err := validateRules(monitorsLocal, "local rules")
-	logger.DieIf(err)
+	if err != nil {
+		return monitorDiff, err
+	}
 
 	flagNameUniqueness := flagNameUniquenessLocal && flagNameUniquenessRemote
 
@@ -339,21 +449,27 @@ func checkMonitorsDiff(c *cli.Context) monitorDiff {
 		}
 	}
 
-	return monitorDiff
+	return monitorDiff, nil
 }
 
 func doMonitorsDiff(c *cli.Context) error {
 	monitorDiff := checkMonitorsDiff(c)
 	isExitCode := c.Bool("exit-code")
 	isReverse := c.Bool("reverse")
+	mask := func(m mkr.Monitor) mkr.Monitor { return m }
+	if shouldMaskSecrets(c, true) {
+		mask = maskMonitorSecrets
+	}
 
 	var diffs []string
 	for _, d := range monitorDiff.diff {
-		var diff string
+		from, to := mask(d.remote), mask(d.local)
 		if isReverse {
-			diff = diffMonitor(d.local, d.remote)
-		} else {
-			diff = diffMonitor(d.remote, d.local)
+			from, to = to, from
+		}
+		diff := trimDiffContext(diffMonitor(from, to), c.Int("diff-context"))
+		if diff == "" {
+			diff = fmt.Sprintf(" // %q: only masked secrets differ,", to.MonitorName())
 		}
 		diffs = append(diffs, diff)
 	}
@@ -375,11 +491,11 @@ func doMonitorsDiff(c *cli.Context) error {
 		noDiff = false
 	}
 	for _, m := range monitorOnlyFrom {
-		fmt.Println(stringifyMonitor(m, "-"))
+		fmt.Println(stringifyMonitor(mask(m), "-"))
 		noDiff = false
 	}
 	for _, m := range monitorOnlyTo {
-		fmt.Println(stringifyMonitor(m, "+"))
+		fmt.Println(stringifyMonitor(mask(m), "+"))
 		noDiff = false
 	}
 	if isExitCode == true && noDiff == false {
@@ -395,10 +511,14 @@ func doMonitorsPush(c *cli.Context) error {
 
 	client := newMackerelFromContext(c)
 	if isVerbose {
-		client.Verbose = true
+		setClientVerbose(client)
 	}
 
 	for _, m := range monitorDiff.onlyLocal {
+		if hasMaskedSecrets(m) {
+			logger.Log("warning", fmt.Sprintf("%q has masked header values, skipped", m.MonitorName()))
+			continue
+		}
 		logger.Log("info", "Create a new rule.")
 		fmt.Println(stringifyMonitor(m, ""))
 		if !isDryRun {
@@ -406,6 +526,10 @@ func doMonitorsPush(c *cli.Context) error {
 			logger.DieIf(err)
 		}
 	}
+	if c.String("split-dir") != "" && !c.Bool("prune") && len(monitorDiff.onlyRemote) > 0 {
+		logger.Log("info", fmt.Sprintf("%d rules which have no files are kept. Specify --prune to delete them.", len(monitorDiff.onlyRemote)))
+		monitorDiff.onlyRemote = nil
+	}
 	for _, m := range monitorDiff.onlyRemote {
 		logger.Log("info", "Delete a rule.")
 		fmt.Println(stringifyMonitor(m, ""))
@@ -415,6 +539,10 @@ func doMonitorsPush(c *cli.Context) error {
 		}
 	}
 	for _, d := range monitorDiff.diff {
+		if hasMaskedSecrets(d.local) {
+			logger.Log("warning", fmt.Sprintf("%q has masked header values, skipped", d.local.MonitorName()))
+			continue
+		}
 		logger.Log("info", "Update a rule.")
 		fmt.Println(stringifyMonitor(d.local, ""))
 		if !isDryRun {
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandMonitorsImport = cli.Command{
+	Name:      "import",
+	Usage:     "create monitors in a file and report their new ids",
+	ArgsUsage: "[--dry-run | -d] <file>",
+	Description: `
+    Create all monitors in <file>, which is in the format of "mkr monitors pull", such as monitors of another organization,
+    and print the remap report of their old ids in <file> to the ids of the created monitors.
+    <file> can have "notificationGroups" in the format of "GET /api/v0/notification-groups" in addition to "monitors",
+    and channels referenced by the groups but not found in the organization are listed as unresolved,
+    so that the notification settings can be fixed after the import.
+    With --dry-run, monitors are not created and the report is printed without new ids.
+`,
+	Action: doMonitorsImport,
+	Flags: []cli.Flag{
+		cli.BoolFlag{Name: "dry-run, d", Usage: "Show the report without creating monitors"},
+	},
+}
+
+// monitorRemap is a monitor in the imported file with its new id. NewID is empty with --dry-run.
+type monitorRemap struct {
+	OldID string `json:"oldId"`
+	NewID string `json:"newId"`
+	Name  string `json:"name"`
+}
+
+// unresolvedChannelRef is a channel referenced in the imported file which doesn't exist in the organization
+type unresolvedChannelRef struct {
+	ChannelID         string `json:"channelId"`
+	NotificationGroup string `json:"notificationGroup"`
+}
+
+type monitorImportReport struct {
+	Remaps             []*monitorRemap         `json:"remaps"`
+	UnresolvedChannels []*unresolvedChannelRef `json:"unresolvedChannels"`
+}
+
+// loadMonitorsImportFile loads monitors and notification groups in the file to import
+func loadMonitorsImportFile(fpath string) ([]mkr.Monitor, []*notificationGroup, error) {
+	content, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, nil, err
+	}
+	monitors, err := decodeMonitors(bytes.NewReader(content))
+	if err != nil {
+		return nil, nil, err
+	}
+	var data struct {
+		NotificationGroups []*notificationGroup `json:"notificationGroups"`
+	}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, nil, err
+	}
+	return monitors, data.NotificationGroups, nil
+}
+
+// importMonitors creates the monitors unless dryRun, and builds the report of them and channels referenced by groups.
+// Monitors are created in order, and the report of ones created before a failure is returned with the error.
+func importMonitors(client *mkr.Client, monitors []mkr.Monitor, groups []*notificationGroup, dryRun bool) (*monitorImportReport, error) {
+	report := &monitorImportReport{Remaps: []*monitorRemap{}, UnresolvedChannels: []*unresolvedChannelRef{}}
+
+	channels, err := findChannels(client)
+	if err != nil {
+		return report, err
+	}
+	channelIDs := make([]string, 0, len(channels))
+	for _, ch := range channels {
+		channelIDs = append(channelIDs, ch.ID)
+	}
+	for _, g := range groups {
+		for _, channelID := range g.ChildChannelIDs {
+			if !containsString(channelIDs, channelID) {
+				report.UnresolvedChannels = append(report.UnresolvedChannels, &unresolvedChannelRef{ChannelID: channelID, NotificationGroup: g.Name})
+			}
+		}
+	}
+
+	oldIDs := make([]string, len(monitors))
+	for i, m := range monitors {
+		oldIDs[i] = m.MonitorID()
+	}
+	// ids of another organization can't be used to create monitors
+	stripMonitorIDs(monitors)
+	for i, m := range monitors {
+		remap := &monitorRemap{OldID: oldIDs[i], Name: m.MonitorName()}
+		if !dryRun {
+			created, err := client.CreateMonitor(m)
+			if err != nil {
+				return report, fmt.Errorf("failed to create monitor %q: %s", m.MonitorName(), err)
+			}
+			remap.NewID = created.MonitorID()
+		}
+		report.Remaps = append(report.Remaps, remap)
+	}
+	return report, nil
+}
+
+func printMonitorImportReport(w io.Writer, report *monitorImportReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OLD ID\tNEW ID\tNAME")
+	for _, r := range report.Remaps {
+		oldID, newID := r.OldID, r.NewID
+		if oldID == "" {
+			oldID = "-"
+		}
+		if newID == "" {
+			newID = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", oldID, newID, r.Name)
+	}
+	tw.Flush()
+
+	if len(report.UnresolvedChannels) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Unresolved channel references:")
+		for _, ref := range report.UnresolvedChannels {
+			fmt.Fprintf(w, "  %s in notification group %q\n", ref.ChannelID, ref.NotificationGroup)
+		}
+	}
+}
+
+func doMonitorsImport(c *cli.Context) error {
+	fpath := c.Args().First()
+	if fpath == "" {
+		cli.ShowCommandHelp(c, "import")
+		os.Exit(1)
+	}
+	monitors, groups, err := loadMonitorsImportFile(fpath)
+	logger.DieIf(err)
+
+	report, err := importMonitors(newMackerelFromContext(c), monitors, groups, c.Bool("dry-run"))
+	printMonitorImportReport(os.Stdout, report)
+	logger.DieIf(err)
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportMonitors(t *testing.T) {
+	created := 0
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodGet && req.URL.Path == "/api/v0/channels":
+			fmt.Fprint(w, `{"channels":[{"id":"3Ja8vHsh8rm","name":"ops","type":"slack"}]}`)
+		case req.Method == http.MethodPost && req.URL.Path == "/api/v0/monitors":
+			var m map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&m)
+			if _, ok := m["id"]; ok {
+				t.Errorf("the old id should not be posted but got %v", m["id"])
+			}
+			created++
+			m["id"] = fmt.Sprintf("4New%d", created)
+			json.NewEncoder(w).Encode(m)
+		default:
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL.Path)
+		}
+	})
+	defer ts.Close()
+
+	f, err := ioutil.TempFile("", "mkr-monitors-import")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{
+		"monitors": [
+			{"id": "2cSZzK3XfmA", "type": "connectivity", "name": "connectivity"},
+			{"id": "2cSZzK3XfmB", "type": "host", "name": "CPU usage", "metric": "cpu%", "operator": ">", "warning": 80, "critical": 90, "duration": 3}
+		],
+		"notificationGroups": [
+			{"id": "2cSZzKnotif", "name": "on-call", "childChannelIds": ["3Ja8vHsh8rm", "2cSZzKchan1"], "monitors": [{"id": "2cSZzK3XfmA"}]}
+		]
+	}`)
+	f.Close()
+
+	monitors, groups, err := loadMonitorsImportFile(f.Name())
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	report, err := importMonitors(client, monitors, groups, false)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	wantRemaps := []*monitorRemap{
+		{OldID: "2cSZzK3XfmA", NewID: "4New1", Name: "connectivity"},
+		{OldID: "2cSZzK3XfmB", NewID: "4New2", Name: "CPU usage"},
+	}
+	if !reflect.DeepEqual(report.Remaps, wantRemaps) {
+		t.Errorf("remaps should be %+v but got %+v", wantRemaps, report.Remaps)
+	}
+	wantUnresolved := []*unresolvedChannelRef{{ChannelID: "2cSZzKchan1", NotificationGroup: "on-call"}}
+	if !reflect.DeepEqual(report.UnresolvedChannels, wantUnresolved) {
+		t.Errorf("unresolved channels should be %+v but got %+v", wantUnresolved, report.UnresolvedChannels)
+	}
+
+	var buf bytes.Buffer
+	printMonitorImportReport(&buf, report)
+	for _, line := range []string{"2cSZzK3XfmA  4New1   connectivity", "2cSZzKchan1 in notification group \"on-call\""} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("the report should contain %q but got:\n%s", line, buf.String())
+		}
+	}
+
+	monitors, groups, _ = loadMonitorsImportFile(f.Name())
+	report, err = importMonitors(client, monitors, groups, true)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if created != 2 || len(report.Remaps) != 2 || report.Remaps[0].NewID != "" {
+		t.Errorf("monitors should not be created with dry-run but got %+v", report.Remaps)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var monitorsMuteFlags = []cli.Flag{
+	cli.StringFlag{Name: "all-matching", Value: "", Usage: "Target all monitors whose names match the regular expression <regexp>"},
+	cli.BoolFlag{Name: "dry-run, d", Usage: "Show which monitors are targeted, but not update them."},
+}
+
+var commandMonitorsDisable = cli.Command{
+	Name:      "disable",
+	Usage:     "mute monitors",
+	ArgsUsage: "[--all-matching <regexp>] [--dry-run | -d] [<monitorIdOrName | ->...]",
+	Description: `
+    Mute monitors identified with IDs or names without deleting them, by setting isMute of the monitors.
+    With "-", IDs or names are read from stdin line by line.
+    Requests "GET /api/v0/monitors" and "PUT /api/v0/monitors/<monitorId>". See https://mackerel.io/api-docs/entry/monitors#update .
+`,
+	Action: doMonitorsDisable,
+	Flags:  monitorsMuteFlags,
+}
+
+var commandMonitorsEnable = cli.Command{
+	Name:      "enable",
+	Usage:     "unmute monitors",
+	ArgsUsage: "[--all-matching <regexp>] [--dry-run | -d] [<monitorIdOrName | ->...]",
+	Description: `
+    Unmute monitors muted by "mkr monitors disable" or on the web.
+    With "-", IDs or names are read from stdin line by line.
+    Requests "GET /api/v0/monitors" and "PUT /api/v0/monitors/<monitorId>". See https://mackerel.io/api-docs/entry/monitors#update .
+`,
+	Action: doMonitorsEnable,
+	Flags:  monitorsMuteFlags,
+}
+
+// rawMonitor is a monitor decoded as generic JSON values,
+// so that fields unknown to mackerel-client-go are kept on update.
+type rawMonitor map[string]interface{}
+
+func (m rawMonitor) id() string {
+	id, _ := m["id"].(string)
+	return id
+}
+
+func (m rawMonitor) name() string {
+	name, _ := m["name"].(string)
+	return name
+}
+
+func findRawMonitors(client *mkr.Client) ([]rawMonitor, error) {
+	var data struct {
+		Monitors []rawMonitor `json:"monitors"`
+	}
+	if err := requestJSON(client, http.MethodGet, "/api/v0/monitors", nil, &data); err != nil {
+		return nil, err
+	}
+	return data.Monitors, nil
+}
+
+// updateRawMonitor updates the monitor with all its fields except for the id
+func updateRawMonitor(client *mkr.Client, m rawMonitor) error {
+	payload := rawMonitor{}
+	for k, v := range m {
+		if k != "id" {
+			payload[k] = v
+		}
+	}
+	return requestJSON(client, http.MethodPut, "/api/v0/monitors/"+url.PathEscape(m.id()), payload, nil)
+}
+
+// resolveMonitorTargets returns monitors identified with the IDs or names, and whose names match the pattern
+func resolveMonitorTargets(monitors []rawMonitor, idsOrNames []string, pattern *regexp.Regexp) ([]rawMonitor, error) {
+	var targets []rawMonitor
+	seen := map[string]bool{}
+	add := func(m rawMonitor) {
+		if !seen[m.id()] {
+			seen[m.id()] = true
+			targets = append(targets, m)
+		}
+	}
+	for _, idOrName := range idsOrNames {
+		found := false
+		for _, m := range monitors {
+			if m.id() == idOrName || m.name() == idOrName {
+				add(m)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("monitor not found: %s", idOrName)
+		}
+	}
+	if pattern != nil {
+		for _, m := range monitors {
+			if pattern.MatchString(m.name()) {
+				add(m)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// setMonitorsMute updates isMute of the monitors one by one, and returns the number of failures
+func setMonitorsMute(client *mkr.Client, monitors []rawMonitor, mute bool) int {
+	state := "enabled"
+	if mute {
+		state = "disabled"
+	}
+	failed := 0
+	for _, m := range monitors {
+		m["isMute"] = mute
+		if err := updateRawMonitor(client, m); err != nil {
+			logger.Log("error", fmt.Sprintf("%s (%s): %s", m.id(), m.name(), err))
+			failed++
+			continue
+		}
+		logger.Log("updated", fmt.Sprintf("%s (%s): %s", m.id(), m.name(), state))
+	}
+	return failed
+}
+
+func doMonitorsDisable(c *cli.Context) error {
+	return doMonitorsMute(c, "disable", true)
+}
+
+func doMonitorsEnable(c *cli.Context) error {
+	return doMonitorsMute(c, "enable", false)
+}
+
+func doMonitorsMute(c *cli.Context, name string, mute bool) error {
+	idsOrNames, err := readIDsFromArgs(c.Args(), os.Stdin, strings.TrimSpace)
+	logger.DieIf(err)
+	var pattern *regexp.Regexp
+	if s := c.String("all-matching"); s != "" {
+		pattern, err = regexp.Compile(s)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("invalid --all-matching: %s", err), 1)
+		}
+	}
+	if len(idsOrNames) == 0 && pattern == nil {
+		cli.ShowCommandHelp(c, name)
+		os.Exit(1)
+	}
+
+	client := newMackerelFromContext(c)
+	monitors, err := findRawMonitors(client)
+	logger.DieIf(err)
+	targets, err := resolveMonitorTargets(monitors, idsOrNames, pattern)
+	logger.DieIf(err)
+
+	if c.Bool("dry-run") {
+		for _, m := range targets {
+			fmt.Printf("%s\t%s\n", m.id(), m.name())
+		}
+		return nil
+	}
+	if failed := setMonitorsMute(client, targets, mute); failed > 0 {
+		return cli.NewExitError(fmt.Sprintf("failed to %s %d of %d monitors", name, failed, len(targets)), 1)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandMonitorsSet = cli.Command{
+	Name:      "set",
+	Usage:     "change fields of a monitor",
+	ArgsUsage: "[--name <name>] [--memo <memo>] [--notification-interval <minutes>] [--warning <value>] [--critical <value>] <monitorId>",
+	Description: `
+    Change the specified fields of the monitor identified with <monitorId>, and keep the other fields.
+    --warning and --critical are available for host metric, service metric and expression monitors.
+    Requests "GET /api/v0/monitors/<monitorId>" and "PUT /api/v0/monitors/<monitorId>". See https://mackerel.io/api-docs/entry/monitors#update .
+`,
+	Action: doMonitorsSet,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "name", Usage: "Set the monitor name"},
+		cli.StringFlag{Name: "memo", Usage: "Set the memo of the monitor"},
+		cli.StringFlag{Name: "notification-interval", Usage: "Set the interval of re-sending notifications in minutes"},
+		cli.StringFlag{Name: "warning", Usage: "Set the warning threshold"},
+		cli.StringFlag{Name: "critical", Usage: "Set the critical threshold"},
+	},
+}
+
+// monitorField is a field of monitors changeable by "mkr monitors set"
+type monitorField struct {
+	flag string
+	key  string
+	// parse converts the flag value to the JSON value
+	parse func(string) (interface{}, error)
+	// types of monitors which have the field. All types have it if empty
+	types []string
+}
+
+var monitorFields = []*monitorField{
+	{flag: "name", key: "name", parse: parseMonitorString},
+	{flag: "memo", key: "memo", parse: parseMonitorString},
+	{flag: "notification-interval", key: "notificationInterval", parse: parseMonitorInterval},
+	{flag: "warning", key: "warning", parse: parseMonitorThreshold, types: []string{"host", "service", "expression"}},
+	{flag: "critical", key: "critical", parse: parseMonitorThreshold, types: []string{"host", "service", "expression"}},
+}
+
+func parseMonitorString(s string) (interface{}, error) {
+	return s, nil
+}
+
+func parseMonitorInterval(s string) (interface{}, error) {
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("should be a non-negative integer: %s", s)
+	}
+	return v, nil
+}
+
+func parseMonitorThreshold(s string) (interface{}, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("should be a number: %s", s)
+	}
+	return v, nil
+}
+
+func findRawMonitor(client *mkr.Client, monitorID string) (rawMonitor, error) {
+	var data struct {
+		Monitor rawMonitor `json:"monitor"`
+	}
+	if err := requestJSON(client, http.MethodGet, "/api/v0/monitors/"+url.PathEscape(monitorID), nil, &data); err != nil {
+		return nil, err
+	}
+	return data.Monitor, nil
+}
+
+// applyMonitorChanges sets flag values of changes to the monitor after validating all of them
+func applyMonitorChanges(m rawMonitor, changes map[string]string) error {
+	monitorType, _ := m["type"].(string)
+	values := map[string]interface{}{}
+	for _, field := range monitorFields {
+		s, ok := changes[field.flag]
+		if !ok {
+			continue
+		}
+		if len(field.types) > 0 && !containsString(field.types, monitorType) {
+			return fmt.Errorf("--%s is not available for %s monitors", field.flag, monitorType)
+		}
+		v, err := field.parse(s)
+		if err != nil {
+			return fmt.Errorf("invalid --%s: %s", field.flag, err)
+		}
+		values[field.key] = v
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("no fields to change are specified")
+	}
+	for k, v := range values {
+		m[k] = v
+	}
+	return nil
+}
+
+func doMonitorsSet(c *cli.Context) error {
+	monitorID := c.Args().First()
+	if monitorID == "" {
+		cli.ShowCommandHelp(c, "set")
+		os.Exit(1)
+	}
+	changes := map[string]string{}
+	for _, field := range monitorFields {
+		if c.IsSet(field.flag) {
+			changes[field.flag] = c.String(field.flag)
+		}
+	}
+
+	client := newMackerelFromContext(c)
+	m, err := findRawMonitor(client, monitorID)
+	logger.DieIf(err)
+	if err := applyMonitorChanges(m, changes); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	logger.DieIf(updateRawMonitor(client, m))
+	logger.Log("updated", fmt.Sprintf("%s (%s)", m.id(), m.name()))
+	return nil
+}
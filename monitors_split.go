@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+// letters in any language are kept in slugs, not to make names in non-ASCII languages empty
+var monitorSlugPattern = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// monitorSlug returns the file name of the monitor in a split directory without the extension
+func monitorSlug(m mkr.Monitor) string {
+	slug := strings.Trim(monitorSlugPattern.ReplaceAllString(strings.ToLower(m.MonitorName()), "-"), "-")
+	if slug == "" {
+		slug = m.MonitorType()
+	}
+	return slug
+}
+
+// monitorSplitFileNames returns unique file names of the monitors, numbering ones with the same slug
+func monitorSplitFileNames(monitors []mkr.Monitor) []string {
+	names := make([]string, len(monitors))
+	used := map[string]bool{}
+	for i, m := range monitors {
+		slug := monitorSlug(m)
+		name := slug + ".json"
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s-%d.json", slug, n)
+		}
+		used[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+// monitorSaveSplitDir saves each monitor to its own file in dir,
+// and removes other monitor files in dir so that the directory mirrors the rules.
+// It refuses dir having json files other than monitors, not to remove files unrelated to mkr.
+func monitorSaveSplitDir(monitors []mkr.Monitor, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if _, err := decodeMonitor(data); err != nil {
+			return fmt.Errorf("%s is not a monitor file, and monitors can't be saved to %s: %s", file, dir, err)
+		}
+	}
+
+	names := monitorSplitFileNames(monitors)
+	saved := map[string]bool{}
+	for i, m := range monitors {
+		err := writeOutput(filepath.Join(dir, names[i]), func(w io.Writer) error {
+			_, err := fmt.Fprintln(w, JSONMarshalIndent(m, "", "    "))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		saved[names[i]] = true
+	}
+
+	for _, file := range files {
+		if !saved[filepath.Base(file)] {
+			if err := os.Remove(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// monitorLoadSplitDir loads monitors from json files in dir, each of which defines a monitor
+func monitorLoadSplitDir(dir string) ([]mkr.Monitor, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	monitors := make([]mkr.Monitor, 0, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		m, err := decodeMonitor(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %s", file, err)
+		}
+		monitors = append(monitors, m)
+	}
+	return monitors, nil
+}
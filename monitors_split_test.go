@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestMonitorSplitDirRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkr-monitors-split")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// a file of a monitor which no longer exists
+	ioutil.WriteFile(filepath.Join(dir, "deleted.json"), []byte(`{"type":"connectivity","name":"deleted"}`), 0644)
+
+	remote := []mkr.Monitor{
+		&mkr.MonitorConnectivity{ID: "2cSZzK3XfmA", Name: "connectivity", Type: "connectivity"},
+		&mkr.MonitorHostMetric{ID: "2cSZzK3XfmB", Name: "CPU usage", Type: "host", Metric: "cpu%", Operator: ">", Warning: 80, Critical: 90, Duration: 3},
+		&mkr.MonitorHostMetric{ID: "2cSZzK3XfmC", Name: "cpu-usage", Type: "host", Metric: "cpu%", Operator: ">", Warning: 90, Critical: 95, Duration: 3},
+		&mkr.MonitorExternalHTTP{ID: "2cSZzK3XfmD", Name: "体温", Type: "external", URL: "https://example.com", Headers: []mkr.HeaderField{}},
+	}
+	if err := monitorSaveSplitDir(remote, dir); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for i := range files {
+		files[i] = filepath.Base(files[i])
+	}
+	if want := []string{"connectivity.json", "cpu-usage-2.json", "cpu-usage.json", "体温.json"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("files should be %v but got %v", want, files)
+	}
+
+	local, err := monitorLoadSplitDir(dir)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	d, err := diffMonitorRules(remote, local)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(d.onlyRemote) != 0 || len(d.onlyLocal) != 0 || len(d.diff) != 0 {
+		t.Errorf("pushing the pulled directory should have no diff but got: %+v", d)
+	}
+
+	os.Remove(filepath.Join(dir, "cpu-usage-2.json"))
+	local, _ = monitorLoadSplitDir(dir)
+	d, _ = diffMonitorRules(remote, local)
+	if len(d.onlyRemote) != 1 || d.onlyRemote[0].MonitorID() != "2cSZzK3XfmC" {
+		t.Errorf("the monitor whose file is deleted should be only on remote but got: %+v", d.onlyRemote)
+	}
+}
+
+func TestMonitorSaveSplitDir_unrelatedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkr-monitors-split")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	unrelated := filepath.Join(dir, "package.json")
+	ioutil.WriteFile(unrelated, []byte(`{"name":"app","version":"1.0.0"}`), 0644)
+
+	remote := []mkr.Monitor{&mkr.MonitorConnectivity{ID: "2cSZzK3XfmA", Name: "connectivity", Type: "connectivity"}}
+	if err := monitorSaveSplitDir(remote, dir); err == nil {
+		t.Errorf("should raise error for the directory with a json file other than monitors")
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("the unrelated file should be kept but got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "connectivity.json")); !os.IsNotExist(err) {
+		t.Errorf("no monitor should be saved to the directory with unrelated files")
+	}
+}
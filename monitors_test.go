@@ -1,7 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 
 	mkr "github.com/mackerelio/mackerel-client-go"
@@ -86,6 +93,45 @@ func TestMonitorSaveRules(t *testing.T) {
 	}
 }
 
+func TestMonitorSaveRules_stripIDs(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	monitors := []mkr.Monitor{
+		&mkr.MonitorConnectivity{ID: "12345", Name: "connectivity", Type: "connectivity"},
+		&mkr.MonitorHostMetric{ID: "12346", Name: "cpu", Type: "host", Metric: "cpu%", Operator: ">", Warning: 80, Critical: 90},
+	}
+	stripMonitorIDs(monitors)
+	monitorSaveRules(monitors, tmpFile.Name())
+
+	byt, _ := ioutil.ReadFile(tmpFile.Name())
+	var data struct {
+		Monitors []map[string]interface{} `json:"monitors"`
+	}
+	if err := json.Unmarshal(byt, &data); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(data.Monitors) != 2 {
+		t.Fatalf("the number of monitors should be 2 but got %d", len(data.Monitors))
+	}
+	for _, m := range data.Monitors {
+		if _, ok := m["id"]; ok {
+			t.Errorf("id should be stripped but got %v", m)
+		}
+	}
+
+	loaded, err := monitorLoadRules(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	remote := &mkr.MonitorConnectivity{ID: "99999", Name: "connectivity", Type: "connectivity"}
+	if _, ok := isSameMonitor(remote, loaded[0], true); !ok {
+		t.Errorf("a stripped monitor should be matched by name")
+	}
+}
+
 func TestStringifyMonitor(t *testing.T) {
 	a := &mkr.MonitorConnectivity{ID: "12345", Name: "foo", Type: "connectivity"}
 	expected := `+{
@@ -175,3 +221,284 @@ func TestDiffMonitorsWithScopes(t *testing.T) {
 		t.Errorf("expected:\n%s\n, output:\n%s\n", expected, diff)
 	}
 }
+
+func TestMonitorRulesRoundTrip_external(t *testing.T) {
+	const fixture = "test/monitors-external.json"
+
+	monitors, err := monitorLoadRules(fixture)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	monitorSaveRules(monitors, tmpFile.Name())
+
+	pulled, err := monitorLoadRules(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(pulled) != 1 {
+		t.Fatalf("should load 1 monitor but got %d", len(pulled))
+	}
+	if diff := diffMonitor(monitors[0], pulled[0]); diff != "" {
+		t.Errorf("external monitor should survive pull and push with no diff, but got:\n%s", diff)
+	}
+
+	// every field in the fixture, including headers, should be kept
+	var want, got interface{}
+	fixtureJSON, _ := ioutil.ReadFile(fixture)
+	pulledJSON, _ := ioutil.ReadFile(tmpFile.Name())
+	json.Unmarshal(fixtureJSON, &want)
+	json.Unmarshal(pulledJSON, &got)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("saved rules should be:\n%s\nbut got:\n%s", fixtureJSON, pulledJSON)
+	}
+}
+
+func TestDecodeMonitor_unsupportedType(t *testing.T) {
+	_, err := decodeMonitor(json.RawMessage(`{"type":"check","name":"check-procs","notificationInterval":60,"maxCheckAttempts":3}`))
+	if err == nil {
+		t.Fatal("should raise error for an unsupported monitor type")
+	}
+	if want := "Monitor 'check-procs' has unsupported type: 'check'"; err.Error() != want {
+		t.Errorf("error should be %q but got %q", want, err.Error())
+	}
+}
+
+func TestSetMonitorsMute(t *testing.T) {
+	payloads := map[string]map[string]interface{}{}
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodGet && req.URL.Path == "/api/v0/monitors":
+			fmt.Fprint(w, `{"monitors":[
+				{"id":"5rXR3","type":"connectivity","name":"connectivity"},
+				{"id":"5rXR4","type":"host","name":"noisy loadavg5","metric":"loadavg5","operator":">","warning":8,"critical":12},
+				{"id":"5rXR5","type":"host","name":"noisy cpu","metric":"cpu%","operator":">","warning":80,"critical":90,"isMute":true}
+			]}`)
+		case req.Method == http.MethodPut && strings.HasPrefix(req.URL.Path, "/api/v0/monitors/"):
+			var payload map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&payload)
+			payloads[strings.TrimPrefix(req.URL.Path, "/api/v0/monitors/")] = payload
+			fmt.Fprint(w, `{"id":"5rXR4"}`)
+		default:
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer ts.Close()
+
+	monitors, err := findRawMonitors(client)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	ids, _ := readIDsFromArgs([]string{"-"}, strings.NewReader("noisy loadavg5\n\n"), strings.TrimSpace)
+	targets, err := resolveMonitorTargets(monitors, ids, regexp.MustCompile("^noisy "))
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+
+	if failed := setMonitorsMute(client, targets, true); failed != 0 {
+		t.Errorf("no monitors should fail but got %d", failed)
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("two monitors should be updated but got %v", payloads)
+	}
+	for _, id := range []string{"5rXR4", "5rXR5"} {
+		payload := payloads[id]
+		if payload["isMute"] != true {
+			t.Errorf("isMute of %s should be true but got %v", id, payload["isMute"])
+		}
+		if _, ok := payload["id"]; ok {
+			t.Errorf("payload of %s should not contain id", id)
+		}
+		if payload["metric"] == nil {
+			t.Errorf("payload of %s should keep other fields but got %v", id, payload)
+		}
+	}
+
+	if _, err := resolveMonitorTargets(monitors, []string{"unknown"}, nil); err == nil {
+		t.Errorf("should raise error for an unknown monitor")
+	}
+}
+
+func TestApplyMonitorChanges(t *testing.T) {
+	var payload map[string]interface{}
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v0/monitors/5rXR4" {
+			t.Errorf("request path should be /api/v0/monitors/5rXR4 but got %s", req.URL.Path)
+		}
+		switch req.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `{"monitor":{"id":"5rXR4","type":"host","name":"loadavg5","metric":"loadavg5","operator":">","warning":8,"critical":12,"duration":5}}`)
+		case http.MethodPut:
+			json.NewDecoder(req.Body).Decode(&payload)
+			fmt.Fprint(w, `{"id":"5rXR4"}`)
+		}
+	})
+	defer ts.Close()
+
+	m, err := findRawMonitor(client, "5rXR4")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if err := applyMonitorChanges(m, map[string]string{"critical": "20"}); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if err := updateRawMonitor(client, m); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if payload["critical"] != 20.0 {
+		t.Errorf("critical should be 20 but got %v", payload["critical"])
+	}
+	if payload["warning"] != 8.0 || payload["duration"] != 5.0 {
+		t.Errorf("other fields should be kept but got %v", payload)
+	}
+
+	testCases := []struct {
+		monitor rawMonitor
+		changes map[string]string
+	}{
+		{rawMonitor{"type": "host"}, map[string]string{"critical": "high"}},
+		{rawMonitor{"type": "host"}, map[string]string{"notification-interval": "-1"}},
+		{rawMonitor{"type": "connectivity"}, map[string]string{"warning": "1"}},
+		{rawMonitor{"type": "host"}, map[string]string{}},
+	}
+	for _, testCase := range testCases {
+		if err := applyMonitorChanges(testCase.monitor, testCase.changes); err == nil {
+			t.Errorf("applyMonitorChanges(%v, %v) should raise error", testCase.monitor, testCase.changes)
+		}
+	}
+}
+
+func TestValidateMonitors(t *testing.T) {
+	content := []byte(`{
+    "monitors": [
+        {
+            "type": "connectivity",
+            "name": "connectivity"
+        },
+        {
+            "type": "host",
+            "name": "loadavg5",
+            "metric": "loadavg5",
+            "operator": ">",
+            "warning": 12,
+            "critical": 8,
+            "scopes": ["blog: app", "unknown"]
+        },
+        {
+            "type": "service",
+            "name": "",
+            "service": "blog",
+            "metric": "custom.access.count",
+            "operator": "=",
+            "critical": 10
+        },
+        {
+            "type": "external",
+            "name": "connectivity",
+            "url": "ftp://example.com"
+        },
+        {
+            "type": "anomaly",
+            "name": "unsupported"
+        }
+    ]
+}
+`)
+	monitors, lines, err := parseMonitorsWithLines(content)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if want := []int{3, 7, 16, 24, 29}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines should be %v but got %v", want, lines)
+	}
+
+	services := map[string]map[string]bool{"blog": {"db": true}}
+	var got []string
+	for _, p := range validateMonitors(monitors, lines, services) {
+		got = append(got, p.format("monitors.json"))
+	}
+	expected := []string{
+		`monitors.json:7: monitors[1] "loadavg5": warning (12) should not be greater than critical (8) with operator '>'`,
+		`monitors.json:7: monitors[1] "loadavg5": role of scopes "blog: app" is not found`,
+		`monitors.json:7: monitors[1] "loadavg5": service of scopes "unknown" is not found`,
+		`monitors.json:16: monitors[2] "": name should not be empty`,
+		`monitors.json:16: monitors[2] "": operator should be '>' or '<': "="`,
+		`monitors.json:16: monitors[2] "": warning should be a number`,
+		`monitors.json:24: monitors[3] "connectivity": url should be an http or https URL: "ftp://example.com"`,
+		`monitors.json:24: monitors[3] "connectivity": name is the same as monitors[0], so it can't be matched by name on push`,
+		`monitors.json:29: monitors[4] "unsupported": unsupported type: "anomaly"`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("problems should be:\n%s\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	// references are not checked offline
+	if problems := validateMonitors(monitors[1:2], lines[1:2], nil); len(problems) != 1 {
+		t.Errorf("only the threshold problem should be found offline but got %d problems", len(problems))
+	}
+}
+
+func TestTrimDiffContext(t *testing.T) {
+	const diff = ` {
+   "critical": 90,
+   "duration": 3,
+   "metric": "cpu%",
+   "name": "cpu",
+-  "operator": ">",
++  "operator": "<",
+   "scopes": [
+     "blog"
+   ],
+   "type": "host"
+ },`
+
+	countLines := func(s string) (changed, context int) {
+		for _, l := range strings.Split(s, "\n") {
+			switch {
+			case strings.HasPrefix(l, "+") || strings.HasPrefix(l, "-"):
+				changed++
+			case l != diffOmittedLine:
+				context++
+			}
+		}
+		return
+	}
+
+	for _, testCase := range []struct {
+		context int
+		want    int
+	}{
+		{0, 1},
+		{1, 2},
+		{3, 6},
+		{-1, 10},
+	} {
+		trimmed := trimDiffContext(diff, testCase.context)
+		changed, context := countLines(trimmed)
+		if changed != 2 {
+			t.Errorf("changed lines should be kept with context %d but got:\n%s", testCase.context, trimmed)
+		}
+		if context != testCase.want {
+			t.Errorf("%d context lines should be shown with context %d but got %d:\n%s", testCase.want, testCase.context, context, trimmed)
+		}
+	}
+
+	want := strings.Join([]string{diffOmittedLine, `   "name": "cpu",`, `-  "operator": ">",`, `+  "operator": "<",`, `   "scopes": [`, diffOmittedLine}, "\n")
+	if got := trimDiffContext(diff, 1); got != want {
+		t.Errorf("omitted lines should be replaced:\n%s\nbut got:\n%s", want, got)
+	}
+
+	want = strings.Join([]string{diffOmittedLine, `   "name": "cpu",`, `-  "operator": ">",`, `+  "operator": "<",`, diffOmittedLine}, "\n")
+	if got := trimDiffContext(diff, 0); got != want {
+		t.Errorf("the name line should be kept:\n%s\nbut got:\n%s", want, got)
+	}
+	if got := trimDiffContext("", 3); got != "" {
+		t.Errorf("the empty diff should be kept empty but got %q", got)
+	}
+}
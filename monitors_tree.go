@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandMonitorsTree = cli.Command{
+	Name:      "tree",
+	Usage:     "show monitors grouped by type and scope",
+	ArgsUsage: "[--output | -o <format>]",
+	Description: `
+    Show monitors as a tree grouped by the type and the scope they apply to, which helps finding gaps of the coverage.
+    Scopes of host and connectivity monitors are their services and roles ("(all hosts)" without scopes),
+    and those of service and external monitors are their services. A monitor with multiple scopes appears under each of them.
+    Excluded scopes are shown after the monitor name prefixed by "!". With -o json, the tree is output as nested JSON.
+`,
+	Action: doMonitorsTree,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "output, o", Value: "text", Usage: "Output format ('text' or 'json')"},
+	},
+}
+
+const (
+	monitorScopeAllHosts = "(all hosts)"
+	monitorScopeNone     = "(no scope)"
+)
+
+type monitorTreeType struct {
+	Type   string              `json:"type"`
+	Scopes []*monitorTreeScope `json:"scopes"`
+}
+
+type monitorTreeScope struct {
+	Scope    string             `json:"scope"`
+	Monitors []*monitorTreeItem `json:"monitors"`
+}
+
+type monitorTreeItem struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	ExcludeScopes []string `json:"excludeScopes,omitempty"`
+}
+
+func rawStrings(v interface{}) []string {
+	values, _ := v.([]interface{})
+	var strs []string
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+// monitorScopes returns scopes which the monitor applies to
+func monitorScopes(m rawMonitor) []string {
+	switch m["type"] {
+	case "host", "connectivity", "anomalyDetection":
+		if scopes := rawStrings(m["scopes"]); len(scopes) > 0 {
+			return scopes
+		}
+		return []string{monitorScopeAllHosts}
+	case "service", "external":
+		if service, _ := m["service"].(string); service != "" {
+			return []string{service}
+		}
+	}
+	return []string{monitorScopeNone}
+}
+
+// buildMonitorTree groups monitors by the type and the scope.
+// Types, scopes and monitors are sorted by their names.
+func buildMonitorTree(monitors []rawMonitor) []*monitorTreeType {
+	byType := map[string]map[string][]*monitorTreeItem{}
+	for _, m := range monitors {
+		typ, _ := m["type"].(string)
+		if byType[typ] == nil {
+			byType[typ] = map[string][]*monitorTreeItem{}
+		}
+		for _, scope := range monitorScopes(m) {
+			item := &monitorTreeItem{ID: m.id(), Name: m.name(), ExcludeScopes: rawStrings(m["excludeScopes"])}
+			byType[typ][scope] = append(byType[typ][scope], item)
+		}
+	}
+
+	tree := make([]*monitorTreeType, 0, len(byType))
+	for typ, scopes := range byType {
+		t := &monitorTreeType{Type: typ, Scopes: make([]*monitorTreeScope, 0, len(scopes))}
+		for scope, items := range scopes {
+			sort.Slice(items, func(i, j int) bool {
+				if items[i].Name != items[j].Name {
+					return items[i].Name < items[j].Name
+				}
+				return items[i].ID < items[j].ID
+			})
+			t.Scopes = append(t.Scopes, &monitorTreeScope{Scope: scope, Monitors: items})
+		}
+		sort.Slice(t.Scopes, func(i, j int) bool { return t.Scopes[i].Scope < t.Scopes[j].Scope })
+		tree = append(tree, t)
+	}
+	sort.Slice(tree, func(i, j int) bool { return tree[i].Type < tree[j].Type })
+	return tree
+}
+
+func printMonitorTree(w io.Writer, tree []*monitorTreeType) {
+	for _, t := range tree {
+		fmt.Fprintln(w, t.Type)
+		for _, s := range t.Scopes {
+			fmt.Fprintf(w, "  %s\n", s.Scope)
+			for _, m := range s.Monitors {
+				fmt.Fprintf(w, "    %s (%s)", m.Name, m.ID)
+				for _, scope := range m.ExcludeScopes {
+					fmt.Fprintf(w, " !%s", scope)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+	}
+}
+
+func doMonitorsTree(c *cli.Context) error {
+	output := c.String("output")
+	if output != "text" && output != "json" {
+		return cli.NewExitError(fmt.Sprintf("unknown output format: %s", output), 1)
+	}
+
+	monitors, err := findRawMonitors(newMackerelFromContext(c))
+	logger.DieIf(err)
+
+	tree := buildMonitorTree(monitors)
+	if output == "json" {
+		PrettyPrintJSON(tree)
+	} else {
+		printMonitorTree(os.Stdout, tree)
+	}
+	return nil
+}
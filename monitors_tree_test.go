@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildMonitorTree(t *testing.T) {
+	var monitors []rawMonitor
+	json.Unmarshal([]byte(`[
+		{"id": "m1", "type": "host", "name": "cpu", "scopes": ["blog", "shop:db"], "excludeScopes": ["blog:batch"]},
+		{"id": "m2", "type": "host", "name": "disk"},
+		{"id": "m3", "type": "connectivity", "name": "connectivity", "scopes": ["blog"]},
+		{"id": "m4", "type": "service", "name": "access", "service": "blog"},
+		{"id": "m5", "type": "external", "name": "top page", "service": "shop"},
+		{"id": "m6", "type": "expression", "name": "sum of cpu"},
+		{"id": "m7", "type": "host", "name": "memory", "scopes": ["blog"]}
+	]`), &monitors)
+
+	var buf bytes.Buffer
+	printMonitorTree(&buf, buildMonitorTree(monitors))
+	want := `connectivity
+  blog
+    connectivity (m3)
+expression
+  (no scope)
+    sum of cpu (m6)
+external
+  shop
+    top page (m5)
+host
+  (all hosts)
+    disk (m2)
+  blog
+    cpu (m1) !blog:batch
+    memory (m7)
+  shop:db
+    cpu (m1) !blog:batch
+service
+  blog
+    access (m4)
+`
+	if buf.String() != want {
+		t.Errorf("the tree should be:\n%s\nbut got:\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandMonitorsValidate = cli.Command{
+	Name:      "validate",
+	Usage:     "validate rules",
+	ArgsUsage: "[--offline] [<file>]",
+	Description: `
+    Validate monitor rules stored in a file without updating Mackerel, and report all problems with line numbers.
+    The file can be specified by argument <file>. The default is 'monitors.json'.
+    Types, names, thresholds and their order by the operator, and required fields of each type are checked.
+    Services and roles referenced by monitors are resolved by "GET /api/v0/services" unless --offline.
+    Exits with nonzero status if any problem is found.
+`,
+	Action: doMonitorsValidate,
+	Flags: []cli.Flag{
+		cli.BoolFlag{Name: "offline", Usage: "Skip checks which require the API"},
+	},
+}
+
+// monitorProblem is a problem found in a monitor rule
+type monitorProblem struct {
+	index   int
+	line    int
+	name    string
+	message string
+}
+
+func (p *monitorProblem) format(file string) string {
+	return fmt.Sprintf("%s:%d: monitors[%d] %q: %s", file, p.line, p.index, p.name, p.message)
+}
+
+// parseMonitorsWithLines decodes monitor rules as generic JSON values,
+// and returns the line number where each of them starts.
+func parseMonitorsWithLines(content []byte) ([]rawMonitor, []int, error) {
+	var data struct {
+		Monitors []json.RawMessage `json:"monitors"`
+	}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, nil, err
+	}
+
+	monitors := make([]rawMonitor, 0, len(data.Monitors))
+	lines := make([]int, 0, len(data.Monitors))
+	offset := 0
+	for i, raw := range data.Monitors {
+		var m rawMonitor
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return nil, nil, fmt.Errorf("monitors[%d]: %s", i, err)
+		}
+		// json.RawMessage keeps the bytes of the source, so it can be found in the content
+		line := 0
+		if pos := bytes.Index(content[offset:], raw); pos >= 0 {
+			line = bytes.Count(content[:offset+pos], []byte("\n")) + 1
+			offset += pos + len(raw)
+		}
+		monitors = append(monitors, m)
+		lines = append(lines, line)
+	}
+	return monitors, lines, nil
+}
+
+func (m rawMonitor) stringField(key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func (m rawMonitor) numberField(key string) (float64, bool) {
+	v, ok := m[key].(float64)
+	return v, ok
+}
+
+// lintMonitor returns problems of the monitor rule which can be found without the API
+func lintMonitor(m rawMonitor) []string {
+	var problems []string
+	if m.name() == "" {
+		problems = append(problems, "name should not be empty")
+	}
+
+	required := map[string][]string{
+		"connectivity": nil,
+		"host":         {"metric"},
+		"service":      {"service", "metric"},
+		"external":     {"url"},
+		"expression":   {"expression"},
+	}
+	monitorType := m.stringField("type")
+	fields, ok := required[monitorType]
+	if !ok {
+		return append(problems, fmt.Sprintf("unsupported type: %q", monitorType))
+	}
+	for _, field := range fields {
+		if m.stringField(field) == "" {
+			problems = append(problems, fmt.Sprintf("%s should not be empty for %s monitors", field, monitorType))
+		}
+	}
+
+	switch monitorType {
+	case "host", "service", "expression":
+		problems = append(problems, lintMonitorThresholds(m, "operator", "warning", "critical")...)
+	case "external":
+		if u := m.stringField("url"); u != "" {
+			if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				problems = append(problems, fmt.Sprintf("url should be an http or https URL: %q", u))
+			}
+		}
+		warning, okWarning := m.numberField("responseTimeWarning")
+		critical, okCritical := m.numberField("responseTimeCritical")
+		if okWarning && okCritical && warning > critical {
+			problems = append(problems, fmt.Sprintf("responseTimeWarning (%v) should not be greater than responseTimeCritical (%v)", warning, critical))
+		}
+	}
+	return problems
+}
+
+func lintMonitorThresholds(m rawMonitor, operatorKey, warningKey, criticalKey string) []string {
+	var problems []string
+	operator := m.stringField(operatorKey)
+	if operator != ">" && operator != "<" {
+		problems = append(problems, fmt.Sprintf("%s should be '>' or '<': %q", operatorKey, operator))
+	}
+	warning, okWarning := m.numberField(warningKey)
+	if !okWarning {
+		problems = append(problems, fmt.Sprintf("%s should be a number", warningKey))
+	}
+	critical, okCritical := m.numberField(criticalKey)
+	if !okCritical {
+		problems = append(problems, fmt.Sprintf("%s should be a number", criticalKey))
+	}
+	if okWarning && okCritical {
+		if operator == ">" && warning > critical {
+			problems = append(problems, fmt.Sprintf("%s (%v) should not be greater than %s (%v) with operator '>'", warningKey, warning, criticalKey, critical))
+		}
+		if operator == "<" && warning < critical {
+			problems = append(problems, fmt.Sprintf("%s (%v) should not be less than %s (%v) with operator '<'", warningKey, warning, criticalKey, critical))
+		}
+	}
+	return problems
+}
+
+// lintMonitorReferences returns problems of services and roles referenced by the monitor rule.
+// services maps service names to their role names.
+func lintMonitorReferences(m rawMonitor, services map[string]map[string]bool) []string {
+	var problems []string
+	if service := m.stringField("service"); service != "" {
+		if _, ok := services[service]; !ok {
+			problems = append(problems, fmt.Sprintf("service %q is not found", service))
+		}
+	}
+	for _, key := range []string{"scopes", "excludeScopes"} {
+		scopes, _ := m[key].([]interface{})
+		for _, scope := range scopes {
+			s, _ := scope.(string)
+			parts := strings.SplitN(s, ":", 2)
+			roles, ok := services[strings.TrimSpace(parts[0])]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("service of %s %q is not found", key, s))
+				continue
+			}
+			if len(parts) == 2 && !roles[strings.TrimSpace(parts[1])] {
+				problems = append(problems, fmt.Sprintf("role of %s %q is not found", key, s))
+			}
+		}
+	}
+	return problems
+}
+
+func servicesToRoles(services []mkr.Service) map[string]map[string]bool {
+	m := make(map[string]map[string]bool, len(services))
+	for _, service := range services {
+		roles := make(map[string]bool, len(service.Roles))
+		for _, role := range service.Roles {
+			roles[role] = true
+		}
+		m[service.Name] = roles
+	}
+	return m
+}
+
+// validateMonitors returns all problems of the monitor rules.
+// References are checked only if services is not nil.
+func validateMonitors(monitors []rawMonitor, lines []int, services map[string]map[string]bool) []*monitorProblem {
+	var problems []*monitorProblem
+	names := map[string]int{}
+	for i, m := range monitors {
+		messages := lintMonitor(m)
+		if services != nil {
+			messages = append(messages, lintMonitorReferences(m, services)...)
+		}
+		if j, ok := names[m.name()]; ok && m.name() != "" {
+			messages = append(messages, fmt.Sprintf("name is the same as monitors[%d], so it can't be matched by name on push", j))
+		} else {
+			names[m.name()] = i
+		}
+		for _, message := range messages {
+			problems = append(problems, &monitorProblem{index: i, line: lines[i], name: m.name(), message: message})
+		}
+	}
+	return problems
+}
+
+func printMonitorProblems(w io.Writer, file string, problems []*monitorProblem) {
+	for _, p := range problems {
+		fmt.Fprintln(w, p.format(file))
+	}
+}
+
+func doMonitorsValidate(c *cli.Context) error {
+	file := c.Args().First()
+	if file == "" {
+		file = "monitors.json"
+	}
+	content, err := ioutil.ReadFile(file)
+	logger.DieIf(err)
+	monitors, lines, err := parseMonitorsWithLines(content)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("%s: failed to parse: %s", file, err), 1)
+	}
+
+	var services map[string]map[string]bool
+	if !c.Bool("offline") {
+		ss, err := newMackerelFromContext(c).FindServices()
+		logger.DieIf(err)
+		services = servicesToRoles(ss)
+	}
+
+	problems := validateMonitors(monitors, lines, services)
+	printMonitorProblems(os.Stdout, file, problems)
+	if len(problems) > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d problems are found in %d monitors", len(problems), len(monitors)), 1)
+	}
+	logger.Log("info", fmt.Sprintf("%d monitors are valid", len(monitors)))
+	return nil
+}
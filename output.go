@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+// outFlag is shared by commands which output listings, to write them to a file instead of stdout
+var outFlag = cli.StringFlag{Name: "out", Value: "-", Usage: "Write the output to <path>. '-' means stdout"}
+
+// isStdoutPath returns whether the --out path means stdout
+func isStdoutPath(path string) bool {
+	return path == "" || path == "-"
+}
+
+// writeOutput calls fn with the writer to the path, or stdout if the path is "-".
+// A file is written atomically by renaming a temporary file in the same directory,
+// so it is left untouched if fn fails.
+func writeOutput(path string, fn func(w io.Writer) error) error {
+	if isStdoutPath(path) {
+		return fn(os.Stdout)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	defer os.Remove(tmpName)
+
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// ioutil.TempFile creates a file with 0600, so make it the same as os.Create
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+func TestWriteOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkr-output")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.txt")
+
+	if err := writeOutput(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, "hello\n")
+		return err
+	}); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if content, _ := ioutil.ReadFile(path); string(content) != "hello\n" {
+		t.Errorf("content should be %q but got %q", "hello\n", string(content))
+	}
+
+	if err := writeOutput(path, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errors.New("failed")
+	}); err == nil {
+		t.Errorf("should raise error")
+	}
+	if content, _ := ioutil.ReadFile(path); string(content) != "hello\n" {
+		t.Errorf("the file should be left untouched on failure but got %q", string(content))
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("temporary files should be removed but got %d files", len(files))
+	}
+}
+
+func TestServices_out(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"services":[{"name":"blog","memo":"","roles":["app"]}]}`)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "mkr-output")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "services.json")
+
+	origAPIKey := os.Getenv("MACKEREL_APIKEY")
+	os.Setenv("MACKEREL_APIKEY", "dummy-key")
+	defer os.Setenv("MACKEREL_APIKEY", origAPIKey)
+
+	app := cli.NewApp()
+	app.Name = "mkr"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "conf", Value: filepath.Join(dir, "not_exists.conf")},
+		cli.StringFlag{Name: "apibase"},
+		cli.StringFlag{Name: "user-agent"},
+	}
+	app.Commands = []cli.Command{commandServices}
+	if err := app.Run([]string{"mkr", "--apibase", ts.URL, "services", "--out", path}); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("the output should be written to %s: %v", path, err)
+	}
+	want := `[
+    {
+        "name": "blog",
+        "memo": "",
+        "roles": [
+            "app"
+        ]
+    }
+]
+`
+	if string(content) != want {
+		t.Errorf("content should be:\n%s\nbut got:\n%s", want, string(content))
+	}
+}
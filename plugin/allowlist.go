@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// allowlist is the list of patterns of artifact URLs permitted to install.
+// A pattern is "<host>/<path>" without the scheme, where "*" in path.Match syntax matches within a path segment,
+// and a pattern ending with "/" matches all URLs under it (e.g. "github.com/mackerelio/").
+type allowlist []string
+
+// Load an allowlist file. A nonexistent file is an error not to permit all URLs by a typo,
+// and a file without patterns permits no URL.
+func loadAllowlist(fpath string) (allowlist, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseAllowlist(f)
+}
+
+// Parse an allowlist with a pattern per line. Blank lines and lines starting with "#" are ignored.
+func parseAllowlist(r io.Reader) (allowlist, error) {
+	a := allowlist{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("allowlist: invalid pattern %q", line)
+		}
+		a = append(a, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Check the artifact URL is permitted. Any URL is permitted by the nil allowlist, which means no allowlist is given.
+func (a allowlist) check(rawurl string) error {
+	if a == nil {
+		return nil
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	target := u.Host + u.EscapedPath()
+	for _, pattern := range a {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(target, pattern) {
+			return nil
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not permitted by the allowlist", redactURL(rawurl))
+}
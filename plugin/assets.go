@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// releaseAssets is the asset names of a release and the name to be installed
+type releaseAssets struct {
+	tag      string
+	names    []string
+	expected string
+}
+
+// listReleaseAssets fetches the asset names of the release from Github API.
+// The latest release is used unless the release tag is specified.
+func (it *installTarget) listReleaseAssets() (*releaseAssets, error) {
+	if it.owner == "" || it.repo == "" {
+		return nil, fmt.Errorf("Listing assets is supported only for <owner>/<repo>[@<release_tag>]")
+	}
+
+	ctx := context.Background()
+	client := getGithubClient(ctx)
+	client.BaseURL = it.getAPIGithubURL()
+
+	var release *github.RepositoryRelease
+	var err error
+	if it.releaseTag != "" {
+		release, _, err = client.Repositories.GetReleaseByTag(ctx, it.owner, it.repo, it.releaseTag)
+	} else {
+		release, _, err = client.Repositories.GetLatestRelease(ctx, it.owner, it.repo)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ra := &releaseAssets{tag: release.GetTagName(), expected: assetFilename(it.repo)}
+	for _, asset := range release.Assets {
+		ra.names = append(ra.names, asset.GetName())
+	}
+	return ra, nil
+}
+
+// printReleaseAssets prints asset names with "*" for the one to be installed.
+// It returns whether the asset to be installed is found.
+func printReleaseAssets(w io.Writer, ra *releaseAssets) bool {
+	fmt.Fprintf(w, "Release: %s\n", ra.tag)
+	found := false
+	for _, name := range ra.names {
+		mark := " "
+		if name == ra.expected {
+			mark = "*"
+			found = true
+		}
+		fmt.Fprintf(w, "%s %s\n", mark, name)
+	}
+	return found
+}
+
+func doListAssets(w io.Writer, it *installTarget) error {
+	ra, err := it.listReleaseAssets()
+	if err != nil {
+		return errors.Wrap(err, "Failed to list release assets")
+	}
+	if !printReleaseAssets(w, ra) {
+		return fmt.Errorf("No asset matches %s in the release %s", ra.expected, ra.tag)
+	}
+	return nil
+}
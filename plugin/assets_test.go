@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListReleaseAssets(t *testing.T) {
+	teardown := githubTestSetup()
+	defer teardown()
+
+	expected := fmt.Sprintf("mackerel-plugin-sample_%s_%s.zip", runtime.GOOS, runtime.GOARCH)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner1/mackerel-plugin-sample/releases/tags/v0.1.0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tag_name": "v0.1.0", "assets": [{"name": "mackerel-plugin-sample_plan9_mips.zip"}, {"name": %q}]}`, expected)
+	})
+	mux.HandleFunc("/repos/owner1/mackerel-plugin-other/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tag_name": "v0.2.0", "assets": [{"name": "other_plan9_mips.zip"}]}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	{
+		it := &installTarget{owner: "owner1", repo: "mackerel-plugin-sample", releaseTag: "v0.1.0", apiGithubURL: ts.URL}
+		var buf bytes.Buffer
+		err := doListAssets(&buf, it)
+		assert.NoError(t, err, "the matching asset is found")
+		assert.Equal(t, "Release: v0.1.0\n  mackerel-plugin-sample_plan9_mips.zip\n* "+expected+"\n", buf.String(), "the matching asset is marked")
+	}
+
+	{
+		it := &installTarget{owner: "owner1", repo: "mackerel-plugin-other", apiGithubURL: ts.URL}
+		var buf bytes.Buffer
+		err := doListAssets(&buf, it)
+		assert.Error(t, err, "no asset matches")
+		assert.Equal(t, "Release: v0.2.0\n  other_plan9_mips.zip\n", buf.String(), "the assets of the latest release are listed")
+	}
+
+	{
+		it := &installTarget{pluginName: "mackerel-plugin-sample"}
+		_, err := it.listReleaseAssets()
+		assert.Error(t, err, "listing assets requires <owner>/<repo>")
+	}
+}
@@ -0,0 +1,176 @@
+package plugin
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/mackerelio/mkr/logger"
+	"github.com/mholt/archiver"
+	"github.com/pkg/errors"
+)
+
+// renamePlugin moves a plugin file, and is replaced in tests
+var renamePlugin = os.Rename
+
+// stagedPlugin is a plugin file extracted in the work directory, which will be placed to dest
+type stagedPlugin struct {
+	src  string
+	dest string
+}
+
+// Extract artifact and install all plugins in it, or none of them.
+// Plugins are validated before placed, and already placed ones are rolled back if a later one fails.
+func installByArtifactAtomically(artifactFile, bindir, workdir string, opts installOptions) ([]string, error) {
+	extractDir := filepath.Join(workdir, "extract")
+	if err := os.MkdirAll(extractDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := archiver.Zip.Open(artifactFile, extractDir); err != nil {
+		return nil, err
+	}
+	staged, err := stagePlugins(extractDir, bindir, opts)
+	if err != nil {
+		return nil, err
+	}
+	return placePluginsAtomically(staged, filepath.Join(workdir, "backup"), opts.overwrite)
+}
+
+// stagePlugins looks for plugin files in dir, and validates all of them
+func stagePlugins(dir, bindir string, opts installOptions) ([]*stagedPlugin, error) {
+	var staged []*stagedPlugin
+	names := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		// same as installByArtifact, files without execution permission are not plugins
+		if info.IsDir() || !isPluginFile(info, opts.allowAnyName) {
+			return nil
+		}
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("plugin %s is duplicated in the artifact: %s and %s", name, other, path)
+		}
+		names[name] = path
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("plugin %s is not a regular file", path)
+		}
+		if (info.Mode() & 0500) != 0500 {
+			return fmt.Errorf("plugin %s is not readable and executable by the owner: %s", path, info.Mode().Perm())
+		}
+		if fi, err := os.Stat(filepath.Join(bindir, name)); err == nil && fi.IsDir() {
+			return fmt.Errorf("%s is a directory", filepath.Join(bindir, name))
+		}
+		if opts.checkArch {
+			if err := checkPluginArch(path); err != nil {
+				return err
+			}
+		}
+		warnUnconventionalName(name)
+		staged = append(staged, &stagedPlugin{src: path, dest: filepath.Join(bindir, name)})
+		return nil
+	})
+	return staged, err
+}
+
+// placePluginsAtomically moves staged plugins to their destinations in one pass.
+// Existing plugins are moved to backupDir while overwritten, and restored on the rollback.
+func placePluginsAtomically(staged []*stagedPlugin, backupDir string, overwrite bool) ([]string, error) {
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return nil, err
+	}
+
+	type move struct {
+		dest   string
+		backup string
+		placed bool
+	}
+	var moves []*move
+	rollback := func() {
+		for i := len(moves) - 1; i >= 0; i-- {
+			m := moves[i]
+			if m.placed {
+				logger.ErrorIf(os.Remove(m.dest))
+			}
+			if m.backup != "" {
+				logger.ErrorIf(renamePlugin(m.backup, m.dest))
+			}
+		}
+	}
+
+	var installed []string
+	for _, p := range staged {
+		m := &move{dest: p.dest}
+		if _, err := os.Stat(p.dest); err == nil {
+			if !overwrite {
+				logger.Log("", fmt.Sprintf("%s already exists. Skip installing for now", p.dest))
+				continue
+			}
+			backup := filepath.Join(backupDir, filepath.Base(p.dest))
+			if err := renamePlugin(p.dest, backup); err != nil {
+				rollback()
+				return nil, errors.Wrapf(err, "failed to back up %s", p.dest)
+			}
+			m.backup = backup
+		}
+		moves = append(moves, m)
+
+		logger.Log("", fmt.Sprintf("Installing %s", p.dest))
+		if err := renamePlugin(p.src, p.dest); err != nil {
+			rollback()
+			return nil, errors.Wrapf(err, "failed to place %s, and rolled back installed plugins", p.dest)
+		}
+		m.placed = true
+		installed = append(installed, p.dest)
+	}
+	return installed, nil
+}
+
+// the arm64 architectures of Mach-O and PE, which debug/macho and debug/pe define since Go 1.11
+const (
+	machoCpuArm64           = macho.Cpu(macho.CpuArm | 0x01000000)
+	peImageFileMachineArm64 = uint16(0xaa64)
+)
+
+// checkPluginArch checks that the plugin binary is built for the current OS and architecture.
+// Files in unknown formats, such as scripts, are accepted.
+func checkPluginArch(path string) error {
+	goos, goarch := "", ""
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		goos = "linux"
+		goarch = map[elf.Machine]string{
+			elf.EM_X86_64: "amd64", elf.EM_386: "386", elf.EM_ARM: "arm", elf.EM_AARCH64: "arm64",
+		}[f.Machine]
+		// ELF is used by other Unix-like OSes too
+		if runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+			goos = runtime.GOOS
+		}
+	} else if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		goos = "darwin"
+		goarch = map[macho.Cpu]string{
+			macho.CpuAmd64: "amd64", macho.Cpu386: "386", macho.CpuArm: "arm", machoCpuArm64: "arm64",
+		}[f.Cpu]
+	} else if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+		goos = "windows"
+		goarch = map[uint16]string{
+			pe.IMAGE_FILE_MACHINE_AMD64: "amd64", pe.IMAGE_FILE_MACHINE_I386: "386", peImageFileMachineArm64: "arm64",
+		}[f.Machine]
+	} else {
+		return nil
+	}
+	if goos != runtime.GOOS || goarch != runtime.GOARCH {
+		if goarch == "" {
+			goarch = "unknown"
+		}
+		return fmt.Errorf("plugin %s is built for %s/%s, but this host is %s/%s", path, goos, goarch, runtime.GOOS, runtime.GOARCH)
+	}
+	return nil
+}
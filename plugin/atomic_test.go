@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listDir(t *testing.T, dir string) map[string]string {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := map[string]string{}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[f.Name()] = string(b)
+	}
+	return contents
+}
+
+func TestInstallByArtifactAtomically(t *testing.T) {
+	bindir := tempd(t)
+	defer os.RemoveAll(bindir)
+	workdir := tempd(t)
+	defer os.RemoveAll(workdir)
+
+	installed, err := installByArtifactAtomically("testdata/mackerel-plugin-sample-multi_darwin_386.zip", bindir, workdir, installOptions{})
+	assert.Nil(t, err, "installByArtifactAtomically finished successfully")
+	sort.Strings(installed)
+	assert.Equal(t, []string{
+		filepath.Join(bindir, "check-sample"),
+		filepath.Join(bindir, "mackerel-plugin-sample-multi-1"),
+		filepath.Join(bindir, "mackerel-plugin-sample-multi-2"),
+	}, installed, "All plugins in the artifact are installed")
+	assertEqualFileContent(t,
+		filepath.Join(bindir, "mackerel-plugin-sample-multi-2"),
+		"testdata/mackerel-plugin-sample-multi_darwin_386/plugins/mackerel-plugin-sample-multi-2",
+		"mackerel-plugin-sample-multi-2 is installed",
+	)
+}
+
+func TestInstallByArtifactAtomically_rollback(t *testing.T) {
+	bindir := tempd(t)
+	defer os.RemoveAll(bindir)
+	workdir := tempd(t)
+	defer os.RemoveAll(workdir)
+
+	// check-sample is overwritten and mackerel-plugin-sample-multi-1 is placed before the failure
+	err := ioutil.WriteFile(filepath.Join(bindir, "check-sample"), []byte("old check-sample"), 0755)
+	assert.Nil(t, err)
+	before := listDir(t, bindir)
+
+	defer func() { renamePlugin = os.Rename }()
+	renamePlugin = func(src, dest string) error {
+		if filepath.Base(dest) == "mackerel-plugin-sample-multi-2" {
+			return fmt.Errorf("forced failure")
+		}
+		return os.Rename(src, dest)
+	}
+
+	installed, err := installByArtifactAtomically("testdata/mackerel-plugin-sample-multi_darwin_386.zip", bindir, workdir, installOptions{overwrite: true})
+	assert.NotNil(t, err, "installByArtifactAtomically fails if a plugin can't be placed")
+	assert.Empty(t, installed, "No plugin is returned as installed")
+	assert.Equal(t, before, listDir(t, bindir), "The bin directory is rolled back")
+}
+
+func TestStagePlugins_arch(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	bindir := tempd(t)
+	defer os.RemoveAll(bindir)
+	dir := tempd(t)
+	defer os.RemoveAll(dir)
+
+	// the test binary itself is built for this host
+	b, err := ioutil.ReadFile(exe)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "mackerel-plugin-native"), b, 0755)
+	assert.Nil(t, err)
+	staged, err := stagePlugins(dir, bindir, installOptions{checkArch: true})
+	assert.Nil(t, err, "A binary for this host passes the arch check")
+	assert.Len(t, staged, 1)
+
+	// scripts are accepted regardless of the arch
+	err = ioutil.WriteFile(filepath.Join(dir, "check-script"), []byte("#!/bin/sh\necho ok\n"), 0755)
+	assert.Nil(t, err)
+	staged, err = stagePlugins(dir, bindir, installOptions{checkArch: true})
+	assert.Nil(t, err, "A script passes the arch check")
+	assert.Len(t, staged, 2)
+
+	if runtime.GOOS != "windows" {
+		err = os.Chmod(filepath.Join(dir, "check-script"), 0311)
+		assert.Nil(t, err)
+		_, err = stagePlugins(dir, bindir, installOptions{})
+		assert.NotNil(t, err, "A plugin not readable by the owner is refused")
+	}
+}
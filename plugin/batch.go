@@ -0,0 +1,224 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// batchManifest is the list of install targets installed at once by `mkr plugin install --manifest`
+type batchManifest struct {
+	Plugins []*batchEntry `json:"plugins"`
+}
+
+type batchEntry struct {
+	Target string `json:"target"`
+	// Name identifies the entry in requires of other entries. The default is the repository or plugin name of Target.
+	Name string `json:"name"`
+	// Requires are names of plugins which have to be installed before this entry
+	Requires []string `json:"requires"`
+
+	installTarget *installTarget
+}
+
+func (e *batchEntry) name() string {
+	switch {
+	case e.Name != "":
+		return e.Name
+	case e.installTarget.repo != "":
+		return e.installTarget.repo
+	case e.installTarget.pluginName != "":
+		return e.installTarget.pluginName
+	}
+	base := path.Base(e.installTarget.artifactURL)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// Load the batch manifest, and parse install targets in it
+func loadBatchManifest(fpath string) (*batchManifest, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var bm batchManifest
+	if err := json.NewDecoder(f).Decode(&bm); err != nil {
+		return nil, err
+	}
+	for i, entry := range bm.Plugins {
+		it, err := newInstallTargetFromString(entry.Target)
+		if err != nil {
+			return nil, fmt.Errorf("plugins[%d]: %s", i, err)
+		}
+		entry.installTarget = it
+	}
+	return &bm, nil
+}
+
+// Order entries so that every entry follows the entries it requires, keeping the order of the file otherwise.
+// A requirement which is not in the manifest is accepted only if it's already installed.
+func orderBatchEntries(entries []*batchEntry, installed func(name string) bool) ([]*batchEntry, error) {
+	byName := map[string]*batchEntry{}
+	for _, entry := range entries {
+		byName[entry.name()] = entry
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	states := map[*batchEntry]int{}
+	var ordered []*batchEntry
+	var visit func(entry *batchEntry, chain []string) error
+	visit = func(entry *batchEntry, chain []string) error {
+		chain = append(chain, entry.name())
+		switch states[entry] {
+		case visiting:
+			return fmt.Errorf("dependency cycle is detected: %s", strings.Join(chain, " -> "))
+		case visited:
+			return nil
+		}
+		states[entry] = visiting
+		for _, name := range entry.Requires {
+			dep, ok := byName[name]
+			if !ok {
+				if installed(name) {
+					continue
+				}
+				return fmt.Errorf("%s requires %s, which is neither in the manifest nor installed", entry.name(), name)
+			}
+			if err := visit(dep, chain); err != nil {
+				return err
+			}
+		}
+		states[entry] = visited
+		ordered = append(ordered, entry)
+		return nil
+	}
+	for _, entry := range entries {
+		if err := visit(entry, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// batchResult is the result of installing a batch entry
+type batchResult struct {
+	Target    string
+	Installed []string
+	Err       error
+}
+
+func (r *batchResult) status() string {
+	switch {
+	case r.Err != nil:
+		return "failed"
+	case len(r.Installed) == 0:
+		return "skipped"
+	default:
+		return "installed"
+	}
+}
+
+func doPluginBatchInstall(manifestFile, prefix string, opts installOptions, parallel int) error {
+	bm, err := loadBatchManifest(manifestFile)
+	if err != nil {
+		return errors.Wrap(err, "Failed to install plugins while loading the manifest")
+	}
+
+	pluginDir, err := setupPluginDir(prefix)
+	if err != nil {
+		return errors.Wrap(err, "Failed to install plugins while setup plugin directory")
+	}
+
+	results, err := installBatch(bm.Plugins, pluginDir, opts, parallel)
+	if err != nil {
+		return errors.Wrap(err, "Failed to install plugins while resolving dependencies")
+	}
+	if failed := printBatchSummary(os.Stdout, results); failed > 0 {
+		return fmt.Errorf("Failed to install %d of %d plugins", failed, len(results))
+	}
+	return nil
+}
+
+// Install batch entries with up to `parallel` workers. Each entry is installed after the entries it requires,
+// and fails without installation if any of them fails.
+// Results are returned in the order of entries regardless of the completion order.
+func installBatch(entries []*batchEntry, pluginDir string, opts installOptions, parallel int) ([]*batchResult, error) {
+	ordered, err := orderBatchEntries(entries, func(name string) bool {
+		_, err := os.Stat(filepath.Join(pluginDir, "bin", name))
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	byName := map[string]int{}
+	done := make([]chan struct{}, len(entries))
+	indexes := map[*batchEntry]int{}
+	for i, entry := range entries {
+		byName[entry.name()] = i
+		done[i] = make(chan struct{})
+		indexes[entry] = i
+	}
+	results := make([]*batchResult, len(entries))
+	// entries are started in the dependency order, so that the requirements of an entry waiting for them
+	// have already acquired the semaphore and the workers never deadlock
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for _, entry := range ordered {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, entry *batchEntry) {
+			defer func() {
+				close(done[i])
+				<-sem
+				wg.Done()
+			}()
+			for _, name := range entry.Requires {
+				j, ok := byName[name]
+				if !ok {
+					// already installed
+					continue
+				}
+				<-done[j]
+				if results[j].Err != nil {
+					results[i] = &batchResult{Target: redactURL(entry.Target), Err: fmt.Errorf("required plugin %s failed to be installed", name)}
+					return
+				}
+			}
+			installed, err := installPlugin(entry.installTarget, pluginDir, opts)
+			results[i] = &batchResult{Target: redactURL(entry.Target), Installed: installed, Err: err}
+		}(indexes[entry], entry)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// Print results and the summary of the batch install, and returns the number of failed entries
+func printBatchSummary(w io.Writer, results []*batchResult) int {
+	counts := map[string]int{}
+	for _, r := range results {
+		status := r.status()
+		counts[status]++
+		if r.Err != nil {
+			fmt.Fprintf(w, "%-9s %s: %s\n", status, r.Target, r.Err)
+		} else {
+			fmt.Fprintf(w, "%-9s %s\n", status, r.Target)
+		}
+	}
+	fmt.Fprintf(w, "Summary: %d installed, %d skipped, %d failed\n", counts["installed"], counts["skipped"], counts["failed"])
+	return counts["failed"]
+}
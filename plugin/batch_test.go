@@ -0,0 +1,179 @@
+package plugin
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstallBatch(t *testing.T) {
+	var mu sync.Mutex
+	inflight, maxInflight := 0, 0
+	artifacts := map[string]string{
+		"mackerel-plugin-sample":       "testdata/mackerel-plugin-sample_linux_amd64.zip",
+		"mackerel-plugin-sample-multi": "testdata/mackerel-plugin-sample-multi_darwin_386.zip",
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inflight++
+		if inflight > maxInflight {
+			maxInflight = inflight
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inflight--
+			mu.Unlock()
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		// /<owner>/<repo>/releases/download/<tag>/<file>
+		parts := strings.Split(r.URL.Path, "/")
+		artifact, ok := artifacts[parts[2]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, artifact)
+	}))
+	defer ts.Close()
+
+	tmpd := tempd(t)
+	defer os.RemoveAll(tmpd)
+	pluginDir, err := setupPluginDir(tmpd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mackerel-plugin-sample is already installed, so it is skipped
+	err = ioutil.WriteFile(filepath.Join(pluginDir, "bin", "mackerel-plugin-sample"), []byte("#!/bin/sh\n"), 0755)
+	assert.Nil(t, err, "existing plugin is created")
+
+	manifestFile := filepath.Join(tmpd, "plugins.json")
+	err = ioutil.WriteFile(manifestFile, []byte(`{"plugins": [
+		{"target": "owner1/mackerel-plugin-sample@v0.0.1"},
+		{"target": "owner1/mackerel-plugin-sample-multi@v0.1.0"},
+		{"target": "owner1/mackerel-plugin-not-found@v1.0.0"}
+	]}`), 0644)
+	assert.Nil(t, err, "batch manifest is created")
+
+	bm, err := loadBatchManifest(manifestFile)
+	if !assert.Nil(t, err, "batch manifest is loaded") {
+		return
+	}
+	for _, entry := range bm.Plugins {
+		entry.installTarget.githubURL = ts.URL
+	}
+
+	results, err := installBatch(bm.Plugins, pluginDir, installOptions{}, 3)
+	assert.Nil(t, err)
+	assert.True(t, maxInflight > 1, "entries are installed concurrently")
+
+	var statuses []string
+	for _, r := range results {
+		statuses = append(statuses, r.status())
+	}
+	assert.Equal(t, []string{"skipped", "installed", "failed"}, statuses, "results are in the order of the manifest")
+
+	_, err = os.Stat(filepath.Join(pluginDir, "bin", "mackerel-plugin-sample-multi-1"))
+	assert.Nil(t, err, "plugins in the artifact are installed")
+	m, err := loadManifest(pluginDir)
+	assert.Nil(t, err)
+	assert.Len(t, m.Plugins, 3, "installed plugins are recorded in the manifest")
+
+	var buf bytes.Buffer
+	failed := printBatchSummary(&buf, results)
+	assert.Equal(t, 1, failed)
+	assert.Contains(t, buf.String(), "Summary: 1 installed, 1 skipped, 1 failed")
+}
+
+func TestInstallBatch_requires(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	artifacts := map[string]string{
+		"mackerel-plugin-sample":       "testdata/mackerel-plugin-sample_linux_amd64.zip",
+		"mackerel-plugin-sample-multi": "testdata/mackerel-plugin-sample-multi_darwin_386.zip",
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.URL.Path, "/")
+		mu.Lock()
+		requested = append(requested, parts[2])
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		http.ServeFile(w, r, artifacts[parts[2]])
+	}))
+	defer ts.Close()
+
+	tmpd := tempd(t)
+	defer os.RemoveAll(tmpd)
+	pluginDir, err := setupPluginDir(tmpd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifestFile := filepath.Join(tmpd, "plugins.json")
+	err = ioutil.WriteFile(manifestFile, []byte(`{"plugins": [
+		{"target": "owner1/mackerel-plugin-sample-multi@v0.1.0", "requires": ["sample"]},
+		{"target": "owner1/mackerel-plugin-sample@v0.0.1", "name": "sample"}
+	]}`), 0644)
+	assert.Nil(t, err, "batch manifest is created")
+	bm, err := loadBatchManifest(manifestFile)
+	if !assert.Nil(t, err, "batch manifest is loaded") {
+		return
+	}
+	for _, entry := range bm.Plugins {
+		entry.installTarget.githubURL = ts.URL
+	}
+
+	results, err := installBatch(bm.Plugins, pluginDir, installOptions{}, 2)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"mackerel-plugin-sample", "mackerel-plugin-sample-multi"}, requested, "the dependency is installed first")
+	assert.Equal(t, "installed", results[0].status(), "results are in the order of the manifest")
+	assert.Equal(t, "installed", results[1].status())
+}
+
+func TestOrderBatchEntries(t *testing.T) {
+	entry := func(target string, requires ...string) *batchEntry {
+		it, err := newInstallTargetFromString(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &batchEntry{Target: target, Requires: requires, installTarget: it}
+	}
+	installed := func(name string) bool { return name == "mackerel-plugin-installed" }
+
+	ordered, err := orderBatchEntries([]*batchEntry{
+		entry("owner1/mackerel-plugin-a", "mackerel-plugin-b", "mackerel-plugin-installed"),
+		entry("owner1/mackerel-plugin-b", "mackerel-plugin-c"),
+		entry("mackerel-plugin-c"),
+		entry("https://mirror.example.com/mackerel-plugin-d.zip", "mackerel-plugin-a"),
+	}, installed)
+	if assert.Nil(t, err, "installed dependencies are skipped") {
+		var names []string
+		for _, e := range ordered {
+			names = append(names, e.name())
+		}
+		assert.Equal(t, []string{"mackerel-plugin-c", "mackerel-plugin-b", "mackerel-plugin-a", "mackerel-plugin-d"}, names)
+	}
+
+	_, err = orderBatchEntries([]*batchEntry{
+		entry("owner1/mackerel-plugin-a", "mackerel-plugin-b"),
+		entry("owner1/mackerel-plugin-b", "mackerel-plugin-a"),
+	}, installed)
+	if assert.Error(t, err, "cycles are detected") {
+		assert.Contains(t, err.Error(), "mackerel-plugin-a -> mackerel-plugin-b -> mackerel-plugin-a")
+	}
+
+	_, err = orderBatchEntries([]*batchEntry{entry("owner1/mackerel-plugin-a", "mackerel-plugin-unknown")}, installed)
+	assert.Error(t, err, "unknown dependencies are errors")
+}
@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// the prefix of install targets which are built from git repositories
+const gitTargetPrefix = "git+"
+
+// parseGitTarget parses "git+<repository_url>[@<ref>]", where <ref> is a branch or a tag
+func parseGitTarget(target string) (*installTarget, error) {
+	rawurl := strings.TrimPrefix(target, gitTargetPrefix)
+	ref := ""
+	// "@" before the last "/" is a part of the userinfo
+	if i := strings.LastIndex(rawurl, "@"); i > strings.LastIndex(rawurl, "/") {
+		rawurl, ref = rawurl[:i], rawurl[i+1:]
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http" && u.Scheme != "ssh") {
+		return nil, fmt.Errorf("Install target is invalid: %s", redactURL(target))
+	}
+	name := strings.TrimSuffix(path.Base(u.Path), ".git")
+	if !looksLikePlugin(name) {
+		return nil, fmt.Errorf("Install target is invalid: the repository name %s doesn't look like a plugin", name)
+	}
+	return &installTarget{gitURL: rawurl, releaseTag: ref, repo: name}, nil
+}
+
+// pluginBuilder clones a git repository and builds a plugin in it by `go build`
+type pluginBuilder struct {
+	lookPath func(file string) (string, error)
+	run      func(dir, name string, args ...string) error
+}
+
+var defaultPluginBuilder = &pluginBuilder{lookPath: exec.LookPath, run: runBuildCommand}
+
+func runBuildCommand(dir, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		// the repository URL in args and the output of git can contain credentials
+		return fmt.Errorf("%s %s failed: %s\n%s", name, redactUserinfo(strings.Join(args, " ")), err, redactUserinfo(string(out)))
+	}
+	return nil
+}
+
+// build clones the ref of the repository of `it` into workdir, and returns the path of the built plugin
+func (b *pluginBuilder) build(it *installTarget, workdir string) (string, error) {
+	goCmd, err := b.lookPath("go")
+	if err != nil {
+		return "", errors.Wrap(err, "Go is required to build plugins from source, but not found")
+	}
+	gitCmd, err := b.lookPath("git")
+	if err != nil {
+		return "", errors.Wrap(err, "git is required to build plugins from source, but not found")
+	}
+
+	srcdir := filepath.Join(workdir, "src")
+	args := []string{"clone", "--depth", "1"}
+	if it.releaseTag != "" {
+		args = append(args, "--branch", it.releaseTag)
+	}
+	if err := b.run(workdir, gitCmd, append(args, "--", it.gitURL, srcdir)...); err != nil {
+		return "", errors.Wrap(err, "failed to clone the repository")
+	}
+
+	outdir := filepath.Join(workdir, "out")
+	if err := os.MkdirAll(outdir, 0755); err != nil {
+		return "", err
+	}
+	out := filepath.Join(outdir, it.repo)
+	if err := b.run(srcdir, goCmd, "build", "-o", out, "."); err != nil {
+		return "", errors.Wrap(err, "failed to build the plugin")
+	}
+	if fi, err := os.Stat(out); err != nil || (fi.Mode()&0111) == 0 {
+		return "", fmt.Errorf("go build didn't output the executable %s", it.repo)
+	}
+	return out, nil
+}
+
+// Build the plugin of `it` from source and place it, and returns installed plugin paths
+func buildAndPlacePlugin(b *pluginBuilder, it *installTarget, pluginDir, workdir string, overwrite bool) ([]string, error) {
+	built, err := b.build(it, workdir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to install plugin while building")
+	}
+
+	installLock.Lock()
+	defer installLock.Unlock()
+	dest := filepath.Join(pluginDir, "bin", it.repo)
+	placed, err := placePlugin(built, dest, overwrite)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to install plugin while placing")
+	}
+	if !placed {
+		return nil, nil
+	}
+	installed := []string{dest}
+	source := redactURL(it.gitURL)
+	if err := recordInstalledPlugins(pluginDir, installed, gitTargetPrefix+source, it.releaseTag); err != nil {
+		return installed, errors.Wrap(err, "Failed to install plugin while recording to the manifest")
+	}
+	return installed, nil
+}
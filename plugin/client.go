@@ -1,31 +1,86 @@
 package plugin
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/mackerelio/mkr/httpclient"
+	"github.com/mackerelio/mkr/logger"
 )
 
 // client provides utilities for http request
-type client struct{}
+type client struct {
+	// credentials for basic authentication
+	netrc netrc
+	// the maximum bytes per second to download. Zero means unlimited.
+	rateLimit int64
+	// redirected URLs have to be permitted by the allowlist as well as the requested URL
+	allowlist allowlist
+}
 
 const userAgent = "mkr-plugin-installer/0.0.0"
 
-// Get response from `url`
-func (c *client) get(url string) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+// Get response from `rawurl`.
+// Basic authentication is used with the userinfo in the URL, or the credential in netrc for the host.
+func (c *client) get(rawurl string) (*http.Response, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	userinfo := u.User
+	u.User = nil
+	// the URL without userinfo is used in logs and errors, not to leak credentials
+	safeURL := u.String()
+
+	req, err := http.NewRequest(http.MethodGet, safeURL, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("User-Agent", userAgent)
-	resp, err := http.DefaultClient.Do(req)
+	if userinfo != nil {
+		password, _ := userinfo.Password()
+		req.SetBasicAuth(userinfo.Username(), password)
+	} else if entry := c.netrc.find(u.Hostname()); entry != nil {
+		req.SetBasicAuth(entry.login, entry.password)
+	}
+	logger.Debug(fmt.Sprintf("GET %s", safeURL))
+	hc := httpclient.New(0)
+	hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return c.allowlist.check(req.URL.String())
+	}
+	resp, err := hc.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("http response not OK. code: %d, url: %s", resp.StatusCode, url)
+		resp.Body.Close()
+		err = fmt.Errorf("http response not OK. code: %d, url: %s", resp.StatusCode, safeURL)
 		return nil, err
 	}
 
 	return resp, nil
 }
+
+var userinfoReg = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/@\s]+@`)
+
+// Returns the text with the userinfo of URLs in it removed, such as the output of commands
+func redactUserinfo(s string) string {
+	return userinfoReg.ReplaceAllString(s, "$1")
+}
+
+// Returns the URL without userinfo for logs
+func redactURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.User == nil {
+		return rawurl
+	}
+	u.User = nil
+	return u.String()
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -46,3 +48,75 @@ func TestClientGet(t *testing.T) {
 		)
 	}
 }
+
+func TestClientGet_basicAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, password, ok := req.BasicAuth()
+		if !ok || user != "user1" || password != "secret1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "authorized")
+	}))
+	defer ts.Close()
+	tsURL, _ := url.Parse(ts.URL)
+
+	{
+		// Credential in netrc for the host
+		n, err := parseNetrc(strings.NewReader("machine " + tsURL.Hostname() + " login user1 password secret1"))
+		assert.NoError(t, err)
+		resp, err := (&client{netrc: n}).get(ts.URL + "/artifact.zip")
+		if assert.NoError(t, err, "get with netrc credential finished successfully") {
+			defer resp.Body.Close()
+			b, _ := ioutil.ReadAll(resp.Body)
+			assert.Equal(t, "authorized", string(b))
+		}
+	}
+
+	{
+		// Credential in the URL
+		u := *tsURL
+		u.User = url.UserPassword("user1", "secret1")
+		resp, err := (&client{}).get(u.String() + "/artifact.zip")
+		if assert.NoError(t, err, "get with userinfo finished successfully") {
+			resp.Body.Close()
+		}
+	}
+
+	{
+		// Wrong credential, and the error doesn't contain it
+		u := *tsURL
+		u.User = url.UserPassword("user1", "wrong-password")
+		_, err := (&client{}).get(u.String() + "/artifact.zip")
+		if assert.Error(t, err, "get with wrong credential fails") {
+			assert.NotContains(t, err.Error(), "wrong-password", "credential is not leaked to the error")
+		}
+		assert.Equal(t, ts.URL+"/artifact.zip", redactURL(u.String()+"/artifact.zip"), "credential is removed from URL")
+	}
+}
+
+func TestClientGet_redirectAllowlist(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/allowed/artifact.zip":
+			http.Redirect(w, req, "/denied/artifact.zip", http.StatusFound)
+		case "/allowed/moved.zip":
+			http.Redirect(w, req, "/allowed/artifact2.zip", http.StatusFound)
+		default:
+			fmt.Fprint(w, "artifact")
+		}
+	}))
+	defer ts.Close()
+	tsURL, _ := url.Parse(ts.URL)
+	a := allowlist{tsURL.Host + "/allowed/"}
+
+	_, err := (&client{allowlist: a}).get(ts.URL + "/allowed/artifact.zip")
+	if assert.Error(t, err, "redirect to a URL not permitted by the allowlist is refused") {
+		assert.Contains(t, err.Error(), "is not permitted by the allowlist")
+	}
+
+	resp, err := (&client{allowlist: a}).get(ts.URL + "/allowed/moved.zip")
+	if assert.NoError(t, err, "redirect to a permitted URL is followed") {
+		resp.Body.Close()
+	}
+}
@@ -10,9 +10,16 @@ var CommandPlugin = cli.Command{
 	Usage: "Manage mackerel plugin",
 	Description: `
     Manage mackerel plugin.  For example, you can install a mackerel plugin and
-    check plugin by "mkr plugin install".
+    check plugin by "mkr plugin install", and show what is recorded about an
+    installed plugin by "mkr plugin info".
+    A plugin installed with --versioned can be switched back by "mkr plugin rollback".
+    Installed plugins can be pinned to a lockfile by "mkr plugin pin", and installed on other hosts
+    by "mkr plugin install --locked".
 `,
 	Subcommands: []cli.Command{
 		commandPluginInstall,
+		commandPluginInfo,
+		commandPluginRollback,
+		commandPluginPin,
 	},
 }
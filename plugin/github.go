@@ -2,22 +2,22 @@ package plugin
 
 import (
 	"context"
-	"net/http"
 	"os"
 
 	"github.com/google/go-github/github"
+	"github.com/mackerelio/mkr/httpclient"
 	gitconfig "github.com/tcnksm/go-gitconfig"
 	"golang.org/x/oauth2"
 )
 
 // Get github client having github token.
 func getGithubClient(ctx context.Context) *github.Client {
-	var oauthClient *http.Client
+	oauthClient := httpclient.New(0)
 	if token := getGithubToken(); token != "" {
 		ts := oauth2.StaticTokenSource(
 			&oauth2.Token{AccessToken: getGithubToken()},
 		)
-		oauthClient = oauth2.NewClient(ctx, ts)
+		oauthClient = oauth2.NewClient(context.WithValue(ctx, oauth2.HTTPClient, oauthClient), ts)
 	}
 	return github.NewClient(oauthClient)
 }
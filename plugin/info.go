@@ -0,0 +1,116 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandPluginInfo = cli.Command{
+	Name:      "info",
+	Usage:     "Show the information of an installed plugin",
+	ArgsUsage: "[--prefix <prefix>] [--output | -o <format>] <name>",
+	Action:    doPluginInfo,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "prefix",
+			Usage: "Plugin install location. The default is /opt/mackerel-agent/plugins",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: "text",
+			Usage: "Output format ('text' or 'json')",
+		},
+	},
+	Description: `
+    Show the source URL, version, install time, checksum and path of the plugin command <name>,
+    which are recorded in the manifest by "mkr plugin install".
+    A plugin command placed in the plugin directory without mkr is reported as installed out-of-band.
+`,
+}
+
+// pluginInfo is the information of an installed plugin command
+type pluginInfo struct {
+	manifestEntry
+	OutOfBand bool `json:"outOfBand"`
+}
+
+// main function for mkr plugin info
+func doPluginInfo(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("Specify plugin name")
+	}
+	format := c.String("output")
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+
+	pluginDir := c.String("prefix")
+	if pluginDir == "" {
+		pluginDir = defaultPluginDir
+	}
+	info, err := lookupPluginInfo(pluginDir, name)
+	if err != nil {
+		return errors.Wrap(err, "Failed to show plugin information")
+	}
+	return printPluginInfo(os.Stdout, info, format)
+}
+
+// Look up the plugin command in the manifest, or in the plugin directory if it is not recorded
+func lookupPluginInfo(pluginDir, name string) (*pluginInfo, error) {
+	m, err := loadManifest(pluginDir)
+	if err != nil {
+		return nil, err
+	}
+	if entry, ok := m.Plugins[name]; ok {
+		return &pluginInfo{manifestEntry: *entry}, nil
+	}
+
+	pluginPath, err := filepath.Abs(filepath.Join(pluginDir, "bin", name))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(pluginPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s is not installed in %s", name, pluginDir)
+		}
+		return nil, err
+	}
+	return &pluginInfo{
+		manifestEntry: manifestEntry{Name: name, Path: pluginPath},
+		OutOfBand:     true,
+	}, nil
+}
+
+func printPluginInfo(w io.Writer, info *pluginInfo, format string) error {
+	if format == "json" {
+		data, err := json.MarshalIndent(info, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+
+	if info.OutOfBand {
+		fmt.Fprintf(w, "%s is installed out-of-band (not recorded in the manifest)\n", info.Name)
+		fmt.Fprintf(w, "Path: %s\n", info.Path)
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(tw, "Name:\t%s\n", info.Name)
+	fmt.Fprintf(tw, "Source:\t%s\n", info.Source)
+	fmt.Fprintf(tw, "Version:\t%s\n", info.Version)
+	fmt.Fprintf(tw, "Installed at:\t%s\n", info.InstalledAt.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Checksum:\t%s\n", info.Checksum)
+	fmt.Fprintf(tw, "Path:\t%s\n", info.Path)
+	return tw.Flush()
+}
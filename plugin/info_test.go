@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupPluginInfo(t *testing.T) {
+	tmpd := tempd(t)
+	defer os.RemoveAll(tmpd)
+	pluginDir, err := setupPluginDir(tmpd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pluginPath := filepath.Join(pluginDir, "bin", "mackerel-plugin-sample")
+	if err := ioutil.WriteFile(pluginPath, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	{
+		// The plugin is not recorded in the manifest
+		info, err := lookupPluginInfo(pluginDir, "mackerel-plugin-sample")
+		assert.Nil(t, err, "lookup finished successfully")
+		assert.True(t, info.OutOfBand, "the plugin is reported as installed out-of-band")
+		assert.Equal(t, pluginPath, info.Path)
+
+		var buf bytes.Buffer
+		printPluginInfo(&buf, info, "text")
+		assert.Contains(t, buf.String(), "out-of-band")
+	}
+
+	{
+		// The plugin is recorded in the manifest
+		installedAt := time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)
+		err := recordInstalledPlugins(pluginDir, []string{pluginPath}, "https://example.com/sample.zip", "v0.0.1")
+		assert.Nil(t, err, "recording finished successfully")
+		m, err := loadManifest(pluginDir)
+		assert.Nil(t, err)
+		m.Plugins["mackerel-plugin-sample"].InstalledAt = installedAt
+		assert.Nil(t, m.save(pluginDir))
+
+		info, err := lookupPluginInfo(pluginDir, "mackerel-plugin-sample")
+		assert.Nil(t, err, "lookup finished successfully")
+		assert.False(t, info.OutOfBand)
+		assert.Equal(t, "https://example.com/sample.zip", info.Source)
+		assert.Equal(t, "v0.0.1", info.Version)
+		assert.Equal(t, pluginPath, info.Path)
+		assert.True(t, strings.HasPrefix(info.Checksum, "sha256:"), "checksum is recorded")
+
+		var buf bytes.Buffer
+		printPluginInfo(&buf, info, "json")
+		assert.Contains(t, buf.String(), `"installedAt": "2017-10-01T12:00:00Z"`)
+		assert.Contains(t, buf.String(), `"outOfBand": false`)
+	}
+
+	{
+		// The plugin is not installed
+		_, err := lookupPluginInfo(pluginDir, "mackerel-plugin-unknown")
+		assert.NotNil(t, err, "lookup fails")
+	}
+}
@@ -1,13 +1,18 @@
 package plugin
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mackerelio/mkr/logger"
 	"github.com/mholt/archiver"
@@ -18,7 +23,7 @@ import (
 var commandPluginInstall = cli.Command{
 	Name:      "install",
 	Usage:     "Install a plugin from github or plugin registry",
-	ArgsUsage: "[--prefix <prefix>] [--overwrite] <install_target>",
+	ArgsUsage: "[--prefix <prefix>] [--overwrite] [--verify] [--post-install <command>] [--strict] [--netrc <file>] [--allowlist <file>] [--rate-limit <bytes/s>] [--registry-base <url>] [--atomic [--check-arch]] [--build] [--allow-any-name] [--versioned] [--list-assets] (<install_target> | --manifest <file> [--parallel <N>] | --locked [--lockfile <file>])",
 	Action:    doPluginInstall,
 	Flags: []cli.Flag{
 		cli.StringFlag{
@@ -29,6 +34,76 @@ var commandPluginInstall = cli.Command{
 			Name:  "overwrite",
 			Usage: "Overwrite a plugin command in a plugin directory, even if same name command exists",
 		},
+		cli.BoolFlag{
+			Name:  "verify",
+			Usage: "Run installed plugin commands with --version, and warn if they can't be executed",
+		},
+		cli.StringFlag{
+			Name:  "post-install",
+			Usage: "Run <command> by the shell for each installed plugin, with MKR_PLUGIN_NAME and MKR_PLUGIN_PATH environment variables",
+		},
+		cli.BoolFlag{
+			Name:  "strict",
+			Usage: "Make the installation fail if the verification or the post-install command fails",
+		},
+		cli.StringFlag{
+			Name:  "netrc",
+			Usage: "Use credentials in the netrc <file> for basic authentication to download artifacts",
+		},
+		cli.StringFlag{
+			Name:  "allowlist",
+			Usage: "Refuse artifact URLs not matching any pattern in the allowlist <file>",
+		},
+		cli.Int64Flag{
+			Name:  "rate-limit",
+			Usage: "Limit the download speed of each artifact to <bytes/s>. 0 means unlimited",
+		},
+		cli.StringFlag{
+			Name:  "registry-base",
+			Usage: "Look up <plugin_name> in the plugin registry at <url> instead of the GitHub repository",
+		},
+		cli.BoolFlag{
+			Name:  "atomic",
+			Usage: "Install all plugins in the artifact or none of them, validating them before placing",
+		},
+		cli.BoolFlag{
+			Name:  "check-arch",
+			Usage: "With --atomic, refuse plugin binaries built for another OS or architecture",
+		},
+		cli.BoolFlag{
+			Name:  "build",
+			Usage: "Permit building git+<repository_url>[@<ref>] from source by git and go",
+		},
+		cli.BoolFlag{
+			Name:  "allow-any-name",
+			Usage: "Install all executable files in the artifact, even if they are not named check-* or mackerel-plugin-*",
+		},
+		cli.BoolFlag{
+			Name:  "versioned",
+			Usage: "Place plugins in a directory of each version, and link them from the plugin directory to switch versions by \"mkr plugin rollback\"",
+		},
+		cli.BoolFlag{
+			Name:  "list-assets",
+			Usage: "Print release assets of <owner>/<repo>[@<release_tag>] with the one to be installed marked, and exit without installing",
+		},
+		cli.StringFlag{
+			Name:  "manifest",
+			Usage: "Install all plugins listed in the batch manifest <file>",
+		},
+		cli.IntFlag{
+			Name:  "parallel",
+			Value: 1,
+			Usage: "The number of plugins installed concurrently with --manifest",
+		},
+		cli.BoolFlag{
+			Name:  "locked",
+			Usage: "Install exactly the plugins pinned in the lockfile by \"mkr plugin pin\"",
+		},
+		cli.StringFlag{
+			Name:  "lockfile",
+			Value: defaultLockfilePath,
+			Usage: "Read the lockfile from <file> with --locked",
+		},
 	},
 	Description: `
     Install a mackerel plugin and a check plugin from github or plugin registry.
@@ -42,7 +117,51 @@ var commandPluginInstall = cli.Command{
     - <plugin_name>[@<release_tag]
           Install from plugin registry.
           You can find available plugins in https://github.com/mackerelio/plugin-registry
+          With --registry-base <url>, the definition is read from <url>/plugins/<plugin_name>.json,
+          such as a mirror of the registry in an internal network.
           Example: mkr plugin install mackerel-plugin-sample
+    - <url>
+          Install from the zip artifact at http:// or https:// <url>, such as an internal mirror.
+          Basic authentication is used with the userinfo in <url> or the credential in --netrc <file>.
+          Example: mkr plugin install https://mirror.example.com/mackerel-plugin-sample_linux_amd64.zip
+    - git+<repository_url>[@<ref>]
+          Clone the branch or tag <ref> of the git repository, and install the binary built by "go build" in it.
+          The repository name must be a plugin name. This requires --build, and git and Go on the host.
+          The repository URL is checked by --allowlist, and --versioned, --atomic and --check-arch can't be used.
+          Example: mkr plugin install --build git+https://git.example.com/mackerel-plugin-sample.git@v0.0.1
+
+    With --list-assets, the installer prints all asset names of the release of <owner>/<repo>[@<release_tag>]
+    and marks the one matching the current OS and architecture with "*", without installing.
+
+    With --allowlist <file>, the installer refuses to download artifacts from URLs matching no pattern in <file>,
+    which lists "<host>/<path>" patterns line by line, such as "github.com/mackerelio/*/releases/download/*/*".
+    A pattern ending with "/" permits all URLs under it. A file without patterns permits no URL,
+    and the installer fails if <file> doesn't exist. Redirected URLs are checked as well.
+
+    Only executable files named check-* or mackerel-plugin-* in the artifact are installed by default.
+    With --allow-any-name, all executable regular files are installed regardless of their names.
+    Use it only for trusted artifacts, since any file in them can overwrite commands in the plugin directory.
+
+    With --atomic, the installer extracts and validates all plugins in the artifact before placing any of them,
+    and removes already placed plugins (restoring overwritten ones) if placing a later one fails.
+    Plugins duplicated in the artifact or not readable and executable by the owner make the installation fail,
+    and so do binaries for another OS or architecture with --check-arch.
+
+    With --versioned, each plugin command <name> of the release is placed in versions/<name>/<release_tag>/<name>
+    under the plugin install location, and bin/<name> becomes a symlink via versions/<name>/current.
+    Installing another release switches "current" to it, and "mkr plugin rollback <name>" switches it back.
+    The release tag must be known, so <url> targets are not supported.
+
+    With --manifest <file>, the installer installs all targets listed in the batch manifest,
+    which is a JSON file like {"plugins": [{"target": "mackerelio/mackerel-plugin-sample@v0.0.1"}]},
+    and prints the summary of installed, skipped and failed targets in the order of the file.
+    An entry can have "requires", the list of names of plugins to be installed before it, which are other entries
+    ("name", or the repository or plugin name of "target" by default) or already installed plugins.
+    Use --parallel <N> to install up to <N> targets concurrently.
+
+    With --locked, the installer installs the plugin commands pinned in the lockfile (--lockfile <file>) written by
+    "mkr plugin pin" from their artifact URLs, overwriting existing ones. All artifacts are downloaded and verified
+    before placing any plugin, and the installation fails if a plugin is missing or its checksum doesn't match.
 
     The installer uses Github API to find the latest release.  Please set a github token to
     GITHUB_TOKEN environment variable, or to github.token in .gitconfig.
@@ -57,6 +176,56 @@ var commandPluginInstall = cli.Command{
 
 // main function for mkr plugin install
 func doPluginInstall(c *cli.Context) error {
+	opts := installOptions{
+		overwrite:    c.Bool("overwrite"),
+		verify:       c.Bool("verify"),
+		postInstall:  c.String("post-install"),
+		strict:       c.Bool("strict"),
+		rateLimit:    c.Int64("rate-limit"),
+		atomic:       c.Bool("atomic"),
+		checkArch:    c.Bool("check-arch"),
+		build:        c.Bool("build"),
+		allowAnyName: c.Bool("allow-any-name"),
+		versioned:    c.Bool("versioned"),
+	}
+	if opts.allowAnyName {
+		logger.Log("warning", "--allow-any-name is specified. All executable files in the artifact are installed even if they are not named like plugins")
+	}
+	if registryBase := c.String("registry-base"); registryBase != "" {
+		if _, err := parseRegistryBase(registryBase); err != nil {
+			return errors.Wrap(err, "Failed to install plugin")
+		}
+		opts.registryBase = registryBase
+	}
+	if opts.checkArch && !opts.atomic {
+		return fmt.Errorf("--check-arch requires --atomic")
+	}
+	if opts.rateLimit < 0 {
+		return fmt.Errorf("--rate-limit should not be negative: %d", opts.rateLimit)
+	}
+	if netrcFile := c.String("netrc"); netrcFile != "" {
+		n, err := loadNetrc(netrcFile)
+		if err != nil {
+			return errors.Wrap(err, "Failed to install plugin while loading the netrc file")
+		}
+		opts.netrc = n
+	}
+	if allowlistFile := c.String("allowlist"); allowlistFile != "" {
+		a, err := loadAllowlist(allowlistFile)
+		if err != nil {
+			return errors.Wrap(err, "Failed to install plugin while loading the allowlist file")
+		}
+		opts.allowlist = a
+	}
+
+	if c.Bool("locked") {
+		return doPluginLockedInstall(c.String("lockfile"), c.String("prefix"), opts)
+	}
+
+	if manifestFile := c.String("manifest"); manifestFile != "" {
+		return doPluginBatchInstall(manifestFile, c.String("prefix"), opts, c.Int("parallel"))
+	}
+
 	argInstallTarget := c.Args().First()
 	if argInstallTarget == "" {
 		return fmt.Errorf("Specify install target")
@@ -67,40 +236,158 @@ func doPluginInstall(c *cli.Context) error {
 		return errors.Wrap(err, "Failed to install plugin while parsing install target")
 	}
 
+	if c.Bool("list-assets") {
+		return doListAssets(os.Stdout, it)
+	}
+
 	pluginDir, err := setupPluginDir(c.String("prefix"))
 	if err != nil {
 		return errors.Wrap(err, "Failed to install plugin while setup plugin directory")
 	}
 
+	if _, err := installPlugin(it, pluginDir, opts); err != nil {
+		return err
+	}
+
+	logger.Log("", fmt.Sprintf("Successfully installed %s", redactURL(argInstallTarget)))
+	return nil
+}
+
+type installOptions struct {
+	overwrite   bool
+	verify      bool
+	postInstall string
+	strict      bool
+	netrc       netrc
+	allowlist   allowlist
+	rateLimit   int64
+	atomic      bool
+	checkArch   bool
+	// the base URL of the plugin registry. The default one is used if empty
+	registryBase string
+	build        bool
+	allowAnyName bool
+	versioned    bool
+}
+
+// installLock guards the bin directory and the manifest while plugins are installed in parallel
+var installLock sync.Mutex
+
+// Install a plugin specified by `it` into pluginDir, and returns installed plugin paths
+func installPlugin(it *installTarget, pluginDir string, opts installOptions) ([]string, error) {
 	// Create a work directory for downloading and extracting an artifact
 	workdir, err := ioutil.TempDir(filepath.Join(pluginDir, "work"), "mkr-plugin-installer-")
 	if err != nil {
-		return errors.Wrap(err, "Failed to install plugin while creating a work directory")
+		return nil, errors.Wrap(err, "Failed to install plugin while creating a work directory")
 	}
 	defer os.RemoveAll(workdir)
 
-	// Download an artifact and install by it
-	downloadURL, err := it.makeDownloadURL()
+	var installed []string
+	if it.gitURL != "" {
+		if !opts.build {
+			return nil, fmt.Errorf("Installing %s requires --build", redactURL(it.gitURL))
+		}
+		if opts.versioned || opts.atomic || opts.checkArch {
+			return nil, fmt.Errorf("--versioned, --atomic and --check-arch are not supported for installing %s", redactURL(it.gitURL))
+		}
+		if err := opts.allowlist.check(it.gitURL); err != nil {
+			return nil, errors.Wrap(err, "Failed to install plugin")
+		}
+		installed, err = buildAndPlacePlugin(defaultPluginBuilder, it, pluginDir, workdir, opts.overwrite)
+	} else {
+		installed, err = downloadAndPlacePlugin(it, pluginDir, workdir, opts)
+	}
 	if err != nil {
-		return errors.Wrap(err, "Failed to install plugin while making a download URL")
+		return installed, err
 	}
-	artifactFile, err := downloadPluginArtifact(downloadURL, workdir)
+
+	if opts.verify {
+		for _, pluginPath := range installed {
+			err := verifyPlugin(pluginPath)
+			if err == nil {
+				continue
+			}
+			if opts.strict {
+				return installed, errors.Wrap(err, "Failed to install plugin while verifying")
+			}
+			logger.Log("warning", err.Error())
+		}
+	}
+
+	if opts.postInstall != "" {
+		for _, pluginPath := range installed {
+			err := runPostInstallHook(opts.postInstall, pluginPath)
+			if err == nil {
+				continue
+			}
+			if opts.strict {
+				return installed, errors.Wrap(err, "Failed to install plugin while running the post-install command")
+			}
+			logger.Log("warning", err.Error())
+		}
+	}
+	return installed, nil
+}
+
+// Download the artifact of `it` and place plugins in it, and returns installed plugin paths
+func downloadAndPlacePlugin(it *installTarget, pluginDir, workdir string, opts installOptions) ([]string, error) {
+	if opts.registryBase != "" {
+		it.registryBase = opts.registryBase
+	}
+	downloadURL, err := it.makeDownloadURL()
 	if err != nil {
-		return errors.Wrap(err, "Failed to install plugin while downloading an artifact")
+		return nil, errors.Wrap(err, "Failed to install plugin while making a download URL")
+	}
+	if err := opts.allowlist.check(downloadURL); err != nil {
+		return nil, errors.Wrap(err, "Failed to install plugin")
 	}
-	err = installByArtifact(artifactFile, filepath.Join(pluginDir, "bin"), workdir, c.Bool("overwrite"))
+	if opts.versioned && it.releaseTag == "" {
+		return nil, fmt.Errorf("Failed to install plugin: --versioned requires the release tag of %s", redactURL(downloadURL))
+	}
+	artifactFile, err := downloadPluginArtifact(&client{netrc: opts.netrc, rateLimit: opts.rateLimit, allowlist: opts.allowlist}, downloadURL, workdir)
 	if err != nil {
-		return errors.Wrap(err, "Failed to install plugin while extracting and placing")
+		return nil, errors.Wrap(err, "Failed to install plugin while downloading an artifact")
 	}
 
-	logger.Log("", fmt.Sprintf("Successfully installed %s", argInstallTarget))
-	return nil
+	// with --versioned, plugins are placed in the work directory at first, and moved to their version directories
+	bindir, extractDir := filepath.Join(pluginDir, "bin"), workdir
+	if opts.versioned {
+		bindir, extractDir = filepath.Join(workdir, "versioned"), filepath.Join(workdir, "artifact")
+		for _, dir := range []string{bindir, extractDir} {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, errors.Wrap(err, "Failed to install plugin while creating a work directory")
+			}
+		}
+	}
+
+	installLock.Lock()
+	var installed []string
+	if opts.atomic {
+		installed, err = installByArtifactAtomically(artifactFile, bindir, extractDir, opts)
+	} else {
+		installed, err = installByArtifact(artifactFile, bindir, extractDir, opts)
+	}
+	if err == nil && opts.versioned {
+		installed, err = placeVersionedPlugins(installed, pluginDir, it.releaseTag, redactURL(downloadURL), opts.overwrite)
+	}
+	if err == nil {
+		err = recordInstalledPlugins(pluginDir, installed, redactURL(downloadURL), it.releaseTag)
+		if err != nil {
+			err = errors.Wrap(err, "Failed to install plugin while recording to the manifest")
+		}
+	} else {
+		err = errors.Wrap(err, "Failed to install plugin while extracting and placing")
+	}
+	installLock.Unlock()
+	return installed, err
 }
 
+const defaultPluginDir = "/opt/mackerel-agent/plugins"
+
 // Create a directory for plugin install
 func setupPluginDir(pluginDir string) (string, error) {
 	if pluginDir == "" {
-		pluginDir = "/opt/mackerel-agent/plugins"
+		pluginDir = defaultPluginDir
 	}
 	err := os.MkdirAll(filepath.Join(pluginDir, "bin"), 0755)
 	if err != nil {
@@ -113,13 +400,28 @@ func setupPluginDir(pluginDir string) (string, error) {
 	return pluginDir, nil
 }
 
-// Download plugin artifact from `u`(URL) to `workdir`,
+// CheckPluginDir sets up the plugin directory as "mkr plugin install" does,
+// and checks that files can be written in it. It returns the path of the plugin directory.
+func CheckPluginDir(prefix string) (string, error) {
+	pluginDir, err := setupPluginDir(prefix)
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(filepath.Join(pluginDir, "work"), ".check")
+	if err != nil {
+		return pluginDir, err
+	}
+	f.Close()
+	return pluginDir, os.Remove(f.Name())
+}
+
+// Download plugin artifact from `u`(URL) to `workdir` by `cl`,
 // and returns downloaded filepath
-func downloadPluginArtifact(u, workdir string) (fpath string, err error) {
-	logger.Log("", fmt.Sprintf("Downloading %s", u))
+func downloadPluginArtifact(cl *client, u, workdir string) (fpath string, err error) {
+	logger.Log("", fmt.Sprintf("Downloading %s", redactURL(u)))
 
 	// Create request to download
-	resp, err := (&client{}).get(u)
+	resp, err := cl.get(u)
 	if err != nil {
 		return "", err
 	}
@@ -135,7 +437,11 @@ func downloadPluginArtifact(u, workdir string) (fpath string, err error) {
 	}
 	defer file.Close()
 
-	_, err = io.Copy(file, resp.Body)
+	var body io.Reader = resp.Body
+	if cl.rateLimit > 0 {
+		body = newThrottledReader(body, cl.rateLimit)
+	}
+	_, err = io.Copy(file, body)
 	if err != nil {
 		return "", err
 	}
@@ -143,16 +449,17 @@ func downloadPluginArtifact(u, workdir string) (fpath string, err error) {
 	return fpath, nil
 }
 
-// Extract artifact and install plugin
-func installByArtifact(artifactFile, bindir, workdir string, overwrite bool) error {
+// Extract artifact and install plugin, and returns installed plugin paths
+func installByArtifact(artifactFile, bindir, workdir string, opts installOptions) ([]string, error) {
 	// unzip artifact to work directory
 	err := archiver.Zip.Open(artifactFile, workdir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Look for plugin files recursively, and place those to binPath
-	return filepath.Walk(workdir, func(path string, info os.FileInfo, err error) error {
+	var installed []string
+	err = filepath.Walk(workdir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -162,26 +469,104 @@ func installByArtifact(artifactFile, bindir, workdir string, overwrite bool) err
 
 		// a plugin file should be executable, and have specified name.
 		name := info.Name()
-		isExecutable := (info.Mode() & 0111) != 0
-		if isExecutable && looksLikePlugin(name) {
-			return placePlugin(path, filepath.Join(bindir, name), overwrite)
+		if isPluginFile(info, opts.allowAnyName) {
+			warnUnconventionalName(name)
+			dest := filepath.Join(bindir, name)
+			placed, err := placePlugin(path, dest, opts.overwrite)
+			if placed {
+				installed = append(installed, dest)
+			}
+			return err
 		}
 
 		// `path` is a file but not plugin.
 		return nil
 	})
+	return installed, err
+}
+
+// Record installed plugins to the manifest in pluginDir
+func recordInstalledPlugins(pluginDir string, installed []string, source, version string) error {
+	if len(installed) == 0 {
+		return nil
+	}
+	m, err := loadManifest(pluginDir)
+	if err != nil {
+		return err
+	}
+	if err := m.record(installed, source, version, time.Now()); err != nil {
+		return err
+	}
+	return m.save(pluginDir)
 }
 
 func looksLikePlugin(name string) bool {
 	return strings.HasPrefix(name, "check-") || strings.HasPrefix(name, "mackerel-plugin-")
 }
 
-func placePlugin(src, dest string, overwrite bool) error {
+func warnUnconventionalName(name string) {
+	if !looksLikePlugin(name) {
+		logger.Log("warning", fmt.Sprintf("%s is installed though it isn't named like a plugin", name))
+	}
+}
+
+// isPluginFile returns whether the file in an artifact is installed as a plugin.
+// With allowAnyName, any executable regular file is installed regardless of its name.
+func isPluginFile(info os.FileInfo, allowAnyName bool) bool {
+	isExecutable := (info.Mode() & 0111) != 0
+	if allowAnyName {
+		return isExecutable && info.Mode().IsRegular()
+	}
+	return isExecutable && looksLikePlugin(info.Name())
+}
+
+// Place a plugin file to dest, and returns whether it is placed
+func placePlugin(src, dest string, overwrite bool) (bool, error) {
 	_, err := os.Stat(dest)
 	if err == nil && !overwrite {
 		logger.Log("", fmt.Sprintf("%s already exists. Skip installing for now", dest))
-		return nil
+		return false, nil
 	}
 	logger.Log("", fmt.Sprintf("Installing %s", dest))
-	return os.Rename(src, dest)
+	if err := os.Rename(src, dest); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Run the post-install command by the shell with the installed plugin in environment variables
+func runPostInstallHook(command, pluginPath string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/c", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(),
+		"MKR_PLUGIN_NAME="+filepath.Base(pluginPath),
+		"MKR_PLUGIN_PATH="+pluginPath,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("post-install command for %s failed: %s\n%s", pluginPath, err, out)
+	}
+	logger.Log("", fmt.Sprintf("Ran post-install command for %s", pluginPath))
+	return nil
+}
+
+const verifyTimeout = 5 * time.Second
+
+// Run an installed plugin with `--version` to check it can be executed on this host
+func verifyPlugin(pluginPath string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, pluginPath, "--version").CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s --version timed out after %s\n%s", pluginPath, verifyTimeout, out)
+	}
+	if err != nil {
+		return fmt.Errorf("%s --version failed: %s\n%s", pluginPath, err, out)
+	}
+	return nil
 }
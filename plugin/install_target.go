@@ -15,13 +15,21 @@ type installTarget struct {
 	repo       string
 	pluginName string
 	releaseTag string
+	// the URL of the artifact specified directly
+	artifactURL string
+	// the URL of the git repository to build the plugin from source
+	gitURL string
+	// the base URL of the plugin registry, which is validated by parseRegistryBase
+	registryBase string
 
 	// fields for testing
+	githubURL    string
 	rawGithubURL string
 	apiGithubURL string
 }
 
 const (
+	defaultGithubURL    = "https://github.com"
 	defaultRawGithubURL = "https://raw.githubusercontent.com"
 	defaultAPIGithubURL = "https://api.github.com"
 )
@@ -35,7 +43,19 @@ var targetReg = regexp.MustCompile(`^(?:([^@/]+)/([^@/]+)|([^@/]+))(?:@(.+))?$`)
 // - mackerelio/mackerel-plugin-sample
 // - mackerel-plugin-sample
 // - mackerelio/mackerel-plugin-sample@v0.0.1
+// - https://mirror.example.com/mackerel-plugin-sample_linux_amd64.zip
+// - git+https://git.example.com/mackerel-plugin-sample.git@v0.0.1
 func newInstallTargetFromString(target string) (*installTarget, error) {
+	if strings.HasPrefix(target, gitTargetPrefix) {
+		return parseGitTarget(target)
+	}
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		if _, err := url.Parse(target); err != nil {
+			return nil, fmt.Errorf("Install target is invalid: %s", redactURL(target))
+		}
+		return &installTarget{artifactURL: target}, nil
+	}
+
 	matches := targetReg.FindStringSubmatch(target)
 	if len(matches) != 5 {
 		return nil, fmt.Errorf("Install target is invalid: %s", target)
@@ -52,6 +72,10 @@ func newInstallTargetFromString(target string) (*installTarget, error) {
 
 // Make artifact's download URL
 func (it *installTarget) makeDownloadURL() (string, error) {
+	if it.artifactURL != "" {
+		return it.artifactURL, nil
+	}
+
 	owner, repo, err := it.getOwnerAndRepo()
 	if err != nil {
 		return "", err
@@ -62,9 +86,10 @@ func (it *installTarget) makeDownloadURL() (string, error) {
 		return "", err
 	}
 
-	filename := fmt.Sprintf("%s_%s_%s.zip", url.PathEscape(repo), runtime.GOOS, runtime.GOARCH)
+	filename := url.PathEscape(assetFilename(repo))
 	downloadURL := fmt.Sprintf(
-		"https://github.com/%s/%s/releases/download/%s/%s",
+		"%s/%s/%s/releases/download/%s/%s",
+		it.getGithubURL(),
 		url.PathEscape(owner),
 		url.PathEscape(repo),
 		url.PathEscape(releaseTag),
@@ -80,12 +105,11 @@ func (it *installTarget) getOwnerAndRepo() (string, string, error) {
 	}
 
 	// Get owner and repo from plugin registry
-	defURL := fmt.Sprintf(
-		"%s/mackerelio/plugin-registry/master/plugins/%s.json",
-		it.getRawGithubURL(),
-		url.PathEscape(it.pluginName),
-	)
-	resp, err := (&client{}).get(defURL)
+	base, err := parseRegistryBase(it.getRegistryBase())
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := (&client{}).get(joinURL(base, "plugins", it.pluginName+".json"))
 	if err != nil {
 		return "", "", err
 	}
@@ -129,6 +153,18 @@ func (it *installTarget) getReleaseTag(owner, repo string) (string, error) {
 	return it.releaseTag, nil
 }
 
+// assetFilename returns the filename of the release asset for the current os and arch
+func assetFilename(repo string) string {
+	return fmt.Sprintf("%s_%s_%s.zip", repo, runtime.GOOS, runtime.GOARCH)
+}
+
+func (it *installTarget) getGithubURL() string {
+	if it.githubURL != "" {
+		return it.githubURL
+	}
+	return defaultGithubURL
+}
+
 func (it *installTarget) getRawGithubURL() string {
 	if it.rawGithubURL != "" {
 		return it.rawGithubURL
@@ -136,6 +172,42 @@ func (it *installTarget) getRawGithubURL() string {
 	return defaultRawGithubURL
 }
 
+func (it *installTarget) getRegistryBase() string {
+	if it.registryBase != "" {
+		return it.registryBase
+	}
+	return it.getRawGithubURL() + "/mackerelio/plugin-registry/master"
+}
+
+// parseRegistryBase parses the base URL of the plugin registry, which should be an http or https URL
+// without query and fragment
+func parseRegistryBase(base string) (*url.URL, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("registry base is invalid: %s", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("registry base should be an http or https URL: %s", redactURL(base))
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("registry base should not have a query or a fragment: %s", redactURL(base))
+	}
+	return u, nil
+}
+
+// joinURL joins escaped elems to the path of base with a single slash,
+// regardless of whether the path of base ends with a slash
+func joinURL(base *url.URL, elems ...string) string {
+	u := *base
+	p := strings.TrimSuffix(u.EscapedPath(), "/")
+	for _, elem := range elems {
+		p += "/" + url.PathEscape(elem)
+	}
+	u.RawPath = p
+	u.Path, _ = url.PathUnescape(p)
+	return u.String()
+}
+
 // Returns URL object which Github Client.BaseURL can receive as it is
 func (it *installTarget) getAPIGithubURL() *url.URL {
 	u := defaultAPIGithubURL
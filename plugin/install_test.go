@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -74,7 +75,7 @@ func TestDownloadPluginArtifact(t *testing.T) {
 		tmpd := tempd(t)
 		defer os.RemoveAll(tmpd)
 
-		fpath, err := downloadPluginArtifact(ts.URL+"/not_found.zip", tmpd)
+		fpath, err := downloadPluginArtifact(&client{}, ts.URL+"/not_found.zip", tmpd)
 		assert.Equal(t, "", fpath, "fpath is empty")
 		assert.Contains(t, err.Error(), "http response not OK. code: 404,", "Returns correct err")
 	}
@@ -84,7 +85,7 @@ func TestDownloadPluginArtifact(t *testing.T) {
 		tmpd := tempd(t)
 		defer os.RemoveAll(tmpd)
 
-		fpath, err := downloadPluginArtifact(ts.URL+"/mackerel-plugin-sample_linux_amd64.zip", tmpd)
+		fpath, err := downloadPluginArtifact(&client{}, ts.URL+"/mackerel-plugin-sample_linux_amd64.zip", tmpd)
 		assert.Equal(t, tmpd+"/mackerel-plugin-sample_linux_amd64.zip", fpath, "Returns fpath correctly")
 
 		_, err = os.Stat(fpath)
@@ -94,6 +95,23 @@ func TestDownloadPluginArtifact(t *testing.T) {
 	}
 }
 
+func TestDownloadPluginArtifact_rateLimit(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+	tmpd := tempd(t)
+	defer os.RemoveAll(tmpd)
+
+	// the artifact has 2317 bytes, which takes about 0.58 seconds at 4000 bytes/s
+	start := time.Now()
+	fpath, err := downloadPluginArtifact(&client{rateLimit: 4000}, ts.URL+"/mackerel-plugin-sample-multi_darwin_386.zip", tmpd)
+	elapsed := time.Since(start)
+	if !assert.Nil(t, err, "Download is finished successfully") {
+		return
+	}
+	assert.True(t, elapsed > 400*time.Millisecond && elapsed < 1500*time.Millisecond, "download respects the rate limit, but took %s", elapsed)
+	assertEqualFileContent(t, fpath, "testdata/mackerel-plugin-sample-multi_darwin_386.zip", "Downloaded data is correct")
+}
+
 func TestInstallByArtifact(t *testing.T) {
 	{
 		// Install by the artifact which has a single plugin
@@ -102,8 +120,9 @@ func TestInstallByArtifact(t *testing.T) {
 		workdir := tempd(t)
 		defer os.RemoveAll(workdir)
 
-		err := installByArtifact("testdata/mackerel-plugin-sample_linux_amd64.zip", bindir, workdir, false)
+		installed, err := installByArtifact("testdata/mackerel-plugin-sample_linux_amd64.zip", bindir, workdir, installOptions{})
 		assert.Nil(t, err, "installByArtifact finished successfully")
+		assert.Equal(t, []string{filepath.Join(bindir, "mackerel-plugin-sample")}, installed, "Returns installed plugin paths")
 
 		installedPath := filepath.Join(bindir, "mackerel-plugin-sample")
 
@@ -120,8 +139,9 @@ func TestInstallByArtifact(t *testing.T) {
 		// Install same name plugin, but it is skipped
 		workdir2 := tempd(t)
 		defer os.RemoveAll(workdir2)
-		err = installByArtifact("testdata/mackerel-plugin-sample-duplicate_linux_amd64.zip", bindir, workdir2, false)
+		installed, err = installByArtifact("testdata/mackerel-plugin-sample-duplicate_linux_amd64.zip", bindir, workdir2, installOptions{})
 		assert.Nil(t, err, "installByArtifact finished successfully even if same name plugin exists")
+		assert.Empty(t, installed, "Skipped plugin is not returned as installed")
 
 		fi, err = os.Stat(filepath.Join(bindir, "mackerel-plugin-sample"))
 		assert.Nil(t, err, "A plugin file exists")
@@ -135,7 +155,7 @@ func TestInstallByArtifact(t *testing.T) {
 		// Install same name plugin with overwrite option
 		workdir3 := tempd(t)
 		defer os.RemoveAll(workdir3)
-		err = installByArtifact("testdata/mackerel-plugin-sample-duplicate_linux_amd64.zip", bindir, workdir3, true)
+		_, err = installByArtifact("testdata/mackerel-plugin-sample-duplicate_linux_amd64.zip", bindir, workdir3, installOptions{overwrite: true})
 		assert.Nil(t, err, "installByArtifact finished successfully")
 		assertEqualFileContent(
 			t,
@@ -152,7 +172,7 @@ func TestInstallByArtifact(t *testing.T) {
 		workdir := tempd(t)
 		defer os.RemoveAll(workdir)
 
-		installByArtifact("testdata/mackerel-plugin-sample-multi_darwin_386.zip", bindir, workdir, false)
+		installByArtifact("testdata/mackerel-plugin-sample-multi_darwin_386.zip", bindir, workdir, installOptions{})
 
 		// check-sample, mackerel-plugin-sample-multi-1 and plugins/mackerel-plugin-sample-multi-2
 		// are installed.  But followings are not installed
@@ -200,3 +220,103 @@ func TestLooksLikePlugin(t *testing.T) {
 		assert.Equal(t, tc.LooksLikePlugin, looksLikePlugin(tc.Name))
 	}
 }
+
+func TestVerifyPlugin(t *testing.T) {
+	tmpd := tempd(t)
+	defer os.RemoveAll(tmpd)
+
+	{
+		// A plugin which runs successfully
+		pluginPath := filepath.Join(tmpd, "mackerel-plugin-stub")
+		err := ioutil.WriteFile(pluginPath, []byte("#!/bin/sh\necho v0.1.0\n"), 0755)
+		assert.Nil(t, err, "stub plugin is created")
+
+		assert.Nil(t, verifyPlugin(pluginPath), "verification succeeds")
+	}
+
+	{
+		// A plugin which exits nonzero
+		pluginPath := filepath.Join(tmpd, "mackerel-plugin-fail")
+		err := ioutil.WriteFile(pluginPath, []byte("#!/bin/sh\necho 'unknown flag: --version'\nexit 1\n"), 0755)
+		assert.Nil(t, err, "failing plugin is created")
+
+		err = verifyPlugin(pluginPath)
+		if assert.Error(t, err, "verification fails") {
+			assert.Contains(t, err.Error(), "unknown flag: --version", "error contains the output")
+		}
+	}
+
+	{
+		// A plugin which can't be executed (e.g. built for another architecture)
+		pluginPath := filepath.Join(tmpd, "mackerel-plugin-broken")
+		err := ioutil.WriteFile(pluginPath, []byte{0x7f, 'E', 'L', 'F', 0, 0, 0, 0}, 0755)
+		assert.Nil(t, err, "broken plugin is created")
+
+		assert.Error(t, verifyPlugin(pluginPath), "verification fails")
+	}
+}
+
+func TestRunPostInstallHook(t *testing.T) {
+	tmpd := tempd(t)
+	defer os.RemoveAll(tmpd)
+
+	{
+		// The hook receives the plugin name and path for each plugin
+		out := filepath.Join(tmpd, "hook.log")
+		command := `echo "$MKR_PLUGIN_NAME $MKR_PLUGIN_PATH" >> ` + out
+		for _, name := range []string{"mackerel-plugin-sample", "check-sample"} {
+			err := runPostInstallHook(command, filepath.Join(tmpd, "bin", name))
+			assert.Nil(t, err, "post-install command succeeds")
+		}
+		content, err := ioutil.ReadFile(out)
+		assert.Nil(t, err, "post-install command is run")
+		assert.Equal(t,
+			"mackerel-plugin-sample "+filepath.Join(tmpd, "bin", "mackerel-plugin-sample")+"\n"+
+				"check-sample "+filepath.Join(tmpd, "bin", "check-sample")+"\n",
+			string(content),
+			"post-install command is run once per plugin with environment variables",
+		)
+	}
+
+	{
+		// The hook exits nonzero
+		err := runPostInstallHook("echo 'config error'; exit 3", filepath.Join(tmpd, "bin", "mackerel-plugin-sample"))
+		if assert.Error(t, err, "post-install command fails") {
+			assert.Contains(t, err.Error(), "config error", "error contains the output")
+		}
+	}
+}
+
+func TestInstallByArtifact_allowAnyName(t *testing.T) {
+	{
+		// not-mackerel-plugin-sample is not installed by default
+		bindir := tempd(t)
+		defer os.RemoveAll(bindir)
+		workdir := tempd(t)
+		defer os.RemoveAll(workdir)
+
+		installByArtifact("testdata/mackerel-plugin-sample-multi_darwin_386.zip", bindir, workdir, installOptions{})
+		_, err := os.Stat(filepath.Join(bindir, "not-mackerel-plugin-sample"))
+		assert.NotNil(t, err, "not-mackerel-plugin-sample is not installed")
+	}
+
+	{
+		// any executable file is installed with allowAnyName
+		bindir := tempd(t)
+		defer os.RemoveAll(bindir)
+		workdir := tempd(t)
+		defer os.RemoveAll(workdir)
+
+		_, err := installByArtifact("testdata/mackerel-plugin-sample-multi_darwin_386.zip", bindir, workdir, installOptions{allowAnyName: true})
+		assert.Nil(t, err, "installByArtifact finished successfully")
+		assertEqualFileContent(t,
+			filepath.Join(bindir, "not-mackerel-plugin-sample"),
+			"testdata/mackerel-plugin-sample-multi_darwin_386/not-mackerel-plugin-sample",
+			"not-mackerel-plugin-sample is installed",
+		)
+		_, err = os.Stat(filepath.Join(bindir, "mackerel-plugin-non-executable"))
+		assert.NotNil(t, err, "mackerel-plugin-non-executable is not installed even with allowAnyName")
+		_, err = os.Stat(filepath.Join(bindir, "README.md"))
+		assert.NotNil(t, err, "README.md is not installed even with allowAnyName")
+	}
+}
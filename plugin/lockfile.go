@@ -0,0 +1,209 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mackerelio/mkr/logger"
+	"github.com/mholt/archiver"
+	"github.com/pkg/errors"
+)
+
+// the default path of the lockfile written by `mkr plugin pin` and read by `mkr plugin install --locked`
+const defaultLockfilePath = "mkr-plugins.lock"
+
+// lockfile pins installed plugin commands to their artifacts, so that the same plugins can be installed on other hosts
+type lockfile struct {
+	Plugins []*lockEntry `json:"plugins"`
+}
+
+// lockEntry is a plugin command in the artifact at URL, which has to have the checksum
+type lockEntry struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Version  string `json:"version"`
+	Checksum string `json:"checksum"`
+}
+
+// Build the lockfile from the manifest in pluginDir.
+// Plugins modified after installed, or not downloaded from URLs such as ones built from source, can't be pinned.
+func pinPlugins(pluginDir string) (*lockfile, error) {
+	m, err := loadManifest(pluginDir)
+	if err != nil {
+		return nil, err
+	}
+	l := &lockfile{Plugins: []*lockEntry{}}
+	for name, entry := range m.Plugins {
+		if !strings.HasPrefix(entry.Source, "http://") && !strings.HasPrefix(entry.Source, "https://") {
+			return nil, fmt.Errorf("%s can't be pinned since it isn't downloaded from a URL: %s", name, entry.Source)
+		}
+		checksum, err := fileChecksum(entry.Path)
+		if err != nil {
+			return nil, err
+		}
+		if checksum != entry.Checksum {
+			return nil, fmt.Errorf("%s can't be pinned since it's modified after installed", name)
+		}
+		l.Plugins = append(l.Plugins, &lockEntry{
+			Name:     name,
+			URL:      entry.Source,
+			Version:  entry.Version,
+			Checksum: entry.Checksum,
+		})
+	}
+	sort.Slice(l.Plugins, func(i, j int) bool { return l.Plugins[i].Name < l.Plugins[j].Name })
+	return l, nil
+}
+
+func loadLockfile(fpath string) (*lockfile, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var l lockfile
+	if err := json.NewDecoder(f).Decode(&l); err != nil {
+		return nil, err
+	}
+	for i, entry := range l.Plugins {
+		if entry.Name == "" || entry.URL == "" || entry.Checksum == "" {
+			return nil, fmt.Errorf("plugins[%d]: name, url and checksum are required", i)
+		}
+	}
+	return &l, nil
+}
+
+func (l *lockfile) save(fpath string) error {
+	data, err := json.MarshalIndent(l, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fpath, append(data, '\n'), 0644)
+}
+
+// Install plugins pinned in the lockfile
+func doPluginLockedInstall(lockfilePath, prefix string, opts installOptions) error {
+	l, err := loadLockfile(lockfilePath)
+	if err != nil {
+		return errors.Wrap(err, "Failed to install plugin while loading the lockfile")
+	}
+	pluginDir, err := setupPluginDir(prefix)
+	if err != nil {
+		return errors.Wrap(err, "Failed to install plugin while setup plugin directory")
+	}
+	installed, err := installLocked(l, pluginDir, opts)
+	if err != nil {
+		return err
+	}
+	logger.Log("", fmt.Sprintf("Successfully installed %d plugins from %s", len(installed), lockfilePath))
+	return nil
+}
+
+// Install plugins in the lockfile into pluginDir, and returns installed plugin paths.
+// All artifacts are downloaded and verified before placing any plugin, so nothing is installed
+// if a plugin is missing in its artifact or its checksum doesn't match the lockfile.
+// Plugins in the lockfile overwrite existing ones.
+func installLocked(l *lockfile, pluginDir string, opts installOptions) ([]string, error) {
+	workdir, err := ioutil.TempDir(filepath.Join(pluginDir, "work"), "mkr-plugin-installer-")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to install plugin while creating a work directory")
+	}
+	defer os.RemoveAll(workdir)
+
+	var urls []string
+	entriesByURL := map[string][]*lockEntry{}
+	for _, entry := range l.Plugins {
+		if _, ok := entriesByURL[entry.URL]; !ok {
+			urls = append(urls, entry.URL)
+		}
+		entriesByURL[entry.URL] = append(entriesByURL[entry.URL], entry)
+	}
+
+	staged := map[*lockEntry]string{}
+	cl := &client{netrc: opts.netrc, rateLimit: opts.rateLimit, allowlist: opts.allowlist}
+	for i, u := range urls {
+		if err := opts.allowlist.check(u); err != nil {
+			return nil, errors.Wrap(err, "Failed to install plugin")
+		}
+		artifactDir := filepath.Join(workdir, fmt.Sprint(i))
+		if err := os.Mkdir(artifactDir, 0755); err != nil {
+			return nil, errors.Wrap(err, "Failed to install plugin while creating a work directory")
+		}
+		artifactFile, err := downloadPluginArtifact(cl, u, artifactDir)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to install plugin while downloading an artifact")
+		}
+		if err := stageLockedPlugins(artifactFile, filepath.Join(artifactDir, "artifact"), entriesByURL[u], staged); err != nil {
+			return nil, errors.Wrapf(err, "Failed to install plugin from %s", redactURL(u))
+		}
+	}
+
+	installLock.Lock()
+	defer installLock.Unlock()
+	var installed []string
+	for _, u := range urls {
+		var placed []string
+		for _, entry := range entriesByURL[u] {
+			dest := filepath.Join(pluginDir, "bin", entry.Name)
+			if _, err := placePlugin(staged[entry], dest, true); err != nil {
+				return installed, errors.Wrap(err, "Failed to install plugin while placing")
+			}
+			placed = append(placed, dest)
+		}
+		installed = append(installed, placed...)
+		if err := recordInstalledPlugins(pluginDir, placed, u, entriesByURL[u][0].Version); err != nil {
+			return installed, errors.Wrap(err, "Failed to install plugin while recording to the manifest")
+		}
+	}
+	return installed, nil
+}
+
+// Extract the artifact into dir, and look for the plugins of entries in it verifying their checksums.
+// The paths of the found plugins are set to staged.
+func stageLockedPlugins(artifactFile, dir string, entries []*lockEntry, staged map[*lockEntry]string) error {
+	if err := archiver.Zip.Open(artifactFile, dir); err != nil {
+		return err
+	}
+	wanted := map[string]bool{}
+	for _, entry := range entries {
+		wanted[entry.Name] = true
+	}
+	found := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !wanted[info.Name()] || !isPluginFile(info, true) {
+			return nil
+		}
+		if _, ok := found[info.Name()]; ok {
+			return fmt.Errorf("%s is duplicated in the artifact", info.Name())
+		}
+		found[info.Name()] = path
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path, ok := found[entry.Name]
+		if !ok {
+			return fmt.Errorf("%s is not found in the artifact", entry.Name)
+		}
+		checksum, err := fileChecksum(path)
+		if err != nil {
+			return err
+		}
+		if checksum != entry.Checksum {
+			return fmt.Errorf("the checksum of %s doesn't match the lockfile: %s (expected %s)", entry.Name, checksum, entry.Checksum)
+		}
+		staged[entry] = path
+	}
+	return nil
+}
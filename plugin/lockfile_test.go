@@ -0,0 +1,66 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinAndInstallLocked(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+
+	tmpd := tempd(t)
+	defer os.RemoveAll(tmpd)
+	pluginDir, err := setupPluginDir(filepath.Join(tmpd, "original"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, _ := newInstallTargetFromString(ts.URL + "/mackerel-plugin-sample-multi_darwin_386.zip")
+	_, err = installPlugin(it, pluginDir, installOptions{})
+	assert.Nil(t, err, "installPlugin finished successfully")
+
+	l, err := pinPlugins(pluginDir)
+	assert.Nil(t, err, "pinPlugins finished successfully")
+	var names []string
+	for _, entry := range l.Plugins {
+		names = append(names, entry.Name)
+		assert.Equal(t, ts.URL+"/mackerel-plugin-sample-multi_darwin_386.zip", entry.URL, "the artifact URL is pinned")
+	}
+	assert.Equal(t, []string{"check-sample", "mackerel-plugin-sample-multi-1", "mackerel-plugin-sample-multi-2"}, names, "all installed plugins are pinned in order")
+
+	lockfilePath := filepath.Join(tmpd, "mkr-plugins.lock")
+	assert.Nil(t, l.save(lockfilePath))
+	l, err = loadLockfile(lockfilePath)
+	assert.Nil(t, err, "the saved lockfile can be loaded")
+
+	lockedDir, err := setupPluginDir(filepath.Join(tmpd, "locked"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed, err := installLocked(l, lockedDir, installOptions{})
+	assert.Nil(t, err, "installLocked finished successfully")
+	assert.Len(t, installed, 3)
+	for _, name := range names {
+		assertEqualFileContent(t, filepath.Join(pluginDir, "bin", name), filepath.Join(lockedDir, "bin", name), "the same plugin is installed")
+	}
+	m, _ := loadManifest(lockedDir)
+	assert.Equal(t, l.Plugins[0].Checksum, m.Plugins["check-sample"].Checksum, "plugins installed from the lockfile are recorded")
+
+	// a checksum in the lockfile no longer matches
+	mismatchDir, err := setupPluginDir(filepath.Join(tmpd, "mismatch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Plugins[2].Checksum = "sha256:0000"
+	_, err = installLocked(l, mismatchDir, installOptions{})
+	if assert.NotNil(t, err, "installLocked fails for the mismatched checksum") {
+		assert.Contains(t, err.Error(), "the checksum of mackerel-plugin-sample-multi-2 doesn't match the lockfile")
+	}
+	_, err = os.Stat(filepath.Join(mismatchDir, "bin", "check-sample"))
+	assert.True(t, os.IsNotExist(err), "no plugin is placed if any checksum doesn't match")
+}
@@ -0,0 +1,116 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// the file name of the manifest placed in the plugin directory
+const manifestFileName = "manifest.json"
+
+// manifest records plugins installed by mkr, keyed by command names
+type manifest struct {
+	Plugins map[string]*manifestEntry `json:"plugins"`
+}
+
+// manifestEntry is the record of an installed plugin command
+type manifestEntry struct {
+	Name        string    `json:"name"`
+	Source      string    `json:"source"`
+	Version     string    `json:"version"`
+	InstalledAt time.Time `json:"installedAt"`
+	Checksum    string    `json:"checksum"`
+	Path        string    `json:"path"`
+}
+
+func manifestPath(pluginDir string) string {
+	return filepath.Join(pluginDir, manifestFileName)
+}
+
+// Load the manifest in pluginDir. An empty manifest is returned if it doesn't exist yet.
+func loadManifest(pluginDir string) (*manifest, error) {
+	m := &manifest{Plugins: map[string]*manifestEntry{}}
+	f, err := os.Open(manifestPath(pluginDir))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(m); err != nil {
+		return nil, err
+	}
+	if m.Plugins == nil {
+		m.Plugins = map[string]*manifestEntry{}
+	}
+	return m, nil
+}
+
+// Write the manifest to pluginDir atomically
+func (m *manifest) save(pluginDir string) error {
+	data, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(pluginDir, manifestFileName+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), manifestPath(pluginDir))
+}
+
+// Record installed plugin commands with their source and version
+func (m *manifest) record(pluginPaths []string, source, version string, installedAt time.Time) error {
+	for _, pluginPath := range pluginPaths {
+		absPath, err := filepath.Abs(pluginPath)
+		if err != nil {
+			return err
+		}
+		checksum, err := fileChecksum(absPath)
+		if err != nil {
+			return err
+		}
+		name := filepath.Base(absPath)
+		m.Plugins[name] = &manifestEntry{
+			Name:        name,
+			Source:      source,
+			Version:     version,
+			InstalledAt: installedAt,
+			Checksum:    checksum,
+			Path:        absPath,
+		}
+	}
+	return nil
+}
+
+// Returns the sha256 checksum of the file, in the form of "sha256:<hex>"
+func fileChecksum(fpath string) (string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
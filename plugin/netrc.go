@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// netrcEntry is a credential for a machine in a netrc file
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+// netrc is the list of credentials in a netrc file.
+// An entry with empty machine is the default entry.
+type netrc []*netrcEntry
+
+// Load a netrc file
+func loadNetrc(fpath string) (netrc, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseNetrc(f)
+}
+
+// Parse netrc format. "macdef" is not supported.
+func parseNetrc(r io.Reader) (netrc, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+
+	var entries netrc
+	var current *netrcEntry
+	for scanner.Scan() {
+		switch token := scanner.Text(); token {
+		case "machine", "default":
+			current = &netrcEntry{}
+			if token == "machine" {
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("netrc: machine name is missing")
+				}
+				current.machine = scanner.Text()
+			}
+			entries = append(entries, current)
+		case "login", "password", "account":
+			if current == nil {
+				return nil, fmt.Errorf("netrc: %s appears before machine", token)
+			}
+			if !scanner.Scan() {
+				return nil, fmt.Errorf("netrc: value of %s is missing", token)
+			}
+			switch token {
+			case "login":
+				current.login = scanner.Text()
+			case "password":
+				current.password = scanner.Text()
+			}
+		case "macdef":
+			return nil, fmt.Errorf("netrc: macdef is not supported")
+		default:
+			return nil, fmt.Errorf("netrc: unexpected token")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Find the credential for the host. The default entry is used if no machine matches.
+func (n netrc) find(host string) *netrcEntry {
+	var defaultEntry *netrcEntry
+	for _, entry := range n {
+		if entry.machine == host {
+			return entry
+		}
+		if entry.machine == "" && defaultEntry == nil {
+			defaultEntry = entry
+		}
+	}
+	return defaultEntry
+}
@@ -0,0 +1,34 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNetrc(t *testing.T) {
+	n, err := parseNetrc(strings.NewReader(`
+machine mirror.example.com
+  login user1
+  password secret1
+machine other.example.com login user2 password secret2
+default login anonymous password guest
+`))
+	if !assert.NoError(t, err, "parseNetrc finished successfully") {
+		return
+	}
+
+	entry := n.find("other.example.com")
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, "user2", entry.login)
+		assert.Equal(t, "secret2", entry.password)
+	}
+	entry = n.find("unknown.example.com")
+	if assert.NotNil(t, entry, "default entry is used") {
+		assert.Equal(t, "anonymous", entry.login)
+	}
+
+	_, err = parseNetrc(strings.NewReader("login user1 password secret1"))
+	assert.Error(t, err, "login before machine is invalid")
+}
@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/mackerelio/mkr/logger"
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandPluginPin = cli.Command{
+	Name:      "pin",
+	Usage:     "Write the lockfile of installed plugins",
+	ArgsUsage: "[--prefix <prefix>] [--lockfile <file>]",
+	Action:    doPluginPin,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "prefix",
+			Usage: "Plugin install location. The default is /opt/mackerel-agent/plugins",
+		},
+		cli.StringFlag{
+			Name:  "lockfile",
+			Value: defaultLockfilePath,
+			Usage: "Write the lockfile to <file>",
+		},
+	},
+	Description: `
+    Write the lockfile which records the artifact URL, version and checksum of every plugin command
+    installed by "mkr plugin install", such as {"plugins": [{"name": "mackerel-plugin-sample", "url": ..., "version": ..., "checksum": ...}]}.
+    "mkr plugin install --locked" installs exactly the same plugins from the lockfile on other hosts.
+    Plugins built from source, or modified after installed, can't be pinned.
+`,
+}
+
+// main function for mkr plugin pin
+func doPluginPin(c *cli.Context) error {
+	pluginDir := c.String("prefix")
+	if pluginDir == "" {
+		pluginDir = defaultPluginDir
+	}
+	l, err := pinPlugins(pluginDir)
+	if err != nil {
+		return errors.Wrap(err, "Failed to pin plugins")
+	}
+	if err := l.save(c.String("lockfile")); err != nil {
+		return errors.Wrap(err, "Failed to pin plugins while writing the lockfile")
+	}
+	logger.Log("", fmt.Sprintf("Pinned %d plugins to %s", len(l.Plugins), c.String("lockfile")))
+	return nil
+}
@@ -0,0 +1,45 @@
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/mackerelio/mkr/logger"
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandPluginRollback = cli.Command{
+	Name:      "rollback",
+	Usage:     "Switch a plugin installed with --versioned to the previous version",
+	ArgsUsage: "[--prefix <prefix>] <name>",
+	Action:    doPluginRollback,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "prefix",
+			Usage: "Plugin install location. The default is /opt/mackerel-agent/plugins",
+		},
+	},
+	Description: `
+    Switch the plugin command <name> installed by "mkr plugin install --versioned" to the version
+    which was current before the last install or rollback. Rolling back twice returns to the original version.
+    The source and the version are restored in the manifest too, so that "mkr plugin pin" pins the version switched to.
+`,
+}
+
+// main function for mkr plugin rollback
+func doPluginRollback(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("Specify plugin name")
+	}
+	pluginDir := c.String("prefix")
+	if pluginDir == "" {
+		pluginDir = defaultPluginDir
+	}
+	version, err := rollbackPlugin(pluginDir, name)
+	if err != nil {
+		return errors.Wrap(err, "Failed to roll back plugin")
+	}
+	logger.Log("", fmt.Sprintf("Rolled back %s to %s", name, version))
+	return nil
+}
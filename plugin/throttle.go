@@ -0,0 +1,46 @@
+package plugin
+
+import (
+	"io"
+	"time"
+)
+
+// throttledReader limits the reading rate of r to rate bytes per second by a token bucket,
+// which holds tokens for a second at most and starts empty.
+type throttledReader struct {
+	r    io.Reader
+	rate float64
+
+	tokens float64
+	last   time.Time
+}
+
+func newThrottledReader(r io.Reader, rate int64) *throttledReader {
+	return &throttledReader{r: r, rate: float64(rate), last: time.Now()}
+}
+
+func (t *throttledReader) refill() {
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.rate {
+		t.tokens = t.rate
+	}
+	t.last = now
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	t.refill()
+	if t.tokens < 1 {
+		time.Sleep(time.Duration((1 - t.tokens) / t.rate * float64(time.Second)))
+		t.refill()
+	}
+	if n := int(t.tokens); n < len(p) {
+		p = p[:n]
+	}
+	n, err := t.r.Read(p)
+	t.tokens -= float64(n)
+	return n, err
+}
@@ -0,0 +1,191 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mackerelio/mkr/logger"
+)
+
+// With --versioned, each version of a plugin command is placed in versions/<name>/<version>/<name>
+// under the plugin directory, and selected by the "current" symlink in versions/<name>.
+// bin/<name> is a symlink to versions/<name>/current/<name>, so that the agent finds it as usual.
+const (
+	versionsDirName = "versions"
+	currentLinkName = "current"
+	// the version which "current" pointed to before the last switch, used by rollback
+	previousLinkName = "previous"
+	// the file in each version directory which records where the version was installed from
+	versionRecordFileName = ".install.json"
+)
+
+// versionRecord is the source and the version of a version directory, restored to the manifest on rollback
+type versionRecord struct {
+	Source  string `json:"source"`
+	Version string `json:"version"`
+}
+
+func versionsDir(pluginDir, name string) string {
+	return filepath.Join(pluginDir, versionsDirName, name)
+}
+
+// versionDirName returns the directory name of the version, which is the release tag without path separators
+func versionDirName(version string) (string, error) {
+	dirName := strings.NewReplacer("/", "_", `\`, "_").Replace(version)
+	switch dirName {
+	case "", ".", "..", currentLinkName, previousLinkName:
+		return "", fmt.Errorf("cannot use %q as a version directory", version)
+	}
+	return dirName, nil
+}
+
+// placeVersionedPlugins moves plugin files staged in the work directory to their version directories,
+// switches their current versions, and returns the paths of the symlinks in bin.
+// The source of the version is recorded in each version directory.
+func placeVersionedPlugins(staged []string, pluginDir, version, source string, overwrite bool) ([]string, error) {
+	dirName, err := versionDirName(version)
+	if err != nil {
+		return nil, err
+	}
+	// check bin before placing any of them, not to leave versions unreachable from bin
+	for _, src := range staged {
+		binPath := filepath.Join(pluginDir, "bin", filepath.Base(src))
+		fi, err := os.Lstat(binPath)
+		if err == nil && fi.Mode()&os.ModeSymlink == 0 && !overwrite {
+			return nil, fmt.Errorf("%s already exists and is not a symlink. Specify --overwrite to replace it", binPath)
+		}
+	}
+
+	var installed []string
+	for _, src := range staged {
+		name := filepath.Base(src)
+		dest := filepath.Join(versionsDir(pluginDir, name), dirName, name)
+		if _, err := os.Stat(dest); err == nil && !overwrite {
+			logger.Log("", fmt.Sprintf("%s already exists. Skip installing for now", dest))
+			continue
+		}
+		logger.Log("", fmt.Sprintf("Installing %s", dest))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return installed, err
+		}
+		if err := os.Rename(src, dest); err != nil {
+			return installed, err
+		}
+		if err := saveVersionRecord(filepath.Dir(dest), &versionRecord{Source: source, Version: version}); err != nil {
+			return installed, err
+		}
+		if err := switchPluginVersion(pluginDir, name, dirName); err != nil {
+			return installed, err
+		}
+		binPath := filepath.Join(pluginDir, "bin", name)
+		if err := replaceSymlink(filepath.Join("..", versionsDirName, name, currentLinkName, name), binPath); err != nil {
+			return installed, err
+		}
+		installed = append(installed, binPath)
+	}
+	return installed, nil
+}
+
+// switchPluginVersion points "current" to the version directory, and "previous" to the one it pointed to
+func switchPluginVersion(pluginDir, name, dirName string) error {
+	dir := versionsDir(pluginDir, name)
+	current, err := os.Readlink(filepath.Join(dir, currentLinkName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if current == dirName {
+		return nil
+	}
+	if current != "" {
+		if err := replaceSymlink(current, filepath.Join(dir, previousLinkName)); err != nil {
+			return err
+		}
+	}
+	return replaceSymlink(dirName, filepath.Join(dir, currentLinkName))
+}
+
+// rollbackPlugin switches the plugin command to the previous version, and returns the version
+func rollbackPlugin(pluginDir, name string) (string, error) {
+	dir := versionsDir(pluginDir, name)
+	previous, err := os.Readlink(filepath.Join(dir, previousLinkName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("no previous version of %s is installed by --versioned in %s", name, pluginDir)
+		}
+		return "", err
+	}
+	if err := switchPluginVersion(pluginDir, name, previous); err != nil {
+		return "", err
+	}
+
+	m, err := loadManifest(pluginDir)
+	if err != nil {
+		return previous, err
+	}
+	if entry, ok := m.Plugins[name]; ok {
+		checksum, err := fileChecksum(entry.Path)
+		if err != nil {
+			return previous, err
+		}
+		record, err := loadVersionRecord(filepath.Join(dir, previous))
+		if err != nil {
+			return previous, err
+		}
+		if record == nil {
+			// the source of versions installed before recording is unknown,
+			// and the entry must not be pinned with the source of another version
+			record = &versionRecord{Version: previous}
+		}
+		entry.Source = record.Source
+		entry.Version = record.Version
+		entry.Checksum = checksum
+		if err := m.save(pluginDir); err != nil {
+			return previous, err
+		}
+	}
+	return previous, nil
+}
+
+func saveVersionRecord(versionDir string, record *versionRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(versionDir, versionRecordFileName), data, 0644)
+}
+
+// loadVersionRecord returns the record of the version directory, or nil if it isn't recorded
+func loadVersionRecord(versionDir string) (*versionRecord, error) {
+	data, err := ioutil.ReadFile(filepath.Join(versionDir, versionRecordFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var record versionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// replaceSymlink creates or replaces the symlink at link atomically
+func replaceSymlink(target, link string) error {
+	tmp := link + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stageVersionedPlugin(t *testing.T, workdir, name, content string) string {
+	src := filepath.Join(workdir, name)
+	if err := ioutil.WriteFile(src, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func TestPlaceVersionedPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks may not be permitted on Windows")
+	}
+	tmpd := tempd(t)
+	defer os.RemoveAll(tmpd)
+	pluginDir, err := setupPluginDir(tmpd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const name = "mackerel-plugin-sample"
+	binPath := filepath.Join(pluginDir, "bin", name)
+
+	for _, version := range []string{"v0.1.0", "release/v0.2.0"} {
+		src := stageVersionedPlugin(t, filepath.Join(pluginDir, "work"), name, version)
+		source := "https://example.com/" + version + ".zip"
+		installed, err := placeVersionedPlugins([]string{src}, pluginDir, version, source, false)
+		assert.Nil(t, err, "placeVersionedPlugins finished successfully")
+		assert.Equal(t, []string{binPath}, installed, "the symlink in bin is returned as installed")
+		assert.Nil(t, recordInstalledPlugins(pluginDir, installed, source, version))
+	}
+
+	dir := filepath.Join(pluginDir, "versions", name)
+	for dirName, version := range map[string]string{"v0.1.0": "v0.1.0", "release_v0.2.0": "release/v0.2.0"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, dirName, name))
+		if assert.Nil(t, err, "each version is placed in its own directory") {
+			assert.Equal(t, version, string(content))
+		}
+	}
+	link, err := os.Readlink(binPath)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join("..", "versions", name, "current", name), link, "bin links the current version")
+	link, _ = os.Readlink(filepath.Join(dir, "current"))
+	assert.Equal(t, "release_v0.2.0", link, "current is the last installed version")
+	link, _ = os.Readlink(filepath.Join(dir, "previous"))
+	assert.Equal(t, "v0.1.0", link, "previous is the version installed before")
+	content, _ := ioutil.ReadFile(binPath)
+	assert.Equal(t, "release/v0.2.0", string(content), "bin resolves to the current version")
+
+	version, err := rollbackPlugin(pluginDir, name)
+	assert.Nil(t, err, "rollbackPlugin finished successfully")
+	assert.Equal(t, "v0.1.0", version)
+	content, _ = ioutil.ReadFile(binPath)
+	assert.Equal(t, "v0.1.0", string(content), "bin resolves to the previous version after rollback")
+	m, err := loadManifest(pluginDir)
+	if assert.Nil(t, err) && assert.NotNil(t, m.Plugins[name]) {
+		assert.Equal(t, "https://example.com/v0.1.0.zip", m.Plugins[name].Source, "the source of the previous version is restored")
+		assert.Equal(t, "v0.1.0", m.Plugins[name].Version)
+	}
+	l, err := pinPlugins(pluginDir)
+	if assert.Nil(t, err, "the rolled back plugin can be pinned") && assert.Len(t, l.Plugins, 1) {
+		checksum, _ := fileChecksum(binPath)
+		assert.Equal(t, &lockEntry{Name: name, URL: "https://example.com/v0.1.0.zip", Version: "v0.1.0", Checksum: checksum}, l.Plugins[0],
+			"the lockfile pairs the source with the checksum of the same version")
+	}
+	link, _ = os.Readlink(filepath.Join(dir, "previous"))
+	assert.Equal(t, "release_v0.2.0", link, "rolling back again returns to the original version")
+}
+
+func TestPlaceVersionedPlugins_notSymlink(t *testing.T) {
+	tmpd := tempd(t)
+	defer os.RemoveAll(tmpd)
+	pluginDir, err := setupPluginDir(tmpd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const name = "mackerel-plugin-sample"
+	stageVersionedPlugin(t, filepath.Join(pluginDir, "bin"), name, "out-of-band")
+	src := stageVersionedPlugin(t, filepath.Join(pluginDir, "work"), name, "v0.1.0")
+
+	_, err = placeVersionedPlugins([]string{src}, pluginDir, "v0.1.0", "https://example.com/v0.1.0.zip", false)
+	assert.NotNil(t, err, "a plugin placed without --versioned is not replaced without overwrite")
+	_, err = os.Stat(filepath.Join(pluginDir, "versions", name))
+	assert.True(t, os.IsNotExist(err), "nothing is placed if it fails")
+
+	_, err = rollbackPlugin(pluginDir, name)
+	assert.NotNil(t, err, "a plugin without the previous version cannot be rolled back")
+}
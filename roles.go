@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandRoles = cli.Command{
+	Name:  "roles",
+	Usage: "Manipulate roles of hosts",
+	Description: `
+    Manipulate roles of hosts.
+`,
+	Subcommands: []cli.Command{
+		{
+			Name:      "apply",
+			Usage:     "apply roles of hosts in a mapping file",
+			ArgsUsage: "--from <file> [--prune] [--dry-run | -d]",
+			Description: `
+    Add roles to hosts as listed in the mapping file, and report the changes.
+    The mapping file is a JSON array of hosts having "roleFullnames" and "id" or "name",
+    which is the same format as the output of 'mkr hosts'. Hosts not in the file are untouched.
+    With --prune, roles not listed in the file are removed from the hosts too.
+    Requests "PUT /api/v0/hosts/<hostId>/role-fullnames". See https://mackerel.io/api-docs/entry/hosts#update-roles .
+`,
+			Action: doRolesApply,
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "from", Value: "", Usage: "Read the mapping of hosts to roles from <file>"},
+				cli.BoolFlag{Name: "prune", Usage: "Remove roles of the hosts which are not in the file"},
+				cli.BoolFlag{Name: "dry-run, d", Usage: "Show the changes, but not apply them"},
+			},
+		},
+	},
+}
+
+// hostRolesChange is the change of roles of a host
+type hostRolesChange struct {
+	hostID        string
+	hostName      string
+	added         []string
+	removed       []string
+	roleFullnames []string
+}
+
+// planRolesApply returns changes of roles to apply the mapping to hosts, sorted by host names,
+// and the entries of the mapping which match no host.
+// An error is returned if an entry without the id has the name of multiple hosts.
+func planRolesApply(hosts []*mkr.Host, mapping []*HostFormat, prune bool) ([]*hostRolesChange, []*HostFormat, error) {
+	byID := map[string]*mkr.Host{}
+	byName := map[string][]*mkr.Host{}
+	for _, host := range hosts {
+		byID[host.ID] = host
+		byName[host.Name] = append(byName[host.Name], host)
+	}
+
+	var changes []*hostRolesChange
+	var notFound []*HostFormat
+	for _, entry := range mapping {
+		host, ok := byID[entry.ID]
+		if !ok && entry.ID == "" {
+			named := byName[entry.Name]
+			if len(named) > 1 {
+				var hostIDs []string
+				for _, h := range named {
+					hostIDs = append(hostIDs, h.ID)
+				}
+				return nil, nil, fmt.Errorf("host name '%s' is ambiguous: %s", entry.Name, strings.Join(hostIDs, ", "))
+			}
+			if len(named) == 1 {
+				host, ok = named[0], true
+			}
+		}
+		if !ok {
+			notFound = append(notFound, entry)
+			continue
+		}
+
+		current := host.GetRoleFullnames()
+		change := &hostRolesChange{hostID: host.ID, hostName: host.Name}
+		for _, role := range entry.RoleFullnames {
+			if !containsString(current, role) && !containsString(change.added, role) {
+				change.added = append(change.added, role)
+			}
+		}
+		for _, role := range current {
+			if prune && !containsString(entry.RoleFullnames, role) {
+				change.removed = append(change.removed, role)
+			} else {
+				change.roleFullnames = append(change.roleFullnames, role)
+			}
+		}
+		if len(change.added) == 0 && len(change.removed) == 0 {
+			continue
+		}
+		change.roleFullnames = sortedRoles(append(change.roleFullnames, change.added...))
+		change.added = sortedRoles(change.added)
+		change.removed = sortedRoles(change.removed)
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].hostName < changes[j].hostName })
+	return changes, notFound, nil
+}
+
+func printRolesChanges(w io.Writer, changes []*hostRolesChange) {
+	for _, change := range changes {
+		fmt.Fprintf(w, " %s (%s)\n", change.hostName, change.hostID)
+		for _, role := range change.removed {
+			fmt.Fprintf(w, "-  %s\n", role)
+		}
+		for _, role := range change.added {
+			fmt.Fprintf(w, "+  %s\n", role)
+		}
+	}
+}
+
+func applyRolesChanges(client *mkr.Client, changes []*hostRolesChange) error {
+	for _, change := range changes {
+		if err := client.UpdateHostRoleFullnames(change.hostID, change.roleFullnames); err != nil {
+			return fmt.Errorf("failed to update roles of %s: %s", change.hostName, err)
+		}
+		logger.Log("updated", fmt.Sprintf("%s [%s]", change.hostName, strings.Join(change.roleFullnames, ", ")))
+	}
+	return nil
+}
+
+func doRolesApply(c *cli.Context) error {
+	filePath := c.String("from")
+	if filePath == "" {
+		cli.ShowCommandHelp(c, "apply")
+		return cli.NewExitError("specify a mapping file with --from.", 1)
+	}
+	mapping, err := loadRolesMapping(filePath)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	client := newMackerelFromContext(c)
+	hosts, err := client.FindHosts(&mkr.FindHostsParam{Statuses: hostStatuses})
+	logger.DieIf(err)
+
+	changes, notFound, err := planRolesApply(filterRetiredHosts(hosts, false, false), mapping, c.Bool("prune"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	for _, entry := range notFound {
+		name := entry.ID
+		if name == "" {
+			name = entry.Name
+		}
+		logger.Log("warning", fmt.Sprintf("host %s is not found", name))
+	}
+	fmt.Printf("Summary: %d hosts to change\n\n", len(changes))
+	printRolesChanges(os.Stdout, changes)
+	if c.Bool("dry-run") {
+		return nil
+	}
+	logger.DieIf(applyRolesChanges(client, changes))
+	return nil
+}
+
+// loadRolesMapping loads the mapping file, whose entries should have an id or a name
+func loadRolesMapping(filePath string) ([]*HostFormat, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var mapping []*HostFormat
+	if err := json.NewDecoder(f).Decode(&mapping); err != nil {
+		return nil, err
+	}
+	for i, entry := range mapping {
+		if entry.ID == "" && entry.Name == "" {
+			return nil, fmt.Errorf("host #%d in %s should have 'id' or 'name'", i, filePath)
+		}
+	}
+	return mapping, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestPlanRolesApply(t *testing.T) {
+	hosts := []*mkr.Host{
+		{ID: "3XYyG", Name: "app01", Roles: mkr.Roles{"blog": {"app"}}},
+		{ID: "3XYyH", Name: "app02", Roles: mkr.Roles{"blog": {"app", "batch"}}},
+		{ID: "3XYyJ", Name: "db01", Roles: mkr.Roles{"blog": {"db"}}},
+		{ID: "3XYyK", Name: "db02", Roles: mkr.Roles{"blog": {"db"}}},
+	}
+	mapping := []*HostFormat{
+		{Name: "app01", RoleFullnames: []string{"blog:app", "blog:cache"}},
+		{ID: "3XYyH", RoleFullnames: []string{"blog:app"}},
+		{Name: "db01", RoleFullnames: []string{"blog:db"}},
+		{Name: "web01", RoleFullnames: []string{"blog:web"}},
+	}
+
+	changes, notFound, err := planRolesApply(hosts, mapping, false)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].hostID != "3XYyG" {
+		t.Fatalf("only app01 should be changed without --prune but got %+v", changes)
+	}
+	if want := []string{"blog:app", "blog:cache"}; !reflect.DeepEqual(changes[0].roleFullnames, want) {
+		t.Errorf("roles of app01 should be %v but got %v", want, changes[0].roleFullnames)
+	}
+	if len(notFound) != 1 || notFound[0].Name != "web01" {
+		t.Errorf("web01 should not be found but got %+v", notFound)
+	}
+
+	changes, _, _ = planRolesApply(hosts, mapping, true)
+	var buf bytes.Buffer
+	printRolesChanges(&buf, changes)
+	want := ` app01 (3XYyG)
++  blog:cache
+ app02 (3XYyH)
+-  blog:batch
+`
+	if buf.String() != want {
+		t.Errorf("changes should be:\n%s\nbut got:\n%s", want, buf.String())
+	}
+
+	updated := map[string][]string{}
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			RoleFullnames []string `json:"roleFullnames"`
+		}
+		json.NewDecoder(req.Body).Decode(&body)
+		updated[req.Method+" "+req.URL.Path] = body.RoleFullnames
+		w.Write([]byte(`{"success":true}`))
+	})
+	defer ts.Close()
+
+	if err := applyRolesChanges(client, changes); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	wantUpdated := map[string][]string{
+		"PUT /api/v0/hosts/3XYyG/role-fullnames": {"blog:app", "blog:cache"},
+		"PUT /api/v0/hosts/3XYyH/role-fullnames": {"blog:app"},
+	}
+	if !reflect.DeepEqual(updated, wantUpdated) {
+		t.Errorf("roles should be updated as %v but got %v", wantUpdated, updated)
+	}
+}
+
+func TestPlanRolesApply_ambiguousName(t *testing.T) {
+	hosts := []*mkr.Host{
+		{ID: "3XYyG", Name: "app01", Roles: mkr.Roles{"blog": {"app"}}},
+		{ID: "3XYyH", Name: "app01", Roles: mkr.Roles{"blog": {"app"}}},
+	}
+	_, _, err := planRolesApply(hosts, []*HostFormat{{Name: "app01", RoleFullnames: []string{"blog:cache"}}}, false)
+	if err == nil || !strings.Contains(err.Error(), "3XYyG, 3XYyH") {
+		t.Errorf("should raise error for the ambiguous name with the host IDs but got %v", err)
+	}
+
+	changes, _, err := planRolesApply(hosts, []*HostFormat{{ID: "3XYyH", RoleFullnames: []string{"blog:cache"}}}, false)
+	if err != nil || len(changes) != 1 || changes[0].hostID != "3XYyH" {
+		t.Errorf("the host specified by the id should be changed but got %+v, %v", changes, err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/httpclient"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// the replacement of secrets in outputs and exported files, which is the same as in verbose dumps
+const redactedValue = httpclient.Redacted
+
+// maskSecretsFlags returns the flags to switch masking of secrets.
+// If defaultOn, --mask-secrets is accepted only to be explicit.
+func maskSecretsFlags(defaultOn bool) []cli.Flag {
+	usage := "Mask secrets such as Authorization headers and webhook URLs with '***'"
+	if defaultOn {
+		usage += ". default: true"
+	}
+	return []cli.Flag{
+		cli.BoolFlag{Name: "mask-secrets", Usage: usage},
+		cli.BoolFlag{Name: "no-mask-secrets", Usage: "Output secrets as they are"},
+	}
+}
+
+func shouldMaskSecrets(c *cli.Context, defaultOn bool) bool {
+	if c.Bool("no-mask-secrets") {
+		return false
+	}
+	return defaultOn || c.Bool("mask-secrets")
+}
+
+// maskMonitorSecrets returns a copy of the monitor whose sensitive header values are masked.
+// Monitors without secrets are returned as they are.
+func maskMonitorSecrets(m mkr.Monitor) mkr.Monitor {
+	e, ok := m.(*mkr.MonitorExternalHTTP)
+	if !ok || e == nil {
+		return m
+	}
+	masked := *e
+	masked.Headers = make([]mkr.HeaderField, len(e.Headers))
+	for i, h := range e.Headers {
+		if httpclient.IsSensitiveHeader(h.Name) {
+			h.Value = redactedValue
+		}
+		masked.Headers[i] = h
+	}
+	return &masked
+}
+
+// hasMaskedSecrets returns whether the monitor has masked header values, which must not be pushed
+func hasMaskedSecrets(m mkr.Monitor) bool {
+	e, ok := m.(*mkr.MonitorExternalHTTP)
+	if !ok || e == nil {
+		return false
+	}
+	for _, h := range e.Headers {
+		if h.Value == redactedValue {
+			return true
+		}
+	}
+	return false
+}
+
+func maskMonitorsSecrets(monitors []mkr.Monitor) []mkr.Monitor {
+	masked := make([]mkr.Monitor, len(monitors))
+	for i, m := range monitors {
+		masked[i] = maskMonitorSecrets(m)
+	}
+	return masked
+}
+
+// maskChannelsSecrets returns copies of channels whose webhook URLs are masked
+func maskChannelsSecrets(channels []*channel) []*channel {
+	masked := make([]*channel, len(channels))
+	for i, ch := range channels {
+		copied := *ch
+		if copied.URL != "" {
+			copied.URL = redactedValue
+		}
+		masked[i] = &copied
+	}
+	return masked
+}
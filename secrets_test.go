@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestMaskMonitorSecrets_diff(t *testing.T) {
+	remote := &mkr.MonitorExternalHTTP{ID: "12345", Name: "foo", Type: "external", URL: "http://example.com", Service: "bar",
+		Headers: []mkr.HeaderField{{Name: "Authorization", Value: "Bearer remote-token"}, {Name: "Accept", Value: "text/html"}}}
+	local := &mkr.MonitorExternalHTTP{ID: "12345", Name: "foo", Type: "external", URL: "http://example.com/health", Service: "bar",
+		Headers: []mkr.HeaderField{{Name: "Authorization", Value: "Bearer local-token"}, {Name: "Accept", Value: "text/html"}}}
+
+	diff := diffMonitor(maskMonitorSecrets(remote), maskMonitorSecrets(local))
+	if diff == "" {
+		t.Fatalf("the difference of url should be shown")
+	}
+	if strings.Contains(diff, "remote-token") || strings.Contains(diff, "local-token") {
+		t.Errorf("the Authorization header should be masked but got:\n%s", diff)
+	}
+	if !strings.Contains(diff, `"value": "***"`) || !strings.Contains(diff, `"value": "text/html"`) {
+		t.Errorf("only the Authorization header should be masked but got:\n%s", diff)
+	}
+	if remote.Headers[0].Value != "Bearer remote-token" {
+		t.Errorf("the original monitor should not be modified but got %s", remote.Headers[0].Value)
+	}
+
+	host := &mkr.MonitorHostMetric{ID: "12346", Name: "cpu", Type: "host"}
+	if maskMonitorSecrets(host) != mkr.Monitor(host) {
+		t.Errorf("monitors without secrets should be returned as they are")
+	}
+
+	if !hasMaskedSecrets(maskMonitorSecrets(local)) || hasMaskedSecrets(local) || hasMaskedSecrets(host) {
+		t.Errorf("only monitors with masked values should be detected")
+	}
+}
+
+func TestMaskChannelsSecrets(t *testing.T) {
+	channels := []*channel{
+		{ID: "1", Name: "slack", Type: "slack", URL: "https://hooks.slack.com/services/secret"},
+		{ID: "2", Name: "mail", Type: "email", Emails: []string{"a@example.com"}},
+	}
+	masked := maskChannelsSecrets(channels)
+	if masked[0].URL != "***" || masked[1].URL != "" {
+		t.Errorf("only webhook urls should be masked but got %q and %q", masked[0].URL, masked[1].URL)
+	}
+	if channels[0].URL == redactedValue {
+		t.Errorf("the original channel should not be modified")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+var sparklineTicks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders values as unicode block characters scaled between their min and max
+func sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	min, max := values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	ticks := make([]rune, 0, len(values))
+	for _, v := range values {
+		i := 0
+		if max > min {
+			i = int((v-min)/(max-min)*float64(len(sparklineTicks)-1) + 0.5)
+		}
+		ticks = append(ticks, sparklineTicks[i])
+	}
+	return string(ticks)
+}
+
+// formatSparkline renders metric values as a sparkline annotated with the min and max values.
+// Values which are not numbers are skipped.
+func formatSparkline(metricValues []mkr.MetricValue) string {
+	var values []float64
+	for _, mv := range metricValues {
+		if v, ok := mv.Value.(float64); ok {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return "no data points"
+	}
+	min, max := values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	return fmt.Sprintf("%s min: %.2f max: %.2f", sparkline(values), min, max)
+}
+
+// terminalSupportsUnicode guesses whether the terminal can display unicode from the locale
+func terminalSupportsUnicode() bool {
+	for _, key := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(key); v != "" {
+			v = strings.ToLower(v)
+			return strings.Contains(v, "utf-8") || strings.Contains(v, "utf8")
+		}
+	}
+	return false
+}
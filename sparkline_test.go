@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestSparkline(t *testing.T) {
+	testCases := []struct {
+		values []float64
+		want   string
+	}{
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8}, "▁▂▃▄▅▆▇█"},
+		{[]float64{0, 100, 50, 0}, "▁█▅▁"},
+		{[]float64{3, 3, 3}, "▁▁▁"},
+		{[]float64{}, ""},
+	}
+
+	for _, testCase := range testCases {
+		if got := sparkline(testCase.values); got != testCase.want {
+			t.Errorf("sparkline(%v) should be %q but got %q", testCase.values, testCase.want, got)
+		}
+	}
+}
+
+func TestFormatSparkline(t *testing.T) {
+	metricValues := []mkr.MetricValue{
+		{Name: "loadavg5", Time: 1500000000, Value: 0.5},
+		{Name: "loadavg5", Time: 1500000060, Value: 1.5},
+		{Name: "loadavg5", Time: 1500000120, Value: 4.0},
+	}
+
+	want := "▁▃█ min: 0.50 max: 4.00"
+	if got := formatSparkline(metricValues); got != want {
+		t.Errorf("formatSparkline should be %q but got %q", want, got)
+	}
+}
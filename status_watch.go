@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mackerelio/mkr/logger"
+)
+
+// the escape sequence to move the cursor home and clear the screen
+const clearScreen = "\033[H\033[2J"
+
+// statusWatcher reprints the output of render every interval like watch(1)
+type statusWatcher struct {
+	render   func(w io.Writer) error
+	title    string
+	interval time.Duration
+	now      func() time.Time
+}
+
+// run refreshes the screen until a signal from sigCh, or maxRefreshes times if it's positive.
+// Errors of render are shown on the screen and the watching continues.
+func (sw *statusWatcher) run(w io.Writer, sigCh <-chan os.Signal, maxRefreshes int) error {
+	if sw.interval <= 0 {
+		return fmt.Errorf("interval should be positive: %s", sw.interval)
+	}
+	ticker := time.NewTicker(sw.interval)
+	defer ticker.Stop()
+	for i := 0; maxRefreshes <= 0 || i < maxRefreshes; i++ {
+		// render before clearing the screen not to flicker while requesting
+		var buf bytes.Buffer
+		if err := sw.render(&buf); err != nil {
+			fmt.Fprintln(&buf, err.Error())
+		}
+		fmt.Fprintf(w, "%sEvery %s: %s    %s\n\n", clearScreen, sw.interval, sw.title, outputTimeFormat.human(sw.now(), time.RFC3339))
+		if _, err := buf.WriteTo(w); err != nil {
+			return err
+		}
+		if maxRefreshes > 0 && i == maxRefreshes-1 {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case sig := <-sigCh:
+			logger.Log("", fmt.Sprintf("Received %s, stop watching", sig))
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusWatcherRun(t *testing.T) {
+	refreshes := 0
+	watcher := &statusWatcher{
+		render: func(w io.Writer) error {
+			refreshes++
+			if refreshes == 2 {
+				return errors.New("temporary error")
+			}
+			fmt.Fprintf(w, "refresh %d\n", refreshes)
+			return nil
+		},
+		title:    "mkr status 3XYyG",
+		interval: 10 * time.Millisecond,
+		now:      func() time.Time { return time.Date(2017, 11, 1, 9, 0, 0, 0, time.UTC) },
+	}
+
+	var buf bytes.Buffer
+	if err := watcher.run(&buf, nil, 3); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if refreshes != 3 {
+		t.Errorf("the host should be refreshed 3 times but got %d", refreshes)
+	}
+	out := buf.String()
+	if n := strings.Count(out, clearScreen); n != 3 {
+		t.Errorf("the screen should be cleared 3 times but got %d", n)
+	}
+	for _, want := range []string{"Every 10ms: mkr status 3XYyG    2017-11-01T09:00:00Z\n", "refresh 1\n", "temporary error\n", "refresh 3\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the output should contain %q but got:\n%s", want, out)
+		}
+	}
+
+	watcher.interval = 0
+	if err := watcher.run(&buf, nil, 1); err == nil {
+		t.Errorf("should raise error for non-positive interval")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandSummary = cli.Command{
+	Name:      "summary",
+	Usage:     "Summarize hosts by role and status",
+	ArgsUsage: "[--service | -s <service>] [--format | -f <format>] [--out <path>]",
+	Description: `
+    Show the number of hosts of each status (working, standby, maintenance and poweroff) per role, with a totals row.
+    A host belonging to multiple roles is counted in each role, but only once in the totals.
+    Requests "GET /api/v0/hosts". See https://mackerel.io/api-docs/entry/hosts#list .
+`,
+	Action: doSummary,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "service, s", Value: "", Usage: "Summarize hosts only belonging to <service>"},
+		cli.StringFlag{Name: "format, f", Value: "table", Usage: "Output format ('table' or 'json')"},
+		outFlag,
+	},
+}
+
+// all statuses of hosts which are not retired
+var hostStatuses = []string{"working", "standby", "maintenance", "poweroff"}
+
+const noRoleName = "(no role)"
+
+type roleSummary struct {
+	Role        string `json:"role"`
+	Working     int    `json:"working"`
+	Standby     int    `json:"standby"`
+	Maintenance int    `json:"maintenance"`
+	Poweroff    int    `json:"poweroff"`
+}
+
+func (r *roleSummary) add(status string) {
+	switch status {
+	case "working":
+		r.Working++
+	case "standby":
+		r.Standby++
+	case "maintenance":
+		r.Maintenance++
+	case "poweroff":
+		r.Poweroff++
+	}
+}
+
+type hostsSummary struct {
+	Roles []*roleSummary `json:"roles"`
+	Total *roleSummary   `json:"total"`
+}
+
+func summarizeHosts(hosts []*mkr.Host) *hostsSummary {
+	roles := map[string]*roleSummary{}
+	total := &roleSummary{Role: "total"}
+	for _, host := range hosts {
+		roleFullnames := host.GetRoleFullnames()
+		if len(roleFullnames) == 0 {
+			roleFullnames = []string{noRoleName}
+		}
+		for _, roleFullname := range roleFullnames {
+			if _, ok := roles[roleFullname]; !ok {
+				roles[roleFullname] = &roleSummary{Role: roleFullname}
+			}
+			roles[roleFullname].add(host.Status)
+		}
+		total.add(host.Status)
+	}
+
+	summary := &hostsSummary{Roles: make([]*roleSummary, 0, len(roles)), Total: total}
+	for _, r := range roles {
+		summary.Roles = append(summary.Roles, r)
+	}
+	sort.Slice(summary.Roles, func(i, j int) bool {
+		return summary.Roles[i].Role < summary.Roles[j].Role
+	})
+	return summary
+}
+
+func printHostsSummary(w io.Writer, summary *hostsSummary) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROLE\tWORKING\tSTANDBY\tMAINTENANCE\tPOWEROFF")
+	for _, r := range append(summary.Roles, summary.Total) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", r.Role, r.Working, r.Standby, r.Maintenance, r.Poweroff)
+	}
+	tw.Flush()
+}
+
+func doSummary(c *cli.Context) error {
+	format := c.String("format")
+	if format != "table" && format != "json" {
+		return cli.NewExitError(fmt.Sprintf("unknown format: %s", format), 1)
+	}
+
+	hosts, err := newMackerelFromContext(c).FindHosts(&mkr.FindHostsParam{
+		Service:  c.String("service"),
+		Statuses: hostStatuses,
+	})
+	logger.DieIf(err)
+
+	summary := summarizeHosts(hosts)
+	logger.DieIf(writeOutput(c.String("out"), func(w io.Writer) error {
+		if format == "json" {
+			fprettyPrintJSON(w, summary)
+		} else {
+			printHostsSummary(w, summary)
+		}
+		return nil
+	}))
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestSummarizeHosts(t *testing.T) {
+	hosts := []*mkr.Host{
+		{ID: "1", Status: "working", Roles: mkr.Roles{"foo": {"app"}}},
+		{ID: "2", Status: "working", Roles: mkr.Roles{"foo": {"app", "batch"}}},
+		{ID: "3", Status: "standby", Roles: mkr.Roles{"foo": {"app"}}},
+		{ID: "4", Status: "maintenance", Roles: mkr.Roles{"bar": {"db"}}},
+		{ID: "5", Status: "poweroff", Roles: mkr.Roles{"foo": {"batch"}}},
+		{ID: "6", Status: "working"},
+	}
+
+	summary := summarizeHosts(hosts)
+
+	expected := &hostsSummary{
+		Roles: []*roleSummary{
+			{Role: noRoleName, Working: 1},
+			{Role: "bar:db", Maintenance: 1},
+			{Role: "foo:app", Working: 2, Standby: 1},
+			{Role: "foo:batch", Working: 1, Poweroff: 1},
+		},
+		Total: &roleSummary{Role: "total", Working: 3, Standby: 1, Maintenance: 1, Poweroff: 1},
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("summary should be:\n%s\nbut got:\n%s", JSONMarshalIndent(expected, "", "  "), JSONMarshalIndent(summary, "", "  "))
+	}
+
+	var buf bytes.Buffer
+	printHostsSummary(&buf, summary)
+	want := `ROLE       WORKING  STANDBY  MAINTENANCE  POWEROFF
+(no role)  1        0        0            0
+bar:db     0        0        1            0
+foo:app    2        1        0            0
+foo:batch  1        0        0            1
+total      3        1        1            1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("table should be:\n%s\nbut got:\n%s", want, got)
+	}
+}
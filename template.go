@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are helper functions available in --template
+var templateFuncs = template.FuncMap{
+	// join concatenates the elements, e.g. {{.GetRoleFullnames | join ","}}
+	"join": func(sep string, a []string) string {
+		return strings.Join(a, sep)
+	},
+	// default returns def if the value is empty, e.g. {{.DisplayName | default "-"}}
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || reflect.DeepEqual(v, reflect.Zero(reflect.TypeOf(v)).Interface()) {
+			return def
+		}
+		if rv := reflect.ValueOf(v); (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Map) && rv.Len() == 0 {
+			return def
+		}
+		return v
+	},
+}
+
+// parseItemTemplate parses the template rendered for each item.
+// A newline is appended to the output of each item unless the template ends with it.
+func parseItemTemplate(text string) (*template.Template, error) {
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	tmpl, err := template.New("template").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %s", err)
+	}
+	return tmpl, nil
+}
+
+// renderItems renders each element of the slice items with the template
+func renderItems(w io.Writer, tmpl *template.Template, items interface{}) error {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		return tmpl.Execute(w, items)
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := tmpl.Execute(w, v.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
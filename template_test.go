@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestRenderItems(t *testing.T) {
+	hosts := []*mkr.Host{
+		{ID: "3XYyG", Name: "app01.example.com", DisplayName: "app01", Status: "working", Roles: mkr.Roles{"foo": {"app"}}},
+		{ID: "3XYyH", Name: "db01.example.com", Status: "standby", Roles: mkr.Roles{"foo": {"db"}}},
+		{ID: "3XYyI", Name: "standalone.example.com", Status: "working"},
+	}
+
+	tmpl, err := parseItemTemplate(`{{.ID}} {{.DisplayName | default .Name}} {{.GetRoleFullnames | join "," | default "(no role)"}}`)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := renderItems(&buf, tmpl, hosts); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	expected := `3XYyG app01 foo:app
+3XYyH db01.example.com foo:db
+3XYyI standalone.example.com (no role)
+`
+	if buf.String() != expected {
+		t.Errorf("output should be:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+
+	if _, err := parseItemTemplate("{{.ID"); err == nil {
+		t.Errorf("should raise error for an invalid template")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+// metricAggregators combine values of the same metric of multiple hosts into a value
+var metricAggregators = map[string]func(values []float64) float64{
+	"sum": func(values []float64) float64 {
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	},
+	"avg": func(values []float64) float64 {
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	},
+	"max": func(values []float64) float64 {
+		max := math.Inf(-1)
+		for _, v := range values {
+			max = math.Max(max, v)
+		}
+		return max
+	},
+	"min": func(values []float64) float64 {
+		min := math.Inf(1)
+		for _, v := range values {
+			min = math.Min(min, v)
+		}
+		return min
+	},
+}
+
+func metricAggregatorNames() []string {
+	var names []string
+	for name := range metricAggregators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// aggregateLatestMetricValues aggregates the latest values of the metric of all hosts into a service metric value
+// of the same name at the newest time of them. Hosts without the value of the metric are ignored.
+func aggregateLatestMetricValues(latest mkr.LatestMetricValues, name, aggregate string) (*mkr.MetricValue, error) {
+	aggregator, ok := metricAggregators[aggregate]
+	if !ok {
+		return nil, fmt.Errorf("unknown aggregate function: %s", aggregate)
+	}
+	var values []float64
+	var newest int64
+	for _, metricValues := range latest {
+		mv, ok := metricValues[name]
+		if !ok || mv == nil {
+			continue
+		}
+		v, ok := mv.Value.(float64)
+		if !ok {
+			continue
+		}
+		values = append(values, v)
+		if mv.Time > newest {
+			newest = mv.Time
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no host has the value of %s", name)
+	}
+	return &mkr.MetricValue{Name: name, Value: aggregator(values), Time: newest}, nil
+}
+
+// fetchAndAggregateMetric fetches the latest values of the metric of hosts in the roles of the service,
+// and aggregates them by aggregateLatestMetricValues.
+func fetchAndAggregateMetric(client *mkr.Client, service string, roles []string, name, aggregate string) (*mkr.MetricValue, error) {
+	hosts, err := client.FindHosts(&mkr.FindHostsParam{Service: service, Roles: roles})
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no host belongs to the roles of %s", service)
+	}
+	hostIDs := make([]string, len(hosts))
+	for i, host := range hosts {
+		hostIDs[i] = host.ID
+	}
+	fetcher := &latestMetricValuesFetcher{fetch: client.FetchLatestMetricValues, chunkSize: fetchChunkSize}
+	latest, errs := fetcher.run(hostIDs, []string{name})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to fetch metric values of %d hosts", len(errs))
+	}
+	return aggregateLatestMetricValues(latest, name, aggregate)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestAggregateLatestMetricValues(t *testing.T) {
+	latest := mkr.LatestMetricValues{
+		"3XYyG": {"custom.requests": {Name: "custom.requests", Value: 12.5, Time: 1500000000}},
+		"3XYyH": {"custom.requests": {Name: "custom.requests", Value: 7.5, Time: 1500000060}},
+		"3XYyJ": {"custom.requests": nil},
+	}
+
+	metricValue, err := aggregateLatestMetricValues(latest, "custom.requests", "sum")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if metricValue.Name != "custom.requests" || metricValue.Value != 20.0 || metricValue.Time != 1500000060 {
+		t.Errorf("the sum should be 20.0 at the newest time but got %+v", metricValue)
+	}
+
+	for aggregate, want := range map[string]float64{"avg": 10.0, "max": 12.5, "min": 7.5} {
+		metricValue, err := aggregateLatestMetricValues(latest, "custom.requests", aggregate)
+		if err != nil {
+			t.Errorf("%s should not raise error: %v", aggregate, err)
+			continue
+		}
+		if metricValue.Value != want {
+			t.Errorf("%s should be %f but got %v", aggregate, want, metricValue.Value)
+		}
+	}
+
+	if _, err := aggregateLatestMetricValues(latest, "custom.unknown", "sum"); err == nil {
+		t.Errorf("should raise error if no host has the value")
+	}
+}
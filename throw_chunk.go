@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+)
+
+// the default number of metric values posted by a request of throw
+const defaultThrowChunkSize = 1000
+
+// postInChunks posts metric values sequentially in chunks of chunkSize values.
+// It stops at the first failed chunk unless continueOnError, and returns an error if any chunk failed.
+func postInChunks(post func([]*mkr.MetricValue) error, metricValues []*mkr.MetricValue, chunkSize int, continueOnError bool) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("chunk size should be positive: %d", chunkSize)
+	}
+	chunks := (len(metricValues) + chunkSize - 1) / chunkSize
+	failed := 0
+	for i := 0; i < chunks; i++ {
+		start, end := i*chunkSize, (i+1)*chunkSize
+		if end > len(metricValues) {
+			end = len(metricValues)
+		}
+		if err := post(metricValues[start:end]); err != nil {
+			if !continueOnError {
+				return fmt.Errorf("failed to post chunk %d/%d: %s", i+1, chunks, err)
+			}
+			logger.Log("error", fmt.Sprintf("failed to post chunk %d/%d: %s", i+1, chunks, err))
+			failed++
+			continue
+		}
+		if chunks > 1 {
+			logger.Log("info", fmt.Sprintf("posted chunk %d/%d (%d metric values)", i+1, chunks, end-start))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to post %d of %d chunks", failed, chunks)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestPostInChunks(t *testing.T) {
+	var metricValues []*mkr.MetricValue
+	for i := 0; i < 2500; i++ {
+		metricValues = append(metricValues, &mkr.MetricValue{Name: "custom.foo", Value: float64(i), Time: 1500000000 + int64(i)})
+	}
+
+	recorder := &postRecorder{}
+	if err := postInChunks(recorder.post, metricValues, 1000, false); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(recorder.batches) != 3 {
+		t.Fatalf("metric values should be posted in 3 chunks but got %d", len(recorder.batches))
+	}
+	for i, want := range []int{1000, 1000, 500} {
+		if len(recorder.batches[i]) != want {
+			t.Errorf("chunk %d should have %d values but got %d", i+1, want, len(recorder.batches[i]))
+		}
+	}
+	if recorder.count() != 2500 || recorder.batches[2][499].Time != 1500002499 {
+		t.Errorf("all metric values should be posted in order")
+	}
+
+	calls := 0
+	failSecond := func(metricValues []*mkr.MetricValue) error {
+		calls++
+		if calls == 2 {
+			return errors.New("payload too large")
+		}
+		return nil
+	}
+	if err := postInChunks(failSecond, metricValues, 1000, false); err == nil || calls != 2 {
+		t.Errorf("posting should stop at the failed chunk but called %d times (%v)", calls, err)
+	}
+	calls = 0
+	if err := postInChunks(failSecond, metricValues, 1000, true); err == nil || calls != 3 {
+		t.Errorf("the remaining chunks should be posted with continueOnError but called %d times (%v)", calls, err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// fileFollower reads lines appended to a file like "tail -f", and never returns io.EOF until stopped.
+// Reading starts at the end of the file. When the file is truncated, it is read again from the beginning,
+// and when the file is replaced by rotation, the new file is read from the beginning.
+type fileFollower struct {
+	path     string
+	interval time.Duration
+	stop     <-chan struct{}
+
+	file   *os.File
+	offset int64
+}
+
+func newFileFollower(path string, interval time.Duration, stop <-chan struct{}) (*fileFollower, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &fileFollower{path: path, interval: interval, stop: stop, file: file, offset: offset}, nil
+}
+
+func (f *fileFollower) Read(p []byte) (int, error) {
+	for {
+		if f.file != nil {
+			n, err := f.file.Read(p)
+			f.offset += int64(n)
+			if n > 0 {
+				return n, nil
+			}
+			if err != nil && err != io.EOF {
+				return 0, err
+			}
+			if f.reopen() {
+				continue
+			}
+		} else if file, err := os.Open(f.path); err == nil {
+			f.file, f.offset = file, 0
+			continue
+		}
+
+		select {
+		case <-f.stop:
+			return 0, io.EOF
+		case <-time.After(f.interval):
+		}
+	}
+}
+
+// reopen handles truncation and rotation of the file, and returns whether there may be more to read
+func (f *fileFollower) reopen() bool {
+	current, err := f.file.Stat()
+	if err != nil {
+		return false
+	}
+	latest, err := os.Stat(f.path)
+	if err != nil {
+		// the file is moved and not yet recreated
+		return false
+	}
+	if !os.SameFile(current, latest) {
+		// the rotated file has been read to the end, so switch to the new one
+		f.file.Close()
+		f.file = nil
+		return true
+	}
+	if latest.Size() < f.offset {
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return false
+		}
+		f.offset = 0
+		return true
+	}
+	return false
+}
+
+// Close closes the file being read
+func (f *fileFollower) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
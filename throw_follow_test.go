@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitPosted(t *testing.T, recorder *postRecorder, n int) {
+	for i := 0; i < 100 && recorder.count() < n; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := recorder.count(); got != n {
+		t.Fatalf("%d metric values should be posted but got %d", n, got)
+	}
+}
+
+func TestFileFollower(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkr-follow")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.log")
+	if err := ioutil.WriteFile(path, []byte("old.value 1 1397031808\n"), 0644); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+
+	stop := make(chan struct{})
+	follower, err := newFileFollower(path, 10*time.Millisecond, stop)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer follower.Close()
+
+	recorder := &postRecorder{}
+	streamer := &metricStreamer{post: recorder.post, flushInterval: 20 * time.Millisecond, batchSize: 100}
+	done := make(chan error)
+	go func() { done <- streamer.run(follower, nil) }()
+
+	appendLines := func(path string, lines ...string) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatalf("should not raise error: %v", err)
+		}
+		defer f.Close()
+		for _, line := range lines {
+			fmt.Fprintln(f, line)
+		}
+	}
+
+	appendLines(path, "foo.bar 1 1397031808", "foo.bar 2 1397031868")
+	waitPosted(t, recorder, 2)
+
+	// truncated
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	appendLines(path, "foo.bar 3 1397031928")
+	waitPosted(t, recorder, 3)
+
+	// rotated
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	appendLines(path, "foo.bar 4 1397031988")
+	waitPosted(t, recorder, 4)
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	for _, batch := range recorder.batches {
+		for _, metricValue := range batch {
+			if metricValue.Name != "foo.bar" {
+				t.Errorf("lines written before following should not be posted but got %s", metricValue.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+)
+
+// postMetricValuesGzip posts metric values with the gzip-compressed request body.
+// If the server rejects the compressed body, they are posted again without compression by fallback.
+func postMetricValuesGzip(client *mkr.Client, hostID, service string, metricValues []*mkr.MetricValue, fallback func([]*mkr.MetricValue) error) error {
+	var path string
+	var payload interface{}
+	if hostID != "" {
+		path = "/api/v0/tsdb"
+		hostMetricValues := make([]*mkr.HostMetricValue, 0, len(metricValues))
+		for _, metricValue := range metricValues {
+			hostMetricValues = append(hostMetricValues, &mkr.HostMetricValue{HostID: hostID, MetricValue: metricValue})
+		}
+		payload = hostMetricValues
+	} else {
+		path = fmt.Sprintf("/api/v0/services/%s/tsdb", url.PathEscape(service))
+		payload = metricValues
+	}
+
+	err := requestGzipJSON(client, "POST", path, payload, nil)
+	if apiErr, ok := err.(*mkr.APIError); ok && (apiErr.StatusCode == http.StatusUnsupportedMediaType || apiErr.StatusCode == http.StatusBadRequest) {
+		logger.Log("warning", fmt.Sprintf("the compressed request is rejected, retrying without compression: %s", err))
+		return fallback(metricValues)
+	}
+	return err
+}
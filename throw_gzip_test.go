@@ -0,0 +1,67 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestPostMetricValuesGzip(t *testing.T) {
+	var encoding string
+	var posted []map[string]interface{}
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v0/tsdb" {
+			t.Errorf("request path should be /api/v0/tsdb but got %s", req.URL.Path)
+		}
+		encoding = req.Header.Get("Content-Encoding")
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			t.Errorf("request body should be gzipped: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(zr).Decode(&posted)
+		fmt.Fprint(w, `{"success":true}`)
+	})
+	defer ts.Close()
+
+	metricValues := []*mkr.MetricValue{{Name: "custom.tcp.CLOSING", Value: 1.5, Time: 1397031808}}
+	fallback := func([]*mkr.MetricValue) error {
+		t.Errorf("fallback should not be called")
+		return nil
+	}
+	if err := postMetricValuesGzip(client, "3XYyG", "", metricValues, fallback); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if encoding != "gzip" {
+		t.Errorf("Content-Encoding should be gzip but got %q", encoding)
+	}
+	if len(posted) != 1 || posted[0]["hostId"] != "3XYyG" || posted[0]["name"] != "custom.tcp.CLOSING" {
+		t.Errorf("host metric values should be posted but got %v", posted)
+	}
+}
+
+func TestPostMetricValuesGzip_fallback(t *testing.T) {
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		fmt.Fprint(w, `{"error":{"message":"Unsupported Content-Encoding"}}`)
+	})
+	defer ts.Close()
+
+	called := false
+	fallback := func([]*mkr.MetricValue) error {
+		called = true
+		return nil
+	}
+	metricValues := []*mkr.MetricValue{{Name: "foo.bar", Value: 1, Time: 1397031808}}
+	if err := postMetricValuesGzip(client, "", "blog", metricValues, fallback); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if !called {
+		t.Errorf("metric values should be posted without compression when the server rejects gzip")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+)
+
+// characters allowed in metric names
+var metricNamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// validateMetricNamePrefix checks the prefix of --prefix
+func validateMetricNamePrefix(prefix string) error {
+	if !metricNamePattern.MatchString(prefix) || strings.HasPrefix(prefix, ".") || strings.HasSuffix(prefix, ".") {
+		return fmt.Errorf("invalid --prefix: %q (it should consist of alphanumerics, '.', '_' and '-', and not start or end with '.')", prefix)
+	}
+	return nil
+}
+
+// prefixMetricName prepends the prefix and a dot to the metric name, after "custom." if the name has it.
+// For example, "custom.foo" becomes "custom.subsystem.foo" with the prefix "subsystem".
+func prefixMetricName(name, prefix string) (string, error) {
+	if strings.HasPrefix(name, "custom.") {
+		name = "custom." + prefix + "." + strings.TrimPrefix(name, "custom.")
+	} else {
+		name = prefix + "." + name
+	}
+	if !metricNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid metric name: %q", name)
+	}
+	return name, nil
+}
+
+// prefixMetricValues returns metric values with their names prefixed.
+// Values whose names are invalid are dropped with warnings.
+func prefixMetricValues(metricValues []*mkr.MetricValue, prefix string) []*mkr.MetricValue {
+	prefixed := make([]*mkr.MetricValue, 0, len(metricValues))
+	for _, metricValue := range metricValues {
+		name, err := prefixMetricName(metricValue.Name, prefix)
+		if err != nil {
+			logger.Log("warning", err.Error())
+			continue
+		}
+		prefixed = append(prefixed, &mkr.MetricValue{Name: name, Value: metricValue.Value, Time: metricValue.Time})
+	}
+	return prefixed
+}
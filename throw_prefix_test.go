@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestThrowDryRun_prefix(t *testing.T) {
+	input := strings.Join([]string{
+		"custom.foo 1 1397031808",
+		"bar.baz 2 1397031808",
+		"qux/quux 3 1397031808",
+	}, "\n")
+
+	var out, errOut bytes.Buffer
+	if err := throwDryRun(strings.NewReader(input), &out, &errOut, true, "subsystem", nil); err == nil {
+		t.Errorf("should raise error for the invalid metric name")
+	}
+	want := "custom.subsystem.foo\t1\t1397031808\ncustom.subsystem.bar.baz\t2\t1397031808\n"
+	if got := out.String(); got != want {
+		t.Errorf("metric names should be prefixed:\n%s\nbut got:\n%s", want, got)
+	}
+	if !strings.Contains(errOut.String(), `line 3: invalid metric name: "custom.subsystem.qux/quux"`) {
+		t.Errorf("the invalid metric name should be reported but got:\n%s", errOut.String())
+	}
+
+	out.Reset()
+	errOut.Reset()
+	if err := throwDryRun(strings.NewReader("foo.bar 1 1397031808\n"), &out, &errOut, false, "sub.system", nil); err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if got := out.String(); got != "sub.system.foo.bar\t1\t1397031808\n" {
+		t.Errorf("service metric name should be prefixed but got %q", got)
+	}
+}
+
+func TestPrefixMetricValues(t *testing.T) {
+	metricValues := []*mkr.MetricValue{
+		{Name: "custom.foo", Value: 1, Time: 1397031808},
+		{Name: "custom.foo bar", Value: 2, Time: 1397031808},
+	}
+	prefixed := prefixMetricValues(metricValues, "subsystem")
+	if len(prefixed) != 1 || prefixed[0].Name != "custom.subsystem.foo" || prefixed[0].Value != 1 {
+		t.Errorf("only the valid metric value should be prefixed but got %+v", prefixed)
+	}
+	if metricValues[0].Name != "custom.foo" {
+		t.Errorf("the original metric value should not be modified but got %q", metricValues[0].Name)
+	}
+
+	for _, prefix := range []string{"", ".sub", "sub.", "sub system"} {
+		if err := validateMetricNamePrefix(prefix); err == nil {
+			t.Errorf("validateMetricNamePrefix(%q) should raise error", prefix)
+		}
+	}
+}
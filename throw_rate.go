@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+// the behaviors of --rate when a counter decreases
+const (
+	rateResetSkip = "skip"
+	rateResetZero = "zero"
+)
+
+// ratePoint is the previous value of a counter
+type ratePoint struct {
+	Value float64 `json:"value"`
+	Time  int64   `json:"time"`
+}
+
+// rateConverter converts counter values to per-second rates,
+// keeping the previous values of counters in the state file across invocations.
+type rateConverter struct {
+	stateFile string
+	target    string
+	onReset   string
+	prev      map[string]*ratePoint
+}
+
+func newRateConverter(stateFile, target, onReset string) (*rateConverter, error) {
+	if onReset != rateResetSkip && onReset != rateResetZero {
+		return nil, fmt.Errorf("--on-reset should be '%s' or '%s': %s", rateResetSkip, rateResetZero, onReset)
+	}
+	r := &rateConverter{stateFile: stateFile, target: target, onReset: onReset, prev: map[string]*ratePoint{}}
+	content, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &r.prev); err != nil {
+		return nil, fmt.Errorf("failed to parse the state file %s: %s", stateFile, err)
+	}
+	return r, nil
+}
+
+// key distinguishes the same metric names of different hosts or services
+func (r *rateConverter) key(name string) string {
+	return r.target + "\t" + name
+}
+
+// convert returns rates of metricValues from the previous values, and the points to be the next previous values.
+// No rate is returned for the first value of a metric, and values not newer than the previous one are ignored.
+// The previous values are kept until advance, so that values failed to be posted are converted again.
+func (r *rateConverter) convert(metricValues []*mkr.MetricValue) ([]*mkr.MetricValue, map[string]*ratePoint) {
+	var rates []*mkr.MetricValue
+	points := map[string]*ratePoint{}
+	for _, metricValue := range metricValues {
+		value, ok := metricValue.Value.(float64)
+		if !ok {
+			continue
+		}
+		key := r.key(metricValue.Name)
+		prev := points[key]
+		if prev == nil {
+			prev = r.prev[key]
+		}
+		if prev != nil && metricValue.Time <= prev.Time {
+			continue
+		}
+		points[key] = &ratePoint{Value: value, Time: metricValue.Time}
+		if prev == nil {
+			continue
+		}
+		if value < prev.Value {
+			if r.onReset == rateResetZero {
+				rates = append(rates, &mkr.MetricValue{Name: metricValue.Name, Value: 0.0, Time: metricValue.Time})
+			}
+			continue
+		}
+		rate := (value - prev.Value) / float64(metricValue.Time-prev.Time)
+		rates = append(rates, &mkr.MetricValue{Name: metricValue.Name, Value: rate, Time: metricValue.Time})
+	}
+	return rates, points
+}
+
+// advance updates the previous values by the points returned by convert, without saving them
+func (r *rateConverter) advance(points map[string]*ratePoint) {
+	for key, point := range points {
+		if prev := r.prev[key]; prev == nil || prev.Time < point.Time {
+			r.prev[key] = point
+		}
+	}
+}
+
+// save writes the previous values to the state file
+func (r *rateConverter) save() error {
+	data, err := json.Marshal(r.prev)
+	if err != nil {
+		return err
+	}
+	return writeOutput(r.stateFile, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
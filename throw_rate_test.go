@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestRateConverter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkr-rate")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	r, err := newRateConverter(stateFile, "3XYyG", rateResetSkip)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	rates, points := r.convert([]*mkr.MetricValue{{Name: "custom.requests", Value: 100.0, Time: 1500000000}})
+	if len(rates) != 0 {
+		t.Errorf("no rate should be computed from the first value but got %d", len(rates))
+	}
+	r.advance(points)
+	if err := r.save(); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+
+	// the previous value is restored from the state file
+	r, err = newRateConverter(stateFile, "3XYyG", rateResetSkip)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	rates, points = r.convert([]*mkr.MetricValue{{Name: "custom.requests", Value: 700.0, Time: 1500000060}})
+	if len(rates) != 1 {
+		t.Fatalf("a rate should be computed but got %d", len(rates))
+	}
+	if rates[0].Value != 10.0 || rates[0].Time != 1500000060 || rates[0].Name != "custom.requests" {
+		t.Errorf("the rate should be 10 at 1500000060 but got %v at %d", rates[0].Value, rates[0].Time)
+	}
+	// the values failed to be posted are converted again, since the previous values are not advanced
+	if rates, _ := r.convert([]*mkr.MetricValue{{Name: "custom.requests", Value: 700.0, Time: 1500000060}}); len(rates) != 1 || rates[0].Value != 10.0 {
+		t.Errorf("the rate should be computed again before advance but got %v", rates)
+	}
+	r.advance(points)
+
+	rates, points = r.convert([]*mkr.MetricValue{{Name: "custom.requests", Value: 5.0, Time: 1500000120}})
+	if len(rates) != 0 {
+		t.Errorf("no rate should be posted on a counter reset but got %v", rates[0].Value)
+	}
+	r.advance(points)
+
+	r.onReset = rateResetZero
+	rates, _ = r.convert([]*mkr.MetricValue{{Name: "custom.requests", Value: 1.0, Time: 1500000180}})
+	if len(rates) != 1 || rates[0].Value != 0.0 {
+		t.Errorf("zero should be posted on a counter reset with %q", rateResetZero)
+	}
+
+	if _, err := newRateConverter(stateFile, "3XYyG", "unknown"); err == nil {
+		t.Errorf("should raise error for unknown --on-reset")
+	}
+}
+
+func TestThrowDryRun_rate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkr-rate")
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+	ioutil.WriteFile(stateFile, []byte(`{"3XYyG\tcustom.requests":{"value":100,"time":1500000000}}`), 0644)
+
+	r, err := newRateConverter(stateFile, "3XYyG", rateResetSkip)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	var out, errOut bytes.Buffer
+	input := "requests 700 1500000060\nrequests 1900 1500000120\n"
+	if err := throwDryRun(strings.NewReader(input), &out, &errOut, true, "", r); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if want := "custom.requests\t10\t1500000060\ncustom.requests\t20\t1500000120\n"; out.String() != want {
+		t.Errorf("rates should be output as %q but got %q", want, out.String())
+	}
+	if content, _ := ioutil.ReadFile(stateFile); !strings.Contains(string(content), `"time":1500000000`) {
+		t.Errorf("the state file should not be updated by the dry run but got %s", content)
+	}
+}
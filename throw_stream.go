@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+)
+
+// metricStreamer posts metric values read from a stream in batches,
+// every flushInterval or when batchSize values are buffered.
+type metricStreamer struct {
+	post          func([]*mkr.MetricValue) error
+	flushInterval time.Duration
+	batchSize     int
+	hostMetric    bool
+	// the maximum number of buffered values, over which the oldest values are dropped. Zero means unlimited.
+	maxBuffered int
+}
+
+// the maximum number of buffered values of `mkr throw --stream`, for the API being unavailable for long
+const streamMaxBuffered = 100000
+
+// run reads metric values from r until EOF or a signal from sigCh, and flushes buffered values at last.
+// Values which failed to be posted are kept in the buffer and retried every flushInterval,
+// without flushing by batchSize until the retry succeeds.
+func (s *metricStreamer) run(r io.Reader, sigCh <-chan os.Signal) error {
+	if s.flushInterval <= 0 {
+		return fmt.Errorf("flush interval should be positive: %s", s.flushInterval)
+	}
+
+	lines := make(chan string)
+	scanErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		scanErr <- scanner.Err()
+		close(lines)
+	}()
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	var buffer []*mkr.MetricValue
+	// whether the last flush failed, when values are flushed only by the ticker
+	failing := false
+	dropped := 0
+	flush := func() error {
+		if len(buffer) == 0 {
+			return nil
+		}
+		if err := s.post(buffer); err != nil {
+			failing = true
+			return err
+		}
+		buffer = nil
+		failing = false
+		if dropped > 0 {
+			logger.Log("warning", fmt.Sprintf("Dropped %d metric values while failing to post", dropped))
+			dropped = 0
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				logger.ErrorIf(<-scanErr)
+				return flush()
+			}
+			metricValue, err := parseMetricLine(line, s.hostMetric)
+			if err != nil {
+				warnMalformedMetricLine(err)
+			} else if metricValue != nil {
+				buffer = append(buffer, metricValue)
+				if s.maxBuffered > 0 && len(buffer) > s.maxBuffered {
+					if dropped == 0 {
+						logger.Log("warning", fmt.Sprintf("Dropping the oldest metric values since over %d values are buffered", s.maxBuffered))
+					}
+					buffer = buffer[1:]
+					dropped++
+				}
+			}
+			if !failing && s.batchSize > 0 && len(buffer) >= s.batchSize {
+				if err := flush(); err != nil {
+					logger.Log("error", fmt.Sprintf("Failed to post metric values, retrying later: %s", err))
+				}
+			}
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				logger.Log("error", fmt.Sprintf("Failed to post metric values, retrying later: %s", err))
+			}
+		case sig := <-sigCh:
+			logger.Log("", fmt.Sprintf("Received %s, flushing buffered metric values", sig))
+			return flush()
+		}
+	}
+}
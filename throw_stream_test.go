@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+type postRecorder struct {
+	mu      sync.Mutex
+	batches [][]*mkr.MetricValue
+}
+
+func (r *postRecorder) post(metricValues []*mkr.MetricValue) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, metricValues)
+	return nil
+}
+
+func (r *postRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, batch := range r.batches {
+		n += len(batch)
+	}
+	return n
+}
+
+func TestMetricStreamerRun_flushInterval(t *testing.T) {
+	pr, pw := io.Pipe()
+	recorder := &postRecorder{}
+	streamer := &metricStreamer{post: recorder.post, flushInterval: 20 * time.Millisecond, batchSize: 100, hostMetric: true}
+
+	done := make(chan error)
+	go func() { done <- streamer.run(pr, nil) }()
+
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(pw, "tcp.CLOSING %d 1397031808\n", i)
+		time.Sleep(60 * time.Millisecond)
+	}
+	fmt.Fprintln(pw, "tcp.CLOSING 3 1397031808")
+	pw.Close()
+
+	if err := <-done; err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(recorder.batches) < 3 {
+		t.Errorf("metric values should be flushed multiple times but got %d flushes", len(recorder.batches))
+	}
+	if n := recorder.count(); n != 4 {
+		t.Errorf("all metric values should be posted but got %d", n)
+	}
+	if name := recorder.batches[0][0].Name; name != "custom.tcp.CLOSING" {
+		t.Errorf("host metric name should be prefixed but got %s", name)
+	}
+}
+
+func TestMetricStreamerRun_batchSizeAndSignal(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	recorder := &postRecorder{}
+	streamer := &metricStreamer{post: recorder.post, flushInterval: time.Hour, batchSize: 2}
+
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan error)
+	go func() { done <- streamer.run(pr, sigCh) }()
+
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(pw, "foo.bar %d 1397031808\n", i)
+	}
+	// the blank line is read after the last value is received by the streamer
+	fmt.Fprintln(pw)
+	sigCh <- os.Interrupt
+
+	if err := <-done; err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(recorder.batches) != 3 {
+		t.Errorf("metric values should be flushed 3 times but got %d", len(recorder.batches))
+	}
+	if n := recorder.count(); n != 5 {
+		t.Errorf("buffered metric values should be flushed on the signal but got %d", n)
+	}
+}
+
+func TestMetricStreamerRun_retryOnFlushInterval(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	var mu sync.Mutex
+	var attempts int
+	var posted []*mkr.MetricValue
+	post := func(metricValues []*mkr.MetricValue) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			return fmt.Errorf("service unavailable")
+		}
+		posted = append(posted, metricValues...)
+		return nil
+	}
+	streamer := &metricStreamer{post: post, flushInterval: time.Hour, batchSize: 1, maxBuffered: 3}
+
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan error)
+	go func() { done <- streamer.run(pr, sigCh) }()
+
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(pw, "foo.bar %d 1397031808\n", i)
+	}
+	// the blank line is read after the last value is received by the streamer
+	fmt.Fprintln(pw)
+	sigCh <- os.Interrupt
+
+	if err := <-done; err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("values should not be posted by the batch size after a failure but got %d attempts", attempts)
+	}
+	if len(posted) != 3 || posted[0].Value != 2.0 {
+		t.Errorf("the oldest values over the buffer size should be dropped but got %v", posted)
+	}
+}
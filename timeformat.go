@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeFormat is the format of times in the output, which is specified by the global --time-format flag.
+// The zero value keeps the default layout of each output.
+type timeFormat struct {
+	layout string
+	local  bool
+	epoch  bool
+}
+
+// named presets of --time-format. Other values are regarded as Go reference layouts.
+var timeFormatPresets = map[string]timeFormat{
+	"rfc3339": {layout: time.RFC3339},
+	"local":   {layout: "2006-01-02 15:04:05 MST", local: true},
+	"epoch":   {epoch: true},
+}
+
+// outputTimeFormat is set in app.Before
+var outputTimeFormat timeFormat
+
+func parseTimeFormat(s string) (timeFormat, error) {
+	if s == "" {
+		return timeFormat{}, nil
+	}
+	if f, ok := timeFormatPresets[strings.ToLower(s)]; ok {
+		return f, nil
+	}
+	// a layout without any element of the reference time would output the same string for every time
+	if time.Unix(0, 0).Format(s) == s {
+		return timeFormat{}, fmt.Errorf("invalid time format %q: it should be rfc3339, local, epoch or a layout such as '2006-01-02 15:04'", s)
+	}
+	return timeFormat{layout: s}, nil
+}
+
+// human formats t for human readable output, in defaultLayout if --time-format is not specified.
+// Times are formatted by --time-format in UTC unless it's local, regardless of the location of t.
+func (f timeFormat) human(t time.Time, defaultLayout string) string {
+	if f.epoch {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	if f.layout == "" {
+		return t.Format(defaultLayout)
+	}
+	if f.local {
+		t = t.Local()
+	} else {
+		t = t.UTC()
+	}
+	return t.Format(f.layout)
+}
+
+// machine formats t for machine readable output such as json, which only epoch changes.
+func (f timeFormat) machine(t time.Time, defaultLayout string) string {
+	if f.epoch {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	return t.Format(defaultLayout)
+}
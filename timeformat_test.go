@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestParseTimeFormat(t *testing.T) {
+	for _, s := range []string{"", "rfc3339", "LOCAL", "epoch", "2006-01-02 15:04"} {
+		if _, err := parseTimeFormat(s); err != nil {
+			t.Errorf("parseTimeFormat(%q) should not raise error: %v", s, err)
+		}
+	}
+	if _, err := parseTimeFormat("unknown"); err == nil {
+		t.Errorf("parseTimeFormat should raise error for a layout without any element of the reference time")
+	}
+}
+
+func TestTimeFormat_hostCreatedAt(t *testing.T) {
+	defer func(f timeFormat) { outputTimeFormat = f }(outputTimeFormat)
+
+	host := &mkr.Host{ID: "3XYyG", Name: "app01.example.com", Status: "working", CreatedAt: 1483196400}
+	createdAt := time.Unix(1483196400, 0)
+
+	testCases := []struct {
+		format   string
+		wantText string
+		wantJSON string
+	}{
+		{"", host.DateStringFromCreatedAt(), host.DateStringFromCreatedAt()},
+		{"rfc3339", createdAt.UTC().Format(time.RFC3339), host.DateStringFromCreatedAt()},
+		{"local", createdAt.Local().Format("2006-01-02 15:04:05 MST"), host.DateStringFromCreatedAt()},
+		{"epoch", "1483196400", "1483196400"},
+		{"2006/01/02 15:04 MST", createdAt.UTC().Format("2006/01/02 15:04 MST"), host.DateStringFromCreatedAt()},
+	}
+
+	for _, testCase := range testCases {
+		f, err := parseTimeFormat(testCase.format)
+		if err != nil {
+			t.Fatalf("parseTimeFormat(%q) should not raise error: %v", testCase.format, err)
+		}
+		outputTimeFormat = f
+
+		_, rows := hostsTableRows([]*mkr.Host{host}, nil)
+		if got := rows[0][4]; got != testCase.wantText {
+			t.Errorf("createdAt in the table with %q should be %q but got %q", testCase.format, testCase.wantText, got)
+		}
+		if got := newHostFormat(host).CreatedAt; got != testCase.wantJSON {
+			t.Errorf("createdAt in json with %q should be %q but got %q", testCase.format, testCase.wantJSON, got)
+		}
+	}
+}
+
+func TestTimeFormat_zone(t *testing.T) {
+	tz := time.FixedZone("JST", 9*60*60)
+	at := time.Date(2017, 1, 1, 0, 0, 0, 0, tz)
+	for _, f := range []string{"rfc3339", "2006-01-02 15:04 MST"} {
+		format, _ := parseTimeFormat(f)
+		if got, want := format.human(at, time.RFC3339), at.UTC().Format(format.layout); got != want {
+			t.Errorf("times should be formatted by %q in UTC as %q but got %q", f, want, got)
+		}
+	}
+	local, _ := parseTimeFormat("local")
+	if got, want := local.human(at, time.RFC3339), at.Local().Format(local.layout); got != want {
+		t.Errorf("times should be formatted in the local zone as %q but got %q", want, got)
+	}
+}
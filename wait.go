@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	mkr "github.com/mackerelio/mackerel-client-go"
+	"github.com/mackerelio/mkr/logger"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandWait = cli.Command{
+	Name:      "wait",
+	Usage:     "Wait until a host reaches a status or an alert is closed",
+	ArgsUsage: "(--host | -H <hostId> --status | -st <status> | --alert <alertId> --closed) [--timeout <duration>] [--interval <duration>]",
+	Description: `
+    Poll the status of the host until it becomes <status>, or poll open alerts until the alert is closed.
+    Exits with nonzero status if the condition isn't satisfied within the timeout.
+    Requests "GET /api/v0/hosts/<hostId>" or "GET /api/v0/alerts". See https://mackerel.io/api-docs/entry/hosts#get, https://mackerel.io/api-docs/entry/alerts#get .
+`,
+	Action: doWait,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "host, H", Value: "", Usage: "Wait for the host of <hostId>."},
+		cli.StringFlag{Name: "status, st", Value: "", Usage: "The status which the host should reach."},
+		cli.StringFlag{Name: "alert", Value: "", Usage: "Wait for the alert of <alertId>."},
+		cli.BoolFlag{Name: "closed", Usage: "Wait until the alert is closed."},
+		cli.DurationFlag{Name: "timeout", Value: 5 * time.Minute, Usage: "Give up waiting after <duration>."},
+		cli.DurationFlag{Name: "interval", Value: 10 * time.Second, Usage: "The polling interval."},
+	},
+}
+
+func doWait(c *cli.Context) error {
+	hostID := c.String("host")
+	status := c.String("status")
+	alertID := c.String("alert")
+
+	var description string
+	var check func() (bool, error)
+	switch {
+	case hostID != "" && status != "" && alertID == "":
+		description = fmt.Sprintf("host %s to be %s", hostID, status)
+		check = hostStatusChecker(newMackerelFromContext(c), hostID, status)
+	case alertID != "" && c.Bool("closed") && hostID == "":
+		description = fmt.Sprintf("alert %s to be closed", alertID)
+		check = alertClosedChecker(newMackerelFromContext(c), alertID)
+	default:
+		cli.ShowCommandHelp(c, "wait")
+		return cli.NewExitError("specify --host with --status, or --alert with --closed", 1)
+	}
+
+	logger.Log("", fmt.Sprintf("waiting for %s", description))
+	if err := pollUntil(check, c.Duration("interval"), c.Duration("timeout")); err != nil {
+		return cli.NewExitError(fmt.Sprintf("failed to wait for %s: %s", description, err), 1)
+	}
+	logger.Log("", fmt.Sprintf("%s is satisfied", description))
+	return nil
+}
+
+func hostStatusChecker(client *mkr.Client, hostID, status string) func() (bool, error) {
+	return func() (bool, error) {
+		host, err := client.FindHost(hostID)
+		if err != nil {
+			return false, err
+		}
+		logger.Debug(fmt.Sprintf("host %s is %s", hostID, host.Status))
+		return host.Status == status, nil
+	}
+}
+
+// alertClosedChecker regards the alert as closed when it disappears from open alerts
+func alertClosedChecker(client *mkr.Client, alertID string) func() (bool, error) {
+	return func() (bool, error) {
+		alerts, err := client.FindAlerts()
+		if err != nil {
+			return false, err
+		}
+		for _, alert := range alerts {
+			if alert.ID == alertID {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+}
+
+// pollUntil calls check every interval until it returns true, and raises an error on timeout.
+// An error from check stops polling immediately.
+func pollUntil(check func() (bool, error), interval, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := check()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if !time.Now().Add(interval).Before(deadline) {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		time.Sleep(interval)
+	}
+}
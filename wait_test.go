@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPollUntil_hostStatus(t *testing.T) {
+	polls := 0
+	client, ts := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		polls++
+		status := "standby"
+		if polls >= 3 {
+			status = "working"
+		}
+		fmt.Fprintf(w, `{"host":{"id":"3XYyG","name":"app01","status":"%s","meta":{}}}`, status)
+	})
+	defer ts.Close()
+
+	err := pollUntil(hostStatusChecker(client, "3XYyG", "working"), time.Millisecond, time.Second)
+	if err != nil {
+		t.Errorf("should not raise error: %v", err)
+	}
+	if polls != 3 {
+		t.Errorf("the host should be polled 3 times but got %d", polls)
+	}
+}
+
+func TestPollUntil_timeout(t *testing.T) {
+	calls := 0
+	err := pollUntil(func() (bool, error) {
+		calls++
+		return false, nil
+	}, 10*time.Millisecond, 35*time.Millisecond)
+	if err == nil {
+		t.Errorf("should raise error on timeout")
+	}
+	if calls < 2 || calls > 4 {
+		t.Errorf("check should be called a few times before timeout but got %d", calls)
+	}
+}